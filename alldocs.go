@@ -0,0 +1,95 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// AllDocsResponse is the response returned by _all_docs and its
+// _design_docs and _local_docs siblings.
+type AllDocsResponse struct {
+	TotalRows uint64       `json:"total_rows"`
+	Offset    uint64       `json:"offset"`
+	Rows      []AllDocsRow `json:"rows"`
+	Warning   string       `json:"warning,omitempty"`
+}
+
+// AllDocsRow is a single row of an AllDocsResponse. Doc is only
+// populated when the query was made with "include_docs": true.
+type AllDocsRow struct {
+	Id    string          `json:"id"`
+	Key   string          `json:"key"`
+	Value AllDocsValue    `json:"value"`
+	Doc   json.RawMessage `json:"doc,omitempty"`
+	Error string          `json:"error,omitempty"`
+}
+
+type AllDocsValue struct {
+	Rev     string `json:"rev"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// Ids returns the document ids of every row in the response.
+func (r AllDocsResponse) Ids() []string {
+	ids := make([]string, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		if row.Id != "" {
+			ids = append(ids, row.Id)
+		}
+	}
+	return ids
+}
+
+// AllDocs lists the documents in the database via _all_docs.
+// options are the same as for Query, eg. { "include_docs": true }
+func (p Database) AllDocs(options map[string]interface{}) (AllDocsResponse, error) {
+	return p.listDocs("_all_docs", options)
+}
+
+// DesignDocs lists only the design documents in the database,
+// via _design_docs.
+func (p Database) DesignDocs(options map[string]interface{}) (AllDocsResponse, error) {
+	return p.listDocs("_design_docs", options)
+}
+
+// LocalDocs lists the (non-replicating) local documents in the
+// database, via _local_docs.
+func (p Database) LocalDocs(options map[string]interface{}) (AllDocsResponse, error) {
+	return p.listDocs("_local_docs", options)
+}
+
+// prefixEnd is appended to a prefix to form the end of its key range; it
+// collates after any character likely to follow the prefix in an id.
+const prefixEnd = "\ufff0"
+
+// AllDocsByPrefix lists the documents whose ids start with prefix, eg.
+// "user:123:" for the documents of one user in a database of structured
+// ids. options are as for AllDocs; startkey and endkey are set from the
+// prefix (swapped if "descending" is true), replacing any given.
+func (p Database) AllDocsByPrefix(prefix string, options map[string]interface{}) (AllDocsResponse, error) {
+	if prefix == "" {
+		return AllDocsResponse{}, fmt.Errorf("empty prefix")
+	}
+	start, end := prefix, prefix+prefixEnd
+	if descending, _ := options["descending"].(bool); descending {
+		start, end = end, start
+	}
+	withRange := map[string]interface{}{}
+	for k, v := range options {
+		withRange[k] = v
+	}
+	for _, k := range []string{"start_key", "end_key", "key", "keys"} {
+		delete(withRange, k)
+	}
+	withRange["startkey"], withRange["endkey"] = start, end
+	return p.AllDocs(withRange)
+}
+
+func (p Database) listDocs(endpoint string, options map[string]interface{}) (AllDocsResponse, error) {
+	r := AllDocsResponse{}
+	if err := p.Query(endpoint, options, &r); err != nil {
+		return AllDocsResponse{}, err
+	}
+	return r, nil
+}
@@ -0,0 +1,86 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestDesignDocs(t *testing.T) {
+	db, err := NewDatabase(TEST_HOST, TEST_PORT, TEST_NAME)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	id, rev, err := db.Insert(DBRecord{"design_docs_plain", "", 1, nil})
+	if err != nil {
+		t.Fatalf("failed to insert record: %s", err)
+	}
+	design := map[string]interface{}{"_id": "_design/listing"}
+	designId, designRev, err := db.Insert(design)
+	if err != nil {
+		t.Fatalf("failed to insert design: %s", err)
+	}
+	r, err := db.DesignDocs(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("failed to list design docs: %s", err)
+	}
+	ids := r.Ids()
+	if len(ids) != 1 || ids[0] != "_design/listing" {
+		t.Fatalf("design docs: expected [_design/listing], got %v", ids)
+	}
+	if err := db.Delete(id, rev); err != nil {
+		t.Fatalf("failed to delete record: %s", err)
+	}
+	if err := db.Delete(designId, designRev); err != nil {
+		t.Fatalf("failed to delete design record: %s", err)
+	}
+}
+
+func TestLocalDocs(t *testing.T) {
+	db, err := NewDatabase(TEST_HOST, TEST_PORT, TEST_NAME)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	if _, _, err := db.InsertWith(Record{1, nil}, "_local/listing"); err != nil {
+		t.Fatalf("failed to insert local doc: %s", err)
+	}
+	r, err := db.LocalDocs(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("failed to list local docs: %s", err)
+	}
+	found := false
+	for _, id := range r.Ids() {
+		if id == "_local/listing" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("local docs: expected _local/listing in %v", r.Ids())
+	}
+}
+
+func TestAllDocsByPrefix(t *testing.T) {
+	query := url.Values{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		fmt.Fprint(w, `{"total_rows":1,"offset":0,"rows":[{"id":"user:\"1\":a","key":"user:\"1\":a","value":{"rev":"1-a"}}]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	r, err := db.AllDocsByPrefix(`user:"1":`, map[string]interface{}{"descending": true, "startkey": "ignored"})
+	if err != nil {
+		t.Fatalf("failed to list by prefix: %s", err)
+	}
+	if len(r.Rows) != 1 {
+		t.Fatalf("rows: got %+v", r.Rows)
+	}
+	if start := query.Get("startkey"); start != `"user:\"1\":`+"￰"+`"` {
+		t.Fatalf("startkey: got %s", start)
+	}
+	if end := query.Get("endkey"); end != `"user:\"1\":"` {
+		t.Fatalf("endkey: got %s", end)
+	}
+}
@@ -0,0 +1,207 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// AttachmentStub describes an attachment of a document, as listed in its
+// _attachments member when the data itself isn't asked for.
+type AttachmentStub struct {
+	ContentType string `json:"content_type"`
+	Length      int64  `json:"length"`
+	Digest      string `json:"digest"` // eg. "md5-..."
+	RevPos      int    `json:"revpos"` // the revision generation which added it
+	Encoding    string `json:"encoding,omitempty"`
+	Stub        bool   `json:"stub,omitempty"`
+}
+
+// Attachments returns the stubs of the document's attachments, keyed by
+// name, without downloading their data. A document with no attachments
+// has an empty map.
+func (p Database) Attachments(id string) (map[string]AttachmentStub, error) {
+	_, stubs, err := p.attachmentStubs(id)
+	return stubs, err
+}
+
+// attachmentStubs returns the document's revision and attachment stubs.
+func (p Database) attachmentStubs(id string) (string, map[string]AttachmentStub, error) {
+	if id == "" {
+		return "", nil, fmt.Errorf("no id specified")
+	}
+	p.noteAccess(id, false)
+	doc := struct {
+		Rev         string                    `json:"_rev"`
+		Attachments map[string]AttachmentStub `json:"_attachments"`
+	}{}
+	if err := p.unmarshalURL(fmt.Sprintf("%s/%s", p.DBURL(), id), &doc); err != nil {
+		return "", nil, fmt.Errorf("couldn't get attachments of %s: %w", id, err)
+	}
+	if doc.Attachments == nil {
+		doc.Attachments = map[string]AttachmentStub{}
+	}
+	return doc.Rev, doc.Attachments, nil
+}
+
+// ErrDigestMismatch is returned when an attachment's data doesn't match
+// its MD5 digest, ie. it was corrupted on the way.
+var ErrDigestMismatch = errors.New("attachment digest mismatch")
+
+// Attachment is a downloaded attachment. Body verifies the data against
+// Digest as it's read: the Read which reaches the end returns
+// ErrDigestMismatch instead of io.EOF if they differ. The caller must
+// Close Body.
+type Attachment struct {
+	ContentType string
+	Length      int64  // -1 if unknown
+	Digest      string // eg. "md5-...", or "" if the server sent none
+	Body        io.ReadCloser
+}
+
+// attachmentURL returns the URL of the document's attachment name.
+func (p Database) attachmentURL(id, name string) string {
+	return fmt.Sprintf("%s/%s/%s", p.DBURL(), id, url.PathEscape(name))
+}
+
+// GetAttachment downloads the document's attachment name.
+func (p Database) GetAttachment(id, name string) (*Attachment, error) {
+	return p.GetAttachmentContext(context.Background(), id, name)
+}
+
+// GetAttachmentContext is GetAttachment, but gives up when ctx is done.
+func (p Database) GetAttachmentContext(ctx context.Context, id, name string) (*Attachment, error) {
+	if id == "" || name == "" {
+		return nil, fmt.Errorf("no id or attachment name specified")
+	}
+	p.noteAccess(id, false)
+	r, err := p.client().request(ctx, "GET", p.attachmentURL(id, name), map[string][]string{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get attachment %s of %s: %w", name, id, err)
+	}
+	a := &Attachment{ContentType: r.Header.Get("Content-Type"), Length: r.ContentLength, Body: r.Body}
+	// CouchDB sends the digest as Content-MD5 and, quoted, as the ETag
+	sum := r.Header.Get("Content-MD5")
+	if sum == "" {
+		sum = strings.Trim(r.Header.Get("ETag"), `"`)
+	}
+	if want, err := base64.StdEncoding.DecodeString(sum); err == nil && len(want) == md5.Size {
+		a.Digest = "md5-" + sum
+		a.Body = &digestReader{r.Body, md5.New(), want}
+	}
+	return a, nil
+}
+
+// digestReader checks the data read from rc against the digest want.
+type digestReader struct {
+	rc   io.ReadCloser
+	h    hash.Hash
+	want []byte
+}
+
+func (d *digestReader) Read(b []byte) (int, error) {
+	n, err := d.rc.Read(b)
+	d.h.Write(b[:n])
+	if err == io.EOF && !bytes.Equal(d.h.Sum(nil), d.want) {
+		return n, ErrDigestMismatch
+	}
+	return n, err
+}
+
+func (d *digestReader) Close() error {
+	return d.rc.Close()
+}
+
+// AttachmentOptions control PutAttachment.
+type AttachmentOptions struct {
+	// ContentType overrides the type guessed from the name's extension
+	// or, failing that, the first bytes of the data.
+	ContentType string
+
+	// ContentMD5 sends the data's digest, so CouchDB rejects the upload if
+	// it's corrupted on the way. The data is read into memory to compute
+	// it.
+	ContentMD5 bool
+}
+
+// PutAttachment uploads data as the document's attachment name, replacing
+// any attachment of that name, and returns the document's new revision.
+// rev is the document's current revision, or "" to create the document.
+func (p Database) PutAttachment(id, rev, name string, data io.Reader, opts AttachmentOptions) (string, error) {
+	return p.PutAttachmentContext(context.Background(), id, rev, name, data, opts)
+}
+
+// PutAttachmentContext is PutAttachment, but gives up when ctx is done.
+func (p Database) PutAttachmentContext(ctx context.Context, id, rev, name string, data io.Reader, opts AttachmentOptions) (string, error) {
+	if id == "" || name == "" {
+		return "", fmt.Errorf("no id or attachment name specified")
+	}
+	p.noteAccess(id, true)
+	u := p.attachmentURL(id, name)
+	if rev != "" {
+		u += "?rev=" + url.QueryEscape(rev)
+	}
+	header := http.Header{}
+	if opts.ContentMD5 {
+		b, err := ioutil.ReadAll(data)
+		if err != nil {
+			return "", err
+		}
+		sum := md5.Sum(b)
+		header.Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		data = bytes.NewReader(b)
+	}
+	contentType := opts.ContentType
+	if contentType == "" {
+		var err error
+		if contentType, data, err = detectContentType(name, data); err != nil {
+			return "", err
+		}
+	}
+	header.Set("Content-Type", contentType)
+	req, err := http.NewRequestWithContext(ctx, "PUT", u, data)
+	if err != nil {
+		return "", redactError(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r, err := p.client().do(req)
+	if err != nil {
+		return "", fmt.Errorf("couldn't put attachment %s of %s: %w", name, id, err)
+	}
+	defer r.Body.Close()
+	result := WriteResult{}
+	if err := decodeJSON(r.Body, &result); err != nil {
+		return "", err
+	}
+	return result.Rev, nil
+}
+
+// detectContentType guesses the type of the attachment name from its
+// extension, or else by sniffing the start of data, and returns data to
+// be read in its place.
+func detectContentType(name string, data io.Reader) (string, io.Reader, error) {
+	if t := mime.TypeByExtension(path.Ext(name)); t != "" {
+		return t, data, nil
+	}
+	br := bufio.NewReaderSize(data, 512)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return "", nil, err
+	}
+	return http.DetectContentType(head), br, nil
+}
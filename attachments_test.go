@@ -0,0 +1,151 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAttachments(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/a":
+			if r.URL.RawQuery != "" {
+				t.Errorf("query: expected none, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"_id":"a","_rev":"2-a","_attachments":{"photo.jpg":{"content_type":"image/jpeg","revpos":2,"digest":"md5-2JdGiI2i2VELZKnwMers1Q==","length":1024,"stub":true}}}`)
+		case "/db/b":
+			fmt.Fprint(w, `{"_id":"b","_rev":"1-b"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	stubs, err := db.Attachments("a")
+	if err != nil {
+		t.Fatalf("failed to list attachments: %s", err)
+	}
+	expected := map[string]AttachmentStub{"photo.jpg": {
+		ContentType: "image/jpeg",
+		Length:      1024,
+		Digest:      "md5-2JdGiI2i2VELZKnwMers1Q==",
+		RevPos:      2,
+		Stub:        true,
+	}}
+	if !reflect.DeepEqual(stubs, expected) {
+		t.Fatalf("stubs: expected %+v, got %+v", expected, stubs)
+	}
+	if stubs, err := db.Attachments("b"); err != nil || len(stubs) != 0 || stubs == nil {
+		t.Fatalf("no attachments: got %v, %v", stubs, err)
+	}
+	if _, err := db.Attachments("c"); !isNotFound(err) {
+		t.Fatalf("missing: expected not found, got %v", err)
+	}
+}
+
+func TestGetAttachment(t *testing.T) {
+	data := "hello, world"
+	sum := md5.Sum([]byte(data))
+	digest := base64.StdEncoding.EncodeToString(sum[:])
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		switch r.URL.Path {
+		case "/db/a/hello.txt":
+			w.Header().Set("Content-MD5", digest)
+			fmt.Fprint(w, data)
+		case "/db/a/etag.txt":
+			w.Header().Set("ETag", `"`+digest+`"`)
+			fmt.Fprint(w, data)
+		case "/db/a/corrupt.txt":
+			w.Header().Set("Content-MD5", digest)
+			fmt.Fprint(w, "hello, wurld")
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	for _, name := range []string{"hello.txt", "etag.txt"} {
+		a, err := db.GetAttachment("a", name)
+		if err != nil {
+			t.Fatalf("%s: failed to get: %s", name, err)
+		}
+		b, err := ioutil.ReadAll(a.Body)
+		a.Body.Close()
+		if err != nil || string(b) != data {
+			t.Fatalf("%s: expected %q, got %q, %v", name, data, b, err)
+		}
+		if a.ContentType != "text/plain" || a.Digest != "md5-"+digest {
+			t.Fatalf("%s: got %+v", name, a)
+		}
+	}
+	a, err := db.GetAttachment("a", "corrupt.txt")
+	if err != nil {
+		t.Fatalf("failed to get: %s", err)
+	}
+	defer a.Body.Close()
+	if _, err := ioutil.ReadAll(a.Body); err != ErrDigestMismatch {
+		t.Fatalf("corrupt: expected ErrDigestMismatch, got %v", err)
+	}
+}
+
+func TestPutAttachment(t *testing.T) {
+	var req *http.Request
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = ioutil.ReadAll(r.Body)
+		fmt.Fprint(w, `{"ok":true,"id":"a","rev":"3-a"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	rev, err := db.PutAttachment("a", "2-a", "notes/today.txt", strings.NewReader("hello"), AttachmentOptions{ContentType: "text/plain", ContentMD5: true})
+	if err != nil || rev != "3-a" {
+		t.Fatalf("put: expected 3-a, got %q, %v", rev, err)
+	}
+	if req.Method != "PUT" || req.URL.EscapedPath() != "/db/a/notes%2Ftoday.txt" || req.URL.Query().Get("rev") != "2-a" {
+		t.Fatalf("request: got %s %s", req.Method, req.URL)
+	}
+	sum := md5.Sum([]byte("hello"))
+	if string(body) != "hello" || req.Header.Get("Content-Type") != "text/plain" || req.Header.Get("Content-MD5") != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Fatalf("upload: got %q with %v", body, req.Header)
+	}
+}
+
+func TestPutAttachmentContentType(t *testing.T) {
+	var contentType string
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		body, _ = ioutil.ReadAll(r.Body)
+		fmt.Fprint(w, `{"ok":true,"id":"a","rev":"2-a"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 600)
+	for _, test := range []struct {
+		name, data, override, expected string
+	}{
+		{"style.css", "body {}", "", "text/css; charset=utf-8"},
+		{"logo", png, "", "image/png"},
+		{"notes", "plain words", "", "text/plain; charset=utf-8"},
+		{"logo.png", png, "application/x-custom", "application/x-custom"},
+	} {
+		if _, err := db.PutAttachment("a", "1-a", test.name, strings.NewReader(test.data), AttachmentOptions{ContentType: test.override}); err != nil {
+			t.Fatalf("%s: failed to put: %s", test.name, err)
+		}
+		if contentType != test.expected {
+			t.Fatalf("%s: expected %s, got %s", test.name, test.expected, contentType)
+		}
+		if string(body) != test.data {
+			t.Fatalf("%s: data changed in upload", test.name)
+		}
+	}
+}
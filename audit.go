@@ -0,0 +1,133 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// AuditOptions configure the audit trail enabled by WithAudit.
+type AuditOptions struct {
+	DB    Database         // where audit documents are written
+	Actor string           // recorded as "who"; defaults to the user name of the audited Database
+	Clock func() time.Time // defaults to time.Now
+}
+
+// WithAudit makes every Edit and Delete through the Client also write a
+// compact audit document to opts.DB, recording who changed which document
+// when, and which fields changed. The audit database keeps that
+// history even after the audited database is compacted.
+func WithAudit(opts AuditOptions) Option {
+	return func(c *Client) {
+		if opts.Clock == nil {
+			opts.Clock = time.Now
+		}
+		c.audit = &opts
+	}
+}
+
+// AuditRecord is the document written to the audit database.
+type AuditRecord struct {
+	Type    string       `json:"type"` // always "audit"
+	DB      string       `json:"db"`
+	DocId   string       `json:"doc_id"`
+	Op      string       `json:"op"` // "edit" or "delete"
+	PrevRev string       `json:"prev_rev"`
+	Rev     string       `json:"rev,omitempty"`
+	Who     string       `json:"who"`
+	When    time.Time    `json:"when"`
+	Changes AuditChanges `json:"changes"`
+}
+
+// AuditChanges summarizes a change as the JSON Pointer paths (see Diff)
+// of the fields which were added, removed and changed.
+type AuditChanges struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+// AuditError is returned when a write succeeded but its audit record
+// couldn't be written.
+type AuditError struct {
+	DocId string
+	Err   error
+}
+
+func (e *AuditError) Error() string {
+	return fmt.Sprintf("audit of %s failed: %s", e.DocId, e.Err)
+}
+
+func (e *AuditError) Unwrap() error {
+	return e.Err
+}
+
+// auditing reports whether writes to p should be audited.
+func (p Database) auditing() bool {
+	return p.client().audit != nil
+}
+
+// currentDoc returns the raw JSON of the current revision of document id.
+func (p Database) currentDoc(id string) ([]byte, error) {
+	r, err := p.getURL(fmt.Sprintf("%s/%s", p.DBURL(), id))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(p.client().limitBody(r))
+}
+
+// audit writes an audit record for a change from before to after, either
+// of which may be nil.
+func (p Database) audit(op, id, prevRev, rev string, before, after []byte) error {
+	a := p.client().audit
+	changes, err := summarizeChanges(before, after)
+	if err != nil {
+		return &AuditError{id, err}
+	}
+	who := a.Actor
+	if who == "" && p.Auth != nil {
+		who = p.Auth.Username()
+	}
+	rec := AuditRecord{
+		Type:    "audit",
+		DB:      p.Name,
+		DocId:   id,
+		Op:      op,
+		PrevRev: prevRev,
+		Rev:     rev,
+		Who:     who,
+		When:    a.Clock().UTC(),
+		Changes: changes,
+	}
+	results, err := a.DB.BulkDocs([]interface{}{rec})
+	if err == nil && len(results) == 1 && results[0].Error != "" {
+		err = fmt.Errorf("%s: %s", results[0].Error, results[0].Reason)
+	}
+	if err != nil {
+		return &AuditError{id, err}
+	}
+	return nil
+}
+
+// summarizeChanges lists the paths of the fields that differ between two
+// JSON documents, ignoring _rev.
+func summarizeChanges(before, after []byte) (AuditChanges, error) {
+	diff, err := Diff(before, after)
+	if err != nil {
+		return AuditChanges{}, err
+	}
+	c := AuditChanges{}
+	for _, fc := range diff.Without("/_rev") {
+		switch fc.Kind {
+		case Added:
+			c.Added = append(c.Added, fc.Path)
+		case Removed:
+			c.Removed = append(c.Removed, fc.Path)
+		default:
+			c.Changed = append(c.Changed, fc.Path)
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,69 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSummarizeChanges(t *testing.T) {
+	before := []byte(`{"_id":"x","_rev":"1-a","keep":1,"change":"a","drop":true}`)
+	after := []byte(`{"_id":"x","_rev":"1-a","keep":1,"change":"b","add":[1]}`)
+	c, err := summarizeChanges(before, after)
+	if err != nil {
+		t.Fatalf("failed to summarize: %s", err)
+	}
+	expected := AuditChanges{Added: []string{"/add"}, Removed: []string{"/drop"}, Changed: []string{"/change"}}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("changes: expected %+v, got %+v", expected, c)
+	}
+}
+
+func TestAuditEdit(t *testing.T) {
+	records := []AuditRecord{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/db/doc":
+			fmt.Fprint(w, `{"_id":"doc","_rev":"1-a","Foo":1,"Bars":null}`)
+		case r.Method == "PUT" && r.URL.Path == "/db/doc":
+			fmt.Fprint(w, `{"ok":true,"id":"doc","rev":"2-b"}`)
+		case r.Method == "POST" && r.URL.Path == "/audit/_bulk_docs":
+			in := struct{ Docs []AuditRecord }{}
+			json.NewDecoder(r.Body).Decode(&in)
+			records = append(records, in.Docs...)
+			fmt.Fprint(w, `[{"ok":true,"id":"a1","rev":"1-c"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	auditDB := newTestDatabase(ts)
+	auditDB.Name = "audit"
+	when := time.Date(2012, 6, 1, 0, 0, 0, 0, time.UTC)
+	db := newTestDatabase(ts)
+	db.Auth = url.UserPassword("alice", "secret")
+	db.Client = NewClient(WithAudit(AuditOptions{DB: auditDB, Clock: func() time.Time { return when }}))
+	rev, err := db.Edit(DBRecord{Id: "doc", Rev: "1-a", Foo: 2})
+	if err != nil {
+		t.Fatalf("failed to edit: %s", err)
+	}
+	if rev != "2-b" {
+		t.Fatalf("rev: expected 2-b, got %s", rev)
+	}
+	if len(records) != 1 {
+		t.Fatalf("expected 1 audit record, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.Who != "alice" || rec.Op != "edit" || rec.PrevRev != "1-a" || rec.Rev != "2-b" || !rec.When.Equal(when) {
+		t.Fatalf("audit record: got %+v", rec)
+	}
+	if !reflect.DeepEqual(rec.Changes.Changed, []string{"/Foo"}) {
+		t.Fatalf("changed: expected [/Foo], got %v", rec.Changes.Changed)
+	}
+}
@@ -0,0 +1,212 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Token is a credential obtained from an authentication endpoint, such
+// as a _session cookie, valid until Expires.
+type Token struct {
+	Value   string    `json:"value"`
+	Expires time.Time `json:"expires"`
+}
+
+// valid reports whether t can still be used at now, leaving a margin
+// for the request to reach the server.
+func (t Token) valid(now time.Time) bool {
+	return t.Value != "" && now.Add(10*time.Second).Before(t.Expires)
+}
+
+// TokenStore persists tokens between processes, so that a fleet of
+// short-lived workers can share one session instead of each logging in
+// on startup. Keys identify the user and endpoint a token is for. Load
+// returns false if there's no token under key. Implementations backed by
+// Redis or similar must be safe for concurrent use.
+type TokenStore interface {
+	Load(key string) (Token, bool, error)
+	Save(key string, t Token) error
+}
+
+// MemoryTokenStore keeps tokens in memory, shared within the process.
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+}
+
+func (m *MemoryTokenStore) Load(key string) (Token, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.tokens[key]
+	return t, ok, nil
+}
+
+func (m *MemoryTokenStore) Save(key string, t Token) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.tokens == nil {
+		m.tokens = map[string]Token{}
+	}
+	m.tokens[key] = t
+	return nil
+}
+
+// FileTokenStore keeps each token in its own file in Dir, named by a hash
+// of its key and readable only by the owner. Files are replaced
+// atomically, so processes on the same host can share them.
+type FileTokenStore struct {
+	Dir string
+}
+
+func (f FileTokenStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.Dir, "couch-token-"+hex.EncodeToString(sum[:8]))
+}
+
+func (f FileTokenStore) Load(key string) (Token, bool, error) {
+	b, err := ioutil.ReadFile(f.path(key))
+	if os.IsNotExist(err) {
+		return Token{}, false, nil
+	} else if err != nil {
+		return Token{}, false, err
+	}
+	t := Token{}
+	if err := json.Unmarshal(b, &t); err != nil {
+		return Token{}, false, err
+	}
+	return t, true, nil
+}
+
+func (f FileTokenStore) Save(key string, t Token) error {
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	path := f.path(key)
+	tmp, err := ioutil.TempFile(f.Dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CookieAuth configures cookie authentication, enabled by WithCookieAuth.
+type CookieAuth struct {
+	Name     string
+	Password string
+
+	// SessionURL is where to log in; it defaults to /_session on the host
+	// of each request, and must be set if CouchDB is under a BasePath.
+	SessionURL string
+	// Store shares session cookies; nil keeps them in the Client.
+	Store TokenStore
+	// Clock defaults to time.Now.
+	Clock func() time.Time
+}
+
+// WithCookieAuth makes the Client log in to _session and authenticate
+// requests with the resulting AuthSession cookie, instead of sending the
+// password with every request. Requests whose URL has credentials of its
+// own still use basic auth. The cookie is renewed when it expires or is
+// refused with 401.
+func WithCookieAuth(a CookieAuth) Option {
+	return func(c *Client) {
+		if a.Clock == nil {
+			a.Clock = time.Now
+		}
+		if a.Store == nil {
+			a.Store = &MemoryTokenStore{}
+		}
+		c.cookieAuth = &cookieAuth{CookieAuth: a}
+	}
+}
+
+// defaultSessionTimeout is how long CouchDB's session cookies last when
+// the response doesn't say, from couch_httpd_auth's timeout.
+const defaultSessionTimeout = 10 * time.Minute
+
+type cookieAuth struct {
+	CookieAuth
+	mu sync.Mutex
+}
+
+func (a *cookieAuth) sessionURL(u *url.URL) string {
+	if a.SessionURL != "" {
+		return a.SessionURL
+	}
+	return fmt.Sprintf("%s://%s/_session", u.Scheme, u.Host)
+}
+
+// authorize adds the session cookie for req's server to req, logging in
+// first if there's no valid one, or if renew is set.
+func (a *cookieAuth) authorize(c *Client, req *http.Request, renew bool) error {
+	session := a.sessionURL(req.URL)
+	key := a.Name + "@" + session
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	t, ok, err := a.Store.Load(key)
+	if err != nil {
+		return err
+	}
+	if renew || !ok || !t.valid(a.Clock()) {
+		if t, err = a.login(c, req, session); err != nil {
+			return err
+		}
+		if err := a.Store.Save(key, t); err != nil {
+			return err
+		}
+	}
+	req.Header.Del("Cookie")
+	req.AddCookie(&http.Cookie{Name: "AuthSession", Value: t.Value})
+	return nil
+}
+
+// login posts the credentials to session, returning the session cookie.
+func (a *cookieAuth) login(c *Client, orig *http.Request, session string) (Token, error) {
+	form := url.Values{"name": {a.Name}, "password": {a.Password}}
+	req, err := http.NewRequestWithContext(orig.Context(), "POST", session, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, redactError(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		return Token{}, redactError(err)
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return Token{}, newError(r)
+	}
+	for _, cookie := range r.Cookies() {
+		if cookie.Name != "AuthSession" {
+			continue
+		}
+		t := Token{Value: cookie.Value, Expires: a.Clock().Add(defaultSessionTimeout)}
+		if cookie.MaxAge > 0 {
+			t.Expires = a.Clock().Add(time.Duration(cookie.MaxAge) * time.Second)
+		} else if !cookie.Expires.IsZero() {
+			t.Expires = cookie.Expires
+		}
+		return t, nil
+	}
+	return Token{}, fmt.Errorf("no session cookie from %s", session)
+}
@@ -0,0 +1,92 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCookieAuth(t *testing.T) {
+	logins, session := 0, ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_session" {
+			r.ParseForm()
+			if r.Method != "POST" || r.Form.Get("name") != "admin" || r.Form.Get("password") != TEST_PASSWORD {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			logins++
+			session = fmt.Sprintf("token%d", logins)
+			http.SetCookie(w, &http.Cookie{Name: "AuthSession", Value: session, MaxAge: 600})
+			fmt.Fprint(w, `{"ok":true,"name":"admin","roles":["_admin"]}`)
+			return
+		}
+		if cookie, err := r.Cookie("AuthSession"); err != nil || cookie.Value != session {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"unauthorized","reason":"You are not authorized to access this db."}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"id":"doc","rev":"1-a"}`)
+	}))
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	store := &MemoryTokenStore{}
+	auth := CookieAuth{Name: "admin", Password: TEST_PASSWORD, Store: store}
+
+	// two clients sharing a store log in once between them
+	for i := 0; i < 2; i++ {
+		db := Database{Host: host, Port: port, Name: "db", Client: NewClient(WithCookieAuth(auth))}
+		if _, _, err := db.InsertWith(map[string]string{}, "doc"); err != nil {
+			t.Fatalf("client %d: failed to insert: %s", i, err)
+		}
+	}
+	if logins != 1 {
+		t.Fatalf("logins: expected 1, got %d", logins)
+	}
+
+	// a session ended by the server is renewed, and the write retried
+	session = "revoked"
+	db := Database{Host: host, Port: port, Name: "db", Client: NewClient(WithCookieAuth(auth))}
+	if _, _, err := db.InsertWith(map[string]string{}, "doc"); err != nil {
+		t.Fatalf("failed to insert after revocation: %s", err)
+	}
+	if logins != 2 {
+		t.Fatalf("logins: expected 2, got %d", logins)
+	}
+
+	// bad credentials fail without looping
+	auth.Password, auth.Store = "wrong", nil
+	db.Client = NewClient(WithCookieAuth(auth))
+	if _, _, err := db.InsertWith(map[string]string{}, "doc"); statusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("expected a 401, got %v", err)
+	}
+}
+
+func TestFileTokenStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "couch-tokens")
+	if err != nil {
+		t.Fatalf("failed to create dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store := FileTokenStore{Dir: dir}
+	if _, ok, err := store.Load("admin@http://localhost:5984/_session"); ok || err != nil {
+		t.Fatalf("empty store: got %v, %v", ok, err)
+	}
+	expires := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.Save("admin@http://localhost:5984/_session", Token{"abc", expires}); err != nil {
+		t.Fatalf("failed to save: %s", err)
+	}
+	tok, ok, err := store.Load("admin@http://localhost:5984/_session")
+	if err != nil || !ok || tok.Value != "abc" || !tok.Expires.Equal(expires) {
+		t.Fatalf("load: got %+v, %v, %v", tok, ok, err)
+	}
+	if _, ok, _ := store.Load("other@http://localhost:5984/_session"); ok {
+		t.Fatalf("expected no token for another key")
+	}
+}
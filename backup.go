@@ -0,0 +1,139 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// BackupOptions configure Backup.
+type BackupOptions struct {
+	Dir  string // where backups are kept
+	Keep int    // how many of the database's backups to keep; 0 means 7
+	Gzip bool   // compress the dump
+
+	Clock func() time.Time // names the backup; defaults to time.Now
+}
+
+// backupTime names backups so that they sort oldest first.
+const backupTime = "20060102T150405Z"
+
+// Backup dumps the database to a new file in Dir, named after the
+// database and the time, verifies it, and then removes the database's
+// oldest backups, keeping Keep of them. The file only appears once it's
+// complete and verified, so a failed backup never replaces a good one.
+// It returns the path of the new backup.
+func (p Database) Backup(opts BackupOptions) (string, error) {
+	if opts.Keep <= 0 {
+		opts.Keep = 7
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	prefix := url.PathEscape(p.Name) + "-"
+	name := prefix + opts.Clock().UTC().Format(backupTime) + ".ndjson"
+	if opts.Gzip {
+		name += ".gz"
+	}
+	path := filepath.Join(opts.Dir, name)
+	tmp, err := ioutil.TempFile(opts.Dir, name+".tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	n, err := p.dumpTo(tmp, opts.Gzip)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := verifyFile(tmp.Name(), n); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, rotateBackups(opts.Dir, prefix, opts.Keep)
+}
+
+// dumpTo dumps the database to f, buffered, and gzipped if compress is set.
+func (p Database) dumpTo(f *os.File, compress bool) (int, error) {
+	bw := bufio.NewWriter(f)
+	var w io.Writer = bw
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(bw)
+		w = zw
+	}
+	n, err := p.Dump(w)
+	if err != nil {
+		return n, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return n, err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return n, err
+	}
+	return n, f.Sync()
+}
+
+// verifyFile checks that the dump at path has the docs it should.
+func verifyFile(path string, docs int) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := Verify(f)
+	if err != nil {
+		return fmt.Errorf("verifying backup: %w", err)
+	}
+	if n != docs {
+		return fmt.Errorf("verifying backup: expected %d documents, found %d", docs, n)
+	}
+	return nil
+}
+
+// rotateBackups removes all but the newest keep backups in dir whose
+// names start with prefix.
+func rotateBackups(dir, prefix string, keep int) error {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	backups := []string{}
+	for _, e := range entries {
+		// check the whole name, or another database's backups, whose
+		// name starts with this one's, would match too
+		name := e.Name()
+		stamp, ext, _ := strings.Cut(strings.TrimPrefix(name, prefix), ".")
+		if !e.Mode().IsRegular() || !strings.HasPrefix(name, prefix) || (ext != "ndjson" && ext != "ndjson.gz") {
+			continue
+		}
+		if _, err := time.Parse(backupTime, stamp); err == nil {
+			backups = append(backups, name)
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > keep {
+		if err := os.Remove(filepath.Join(dir, backups[0])); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
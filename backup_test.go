@@ -0,0 +1,72 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackup(t *testing.T) {
+	broken := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if broken {
+			fmt.Fprint(w, `{"rows":[{"id":"a","doc":{"_id":"a"}},`)
+			return
+		}
+		fmt.Fprint(w, `{"rows":[{"id":"a","doc":{"_id":"a"}},{"id":"b","doc":{"_id":"b"}}]}`)
+	}))
+	defer ts.Close()
+	dir := t.TempDir()
+	// another database whose name starts with this one's
+	other := filepath.Join(dir, "db-2-20240101T000000Z.ndjson")
+	ioutil.WriteFile(other, nil, 0644)
+
+	db := newTestDatabase(ts)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	opts := BackupOptions{Dir: dir, Keep: 2, Gzip: true, Clock: func() time.Time { return now }}
+	for day := 0; day < 3; day++ {
+		path, err := db.Backup(opts)
+		if err != nil {
+			t.Fatalf("day %d: %s", day, err)
+		}
+		f, _ := os.Open(path)
+		n, err := Verify(f)
+		f.Close()
+		if n != 2 || err != nil {
+			t.Fatalf("day %d: expected 2 documents, got %d, %v", day, n, err)
+		}
+		now = now.Add(24 * time.Hour)
+	}
+	want := []string{"db-2-20240101T000000Z.ndjson", "db-20240102T000000Z.ndjson.gz", "db-20240103T000000Z.ndjson.gz"}
+	if got := backupNames(dir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("backups: expected %v, got %v", want, got)
+	}
+
+	// a failed dump leaves the existing backups alone
+	broken = true
+	if _, err := db.Backup(opts); err == nil {
+		t.Fatalf("expected the broken dump to fail")
+	}
+	if got := backupNames(dir); !reflect.DeepEqual(got, want) {
+		t.Fatalf("backups after failure: expected %v, got %v", want, got)
+	}
+}
+
+func backupNames(dir string) []string {
+	entries, _ := ioutil.ReadDir(dir)
+	names := []string{}
+	for _, e := range entries {
+		if !strings.Contains(e.Name(), ".tmp") {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
@@ -0,0 +1,238 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// BulkDocs writes many documents in a single request, via _bulk_docs.
+// Documents are inserted, edited or deleted according to their _id, _rev
+// and _deleted fields. Results are in the same order as docs; a failure
+// to write one document doesn't fail the others, so check each result.
+func (p Database) BulkDocs(docs []interface{}) ([]WriteResult, error) {
+	raw := make([]json.RawMessage, len(docs))
+	for i, d := range docs {
+		b, err := marshalDoc(d)
+		if err == nil {
+			b, err = p.stamp(b)
+		}
+		if err == nil {
+			err = p.checkSchema(b, "")
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw[i] = b
+	}
+	in, err := json.Marshal(map[string]interface{}{"docs": raw})
+	if err != nil {
+		return nil, err
+	}
+	results := []WriteResult{}
+	u := fmt.Sprintf("%s/_bulk_docs", p.DBURL())
+	if _, err := p.interact("POST", u, map[string][]string{}, in, &results); err != nil {
+		return nil, err
+	}
+	for _, r := range results {
+		p.noteAccess(r.ID, true)
+	}
+	return results, nil
+}
+
+// BulkFailure describes one document which a bulk write failed to write.
+// Index is its position in the docs passed to the write.
+type BulkFailure struct {
+	Index  int
+	ID     string
+	Error  string // CouchDB's error name, eg. "conflict" or "forbidden"
+	Reason string
+}
+
+// BulkError is returned by bulk writes which failed for some documents
+// but not others. Use errors.As to get at it, and the Index of each
+// Failure to pick out the documents to retry.
+type BulkError struct {
+	Failures []BulkFailure
+}
+
+func (e *BulkError) Error() string {
+	if len(e.Failures) == 1 {
+		f := e.Failures[0]
+		return fmt.Sprintf("bulk write failed for document %d (%q): %s: %s", f.Index, f.ID, f.Error, f.Reason)
+	}
+	return fmt.Sprintf("bulk write failed for %d documents, first %q: %s", len(e.Failures), e.Failures[0].ID, e.Failures[0].Error)
+}
+
+// Indexes returns the indexes of the failed documents, in order.
+func (e *BulkError) Indexes() []int {
+	indexes := make([]int, len(e.Failures))
+	for i, f := range e.Failures {
+		indexes[i] = f.Index
+	}
+	return indexes
+}
+
+// CheckBulk returns a *BulkError describing the failed writes in results,
+// as returned by BulkDocs, or nil if every write succeeded.
+func CheckBulk(results []WriteResult) error {
+	e := &BulkError{}
+	for i, r := range results {
+		if r.Error != "" {
+			e.Failures = append(e.Failures, BulkFailure{Index: i, ID: r.ID, Error: r.Error, Reason: r.Reason})
+		}
+	}
+	if len(e.Failures) == 0 {
+		return nil
+	}
+	return e
+}
+
+// RetryPolicy controls how BulkInsertWithRetry retries failed writes.
+// Waits start at Backoff and double after each attempt, up to MaxBackoff,
+// but are never shorter than the server asks for with Retry-After.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts including the first; 0 means 5
+	Backoff     time.Duration // wait before the first retry; 0 means 100ms
+	MaxBackoff  time.Duration // longest wait between attempts; 0 means 10s
+}
+
+func (rp RetryPolicy) withDefaults() RetryPolicy {
+	if rp.MaxAttempts <= 0 {
+		rp.MaxAttempts = 5
+	}
+	if rp.Backoff <= 0 {
+		rp.Backoff = 100 * time.Millisecond
+	}
+	if rp.MaxBackoff <= 0 {
+		rp.MaxBackoff = 10 * time.Second
+	}
+	return rp
+}
+
+// retriableDocErrors are the per-document errors worth retrying; the
+// rest, like "conflict" or "forbidden", fail the same way every time.
+var retriableDocErrors = map[string]bool{
+	"too_many_requests": true,
+	"timeout":           true,
+	"request_timeout":   true,
+}
+
+// retriable reports whether a failed bulk request is worth retrying:
+// timeouts, 429 Too Many Requests and 5xx gateway errors.
+func retriable(err error) bool {
+	ne := net.Error(nil)
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	switch statusCode(err) {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// BulkInsertWithRetry writes docs with BulkDocs, then retries just the
+// documents which failed with retriable errors (timeouts and 429s, for
+// the whole request or a single document) until they succeed or the
+// policy's attempts run out. It returns the final result for every
+// document, in the order of docs, and a *BulkError if any failed. If the
+// last attempt fails as a whole, its error is returned instead, and the
+// documents it covered keep the results of their previous attempt, if
+// they had one.
+func (p Database) BulkInsertWithRetry(docs []interface{}, policy RetryPolicy) ([]WriteResult, error) {
+	policy = policy.withDefaults()
+	results := make([]WriteResult, len(docs))
+	pending := make([]int, len(docs))
+	for i := range docs {
+		pending[i] = i
+	}
+	wait := policy.Backoff
+	for attempt := 1; ; attempt++ {
+		batch := make([]interface{}, len(pending))
+		for i, index := range pending {
+			batch[i] = docs[index]
+		}
+		written, err := p.BulkDocs(batch)
+		if err != nil && (!retriable(err) || attempt == policy.MaxAttempts) {
+			return results, err
+		}
+		retry := []int{}
+		if err != nil {
+			retry = pending
+		}
+		for i, r := range written {
+			if i >= len(pending) {
+				break
+			}
+			results[pending[i]] = r
+			if retriableDocErrors[r.Error] {
+				retry = append(retry, pending[i])
+			}
+		}
+		if len(retry) == 0 || attempt == policy.MaxAttempts {
+			return results, CheckBulk(results)
+		}
+		pending = retry
+		if d := retryAfter(err); d > wait {
+			wait = d
+		}
+		if err := p.client().pause(wait); err != nil {
+			return results, err
+		}
+		if wait *= 2; wait > policy.MaxBackoff {
+			wait = policy.MaxBackoff
+		}
+	}
+}
+
+// BulkWriteOptions control BulkWrite.
+//
+// Unordered writes (the default) attempt every document and report every
+// failure, as _bulk_docs itself does. Ordered writes stop at the first
+// batch with a failure, leaving the results of later documents empty.
+// Since CouchDB attempts a whole batch, documents after the failure in
+// the same batch may still be written; for strict ordering, leave
+// BatchSize at 0, which for ordered writes means one document at a time.
+type BulkWriteOptions struct {
+	Ordered   bool
+	BatchSize int // documents per request; 0 means all of them, unless Ordered
+}
+
+// BulkWrite writes docs with BulkDocs in batches, returning a result for
+// every document in the order of docs, and a *BulkError if any failed.
+func (p Database) BulkWrite(docs []interface{}, opts BulkWriteOptions) ([]WriteResult, error) {
+	size := opts.BatchSize
+	if size <= 0 {
+		size = len(docs)
+		if opts.Ordered {
+			size = 1
+		}
+	}
+	results := make([]WriteResult, len(docs))
+	failed := false
+	for start := 0; start < len(docs); start += size {
+		end := start + size
+		if end > len(docs) {
+			end = len(docs)
+		}
+		written, err := p.BulkDocs(docs[start:end])
+		if err != nil {
+			return results, err
+		}
+		for i, r := range written {
+			if start+i < end {
+				results[start+i] = r
+				failed = failed || r.Error != ""
+			}
+		}
+		if failed && opts.Ordered {
+			break
+		}
+	}
+	return results, CheckBulk(results)
+}
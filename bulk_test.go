@@ -0,0 +1,137 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckBulk(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"ok":true,"id":"a","rev":"1-a"},{"id":"b","error":"conflict","reason":"Document update conflict."},{"id":"c","error":"forbidden","reason":"no"}]`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	results, err := db.BulkDocs([]interface{}{map[string]string{"_id": "a"}, map[string]string{"_id": "b"}, map[string]string{"_id": "c"}})
+	if err != nil {
+		t.Fatalf("failed to write: %s", err)
+	}
+	err = fmt.Errorf("import: %w", CheckBulk(results))
+	be := &BulkError{}
+	if !errors.As(err, &be) {
+		t.Fatalf("expected a BulkError, got %v", err)
+	}
+	if !reflect.DeepEqual(be.Indexes(), []int{1, 2}) {
+		t.Fatalf("indexes: expected [1 2], got %v", be.Indexes())
+	}
+	if f := be.Failures[0]; f.ID != "b" || f.Error != "conflict" || f.Reason != "Document update conflict." {
+		t.Fatalf("failure: got %+v", f)
+	}
+	if err := CheckBulk(results[:1]); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestBulkInsertWithRetry(t *testing.T) {
+	bodies := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		switch len(bodies) {
+		case 1:
+			fmt.Fprint(w, `[{"ok":true,"id":"a","rev":"1-a"},{"id":"b","error":"too_many_requests","reason":"slow down"},{"id":"c","error":"conflict","reason":"Document update conflict."}]`)
+		case 2:
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":"too_many_requests","reason":"slow down"}`)
+		default:
+			fmt.Fprint(w, `[{"ok":true,"id":"b","rev":"1-b"}]`)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	docs := []interface{}{map[string]string{"_id": "a"}, map[string]string{"_id": "b"}, map[string]string{"_id": "c"}}
+	results, err := db.BulkInsertWithRetry(docs, RetryPolicy{Backoff: time.Millisecond})
+	if len(bodies) != 3 {
+		t.Fatalf("requests: expected 3, got %d", len(bodies))
+	}
+	if bodies[2] != `{"docs":[{"_id":"b"}]}` {
+		t.Fatalf("retry: expected only b, got %s", bodies[2])
+	}
+	if results[0].Rev != "1-a" || results[1].Rev != "1-b" || results[2].Error != "conflict" {
+		t.Fatalf("results: got %+v", results)
+	}
+	be := &BulkError{}
+	if !errors.As(err, &be) || !reflect.DeepEqual(be.Indexes(), []int{2}) {
+		t.Fatalf("expected a BulkError for c, got %v", err)
+	}
+}
+
+func TestBulkInsertWithRetryGivesUp(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	_, err := db.BulkInsertWithRetry([]interface{}{map[string]string{"_id": "a"}}, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	if statusCode(err) != http.StatusServiceUnavailable {
+		t.Fatalf("expected a 503, got %v", err)
+	}
+	if requests != 3 {
+		t.Fatalf("requests: expected 3, got %d", requests)
+	}
+}
+
+func TestBulkWriteOrdered(t *testing.T) {
+	for _, test := range []struct {
+		opts     BulkWriteOptions
+		requests int
+		failed   []int
+	}{
+		{BulkWriteOptions{}, 1, []int{1, 3}},
+		{BulkWriteOptions{BatchSize: 2}, 2, []int{1, 3}},
+		{BulkWriteOptions{Ordered: true}, 2, []int{1}},
+		{BulkWriteOptions{Ordered: true, BatchSize: 3}, 1, []int{1}},
+	} {
+		requests := 0
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			in := struct{ Docs []map[string]string }{}
+			json.NewDecoder(r.Body).Decode(&in)
+			results := []WriteResult{}
+			for _, d := range in.Docs {
+				if d["_id"] == "b" || d["_id"] == "d" {
+					results = append(results, WriteResult{ID: d["_id"], Error: "forbidden"})
+				} else {
+					results = append(results, WriteResult{ID: d["_id"], Rev: "1-x", OK: true})
+				}
+			}
+			json.NewEncoder(w).Encode(results)
+		}))
+		db := newTestDatabase(ts)
+		docs := []interface{}{}
+		for _, id := range []string{"a", "b", "c", "d"} {
+			docs = append(docs, map[string]string{"_id": id})
+		}
+		results, err := db.BulkWrite(docs, test.opts)
+		ts.Close()
+		if requests != test.requests {
+			t.Fatalf("%+v: requests: expected %d, got %d", test.opts, test.requests, requests)
+		}
+		be := &BulkError{}
+		if !errors.As(err, &be) || !reflect.DeepEqual(be.Indexes(), test.failed) {
+			t.Fatalf("%+v: expected failures %v, got %v", test.opts, test.failed, err)
+		}
+		if len(results) != 4 || results[0].Rev != "1-x" {
+			t.Fatalf("%+v: results: got %+v", test.opts, results)
+		}
+	}
+}
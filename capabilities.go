@@ -0,0 +1,109 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ServerInfo is the welcome message returned by GET /.
+type ServerInfo struct {
+	CouchDB  string   `json:"couchdb"`
+	Version  string   `json:"version"`
+	GitSha   string   `json:"git_sha"`
+	UUID     string   `json:"uuid"`
+	Features []string `json:"features"`
+	Vendor   struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"vendor"`
+}
+
+// HasFeature reports whether the server advertises the named feature.
+func (si ServerInfo) HasFeature(feature string) bool {
+	for _, f := range si.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// Capabilities summarizes what a server supports, as derived from its
+// ServerInfo. The package uses NodeConfig to find the server's
+// configuration; the rest is for callers to branch on.
+type Capabilities struct {
+	Major, Minor, Patch int
+
+	NodeConfig  bool // configuration lives under /_node/{node}/_config (2.0+)
+	Partitioned bool // partitioned databases
+	Reshard     bool // the _reshard API
+	Scheduler   bool // the _scheduler replication API
+}
+
+// AtLeast reports whether the server version is at least major.minor.
+func (c Capabilities) AtLeast(major, minor int) bool {
+	return c.Major > major || (c.Major == major && c.Minor >= minor)
+}
+
+func newCapabilities(si ServerInfo) Capabilities {
+	c := Capabilities{}
+	v := strings.SplitN(si.Version, ".", 3)
+	for i, p := range []*int{&c.Major, &c.Minor, &c.Patch} {
+		if i >= len(v) {
+			break
+		}
+		// tolerate suffixes like "3.3.0-rc1"
+		digits := strings.FieldsFunc(v[i], func(r rune) bool { return r < '0' || r > '9' })
+		if len(digits) > 0 {
+			*p, _ = strconv.Atoi(digits[0])
+		}
+	}
+	c.NodeConfig = c.AtLeast(2, 0)
+	c.Partitioned = si.HasFeature("partitioned")
+	c.Reshard = si.HasFeature("reshard")
+	c.Scheduler = si.HasFeature("scheduler")
+	return c
+}
+
+// Info returns the server's welcome message, and records the server's
+// Capabilities for later use.
+func (s Server) Info() (ServerInfo, error) {
+	si := ServerInfo{}
+	if err := s.unmarshalURL(fmt.Sprintf("%s/", s.BaseURL()), &si); err != nil {
+		return ServerInfo{}, err
+	}
+	s.client().capabilities.Store(s.capabilitiesKey(), newCapabilities(si))
+	return si, nil
+}
+
+// Capabilities returns what the server supports. The server is only asked
+// once per Client; later calls return the recorded answer.
+func (s Server) Capabilities() (Capabilities, error) {
+	if c, ok := s.client().capabilities.Load(s.capabilitiesKey()); ok {
+		return c.(Capabilities), nil
+	}
+	if _, err := s.Info(); err != nil {
+		return Capabilities{}, err
+	}
+	c, _ := s.client().capabilities.Load(s.capabilitiesKey())
+	return c.(Capabilities), nil
+}
+
+// capabilitiesKey identifies the server in the Client's cache of
+// Capabilities: its BaseURL without credentials, which it doesn't
+// depend on, and which shouldn't be kept around.
+func (s Server) capabilitiesKey() string {
+	s.Auth = nil
+	return s.BaseURL()
+}
+
+// localNode names the node whose _config should be used: "_local" on
+// clustered servers, or "" for the top-level /_config of CouchDB 1.x.
+func (s Server) localNode() string {
+	if c, err := s.Capabilities(); err == nil && !c.NodeConfig {
+		return ""
+	}
+	return "_local"
+}
@@ -0,0 +1,66 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCapabilities(t *testing.T) {
+	si := ServerInfo{Version: "3.3.0-rc1", Features: []string{"partitioned", "scheduler"}}
+	c := newCapabilities(si)
+	if c.Major != 3 || c.Minor != 3 || c.Patch != 0 {
+		t.Fatalf("version: got %d.%d.%d", c.Major, c.Minor, c.Patch)
+	}
+	if !c.NodeConfig || !c.Partitioned || !c.Scheduler || c.Reshard {
+		t.Fatalf("capabilities: got %+v", c)
+	}
+	old := newCapabilities(ServerInfo{Version: "1.6.1"})
+	if old.NodeConfig || old.Partitioned {
+		t.Fatalf("1.6 capabilities: got %+v", old)
+	}
+}
+
+func TestLegacyConfigPath(t *testing.T) {
+	paths := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `{"couchdb":"Welcome","version":"1.6.1"}`)
+			return
+		}
+		fmt.Fprint(w, `"value"`)
+	}))
+	defer ts.Close()
+	s := newTestDatabase(ts).Server()
+	s.Client = NewClient()
+	if _, err := s.Config("couchdb", "uuid"); err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	}
+	if _, err := s.Config("couchdb", "uuid"); err != nil {
+		t.Fatalf("failed to read config: %s", err)
+	}
+	if fmt.Sprint(paths) != "[/ /_config/couchdb/uuid /_config/couchdb/uuid]" {
+		t.Fatalf("paths: got %v", paths)
+	}
+
+	// other credentials for the same server share its capabilities,
+	// without them being kept
+	s.Auth = url.UserPassword("admin", "secret")
+	if _, err := s.Capabilities(); err != nil {
+		t.Fatalf("capabilities: %s", err)
+	}
+	if len(paths) != 3 {
+		t.Fatalf("expected the capabilities to be cached, got %v", paths)
+	}
+	s.Client.capabilities.Range(func(k, v interface{}) bool {
+		if strings.Contains(k.(string), "secret") {
+			t.Fatalf("cache key: got %s", k)
+		}
+		return true
+	})
+}
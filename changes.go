@@ -0,0 +1,173 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// Seq is a database update sequence. It's an opaque string since CouchDB
+// 2.0, and a number before; numbers are kept in their decimal form.
+type Seq string
+
+func (s *Seq) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, (*string)(s))
+	}
+	if string(b) == "null" {
+		*s = ""
+		return nil
+	}
+	n := json.Number("")
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*s = Seq(n)
+	return nil
+}
+
+// Change is a single event of the changes feed. Revs holds the leaf
+// revisions of the document: just the winning one, or with
+// ChangesOptions.AllRevs, every leaf, winner first, so more than one
+// means the document is conflicted. Doc is set with IncludeDocs.
+type Change struct {
+	Seq     Seq
+	Id      string
+	Deleted bool
+	Revs    []string
+	Doc     json.RawMessage
+}
+
+func (c *Change) UnmarshalJSON(b []byte) error {
+	raw := struct {
+		Seq     Seq    `json:"seq"`
+		Id      string `json:"id"`
+		Deleted bool   `json:"deleted"`
+		Changes []struct {
+			Rev string `json:"rev"`
+		} `json:"changes"`
+		Doc json.RawMessage `json:"doc"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*c = Change{Seq: raw.Seq, Id: raw.Id, Deleted: raw.Deleted, Doc: raw.Doc}
+	for _, ch := range raw.Changes {
+		c.Revs = append(c.Revs, ch.Rev)
+	}
+	return nil
+}
+
+// Rev returns the winning revision of the changed document.
+func (c Change) Rev() string {
+	if len(c.Revs) == 0 {
+		return ""
+	}
+	return c.Revs[0]
+}
+
+// Conflicted reports whether the change lists more than one leaf
+// revision, which requires ChangesOptions.AllRevs.
+func (c Change) Conflicted() bool {
+	return len(c.Revs) > 1
+}
+
+// ChangesOptions select the events of the changes feed.
+type ChangesOptions struct {
+	Since       Seq // only changes after this sequence; "now" for future changes only
+	Limit       int // 0 means no limit
+	Descending  bool
+	IncludeDocs bool
+	AllRevs     bool        // list every leaf revision (style=all_docs), not just the winner
+	Selector    interface{} // only documents matching this Mango selector
+	Filter      string      // a filter function, "ddoc/name"; can't be used with Selector
+}
+
+// query renders the options as the query string of a _changes request.
+func (o ChangesOptions) query() (string, error) {
+	v := url.Values{}
+	if o.Since != "" {
+		v.Set("since", string(o.Since))
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Descending {
+		v.Set("descending", "true")
+	}
+	if o.IncludeDocs {
+		v.Set("include_docs", "true")
+	}
+	if o.AllRevs {
+		v.Set("style", "all_docs")
+	}
+	switch {
+	case o.Selector != nil && o.Filter != "":
+		return "", fmt.Errorf("changes: both selector and filter set")
+	case o.Selector != nil:
+		v.Set("filter", "_selector")
+	case o.Filter != "":
+		v.Set("filter", o.Filter)
+	}
+	return v.Encode(), nil
+}
+
+// body returns the POST body of a _changes request, or nil for a GET.
+func (o ChangesOptions) body() ([]byte, error) {
+	if o.Selector == nil {
+		return nil, nil
+	}
+	return json.Marshal(map[string]interface{}{"selector": o.Selector})
+}
+
+// ChangesResponse is a batch of the changes feed. LastSeq is the sequence
+// to pass as Since to continue from the end of the batch; Pending is how
+// many more changes there are after it (CouchDB 2.0+), eg. when Limit cut
+// the batch short.
+type ChangesResponse struct {
+	Results []Change `json:"results"`
+	LastSeq Seq      `json:"last_seq"`
+	Pending int64    `json:"pending"`
+}
+
+// Changes returns the changes made to the database, from _changes.
+func (p Database) Changes(opts ChangesOptions) (ChangesResponse, error) {
+	return p.ChangesContext(context.Background(), opts)
+}
+
+// ChangesContext is Changes, but gives up when ctx is done.
+func (p Database) ChangesContext(ctx context.Context, opts ChangesOptions) (ChangesResponse, error) {
+	r := ChangesResponse{}
+	if err := p.changes(ctx, opts, nil, &r); err != nil {
+		return ChangesResponse{}, err
+	}
+	return r, nil
+}
+
+// changes makes a _changes request for opts, with the extra query
+// parameters in extra, decoding the response into out.
+func (p Database) changes(ctx context.Context, opts ChangesOptions, extra url.Values, out interface{}) error {
+	q, err := opts.query()
+	if err != nil {
+		return err
+	}
+	if len(extra) > 0 {
+		if q != "" {
+			q += "&"
+		}
+		q += extra.Encode()
+	}
+	body, err := opts.body()
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/_changes?%s", p.DBURL(), q)
+	if body == nil {
+		return p.client().unmarshalURLContext(ctx, u, out)
+	}
+	_, err = p.client().interactContext(ctx, "POST", u, map[string][]string{}, body, out)
+	return err
+}
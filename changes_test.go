@@ -0,0 +1,63 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestChangeJSON(t *testing.T) {
+	in := `{"results":[
+		{"seq":"2-g1AAAA","id":"a","changes":[{"rev":"2-x"},{"rev":"2-y"}]},
+		{"seq":3,"id":"b","deleted":true,"changes":[{"rev":"3-z"}]}
+	],"last_seq":3}`
+	r := ChangesResponse{}
+	if err := json.Unmarshal([]byte(in), &r); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	expected := ChangesResponse{
+		Results: []Change{
+			{Seq: "2-g1AAAA", Id: "a", Revs: []string{"2-x", "2-y"}},
+			{Seq: "3", Id: "b", Deleted: true, Revs: []string{"3-z"}},
+		},
+		LastSeq: "3",
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("changes:\nexpected %+v\n     got %+v", expected, r)
+	}
+	if !r.Results[0].Conflicted() || r.Results[0].Rev() != "2-x" {
+		t.Fatalf("expected conflicted change with winner 2-x, got %+v", r.Results[0])
+	}
+}
+
+func TestChangesSelector(t *testing.T) {
+	var query, body string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		query, body = r.URL.RawQuery, string(b)
+		fmt.Fprint(w, `{"results":[],"last_seq":"5-abc"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	r, err := db.Changes(ChangesOptions{Since: "now", AllRevs: true, Selector: map[string]string{"type": "user"}})
+	if err != nil {
+		t.Fatalf("failed to get changes: %s", err)
+	}
+	if r.LastSeq != "5-abc" {
+		t.Fatalf("last seq: got %s", r.LastSeq)
+	}
+	if query != "filter=_selector&since=now&style=all_docs" {
+		t.Fatalf("query: got %s", query)
+	}
+	if body != `{"selector":{"type":"user"}}` {
+		t.Fatalf("body: got %s", body)
+	}
+	if _, err := db.Changes(ChangesOptions{Selector: 1, Filter: "a/b"}); err == nil {
+		t.Fatalf("expected error with both selector and filter")
+	}
+}
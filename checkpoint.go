@@ -0,0 +1,133 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Checkpointer stores how far a changes consumer has got, so it can
+// resume where it left off. Load returns "" if nothing was saved yet.
+type Checkpointer interface {
+	Load() (Seq, error)
+	Save(Seq) error
+}
+
+// MemoryCheckpointer keeps the sequence in memory, so it's lost when the
+// process exits; it's mainly useful for tests.
+type MemoryCheckpointer struct {
+	mu  sync.Mutex
+	seq Seq
+}
+
+func (m *MemoryCheckpointer) Load() (Seq, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.seq, nil
+}
+
+func (m *MemoryCheckpointer) Save(seq Seq) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.seq = seq
+	return nil
+}
+
+// FileCheckpointer keeps the sequence in the file at Path, which is
+// replaced atomically on every Save.
+type FileCheckpointer struct {
+	Path string
+}
+
+func (f FileCheckpointer) Load() (Seq, error) {
+	b, err := ioutil.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return Seq(b), nil
+}
+
+func (f FileCheckpointer) Save(seq Seq) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(f.Path), filepath.Base(f.Path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(string(seq)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.Path)
+}
+
+// LocalCheckpointer keeps the sequence in the _local document Id (without
+// the "_local/" prefix) of DB, typically the database being consumed.
+// _local documents don't replicate, so each replica keeps its own.
+type LocalCheckpointer struct {
+	DB Database
+	Id string
+
+	mu  sync.Mutex
+	rev string
+}
+
+type localCheckpoint struct {
+	Rev string `json:"_rev,omitempty"`
+	Seq Seq    `json:"seq"`
+}
+
+func (l *LocalCheckpointer) url() string {
+	return fmt.Sprintf("%s/_local/%s", l.DB.DBURL(), url.PathEscape(l.Id))
+}
+
+func (l *LocalCheckpointer) Load() (Seq, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	cp := localCheckpoint{}
+	err := l.DB.unmarshalURL(l.url(), &cp)
+	if isNotFound(err) {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	l.rev = cp.Rev
+	return cp.Seq, nil
+}
+
+// Save writes the sequence, reloading the current revision of the
+// checkpoint document once if another writer has changed it.
+func (l *LocalCheckpointer) Save(seq Seq) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		in, err := json.Marshal(localCheckpoint{l.rev, seq})
+		if err != nil {
+			return err
+		}
+		r := WriteResult{}
+		_, err = l.DB.interact("PUT", l.url(), map[string][]string{}, in, &r)
+		if statusCode(err) == 409 && attempt == 0 {
+			cp := localCheckpoint{}
+			if err := l.DB.unmarshalURL(l.url(), &cp); err != nil && !isNotFound(err) {
+				return err
+			}
+			l.rev = cp.Rev
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		l.rev = r.Rev
+		return nil
+	}
+}
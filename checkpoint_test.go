@@ -0,0 +1,87 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testCheckpointer(t *testing.T, cp Checkpointer) {
+	seq, err := cp.Load()
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if seq != "" {
+		t.Fatalf("initial load: expected nothing, got %q", seq)
+	}
+	for _, s := range []Seq{"1-abc", "2-def"} {
+		if err := cp.Save(s); err != nil {
+			t.Fatalf("failed to save: %s", err)
+		}
+		if seq, err = cp.Load(); err != nil || seq != s {
+			t.Fatalf("load: expected %q, got %q (%v)", s, seq, err)
+		}
+	}
+}
+
+func TestMemoryCheckpointer(t *testing.T) {
+	testCheckpointer(t, &MemoryCheckpointer{})
+}
+
+func TestFileCheckpointer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	testCheckpointer(t, FileCheckpointer{filepath.Join(dir, "seq")})
+}
+
+func TestLocalCheckpointer(t *testing.T) {
+	stored := localCheckpoint{}
+	n := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_local/consumer" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			if stored.Rev == "" {
+				w.WriteHeader(404)
+				fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+				return
+			}
+			json.NewEncoder(w).Encode(stored)
+		case "PUT":
+			in := localCheckpoint{}
+			json.NewDecoder(r.Body).Decode(&in)
+			if in.Rev != stored.Rev {
+				w.WriteHeader(409)
+				fmt.Fprint(w, `{"error":"conflict","reason":"Document update conflict."}`)
+				return
+			}
+			n++
+			stored = localCheckpoint{fmt.Sprintf("0-%d", n), in.Seq}
+			fmt.Fprintf(w, `{"ok":true,"id":"_local/consumer","rev":%q}`, stored.Rev)
+		}
+	}))
+	defer ts.Close()
+	cp := &LocalCheckpointer{DB: newTestDatabase(ts), Id: "consumer"}
+	testCheckpointer(t, cp)
+
+	// another writer moved the checkpoint on
+	stored.Rev = "0-9"
+	if err := cp.Save("3-ghi"); err != nil {
+		t.Fatalf("failed to save after conflict: %s", err)
+	}
+	if stored.Seq != "3-ghi" {
+		t.Fatalf("stored: got %+v", stored)
+	}
+}
@@ -0,0 +1,117 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestDatabase returns a Database pointing at the given test server.
+func newTestDatabase(ts *httptest.Server) Database {
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	return Database{Host: host, Port: port, Name: "db"}
+}
+
+func TestClientProxy(t *testing.T) {
+	seen := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.String()
+		fmt.Fprint(w, `["_users"]`)
+	}))
+	defer proxy.Close()
+	u, _ := url.Parse(proxy.URL)
+	c := NewClient(WithProxy(u))
+	dbs := []string{}
+	if err := c.unmarshalURL("http://couch.invalid:5984/_all_dbs", &dbs); err != nil {
+		t.Fatalf("failed to GET through proxy: %s", err)
+	}
+	if seen != "http://couch.invalid:5984/_all_dbs" {
+		t.Fatalf("proxy: expected absolute request URL, got %q", seen)
+	}
+	if len(dbs) != 1 || dbs[0] != "_users" {
+		t.Fatalf("dbs: expected [_users], got %v", dbs)
+	}
+}
+
+type redirectDialer string
+
+func (d redirectDialer) Dial(network, addr string) (net.Conn, error) {
+	return net.Dial(network, string(d))
+}
+
+func TestClientDialer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ts.Close()
+	c := NewClient(WithProxy(nil), WithDialer(redirectDialer(ts.Listener.Addr().String())))
+	r := WriteResult{}
+	if _, err := c.interact("PUT", "http://couch.invalid:5984/db", map[string][]string{}, []byte("{}"), &r); err != nil {
+		t.Fatalf("failed to PUT through dialer: %s", err)
+	}
+	if !r.OK {
+		t.Fatalf("expected ok response")
+	}
+}
+
+func TestClientWith(t *testing.T) {
+	var mu sync.Mutex
+	seen := http.Header{}
+	lastSeen := func() http.Header {
+		mu.Lock()
+		defer mu.Unlock()
+		return seen
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = r.Header.Clone()
+		mu.Unlock()
+		if r.URL.Path == "/slow" {
+			time.Sleep(50 * time.Millisecond)
+		}
+		fmt.Fprint(w, `{"ok":true,"id":"doc","rev":"1-a"}`)
+	}))
+	defer ts.Close()
+	base := NewClient(WithHeader("X-Service", "api"))
+	batch := base.With(WithHeader("X-Source", "batch"), WithReadOnly())
+	fast := base.With(WithTimeout(10 * time.Millisecond))
+	if batch.httpClient.Transport != base.httpClient.Transport || fast.httpClient.Transport != base.httpClient.Transport {
+		t.Fatalf("expected clones to share the transport")
+	}
+
+	out := map[string]interface{}{}
+	if err := batch.unmarshalURL(ts.URL+"/db/doc", &out); err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if h := lastSeen(); h.Get("X-Service") != "api" || h.Get("X-Source") != "batch" {
+		t.Fatalf("headers: got %v", h)
+	}
+	if _, err := batch.interact("PUT", ts.URL+"/db/doc", defaultHeaders, []byte(`{}`), &out); err != ErrReadOnly {
+		t.Fatalf("write: expected ErrReadOnly, got %v", err)
+	}
+	if _, err := batch.interact("POST", ts.URL+"/db/_find", defaultHeaders, []byte(`{}`), &out); err != nil {
+		t.Fatalf("query: %s", err)
+	}
+
+	if _, err := base.interact("PUT", ts.URL+"/db/doc", defaultHeaders, []byte(`{}`), &out); err != nil {
+		t.Fatalf("base write: %s", err)
+	}
+	if lastSeen().Get("X-Source") != "" {
+		t.Fatalf("base client got the clone's header")
+	}
+	if err := fast.unmarshalURL(ts.URL+"/slow", &out); err == nil {
+		t.Fatalf("expected a timeout")
+	}
+	if err := base.unmarshalURL(ts.URL+"/slow", &out); err != nil {
+		t.Fatalf("base client: %s", err)
+	}
+	if proxied := base.With(WithProxy(nil)); proxied.httpClient.Transport == base.httpClient.Transport {
+		t.Fatalf("expected a new transport after WithProxy")
+	}
+}
@@ -0,0 +1,207 @@
+// -*- tab-width: 4 -*-
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	couch "github.com/peterbourgon/couch-go"
+	"github.com/peterbourgon/couch-go/couchgen"
+)
+
+// benchOptions configure a benchmark run.
+type benchOptions struct {
+	Concurrency int
+	Duration    time.Duration
+	Mix         map[string]int // op -> weight; ops are read, write and query
+	Docs        int            // documents loaded for reads, and their count
+	View        string         // queried by query ops; "" means _all_docs
+	Seed        int64
+}
+
+// opStats are the latencies of one kind of operation.
+type opStats struct {
+	Latencies []time.Duration
+	Errors    int
+}
+
+// percentile returns the latency below which fraction p of them fall.
+func (s opStats) percentile(p float64) time.Duration {
+	if len(s.Latencies) == 0 {
+		return 0
+	}
+	i := int(p * float64(len(s.Latencies)))
+	if i >= len(s.Latencies) {
+		i = len(s.Latencies) - 1
+	}
+	return s.Latencies[i]
+}
+
+var benchSchema = couchgen.Schema{
+	IDPrefix: "bench:",
+	Fields: []couchgen.Field{
+		{Name: "name", Kind: couchgen.String, Min: 5, Max: 20},
+		{Name: "bio", Kind: couchgen.Text, Min: 10, Max: 50},
+		{Name: "age", Kind: couchgen.Int, Min: 18, Max: 90},
+		{Name: "joined", Kind: couchgen.Time, Max: 86400 * 365},
+	},
+}
+
+func benchCommand(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	dburl := fs.String("url", "http://localhost:5984/bench", "database URL, created if need be")
+	concurrency := fs.Int("c", 8, "concurrent clients")
+	duration := fs.Duration("d", 10*time.Second, "how long to run")
+	mix := fs.String("mix", "read=80,write=15,query=5", "weights of read, write and query operations")
+	docs := fs.Int("docs", 1000, "documents to load before starting")
+	view := fs.String("view", "", "view queried by query operations; default _all_docs")
+	seed := fs.Int64("seed", 1, "seed of the generated documents and operations")
+	fs.Parse(args)
+
+	weights, err := parseMix(*mix)
+	if err != nil {
+		return err
+	}
+	if weights["read"] > 0 && *docs <= 0 {
+		return fmt.Errorf("reads need documents to read")
+	}
+	db, err := couch.NewClient().NewDatabaseByURL(*dburl)
+	if err != nil {
+		return err
+	}
+	opts := benchOptions{*concurrency, *duration, weights, *docs, *view, *seed}
+	fmt.Fprintf(os.Stderr, "loading %d documents...\n", opts.Docs)
+	if err := loadBench(db, opts); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "running for %s with %d clients...\n", opts.Duration, opts.Concurrency)
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Duration)
+	defer cancel()
+	start := time.Now()
+	stats := runBench(ctx, db, opts)
+	report(os.Stdout, stats, time.Since(start))
+	return nil
+}
+
+// parseMix parses weights like "read=80,write=20".
+func parseMix(s string) (map[string]int, error) {
+	weights := map[string]int{}
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(part), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bad mix %q", part)
+		}
+		switch kv[0] {
+		case "read", "write", "query":
+		default:
+			return nil, fmt.Errorf("unknown operation %q", kv[0])
+		}
+		w, err := strconv.Atoi(kv[1])
+		if err != nil || w < 0 {
+			return nil, fmt.Errorf("bad weight %q", kv[1])
+		}
+		weights[kv[0]] = w
+	}
+	return weights, nil
+}
+
+// loadBench loads the documents which reads are made of. Documents loaded
+// by an earlier run are left as they are.
+func loadBench(db couch.Database, opts benchOptions) error {
+	_, err := couchgen.New(benchSchema, opts.Seed).Load(db, 0, opts.Docs, 0)
+	var be *couch.BulkError
+	if err != nil && !errors.As(err, &be) {
+		return err
+	}
+	return nil
+}
+
+// runBench runs the mix of operations until ctx is done, and returns the
+// sorted latencies of each.
+func runBench(ctx context.Context, db couch.Database, opts benchOptions) map[string]*opStats {
+	ops := []string{}
+	for _, op := range []string{"read", "write", "query"} {
+		for i := 0; i < opts.Mix[op]; i++ {
+			ops = append(ops, op)
+		}
+	}
+	view := opts.View
+	if view == "" {
+		view = "_all_docs"
+	}
+	writes := couchgen.New(couchgen.Schema{
+		IDPrefix: fmt.Sprintf("bench-write-%d:", time.Now().UnixNano()),
+		Fields:   benchSchema.Fields,
+	}, opts.Seed)
+	var written int64
+	stats := map[string]*opStats{}
+	for _, op := range ops {
+		stats[op] = &opStats{}
+	}
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for w := 0; w < opts.Concurrency && len(ops) > 0; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(opts.Seed + int64(w)))
+			for ctx.Err() == nil {
+				op := ops[rng.Intn(len(ops))]
+				start := time.Now()
+				var err error
+				switch op {
+				case "read":
+					doc := map[string]interface{}{}
+					_, err = db.Retrieve(fmt.Sprintf("bench:%08d", rng.Intn(opts.Docs)), &doc)
+				case "write":
+					_, _, err = db.Insert(writes.Doc(int(atomic.AddInt64(&written, 1))))
+				case "query":
+					err = db.QueryViewContext(ctx, view, couch.ViewOptions{Limit: 10}, &couch.KeyedViewResponse{})
+				}
+				elapsed := time.Since(start)
+				if ctx.Err() != nil {
+					return // cut short; don't count it
+				}
+				mu.Lock()
+				if err != nil {
+					stats[op].Errors++
+				} else {
+					stats[op].Latencies = append(stats[op].Latencies, elapsed)
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	for _, s := range stats {
+		sort.Slice(s.Latencies, func(i, j int) bool { return s.Latencies[i] < s.Latencies[j] })
+	}
+	return stats
+}
+
+// report writes a table of throughput and latency percentiles.
+func report(w io.Writer, stats map[string]*opStats, elapsed time.Duration) {
+	fmt.Fprintf(w, "%-6s %8s %8s %10s %10s %10s %10s %10s\n", "op", "count", "errors", "req/s", "p50", "p90", "p99", "max")
+	for _, op := range []string{"read", "write", "query"} {
+		s, ok := stats[op]
+		if !ok {
+			continue
+		}
+		n := len(s.Latencies)
+		fmt.Fprintf(w, "%-6s %8d %8d %10.1f %10s %10s %10s %10s\n", op, n, s.Errors,
+			float64(n)/elapsed.Seconds(),
+			s.percentile(0.5).Round(time.Microsecond), s.percentile(0.9).Round(time.Microsecond),
+			s.percentile(0.99).Round(time.Microsecond), s.percentile(1).Round(time.Microsecond))
+	}
+}
@@ -0,0 +1,75 @@
+// -*- tab-width: 4 -*-
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	couch "github.com/peterbourgon/couch-go"
+)
+
+func TestParseMix(t *testing.T) {
+	weights, err := parseMix("read=70, write=20,query=10")
+	if err != nil || !reflect.DeepEqual(weights, map[string]int{"read": 70, "write": 20, "query": 10}) {
+		t.Fatalf("mix: got %v, %v", weights, err)
+	}
+	for _, bad := range []string{"read", "delete=1", "read=x", "read=-1"} {
+		if _, err := parseMix(bad); err == nil {
+			t.Fatalf("%s: expected error", bad)
+		}
+	}
+}
+
+func TestRunBench(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/db/_all_docs":
+			fmt.Fprint(w, `{"total_rows":0,"offset":0,"rows":[]}`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `{"_id":"x","_rev":"1-x"}`)
+		case r.Method == "POST" && r.URL.Path == "/db/_bulk_docs":
+			in := struct{ Docs []map[string]interface{} }{}
+			json.NewDecoder(r.Body).Decode(&in)
+			results := []couch.WriteResult{}
+			for _, d := range in.Docs {
+				results = append(results, couch.WriteResult{OK: true, ID: d["_id"].(string), Rev: "1-x"})
+			}
+			json.NewEncoder(w).Encode(results)
+		default:
+			fmt.Fprint(w, `{"ok":true,"id":"x","rev":"1-x"}`)
+		}
+	}))
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	db := couch.Database{Host: host, Port: port, Name: "db"}
+	opts := benchOptions{Concurrency: 4, Duration: 100 * time.Millisecond, Mix: map[string]int{"read": 2, "write": 1, "query": 1}, Docs: 10, Seed: 1}
+	if err := loadBench(db, opts); err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Duration)
+	defer cancel()
+	stats := runBench(ctx, db, opts)
+	for _, op := range []string{"read", "write", "query"} {
+		s := stats[op]
+		if s == nil || len(s.Latencies) == 0 || s.Errors != 0 {
+			t.Fatalf("%s: got %+v", op, s)
+		}
+		if s.percentile(0.5) > s.percentile(1) {
+			t.Fatalf("%s: percentiles out of order", op)
+		}
+	}
+	out := &bytes.Buffer{}
+	report(out, stats, opts.Duration)
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 4 {
+		t.Fatalf("report: got %s", out)
+	}
+}
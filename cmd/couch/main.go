@@ -0,0 +1,35 @@
+// -*- tab-width: 4 -*-
+
+// Command couch is a command-line companion to the couch package.
+//
+//	couch bench -url http://localhost:5984/bench -c 16 -d 30s -mix read=80,write=15,query=5
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+var commands = map[string]func(args []string) error{
+	"bench": benchCommand,
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: couch <command> [flags]\n\ncommands:\n")
+	fmt.Fprintf(os.Stderr, "  bench   drive a read/write/query mix and report latencies\n")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "couch %s: %s\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,226 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Compact starts compacting the database file, which rewrites it without
+// old revisions and deleted data. CouchDB compacts in the background; the
+// database's CompactRunning info is set until it's done.
+func (p Database) Compact() error {
+	return p.compact(context.Background(), "_compact")
+}
+
+// CompactView starts compacting the view index of the design document
+// with the given id, eg. "_design/users".
+func (p Database) CompactView(id string) error {
+	name := strings.TrimPrefix(id, "_design/")
+	if name == id || name == "" {
+		return fmt.Errorf("design document id must start with _design/")
+	}
+	return p.compact(context.Background(), "_compact/"+url.PathEscape(name))
+}
+
+func (p Database) compact(ctx context.Context, path string) error {
+	r := struct {
+		OK bool `json:"ok"`
+	}{}
+	_, err := p.client().interactContext(ctx, "POST", p.DBURL()+"/"+path, map[string][]string{}, []byte("{}"), &r)
+	return err
+}
+
+// fragmentation is the share of a file not in active use.
+func fragmentation(file, active int64) float64 {
+	if file <= 0 || active >= file {
+		return 0
+	}
+	return float64(file-active) / float64(file)
+}
+
+// CompactionWindow is a daily period when compaction may start, as
+// offsets from midnight, eg. 2h to 5h. A window whose End is before its
+// Start spans midnight.
+type CompactionWindow struct {
+	Start, End time.Duration
+}
+
+func (w CompactionWindow) contains(t time.Time) bool {
+	y, m, d := t.Date()
+	off := t.Sub(time.Date(y, m, d, 0, 0, 0, 0, t.Location()))
+	if w.Start <= w.End {
+		return off >= w.Start && off < w.End
+	}
+	return off >= w.Start || off < w.End
+}
+
+// CompactionOptions configure a CompactionScheduler.
+type CompactionOptions struct {
+	// Windows are when compaction may start, in the Clock's time zone;
+	// none means any time. Compactions already started aren't stopped
+	// when a window ends.
+	Windows []CompactionWindow
+	// Threshold is the fragmentation, the share of a file not in active
+	// use, at which it's compacted; 0 means 0.5.
+	Threshold float64
+	// MinFileSize skips files smaller than this many bytes, which aren't
+	// worth the trouble; 0 means 16 MiB.
+	MinFileSize int64
+	// Views compacts the databases' view indexes too, and cleans up the
+	// index files of old view definitions.
+	Views bool
+
+	Interval  time.Duration    // between checks; 0 means 15 minutes
+	Clock     func() time.Time // defaults to time.Now
+	Compacted func(Compaction) // called for each compaction started, if set
+}
+
+// Compaction describes a compaction started by a CompactionScheduler.
+type Compaction struct {
+	Database      string
+	DesignDoc     string // the design document id, for view compaction
+	Fragmentation float64
+	FileSize      int64
+}
+
+// CompactionScheduler compacts databases, and optionally their view
+// indexes, during off-peak windows, when they're fragmented enough to be
+// worth it.
+type CompactionScheduler struct {
+	dbs  []Database
+	opts CompactionOptions
+}
+
+// NewCompactionScheduler returns a CompactionScheduler of the databases.
+func NewCompactionScheduler(dbs []Database, opts CompactionOptions) *CompactionScheduler {
+	if opts.Threshold <= 0 {
+		opts.Threshold = 0.5
+	}
+	if opts.MinFileSize <= 0 {
+		opts.MinFileSize = 16 << 20
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 15 * time.Minute
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	return &CompactionScheduler{dbs: dbs, opts: opts}
+}
+
+// open reports whether compaction may start at t.
+func (s *CompactionScheduler) open(t time.Time) bool {
+	if len(s.opts.Windows) == 0 {
+		return true
+	}
+	for _, w := range s.opts.Windows {
+		if w.contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Run checks the databases every Interval while a window is open, until
+// ctx is done, which it returns. Failed checks are logged to the Client's
+// Logger, if any, and tried again at the next interval. If the Client
+// of the first database is closed, Run returns ErrClientClosed.
+func (s *CompactionScheduler) Run(ctx context.Context) error {
+	if len(s.dbs) == 0 {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	c := s.dbs[0].client()
+	ctx, done, err := c.background(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	t := time.NewTicker(s.opts.Interval)
+	defer t.Stop()
+	for {
+		if s.open(s.opts.Clock()) {
+			if _, err := s.Check(ctx); err != nil && ctx.Err() == nil && c.logger != nil {
+				c.logger.Printf("couch: scheduling compaction: %s", err)
+			}
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return closedErr(ctx, ctx.Err())
+		}
+	}
+}
+
+// Check starts compacting any database or view index over the
+// Threshold, regardless of the windows, returning the compactions
+// started. It carries on past databases it fails to check, returning the
+// first error.
+func (s *CompactionScheduler) Check(ctx context.Context) ([]Compaction, error) {
+	started := []Compaction{}
+	var first error
+	for _, db := range s.dbs {
+		if err := s.check(ctx, db, &started); err != nil {
+			if ctx.Err() != nil {
+				return started, ctx.Err()
+			}
+			if first == nil {
+				first = fmt.Errorf("%s: %w", db.Name, err)
+			}
+		}
+	}
+	return started, first
+}
+
+func (s *CompactionScheduler) check(ctx context.Context, db Database, started *[]Compaction) error {
+	info, err := db.InfoContext(ctx)
+	if err != nil {
+		return err
+	}
+	if due, frag := s.due(info.Sizes.File, info.Sizes.Active, info.CompactRunning); due {
+		if err := db.compact(ctx, "_compact"); err != nil {
+			return err
+		}
+		s.started(started, Compaction{Database: db.Name, Fragmentation: frag, FileSize: info.Sizes.File})
+	}
+	if !s.opts.Views {
+		return nil
+	}
+	ddocs, err := db.DesignDocs(nil)
+	if err != nil {
+		return err
+	}
+	for _, id := range ddocs.Ids() {
+		di, err := db.DesignInfoContext(ctx, id)
+		if err != nil {
+			return err
+		}
+		vi := di.ViewIndex
+		due, frag := s.due(vi.Sizes.File, vi.Sizes.Active, vi.CompactRunning)
+		if !due {
+			continue
+		}
+		if err := db.compact(ctx, "_compact/"+url.PathEscape(strings.TrimPrefix(id, "_design/"))); err != nil {
+			return err
+		}
+		s.started(started, Compaction{Database: db.Name, DesignDoc: id, Fragmentation: frag, FileSize: vi.Sizes.File})
+	}
+	return db.ViewCleanup()
+}
+
+// due reports whether a file should be compacted, and how fragmented it is.
+func (s *CompactionScheduler) due(file, active int64, running bool) (bool, float64) {
+	frag := fragmentation(file, active)
+	return !running && file >= s.opts.MinFileSize && frag >= s.opts.Threshold, frag
+}
+
+func (s *CompactionScheduler) started(started *[]Compaction, c Compaction) {
+	*started = append(*started, c)
+	if s.opts.Compacted != nil {
+		s.opts.Compacted(c)
+	}
+}
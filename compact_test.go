@@ -0,0 +1,91 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCompactionScheduler(t *testing.T) {
+	posts := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			posts = append(posts, r.URL.Path)
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"ok":true}`)
+			return
+		}
+		switch r.URL.Path {
+		case "/db":
+			fmt.Fprint(w, `{"db_name":"db","sizes":{"file":100000000,"active":20000000}}`)
+		case "/db/_design_docs":
+			fmt.Fprint(w, `{"rows":[{"id":"_design/busy"},{"id":"_design/tidy"},{"id":"_design/running"}]}`)
+		case "/db/_design/busy/_info":
+			fmt.Fprint(w, `{"name":"busy","view_index":{"sizes":{"file":50000000,"active":10000000}}}`)
+		case "/db/_design/tidy/_info":
+			fmt.Fprint(w, `{"name":"tidy","view_index":{"sizes":{"file":50000000,"active":40000000}}}`)
+		case "/db/_design/running/_info":
+			fmt.Fprint(w, `{"name":"running","view_index":{"compact_running":true,"sizes":{"file":50000000,"active":10000000}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+
+	s := NewCompactionScheduler([]Database{db}, CompactionOptions{Views: true})
+	started, err := s.Check(context.Background())
+	if err != nil {
+		t.Fatalf("check: %s", err)
+	}
+	want := []Compaction{
+		{Database: "db", Fragmentation: 0.8, FileSize: 100000000},
+		{Database: "db", DesignDoc: "_design/busy", Fragmentation: 0.8, FileSize: 50000000},
+	}
+	if !reflect.DeepEqual(started, want) {
+		t.Fatalf("compactions: expected %+v, got %+v", want, started)
+	}
+	if want := []string{"/db/_compact", "/db/_compact/busy", "/db/_view_cleanup"}; !reflect.DeepEqual(posts, want) {
+		t.Fatalf("requests: expected %v, got %v", want, posts)
+	}
+
+	// outside its window, the scheduler leaves the databases alone
+	posts = nil
+	noon := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	s = NewCompactionScheduler([]Database{db}, CompactionOptions{
+		Windows: []CompactionWindow{{Start: 22 * time.Hour, End: 4 * time.Hour}},
+		Clock:   func() time.Time { return noon },
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Run(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("run: expected the deadline, got %v", err)
+	}
+	if len(posts) != 0 {
+		t.Fatalf("expected no compaction outside the window, got %v", posts)
+	}
+}
+
+func TestCompactionWindow(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		w    CompactionWindow
+		at   time.Duration
+		want bool
+	}{
+		{CompactionWindow{2 * time.Hour, 5 * time.Hour}, 3 * time.Hour, true},
+		{CompactionWindow{2 * time.Hour, 5 * time.Hour}, 5 * time.Hour, false},
+		{CompactionWindow{22 * time.Hour, 4 * time.Hour}, 23 * time.Hour, true},
+		{CompactionWindow{22 * time.Hour, 4 * time.Hour}, time.Hour, true},
+		{CompactionWindow{22 * time.Hour, 4 * time.Hour}, 12 * time.Hour, false},
+	} {
+		if got := c.w.contains(day.Add(c.at)); got != c.want {
+			t.Fatalf("%v at %s: expected %v, got %v", c.w, c.at, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// WithConcurrency limits the Client to global requests in flight at once,
+// and to perHost in flight to any one host; 0 means no limit. A request
+// is in flight until its response body is closed, so a burst of
+// goroutines can't exhaust the connection pool or swamp the server.
+// Waiting requests are admitted in the order they arrived, and give up
+// when their context is done.
+func WithConcurrency(global, perHost int) Option {
+	return func(c *Client) {
+		c.concurrency = &concurrencyLimits{perHost: perHost, hosts: map[string]*semaphore{}}
+		if global > 0 {
+			c.concurrency.global = newSemaphore(global)
+		}
+	}
+}
+
+type concurrencyLimits struct {
+	global  *semaphore
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*semaphore
+}
+
+// acquire waits for a slot for req, returning the function releasing it.
+// The host slot is taken first, so requests queued behind a busy host
+// don't hold global slots that requests to other hosts could use.
+func (l *concurrencyLimits) acquire(req *http.Request) (func(), error) {
+	sems := []*semaphore{}
+	if l.perHost > 0 {
+		l.mu.Lock()
+		s, ok := l.hosts[req.URL.Host]
+		if !ok {
+			s = newSemaphore(l.perHost)
+			l.hosts[req.URL.Host] = s
+		}
+		l.mu.Unlock()
+		sems = append(sems, s)
+	}
+	if l.global != nil {
+		sems = append(sems, l.global)
+	}
+	release := func(held []*semaphore) {
+		for _, s := range held {
+			s.release()
+		}
+	}
+	for i, s := range sems {
+		if err := s.acquire(req.Context()); err != nil {
+			release(sems[:i])
+			return nil, err
+		}
+	}
+	once := sync.Once{}
+	return func() { once.Do(func() { release(sems) }) }, nil
+}
+
+// releaseBody calls release when the response body is closed.
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// semaphore admits up to max holders, queuing the rest in FIFO order.
+type semaphore struct {
+	mu      sync.Mutex
+	n, max  int
+	waiters list.List // of chan struct{}
+}
+
+func newSemaphore(max int) *semaphore {
+	return &semaphore{max: max}
+}
+
+func (s *semaphore) acquire(ctx context.Context) error {
+	s.mu.Lock()
+	if s.n < s.max && s.waiters.Len() == 0 {
+		s.n++
+		s.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	e := s.waiters.PushBack(ready)
+	s.mu.Unlock()
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+	}
+	s.mu.Lock()
+	select {
+	case <-ready:
+		// admitted as we gave up: pass the slot on
+		s.mu.Unlock()
+		s.release()
+	default:
+		s.waiters.Remove(e)
+		s.mu.Unlock()
+	}
+	return ctx.Err()
+}
+
+// release frees a slot, handing it straight to the longest waiter.
+func (s *semaphore) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.waiters.Front(); e != nil {
+		s.waiters.Remove(e)
+		close(e.Value.(chan struct{}))
+		return
+	}
+	s.n--
+}
@@ -0,0 +1,82 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSemaphoreFIFO(t *testing.T) {
+	s := newSemaphore(1)
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire: %s", err)
+	}
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			s.acquire(context.Background())
+			order <- i
+			s.release()
+		}(i)
+		// let each waiter queue before the next
+		for {
+			s.mu.Lock()
+			n := s.waiters.Len()
+			s.mu.Unlock()
+			if n == i+1 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	s.release()
+	got := []int{<-order, <-order, <-order}
+	if !reflect.DeepEqual(got, []int{0, 1, 2}) {
+		t.Fatalf("order: expected [0 1 2], got %v", got)
+	}
+}
+
+func TestSemaphoreCancel(t *testing.T) {
+	s := newSemaphore(1)
+	s.acquire(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("acquire: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if s.waiters.Len() != 0 {
+		t.Fatalf("waiters: expected none, got %d", s.waiters.Len())
+	}
+	s.release()
+	if err := s.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release: %s", err)
+	}
+}
+
+func TestWithConcurrency(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	c := NewClient(WithConcurrency(0, 1))
+	body, err := c.getURL(ts.URL + "/db/a")
+	if err != nil {
+		t.Fatalf("first request: %s", err)
+	}
+	// the first response is still open, so the host has no free slot
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.getURLContext(ctx, ts.URL+"/db/b"); err != context.DeadlineExceeded {
+		t.Fatalf("second request: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	body.Close()
+	body, err = c.getURL(ts.URL + "/db/b")
+	if err != nil {
+		t.Fatalf("request after close: %s", err)
+	}
+	body.Close()
+}
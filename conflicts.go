@@ -0,0 +1,151 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ConflictReportOptions configure ConflictReport.
+type ConflictReportOptions struct {
+	// View is a view to read conflicted documents from, like
+	// ConflictsView once EnsureLibraryDesignDoc has installed it; ""
+	// means reading every document from _all_docs.
+	View string
+
+	TypeField string // field which ByType groups documents by; "" means "type"
+
+	// TimeField, if set, is a field holding the time a document was last
+	// written, in RFC 3339 format, eg. "updated_at" as set by
+	// WithTimestamps. Conflicted documents are aged by it.
+	TimeField string
+	Clock     func() time.Time // defaults to time.Now
+
+	PageSize int // rows read at once; 0 means 500
+}
+
+// ConflictReport summarizes the conflicted documents of a database.
+type ConflictReport struct {
+	Scanned    int // documents read
+	Conflicted int // documents with conflicts
+	Conflicts  int // conflicting revisions, over all documents
+
+	ByType map[string]int // conflicted documents by their TypeField
+	// ByAge counts conflicted documents by how long since their winning
+	// revision was written: "hour", "day", "week", "older", or "unknown"
+	// if they have no TimeField.
+	ByAge map[string]int
+
+	Docs []ConflictedDoc // oldest first, those of unknown age last
+}
+
+// ConflictedDoc is a document with conflicting revisions.
+type ConflictedDoc struct {
+	Id        string
+	Rev       string   // the winning revision
+	Conflicts []string // the losing revisions
+	Type      string
+	Updated   time.Time // the TimeField of the winning revision, if any
+}
+
+// conflictAges are the ByAge buckets, with their upper bounds.
+var conflictAges = []struct {
+	name string
+	max  time.Duration
+}{
+	{"hour", time.Hour},
+	{"day", 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+}
+
+// ConflictReport scans the database for documents with conflicting
+// revisions, as bidirectional replication leaves behind when both sides
+// edit a document, and summarizes them. A steady or growing count means
+// conflicts aren't being resolved. Deleted conflicting revisions aren't
+// counted, as CouchDB doesn't list them in _conflicts.
+func (p Database) ConflictReport(ctx context.Context, opts ConflictReportOptions) (ConflictReport, error) {
+	if opts.TypeField == "" {
+		opts.TypeField = "type"
+	}
+	if opts.Clock == nil {
+		opts.Clock = time.Now
+	}
+	if opts.PageSize <= 0 {
+		opts.PageSize = 500
+	}
+	view := opts.View
+	vo := ViewOptions{IncludeDocs: true, Conflicts: true, Limit: opts.PageSize}
+	if view == "" {
+		view = "_all_docs"
+	} else {
+		reduce := false
+		vo.Reduce = &reduce
+	}
+	now := opts.Clock()
+	report := ConflictReport{ByType: map[string]int{}, ByAge: map[string]int{}}
+	for {
+		r := struct {
+			Rows []Row `json:"rows"`
+		}{}
+		if err := p.QueryViewContext(ctx, view, vo, &r); err != nil {
+			return report, err
+		}
+		for _, row := range r.Rows {
+			if len(row.Doc) == 0 || string(row.Doc) == "null" {
+				continue
+			}
+			report.Scanned++
+			d, err := conflictedDoc(row.Doc, opts)
+			if err != nil || len(d.Conflicts) == 0 {
+				continue
+			}
+			report.Conflicted++
+			report.Conflicts += len(d.Conflicts)
+			report.ByType[d.Type]++
+			report.ByAge[conflictAge(d.Updated, now)]++
+			report.Docs = append(report.Docs, d)
+		}
+		if len(r.Rows) < opts.PageSize {
+			break
+		}
+		vo = vo.After(r.Rows[len(r.Rows)-1])
+	}
+	sort.SliceStable(report.Docs, func(i, j int) bool {
+		a, b := report.Docs[i].Updated, report.Docs[j].Updated
+		return !a.IsZero() && (b.IsZero() || a.Before(b))
+	})
+	return report, nil
+}
+
+// conflictedDoc reads what ConflictReport needs from a document.
+func conflictedDoc(raw json.RawMessage, opts ConflictReportOptions) (ConflictedDoc, error) {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return ConflictedDoc{}, err
+	}
+	d := ConflictedDoc{}
+	json.Unmarshal(m["_id"], &d.Id)
+	json.Unmarshal(m["_rev"], &d.Rev)
+	json.Unmarshal(m["_conflicts"], &d.Conflicts)
+	json.Unmarshal(m[opts.TypeField], &d.Type)
+	if opts.TimeField != "" {
+		json.Unmarshal(m[opts.TimeField], &d.Updated)
+	}
+	return d, nil
+}
+
+// conflictAge names the ByAge bucket of a document last written at t.
+func conflictAge(t, now time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	age := now.Sub(t)
+	for _, a := range conflictAges {
+		if age < a.max {
+			return a.name
+		}
+	}
+	return "older"
+}
@@ -0,0 +1,69 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestConflictReport(t *testing.T) {
+	queries := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_all_docs" {
+			t.Errorf("path: got %s", r.URL.Path)
+		}
+		q := r.URL.Query()
+		if q.Get("include_docs") != "true" || q.Get("conflicts") != "true" {
+			t.Errorf("query: got %s", r.URL.RawQuery)
+		}
+		queries = append(queries, q.Get("startkey_docid"))
+		if q.Get("startkey_docid") == "" {
+			fmt.Fprint(w, `{"rows":[
+				{"id":"a","key":"a","doc":{"_id":"a","_rev":"3-a","type":"order","updated_at":"2020-01-01T11:30:00Z","_conflicts":["3-x","2-y"]}},
+				{"id":"b","key":"b","doc":{"_id":"b","_rev":"1-b","type":"order"}}]}`)
+			return
+		}
+		if q.Get("startkey_docid") != "b" || q.Get("skip") != "1" {
+			fmt.Fprint(w, `{"rows":[]}`)
+			return
+		}
+		fmt.Fprint(w, `{"rows":[
+			{"id":"c","key":"c","doc":{"_id":"c","_rev":"2-c","type":"user","updated_at":"2019-12-01T00:00:00Z","_conflicts":["2-z"]}},
+			{"id":"d","key":"d","doc":{"_id":"d","_rev":"5-d","_conflicts":["4-w"]}}]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	report, err := db.ConflictReport(context.Background(), ConflictReportOptions{
+		TimeField: "updated_at",
+		Clock:     func() time.Time { return now },
+		PageSize:  2,
+	})
+	if err != nil {
+		t.Fatalf("failed to report: %s", err)
+	}
+	if !reflect.DeepEqual(queries, []string{"", "b", "d"}) {
+		t.Fatalf("queries: got %v", queries)
+	}
+	if report.Scanned != 4 || report.Conflicted != 3 || report.Conflicts != 4 {
+		t.Fatalf("counts: got %+v", report)
+	}
+	if !reflect.DeepEqual(report.ByType, map[string]int{"order": 1, "user": 1, "": 1}) {
+		t.Fatalf("by type: got %v", report.ByType)
+	}
+	if !reflect.DeepEqual(report.ByAge, map[string]int{"hour": 1, "older": 1, "unknown": 1}) {
+		t.Fatalf("by age: got %v", report.ByAge)
+	}
+	ids := []string{}
+	for _, d := range report.Docs {
+		ids = append(ids, d.Id)
+	}
+	if !reflect.DeepEqual(ids, []string{"c", "a", "d"}) || !reflect.DeepEqual(report.Docs[1].Conflicts, []string{"3-x", "2-y"}) {
+		t.Fatalf("docs: got %+v", report.Docs)
+	}
+}
@@ -0,0 +1,173 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ConsumerOptions configure a Consumer.
+type ConsumerOptions struct {
+	// ChangesOptions select the changes to consume. Since is only used
+	// when the Checkpointer has nothing saved.
+	ChangesOptions
+
+	Checkpointer Checkpointer  // nil means a MemoryCheckpointer
+	PollTimeout  time.Duration // how long each long poll waits for changes; 0 means 1 minute
+	RetryDelay   time.Duration // wait after a failed request; 0 means 1 second
+
+	// DeadLetters, if set, is a database where changes the function keeps
+	// failing on are written, as DeadLetter documents, so that Run can
+	// carry on past them. Without it, Run stops at the first failure.
+	DeadLetters *Database
+	MaxAttempts int // tries at a change before it's dead-lettered, RetryDelay apart; 0 means 3
+
+	// Deduper, if set, records each change once it's handled, and skips
+	// changes it has seen, so side effects aren't repeated when changes
+	// are delivered again.
+	Deduper Deduper
+}
+
+// Consumer follows the changes feed of a database, handing each change to
+// a function and checkpointing its progress. Delivery is at least once:
+// progress is saved after each batch of changes, so a batch interrupted
+// by a crash is delivered again on restart.
+type Consumer struct {
+	db   Database
+	opts ConsumerOptions
+
+	mu    sync.Mutex
+	stats ConsumerStats
+
+	// batchDone is called after each batch, if set; caughtUp is whether
+	// it was the last of the changes the server had.
+	batchDone func(s ConsumerStats, caughtUp bool)
+}
+
+// ConsumerStats describe how well a Consumer is keeping up.
+type ConsumerStats struct {
+	Processed  uint64    // changes handed to the function
+	Pending    int64     // changes left after the last batch, according to the server
+	LastSeq    Seq       // sequence of the last batch completed
+	LastBatch  time.Time // when the last batch completed
+	Reconnects int       // failed requests retried
+	LastError  error     // the error of the last failed request
+
+	DeadLettered uint64 // changes written to DeadLetters
+	Skipped      uint64 // changes the Deduper had seen
+}
+
+// Stats returns a snapshot of the consumer's statistics; it's safe to
+// call while Run is running.
+func (c *Consumer) Stats() ConsumerStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+func (c *Consumer) update(fn func(*ConsumerStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fn(&c.stats)
+}
+
+// NewConsumer returns a Consumer of the database's changes feed.
+func (p Database) NewConsumer(opts ConsumerOptions) *Consumer {
+	if opts.Checkpointer == nil {
+		opts.Checkpointer = &MemoryCheckpointer{}
+	}
+	if opts.PollTimeout <= 0 {
+		opts.PollTimeout = time.Minute
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	return &Consumer{db: p, opts: opts}
+}
+
+// Run consumes changes, long polling for new ones, until ctx is done or
+// fn returns an error, which Run returns; with DeadLetters, only once fn
+// has failed MaxAttempts times and the change couldn't be dead-lettered.
+// Failed requests are retried after RetryDelay; checkpoint errors are
+// returned. If the Client is closed, Run returns ErrClientClosed.
+func (c *Consumer) Run(ctx context.Context, fn func(Change) error) error {
+	ctx, done, err := c.db.client().background(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return closedErr(ctx, c.run(ctx, fn))
+}
+
+func (c *Consumer) run(ctx context.Context, fn func(Change) error) error {
+	since, err := c.opts.Checkpointer.Load()
+	if err != nil {
+		return err
+	}
+	opts := c.opts.ChangesOptions
+	if since != "" {
+		opts.Since = since
+	}
+	extra := url.Values{
+		"feed":    {"longpoll"},
+		"timeout": {strconv.FormatInt(int64(c.opts.PollTimeout/time.Millisecond), 10)},
+	}
+	for {
+		r := ChangesResponse{}
+		if err := c.db.changes(ctx, opts, extra, &r); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.update(func(s *ConsumerStats) {
+				s.Reconnects++
+				s.LastError = err
+			})
+			select {
+			case <-time.After(c.opts.RetryDelay):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		for _, change := range r.Results {
+			if d := c.opts.Deduper; d != nil {
+				if seen, err := d.Seen(change.Id, change.Rev()); err != nil {
+					return err
+				} else if seen {
+					c.update(func(s *ConsumerStats) { s.Skipped++ })
+					continue
+				}
+			}
+			if err := c.handle(ctx, change, fn); err != nil {
+				return err
+			}
+			if d := c.opts.Deduper; d != nil {
+				if err := d.Record(change.Id, change.Rev()); err != nil {
+					return err
+				}
+			}
+			c.update(func(s *ConsumerStats) { s.Processed++ })
+		}
+		if r.LastSeq != "" && r.LastSeq != opts.Since {
+			if err := c.opts.Checkpointer.Save(r.LastSeq); err != nil {
+				return err
+			}
+			opts.Since = r.LastSeq
+		}
+		c.update(func(s *ConsumerStats) {
+			s.Pending, s.LastSeq, s.LastBatch = r.Pending, opts.Since, time.Now()
+		})
+		if c.batchDone != nil {
+			c.batchDone(c.Stats(), opts.Limit <= 0 || len(r.Results) < opts.Limit)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestConsumer(t *testing.T) {
+	sinces := []string{}
+	failed := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("feed") != "longpoll" || q.Get("timeout") != "5000" {
+			t.Errorf("query: got %s", r.URL.RawQuery)
+		}
+		sinces = append(sinces, q.Get("since"))
+		switch q.Get("since") {
+		case "1-a":
+			fmt.Fprint(w, `{"results":[{"seq":"2-b","id":"x","changes":[{"rev":"1-x"}]},{"seq":"3-c","id":"y","changes":[{"rev":"1-y"}]}],"last_seq":"3-c","pending":1}`)
+		case "3-c":
+			if !failed {
+				failed = true
+				w.WriteHeader(500)
+				fmt.Fprint(w, `{"error":"unknown","reason":"transient"}`)
+				return
+			}
+			fmt.Fprint(w, `{"results":[{"seq":"4-d","id":"z","changes":[{"rev":"1-z"}]}],"last_seq":"4-d"}`)
+		default:
+			t.Errorf("unexpected since %q", q.Get("since"))
+			fmt.Fprint(w, `{"results":[{"seq":"4-d","id":"z","changes":[{"rev":"1-z"}]}],"last_seq":"4-d"}`)
+		}
+	}))
+	defer ts.Close()
+	cp := &MemoryCheckpointer{}
+	cp.Save("1-a")
+	c := newTestDatabase(ts).NewConsumer(ConsumerOptions{
+		ChangesOptions: ChangesOptions{Since: "0"},
+		Checkpointer:   cp,
+		PollTimeout:    5 * time.Second,
+		RetryDelay:     time.Millisecond,
+	})
+	ids := []string{}
+	stop := errors.New("stop")
+	err := c.Run(context.Background(), func(ch Change) error {
+		ids = append(ids, ch.Id)
+		if len(ids) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+	if fmt.Sprint(ids) != "[x y z]" {
+		t.Fatalf("ids: got %v", ids)
+	}
+	if fmt.Sprint(sinces) != "[1-a 3-c 3-c]" {
+		t.Fatalf("requests: expected a retry after the failure, got since=%v", sinces)
+	}
+	stats := c.Stats()
+	if stats.Processed != 2 || stats.Reconnects != 1 || stats.LastSeq != "3-c" || stats.Pending != 1 {
+		t.Fatalf("stats: got %+v", stats)
+	}
+	if seq, _ := cp.Load(); seq != "3-c" {
+		t.Fatalf("checkpoint: expected 3-c, got %s", seq)
+	}
+}
@@ -0,0 +1,51 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CORSOptions are the optional parts of a CORS configuration.
+// Empty Methods and Headers leave CouchDB's defaults in place.
+type CORSOptions struct {
+	Credentials bool
+	Methods     []string // eg. GET, PUT, POST, HEAD, DELETE
+	Headers     []string // eg. accept, authorization, content-type, origin
+	MaxAge      int      // seconds; 0 leaves the default
+}
+
+// EnableCORS turns on CORS for the given origins (use "*" for any origin),
+// writing all of the relevant _config keys in one call.
+func (s Server) EnableCORS(origins []string, opts CORSOptions) error {
+	if len(origins) == 0 {
+		return fmt.Errorf("no CORS origins specified")
+	}
+	settings := [][3]string{
+		{"chttpd", "enable_cors", "true"},
+		{"cors", "origins", strings.Join(origins, ", ")},
+		{"cors", "credentials", strconv.FormatBool(opts.Credentials)},
+	}
+	if len(opts.Methods) > 0 {
+		settings = append(settings, [3]string{"cors", "methods", strings.Join(opts.Methods, ", ")})
+	}
+	if len(opts.Headers) > 0 {
+		settings = append(settings, [3]string{"cors", "headers", strings.Join(opts.Headers, ", ")})
+	}
+	if opts.MaxAge > 0 {
+		settings = append(settings, [3]string{"cors", "max_age", strconv.Itoa(opts.MaxAge)})
+	}
+	for _, kv := range settings {
+		if _, err := s.SetConfig(kv[0], kv[1], kv[2]); err != nil {
+			return fmt.Errorf("couldn't set %s/%s: %s", kv[0], kv[1], err)
+		}
+	}
+	return nil
+}
+
+// DisableCORS turns CORS off, leaving the [cors] section intact.
+func (s Server) DisableCORS() error {
+	_, err := s.SetConfig("chttpd", "enable_cors", "false")
+	return err
+}
@@ -0,0 +1,178 @@
+// -*- tab-width: 4 -*-
+
+// Package couchgen generates deterministic synthetic documents, and loads
+// them into CouchDB, for load tests and benchmarks. The same Schema and
+// seed always produce the same documents, so runs can be compared.
+package couchgen
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	couch "github.com/peterbourgon/couch-go"
+)
+
+// Kind is the type of a generated field.
+type Kind int
+
+const (
+	String Kind = iota // Min to Max random letters
+	Text               // Min to Max words
+	Int                // Min to Max
+	Float              // Min to Max
+	Bool
+	Time // RFC 3339, within Max seconds after the Schema's Epoch
+	Enum // one of Values
+)
+
+// Field describes one generated field of a document.
+type Field struct {
+	Name     string
+	Kind     Kind
+	Min, Max int
+	Values   []string // for Enum
+}
+
+// Schema describes the generated documents.
+type Schema struct {
+	IDPrefix string // ids are IDPrefix followed by the document's index, zero-padded
+	Fields   []Field
+
+	// Attachments is the number of inline attachments each document
+	// gets, of AttachmentSize random bytes each.
+	Attachments    int
+	AttachmentSize int
+
+	// Pad adds a "padding" field of this many bytes, to reach a target
+	// document size.
+	Pad int
+
+	Epoch time.Time // the base of Time fields; zero means 2020-01-01 UTC
+}
+
+// Generator produces the documents of a Schema. Each document depends only
+// on the seed and its index, so documents can be generated in any order,
+// or in parallel.
+type Generator struct {
+	schema Schema
+	seed   int64
+}
+
+// New returns a Generator of documents of schema, from seed.
+func New(schema Schema, seed int64) *Generator {
+	if schema.Epoch.IsZero() {
+		schema.Epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return &Generator{schema: schema, seed: seed}
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz"
+
+var words = strings.Fields(`lorem ipsum dolor sit amet consectetur adipiscing elit sed do
+	eiusmod tempor incididunt ut labore et dolore magna aliqua enim ad minim veniam quis
+	nostrud exercitation ullamco laboris nisi aliquip ex ea commodo consequat`)
+
+// Doc returns the document with index i.
+func (g *Generator) Doc(i int) map[string]interface{} {
+	rng := rand.New(rand.NewSource(g.seed*1000003 + int64(i)))
+	doc := map[string]interface{}{"_id": fmt.Sprintf("%s%08d", g.schema.IDPrefix, i)}
+	for _, f := range g.schema.Fields {
+		doc[f.Name] = g.value(rng, f)
+	}
+	if g.schema.Pad > 0 {
+		doc["padding"] = randomString(rng, g.schema.Pad)
+	}
+	if g.schema.Attachments > 0 {
+		attachments := map[string]interface{}{}
+		for a := 0; a < g.schema.Attachments; a++ {
+			b := make([]byte, g.schema.AttachmentSize)
+			rng.Read(b)
+			attachments[fmt.Sprintf("blob%d", a)] = map[string]string{
+				"content_type": "application/octet-stream",
+				"data":         base64.StdEncoding.EncodeToString(b),
+			}
+		}
+		doc["_attachments"] = attachments
+	}
+	return doc
+}
+
+func (g *Generator) value(rng *rand.Rand, f Field) interface{} {
+	between := func() int {
+		if f.Max <= f.Min {
+			return f.Min
+		}
+		return f.Min + rng.Intn(f.Max-f.Min+1)
+	}
+	switch f.Kind {
+	case String:
+		return randomString(rng, between())
+	case Text:
+		n := between()
+		w := make([]string, n)
+		for i := range w {
+			w[i] = words[rng.Intn(len(words))]
+		}
+		return strings.Join(w, " ")
+	case Int:
+		return between()
+	case Float:
+		return float64(f.Min) + rng.Float64()*float64(f.Max-f.Min)
+	case Bool:
+		return rng.Intn(2) == 1
+	case Time:
+		secs := 0
+		if f.Max > 0 {
+			secs = rng.Intn(f.Max)
+		}
+		return g.schema.Epoch.Add(time.Duration(secs) * time.Second).Format(time.RFC3339)
+	case Enum:
+		if len(f.Values) == 0 {
+			return nil
+		}
+		return f.Values[rng.Intn(len(f.Values))]
+	}
+	return nil
+}
+
+func randomString(rng *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rng.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+// Load writes the documents with indexes from up to but not including to
+// into db with BulkWrite, batchSize at a time (0 means 500), and returns
+// how many were written. Failures, eg. conflicts with documents loaded
+// before, are returned as a *couch.BulkError.
+func (g *Generator) Load(db couch.Database, from, to, batchSize int) (int, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	written := 0
+	for start := from; start < to; start += batchSize {
+		end := start + batchSize
+		if end > to {
+			end = to
+		}
+		docs := make([]interface{}, 0, end-start)
+		for i := start; i < end; i++ {
+			docs = append(docs, g.Doc(i))
+		}
+		results, err := db.BulkWrite(docs, couch.BulkWriteOptions{})
+		for _, r := range results {
+			if r.Error == "" && r.ID != "" {
+				written++
+			}
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,80 @@
+// -*- tab-width: 4 -*-
+package couchgen
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	couch "github.com/peterbourgon/couch-go"
+)
+
+var testSchema = Schema{
+	IDPrefix: "user:",
+	Fields: []Field{
+		{Name: "name", Kind: String, Min: 5, Max: 10},
+		{Name: "bio", Kind: Text, Min: 3, Max: 6},
+		{Name: "age", Kind: Int, Min: 18, Max: 90},
+		{Name: "score", Kind: Float, Min: 0, Max: 1},
+		{Name: "active", Kind: Bool},
+		{Name: "joined", Kind: Time, Max: 86400 * 365},
+		{Name: "plan", Kind: Enum, Values: []string{"free", "pro"}},
+	},
+	Attachments:    1,
+	AttachmentSize: 16,
+	Pad:            32,
+}
+
+func TestDeterministic(t *testing.T) {
+	a, b := New(testSchema, 42), New(testSchema, 42)
+	if !reflect.DeepEqual(a.Doc(7), b.Doc(7)) {
+		t.Fatalf("same seed: documents differ")
+	}
+	if reflect.DeepEqual(a.Doc(7), a.Doc(8)) || reflect.DeepEqual(a.Doc(7), New(testSchema, 43).Doc(7)) {
+		t.Fatalf("documents should differ by index and seed")
+	}
+	doc := a.Doc(7)
+	if doc["_id"] != "user:00000007" {
+		t.Fatalf("id: got %v", doc["_id"])
+	}
+	if name := doc["name"].(string); len(name) < 5 || len(name) > 10 {
+		t.Fatalf("name: got %q", name)
+	}
+	if age := doc["age"].(int); age < 18 || age > 90 {
+		t.Fatalf("age: got %d", age)
+	}
+	if len(doc["padding"].(string)) != 32 {
+		t.Fatalf("padding: got %d bytes", len(doc["padding"].(string)))
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	batches := []int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		in := struct{ Docs []map[string]interface{} }{}
+		json.NewDecoder(r.Body).Decode(&in)
+		batches = append(batches, len(in.Docs))
+		results := []couch.WriteResult{}
+		for _, d := range in.Docs {
+			results = append(results, couch.WriteResult{OK: true, ID: d["_id"].(string), Rev: "1-x"})
+		}
+		json.NewEncoder(w).Encode(results)
+	}))
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	db := couch.Database{Host: host, Port: port, Name: "db"}
+	n, err := New(testSchema, 1).Load(db, 0, 25, 10)
+	if err != nil {
+		t.Fatalf("failed to load: %s", err)
+	}
+	if n != 25 || fmt.Sprint(batches) != "[10 10 5]" {
+		t.Fatalf("loaded %d in batches %v", n, batches)
+	}
+}
@@ -0,0 +1,68 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// The design document which EnsureLibraryDesignDoc installs, and the
+// functions in it.
+const (
+	LibraryDesignDoc = "_design/couchgo"
+
+	// ConflictsView has a row for each document with conflicting
+	// revisions, keyed by id, with the number of them as the value. Use
+	// it as ConflictReportOptions.View.
+	ConflictsView = LibraryDesignDoc + "/_view/conflicts"
+
+	// ExpiryView has a row for each document with an "expires_at" field,
+	// keyed by it; with RFC 3339 times, those which have expired are the
+	// rows up to the current time.
+	ExpiryView = LibraryDesignDoc + "/_view/expiry"
+
+	// LiveFilter is a _changes filter passing only documents which
+	// aren't soft-deleted, ie. which have no "deleted_at" field.
+	LiveFilter = "couchgo/live"
+)
+
+// libraryDesignVersion is stored in the design document as
+// couchgo_version. Bump it whenever the design document changes.
+const libraryDesignVersion = 1
+
+// libraryDesignDoc returns the design document installed by
+// EnsureLibraryDesignDoc.
+func libraryDesignDoc() DesignDoc {
+	return DesignDoc{
+		Id:       LibraryDesignDoc,
+		Language: LanguageJavaScript,
+		Views: map[string]View{
+			"conflicts": {Map: `function(doc) { if (doc._conflicts) { emit(doc._id, doc._conflicts.length); } }`},
+			"expiry":    {Map: `function(doc) { if (doc.expires_at) { emit(doc.expires_at, null); } }`},
+		},
+		Other: map[string]json.RawMessage{
+			"filters": mustJSON(map[string]string{
+				"live": `function(doc, req) { return !doc.deleted_at; }`,
+			}),
+			"couchgo_version": json.RawMessage(strconv.Itoa(libraryDesignVersion)),
+		},
+	}
+}
+
+// EnsureLibraryDesignDoc installs the views and filters this package's
+// helpers can make use of, in the design document _design/couchgo, and
+// returns its revision. It's idempotent: nothing is written if the
+// design document is already current, or if it was installed by a newer
+// version of this package.
+func (p Database) EnsureLibraryDesignDoc() (string, error) {
+	existing, err := p.RetrieveDesignDoc(LibraryDesignDoc)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	version := 0
+	json.Unmarshal(existing.Other["couchgo_version"], &version)
+	if version > libraryDesignVersion {
+		return existing.Rev, nil
+	}
+	return p.PutDesignDoc(libraryDesignDoc())
+}
@@ -0,0 +1,60 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEnsureLibraryDesignDoc(t *testing.T) {
+	stored, writes := "", 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_design/couchgo" {
+			t.Errorf("path: got %s", r.URL.Path)
+		}
+		switch r.Method {
+		case "GET":
+			if stored == "" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+				return
+			}
+			fmt.Fprint(w, stored)
+		case "PUT":
+			writes++
+			b, _ := ioutil.ReadAll(r.Body)
+			m := map[string]interface{}{}
+			json.Unmarshal(b, &m)
+			m["_rev"] = fmt.Sprintf("%d-c", writes)
+			b, _ = json.Marshal(m)
+			stored = string(b)
+			fmt.Fprintf(w, `{"ok":true,"id":"_design/couchgo","rev":"%d-c"}`, writes)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	for i := 0; i < 2; i++ {
+		rev, err := db.EnsureLibraryDesignDoc()
+		if err != nil {
+			t.Fatalf("failed to install: %s", err)
+		}
+		if rev != "1-c" || writes != 1 {
+			t.Fatalf("install %d: expected 1-c after 1 write, got %s after %d", i, rev, writes)
+		}
+	}
+	dd := DesignDoc{}
+	json.Unmarshal([]byte(stored), &dd)
+	if dd.Views["conflicts"].Map == "" || dd.Views["expiry"].Map == "" || len(dd.Other["filters"]) == 0 {
+		t.Fatalf("design doc: got %s", stored)
+	}
+
+	// a newer version is left alone
+	stored = `{"_id":"_design/couchgo","_rev":"7-c","couchgo_version":99,"views":{}}`
+	if rev, err := db.EnsureLibraryDesignDoc(); err != nil || rev != "7-c" || writes != 1 {
+		t.Fatalf("newer: expected 7-c without a write, got %s, %v after %d writes", rev, err, writes)
+	}
+}
@@ -0,0 +1,98 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// CountDocs returns the number of documents in the database, including
+// design documents but not deleted ones, from the database info.
+func (p Database) CountDocs() (int64, error) {
+	di, err := p.Info()
+	if err != nil {
+		return 0, err
+	}
+	return di.DocCount, nil
+}
+
+// CountByView returns the number of rows the view has for key, or in all
+// if key is nil. Views whose reduce function is _count are counted by
+// reducing; others by reading total_rows or, with a key, the rows.
+func (p Database) CountByView(view string, key interface{}) (int64, error) {
+	opts := ViewOptions{Key: key}
+	if p.countReduced(view) {
+		r := struct {
+			Rows []struct {
+				Value int64 `json:"value"`
+			} `json:"rows"`
+		}{}
+		if err := p.QueryView(view, opts, &r); err != nil {
+			return 0, err
+		}
+		if len(r.Rows) == 0 {
+			return 0, nil
+		}
+		return r.Rows[0].Value, nil
+	}
+	if view != "_all_docs" {
+		noReduce := false
+		opts.Reduce = &noReduce
+	}
+	if key == nil {
+		r := struct {
+			TotalRows int64 `json:"total_rows"`
+		}{}
+		opts.Limit = 1
+		if err := p.QueryView(view, opts, &r); err != nil {
+			return 0, err
+		}
+		return r.TotalRows, nil
+	}
+	v, err := opts.Values()
+	if err != nil {
+		return 0, err
+	}
+	n := int64(0)
+	err = p.streamField(context.Background(), view, v.Encode(), "rows", func(json.RawMessage) error {
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// countReduced reports whether view is "_design/{ddoc}/_view/{name}" with
+// a _count reduce function.
+func (p Database) countReduced(view string) bool {
+	parts := strings.Split(view, "/")
+	if len(parts) != 4 || parts[0] != "_design" || parts[2] != "_view" {
+		return false
+	}
+	dd, err := p.RetrieveDesignDoc(parts[0] + "/" + parts[1])
+	if err != nil {
+		return false
+	}
+	return dd.Views[parts[3]].Reduce == "_count"
+}
+
+// countFindPage is how many ids CountFind reads at once.
+const countFindPage = 1000
+
+// CountFind returns the number of documents matching the Mango selector.
+// Mango has no count, so the ids of the matches are paged through.
+func (p Database) CountFind(selector interface{}) (int64, error) {
+	opts := FindOptions{Fields: []string{"_id"}, Limit: countFindPage}
+	n := int64(0)
+	for {
+		r, err := p.Find(selector, opts)
+		if err != nil {
+			return 0, err
+		}
+		n += int64(len(r.Docs))
+		if len(r.Docs) < countFindPage || r.Bookmark == "" || r.Bookmark == opts.Bookmark {
+			return n, nil
+		}
+		opts.Bookmark = r.Bookmark
+	}
+}
@@ -0,0 +1,94 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCountDocs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"db_name":"db","doc_count":42,"doc_del_count":3,"update_seq":"57-g1AAAA","sizes":{"active":100,"external":200,"file":300}}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	n, err := db.CountDocs()
+	if err != nil || n != 42 {
+		t.Fatalf("count: expected 42, got %d, %v", n, err)
+	}
+	di, err := db.Info()
+	if err != nil || di.UpdateSeq != "57-g1AAAA" || di.Sizes.File != 300 {
+		t.Fatalf("info: got %+v, %v", di, err)
+	}
+}
+
+func TestCountByView(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/db/_design/app":
+			fmt.Fprint(w, `{"_id":"_design/app","views":{"counted":{"map":"function(doc){emit(doc.type)}","reduce":"_count"},"plain":{"map":"function(doc){emit(doc.type)}"}}}`)
+		case "/db/_design/app/_view/counted":
+			if q.Get("key") == `"none"` {
+				fmt.Fprint(w, `{"rows":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"rows":[{"key":null,"value":7}]}`)
+		case "/db/_design/app/_view/plain":
+			if q.Get("reduce") != "false" {
+				t.Errorf("plain view queried with %s", r.URL.RawQuery)
+			}
+			if q.Get("key") != "" {
+				fmt.Fprint(w, `{"total_rows":10,"offset":2,"rows":[{"id":"a","key":"user","value":null},{"id":"b","key":"user","value":null}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"total_rows":10,"offset":0,"rows":[{"id":"a","key":"user","value":null}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	for _, test := range []struct {
+		view     string
+		key      interface{}
+		expected int64
+	}{
+		{"_design/app/_view/counted", "user", 7},
+		{"_design/app/_view/counted", "none", 0},
+		{"_design/app/_view/plain", nil, 10},
+		{"_design/app/_view/plain", "user", 2},
+	} {
+		n, err := db.CountByView(test.view, test.key)
+		if err != nil || n != test.expected {
+			t.Fatalf("%s %v: expected %d, got %d, %v", test.view, test.key, test.expected, n, err)
+		}
+	}
+}
+
+func TestCountFind(t *testing.T) {
+	pages := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		if pages == 1 {
+			fmt.Fprint(w, `{"docs":[`)
+			for i := 0; i < countFindPage; i++ {
+				if i > 0 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"_id":"%d"}`, i)
+			}
+			fmt.Fprint(w, `],"bookmark":"g1"}`)
+			return
+		}
+		fmt.Fprint(w, `{"docs":[{"_id":"x"}],"bookmark":"g2"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	n, err := db.CountFind(map[string]interface{}{"type": "user"})
+	if err != nil || n != countFindPage+1 || pages != 2 {
+		t.Fatalf("count: expected %d in 2 pages, got %d in %d, %v", countFindPage+1, n, pages, err)
+	}
+}
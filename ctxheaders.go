@@ -0,0 +1,39 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+)
+
+// WithContextHeader sets header key on every request to the value fn
+// extracts from the request's context, eg. a tenant or user ID, or trace
+// baggage, so that CouchDB's access logs and any proxies in between can
+// attribute the traffic. Nothing is set when fn returns false, or if the
+// request sets the header itself. Extractors are applied in the order
+// they're given, after any WithHeader headers, which they override.
+func WithContextHeader(key string, fn func(ctx context.Context) (string, bool)) Option {
+	return func(c *Client) {
+		headers := make([]contextHeader, len(c.contextHeaders), len(c.contextHeaders)+1)
+		copy(headers, c.contextHeaders)
+		c.contextHeaders = append(headers, contextHeader{http.CanonicalHeaderKey(key), fn})
+	}
+}
+
+type contextHeader struct {
+	key string
+	fn  func(ctx context.Context) (string, bool)
+}
+
+// setContextHeaders adds the headers extracted from req's context, except
+// those in set, the headers req had to begin with.
+func (c *Client) setContextHeaders(req *http.Request, set http.Header) {
+	for _, h := range c.contextHeaders {
+		if _, ok := set[h.key]; ok {
+			continue
+		}
+		if v, ok := h.fn(req.Context()); ok {
+			req.Header.Set(h.key, v)
+		}
+	}
+}
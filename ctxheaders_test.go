@@ -0,0 +1,57 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type tenantKey struct{}
+
+func TestContextHeaders(t *testing.T) {
+	seen := http.Header{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	tenant := func(ctx context.Context) (string, bool) {
+		id, ok := ctx.Value(tenantKey{}).(string)
+		return id, ok
+	}
+	c := NewClient(WithHeader("X-Tenant", "none"), WithContextHeader("x-tenant", tenant))
+	out := map[string]interface{}{}
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	if err := c.unmarshalURLContext(ctx, ts.URL+"/db/doc", &out); err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	if got := seen["X-Tenant"]; len(got) != 1 || got[0] != "acme" {
+		t.Fatalf("header: expected [acme], got %v", got)
+	}
+	if err := c.unmarshalURLContext(context.Background(), ts.URL+"/db/doc", &out); err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	if got := seen.Get("X-Tenant"); got != "none" {
+		t.Fatalf("header without a tenant: expected none, got %s", got)
+	}
+	if _, err := c.interactContext(ctx, "PUT", ts.URL+"/db/doc", map[string][]string{"X-Tenant": {"own"}}, []byte(`{}`), &out); err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	if got := seen.Get("X-Tenant"); got != "own" {
+		t.Fatalf("header set by the request: expected own, got %s", got)
+	}
+
+	user := c.With(WithContextHeader("X-User", func(context.Context) (string, bool) { return "bob", true }))
+	if err := user.unmarshalURLContext(ctx, ts.URL+"/db/doc", &out); err != nil {
+		t.Fatalf("request: %s", err)
+	}
+	if seen.Get("X-Tenant") != "acme" || seen.Get("X-User") != "bob" {
+		t.Fatalf("clone headers: got %v", seen)
+	}
+	if len(c.contextHeaders) != 1 {
+		t.Fatalf("clone changed the original's extractors")
+	}
+}
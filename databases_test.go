@@ -0,0 +1,77 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDatabases(t *testing.T) {
+	exists := map[string]bool{"/users": true}
+	requests := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		switch {
+		case r.Method == "PUT":
+			exists[r.URL.Path] = true
+			fmt.Fprint(w, `{"ok":true}`)
+		case exists[r.URL.Path]:
+			fmt.Fprintf(w, `{"db_name":"%s","source":"%s"}`, r.URL.Path[1:], r.Header.Get("X-Source"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not_found","reason":"Database does not exist."}`)
+		}
+	}))
+	defer ts.Close()
+	c := NewClient()
+	dbs := c.Databases()
+	if dbs != c.Databases() {
+		t.Fatalf("expected the same registry every time")
+	}
+	if err := dbs.Register("users", DatabaseSpec{URL: ts.URL + "/users", Options: []Option{WithHeader("X-Source", "batch")}}); err != nil {
+		t.Fatalf("failed to register: %s", err)
+	}
+	if err := dbs.Register("orders", DatabaseSpec{URL: ts.URL + "/orders", Create: CreateDBOptions{Q: 2}}); err != nil {
+		t.Fatalf("failed to register: %s", err)
+	}
+	if err := dbs.Register("archive", DatabaseSpec{URL: ts.URL + "/archive", NoCreate: true}); err != nil {
+		t.Fatalf("failed to register: %s", err)
+	}
+	if err := dbs.Register("bad", DatabaseSpec{URL: "ftp://localhost/x"}); err == nil {
+		t.Fatalf("expected error for bad URL")
+	}
+	if len(requests) != 0 {
+		t.Fatalf("expected registration to be lazy, got %v", requests)
+	}
+	if !reflect.DeepEqual(dbs.Names(), []string{"archive", "orders", "users"}) {
+		t.Fatalf("names: got %v", dbs.Names())
+	}
+
+	users, err := dbs.Get("users")
+	if err != nil {
+		t.Fatalf("failed to get users: %s", err)
+	}
+	info := map[string]string{}
+	if err := users.unmarshalURL(users.DBURL(), &info); err != nil || info["source"] != "batch" {
+		t.Fatalf("expected per-database options, got %v, %v", info, err)
+	}
+	if _, err := dbs.Get("orders"); err != nil {
+		t.Fatalf("failed to get orders: %s", err)
+	}
+	if _, err := dbs.Get("orders"); err != nil {
+		t.Fatalf("failed to get orders again: %s", err)
+	}
+	expected := []string{"GET /users", "GET /users", "GET /orders", "PUT /orders?q=2"}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("requests: expected %v, got %v", expected, requests)
+	}
+	if _, err := dbs.Get("archive"); err == nil {
+		t.Fatalf("expected error for missing database with NoCreate")
+	}
+	if _, err := dbs.Get("nope"); err == nil {
+		t.Fatalf("expected error for unregistered name")
+	}
+}
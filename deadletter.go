@@ -0,0 +1,123 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DeadLetter is a change which a Consumer's function kept failing on, as
+// stored in its DeadLetters database.
+type DeadLetter struct {
+	Id  string `json:"_id,omitempty"`
+	Rev string `json:"_rev,omitempty"`
+
+	Database string          `json:"database"` // the database whose change this is
+	Seq      Seq             `json:"seq"`
+	DocId    string          `json:"doc_id"`
+	Revs     []string        `json:"revs,omitempty"`
+	Deleted  bool            `json:"deleted,omitempty"`
+	Doc      json.RawMessage `json:"doc,omitempty"` // with IncludeDocs
+	Error    string          `json:"error"`         // the last failure
+	Attempts int             `json:"attempts"`
+	FailedAt time.Time       `json:"failed_at"`
+}
+
+// Change returns the change as it was given to the function.
+func (d DeadLetter) Change() Change {
+	return Change{Seq: d.Seq, Id: d.DocId, Deleted: d.Deleted, Revs: d.Revs, Doc: d.Doc}
+}
+
+// handle gives change to fn, trying again and then dead-lettering it if
+// the Consumer has DeadLetters.
+func (c *Consumer) handle(ctx context.Context, change Change, fn func(Change) error) error {
+	err := fn(change)
+	if err == nil || c.opts.DeadLetters == nil {
+		return err
+	}
+	attempts := 1
+	for ; attempts < c.opts.MaxAttempts; attempts++ {
+		select {
+		case <-time.After(c.opts.RetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if err = fn(change); err == nil {
+			return nil
+		}
+	}
+	d := DeadLetter{
+		Database: c.db.Name,
+		Seq:      change.Seq,
+		DocId:    change.Id,
+		Revs:     change.Revs,
+		Deleted:  change.Deleted,
+		Doc:      change.Doc,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	if _, _, derr := c.opts.DeadLetters.Insert(d); derr != nil {
+		return fmt.Errorf("dead-lettering %s after %s: %w", change.Id, err, derr)
+	}
+	c.update(func(s *ConsumerStats) { s.DeadLettered++ })
+	return nil
+}
+
+// DeadLetters lists the consumer's dead letters, oldest first.
+func (c *Consumer) DeadLetters() ([]DeadLetter, error) {
+	if c.opts.DeadLetters == nil {
+		return nil, fmt.Errorf("consumer has no dead letters database")
+	}
+	r := struct {
+		Rows []struct {
+			Doc json.RawMessage `json:"doc"`
+		} `json:"rows"`
+	}{}
+	if err := c.opts.DeadLetters.QueryView("_all_docs", ViewOptions{IncludeDocs: true}, &r); err != nil {
+		return nil, err
+	}
+	letters := []DeadLetter{}
+	for _, row := range r.Rows {
+		d := DeadLetter{}
+		if len(row.Doc) == 0 || json.Unmarshal(row.Doc, &d) != nil || d.Database != c.db.Name {
+			continue
+		}
+		letters = append(letters, d)
+	}
+	sort.SliceStable(letters, func(i, j int) bool { return letters[i].FailedAt.Before(letters[j].FailedAt) })
+	return letters, nil
+}
+
+// Reprocess gives each of the consumer's dead letters to fn again, once,
+// eg. after the bug which made them fail is fixed. Those fn handles are
+// deleted; the rest are kept with the new error. It returns how many
+// were handled.
+func (c *Consumer) Reprocess(ctx context.Context, fn func(Change) error) (int, error) {
+	letters, err := c.DeadLetters()
+	if err != nil {
+		return 0, err
+	}
+	handled := 0
+	for _, d := range letters {
+		if err := ctx.Err(); err != nil {
+			return handled, err
+		}
+		if ferr := fn(d.Change()); ferr != nil {
+			d.Error, d.FailedAt = ferr.Error(), time.Now().UTC()
+			d.Attempts++
+			if _, err := c.opts.DeadLetters.Edit(d); err != nil {
+				return handled, err
+			}
+			continue
+		}
+		if err := c.opts.DeadLetters.Delete(d.Id, d.Rev); err != nil {
+			return handled, err
+		}
+		handled++
+	}
+	return handled, nil
+}
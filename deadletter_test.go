@@ -0,0 +1,91 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeadLetters(t *testing.T) {
+	feed := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"results":[
+			{"seq":"2-b","id":"x","changes":[{"rev":"1-x"}]},
+			{"seq":"3-c","id":"poison","changes":[{"rev":"1-p"}],"doc":{"_id":"poison","_rev":"1-p"}},
+			{"seq":"4-d","id":"z","changes":[{"rev":"1-z"}]}],"last_seq":"4-d"}`)
+	}))
+	defer feed.Close()
+	letters := map[string]string{}
+	deleted := []string{}
+	dlq := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/dlq":
+			d := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&d)
+			d["_id"], d["_rev"] = "dl1", "1-d"
+			b, _ := json.Marshal(d)
+			letters["dl1"] = string(b)
+			fmt.Fprint(w, `{"ok":true,"id":"dl1","rev":"1-d"}`)
+		case r.Method == "GET" && r.URL.Path == "/dlq/_all_docs":
+			fmt.Fprintf(w, `{"rows":[{"id":"dl1","doc":%s},{"id":"other","doc":{"_id":"other","database":"elsewhere"}}]}`, letters["dl1"])
+		case r.Method == "DELETE":
+			deleted = append(deleted, r.URL.Path+" "+r.Header.Get("If-Match"))
+			fmt.Fprint(w, `{"ok":true,"id":"dl1","rev":"2-d"}`)
+		default:
+			t.Errorf("request: got %s %s", r.Method, r.URL)
+		}
+	}))
+	defer dlq.Close()
+	dlqDB := newTestDatabase(dlq)
+	dlqDB.Name = "dlq"
+	c := newTestDatabase(feed).NewConsumer(ConsumerOptions{
+		RetryDelay:  time.Millisecond,
+		DeadLetters: &dlqDB,
+		MaxAttempts: 2,
+	})
+	attempts := map[string]int{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err := c.Run(ctx, func(ch Change) error {
+		attempts[ch.Id]++
+		switch ch.Id {
+		case "poison":
+			return errors.New("can't handle it")
+		case "z":
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("run: expected to carry on to z, got %v", err)
+	}
+	if attempts["x"] != 1 || attempts["poison"] != 2 || attempts["z"] != 1 {
+		t.Fatalf("attempts: got %v", attempts)
+	}
+	if c.Stats().DeadLettered != 1 {
+		t.Fatalf("stats: got %+v", c.Stats())
+	}
+
+	dead, err := c.DeadLetters()
+	if err != nil {
+		t.Fatalf("failed to list: %s", err)
+	}
+	if len(dead) != 1 || dead[0].DocId != "poison" || dead[0].Seq != "3-c" || dead[0].Error != "can't handle it" || dead[0].Attempts != 2 {
+		t.Fatalf("dead letters: got %+v", dead)
+	}
+	if ch := dead[0].Change(); ch.Rev() != "1-p" || string(ch.Doc) != `{"_id":"poison","_rev":"1-p"}` {
+		t.Fatalf("change: got %+v", ch)
+	}
+	n, err := c.Reprocess(context.Background(), func(ch Change) error { return nil })
+	if err != nil || n != 1 {
+		t.Fatalf("reprocess: expected 1, got %d, %v", n, err)
+	}
+	if fmt.Sprint(deleted) != "[/dlq/dl1 1-d]" {
+		t.Fatalf("deleted: got %v", deleted)
+	}
+}
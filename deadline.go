@@ -0,0 +1,51 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// QueryOptions control how long a query may run, as opposed to the view
+// options which control what it returns. When both Timeout and Deadline
+// are set, whichever expires first applies.
+type QueryOptions struct {
+	Timeout  time.Duration // relative to the start of the query; 0 means none
+	Deadline time.Time     // absolute; the zero time means none
+}
+
+// context derives a context from parent bounded by the options.
+func (o QueryOptions) context(parent context.Context) (context.Context, context.CancelFunc) {
+	deadline := o.Deadline
+	if o.Timeout > 0 {
+		if d := time.Now().Add(o.Timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	if deadline.IsZero() {
+		return context.WithCancel(parent)
+	}
+	return context.WithDeadline(parent, deadline)
+}
+
+// QueryWithOptions is Query, but abandons the request once the limits in
+// qo are reached, so a pathological view can't hold the caller forever.
+// Views have no server-side timeout; for _changes queries, which do, the
+// remaining time is also passed as the "timeout" parameter (in ms) unless
+// options already has one.
+func (p Database) QueryWithOptions(view string, options map[string]interface{}, qo QueryOptions, results interface{}) error {
+	ctx, cancel := qo.context(context.Background())
+	defer cancel()
+	if deadline, ok := ctx.Deadline(); ok && strings.HasSuffix(view, "_changes") {
+		if _, ok := options["timeout"]; !ok {
+			withTimeout := map[string]interface{}{}
+			for k, v := range options {
+				withTimeout[k] = v
+			}
+			withTimeout["timeout"] = int(time.Until(deadline) / time.Millisecond)
+			options = withTimeout
+		}
+	}
+	return p.QueryContext(ctx, view, options, results)
+}
@@ -0,0 +1,47 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQueryOptionsContext(t *testing.T) {
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancel := QueryOptions{Timeout: time.Minute, Deadline: deadline}.context(context.Background())
+	defer cancel()
+	d, ok := ctx.Deadline()
+	if !ok || !d.Before(deadline) {
+		t.Fatalf("expected the earlier timeout to win, got %v", d)
+	}
+	ctx, cancel = QueryOptions{}.context(context.Background())
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Fatalf("expected no deadline for zero options")
+	}
+}
+
+func TestQueryWithOptionsTimeout(t *testing.T) {
+	release := make(chan struct{})
+	timeouts := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeouts <- r.URL.Query().Get("timeout")
+		<-release
+		fmt.Fprint(w, `{}`)
+	}))
+	defer ts.Close()
+	defer close(release)
+	db := newTestDatabase(ts)
+	err := db.QueryWithOptions("_changes", map[string]interface{}{}, QueryOptions{Timeout: 50 * time.Millisecond}, &struct{}{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if timeout := <-timeouts; timeout == "" {
+		t.Fatalf("expected server-side timeout parameter on _changes")
+	}
+}
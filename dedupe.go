@@ -0,0 +1,159 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// Deduper remembers which revisions of documents a Consumer has
+// processed, so that changes delivered again, after a reconnect or a
+// restart from an older checkpoint, are skipped. A change is skipped if
+// its document's winning revision was processed; a later revision of the
+// same document is new.
+type Deduper interface {
+	Seen(id, rev string) (bool, error)
+	Record(id, rev string) error
+}
+
+// defaultKeepProcessed is how many documents a Deduper remembers by
+// default.
+const defaultKeepProcessed = 1000
+
+// processedSet holds the latest processed revision of up to keep
+// documents, forgetting the least recently processed first.
+type processedSet struct {
+	keep  int
+	revs  map[string]string
+	order []string // ids, least recently processed first
+}
+
+func newProcessedSet(keep int) *processedSet {
+	if keep <= 0 {
+		keep = defaultKeepProcessed
+	}
+	return &processedSet{keep: keep, revs: map[string]string{}}
+}
+
+func (s *processedSet) seen(id, rev string) bool {
+	r, ok := s.revs[id]
+	return ok && r == rev
+}
+
+func (s *processedSet) record(id, rev string) {
+	if _, ok := s.revs[id]; ok {
+		for i, o := range s.order {
+			if o == id {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+	}
+	s.revs[id] = rev
+	s.order = append(s.order, id)
+	for len(s.order) > s.keep {
+		delete(s.revs, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// MemoryDeduper remembers processed revisions in memory, so only changes
+// delivered again within one process are skipped. Keep is how many
+// documents it remembers; 0 means 1000.
+type MemoryDeduper struct {
+	Keep int
+
+	mu  sync.Mutex
+	set *processedSet
+}
+
+func (m *MemoryDeduper) Seen(id, rev string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.set != nil && m.set.seen(id, rev), nil
+}
+
+func (m *MemoryDeduper) Record(id, rev string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.set == nil {
+		m.set = newProcessedSet(m.Keep)
+	}
+	m.set.record(id, rev)
+	return nil
+}
+
+// LocalDeduper remembers processed revisions in the _local document Id
+// (without the "_local/" prefix) of DB, which may be the database being
+// consumed or a side database. The document is rewritten on every
+// Record, and holds only the last Keep documents processed (0 means
+// 1000), so it stays small.
+type LocalDeduper struct {
+	DB   Database
+	Id   string
+	Keep int
+
+	mu  sync.Mutex
+	rev string
+	set *processedSet
+}
+
+type localProcessed struct {
+	Rev       string      `json:"_rev,omitempty"`
+	Processed [][2]string `json:"processed"` // [id, rev], least recently processed first
+}
+
+func (l *LocalDeduper) url() string {
+	return fmt.Sprintf("%s/_local/%s", l.DB.DBURL(), url.PathEscape(l.Id))
+}
+
+// load reads the document the first time it's needed.
+func (l *LocalDeduper) load() error {
+	if l.set != nil {
+		return nil
+	}
+	doc := localProcessed{}
+	if err := l.DB.unmarshalURL(l.url(), &doc); err != nil && !isNotFound(err) {
+		return err
+	}
+	l.rev = doc.Rev
+	l.set = newProcessedSet(l.Keep)
+	for _, p := range doc.Processed {
+		l.set.record(p[0], p[1])
+	}
+	return nil
+}
+
+func (l *LocalDeduper) Seen(id, rev string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return false, err
+	}
+	return l.set.seen(id, rev), nil
+}
+
+func (l *LocalDeduper) Record(id, rev string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.load(); err != nil {
+		return err
+	}
+	l.set.record(id, rev)
+	doc := localProcessed{Rev: l.rev, Processed: make([][2]string, 0, len(l.set.order))}
+	for _, id := range l.set.order {
+		doc.Processed = append(doc.Processed, [2]string{id, l.set.revs[id]})
+	}
+	in, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	r := WriteResult{}
+	if _, err := l.DB.interact("PUT", l.url(), map[string][]string{}, in, &r); err != nil {
+		return err
+	}
+	l.rev = r.Rev
+	return nil
+}
@@ -0,0 +1,80 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProcessedSet(t *testing.T) {
+	s := newProcessedSet(2)
+	s.record("a", "1-a")
+	s.record("b", "1-b")
+	s.record("a", "2-a")
+	s.record("c", "1-c") // forgets b, the least recently processed
+	if !s.seen("a", "2-a") || s.seen("a", "1-a") || s.seen("b", "1-b") || !s.seen("c", "1-c") {
+		t.Fatalf("set: got %v %v", s.revs, s.order)
+	}
+}
+
+func TestLocalDeduper(t *testing.T) {
+	stored, puts := `{"_rev":"0-1","processed":[["x","1-x"]]}`, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_local/dedupe" {
+			t.Errorf("path: got %s", r.URL.Path)
+		}
+		if r.Method == "PUT" {
+			puts++
+			b, _ := ioutil.ReadAll(r.Body)
+			stored = string(b)
+			fmt.Fprintf(w, `{"ok":true,"id":"_local/dedupe","rev":"0-%d"}`, puts+1)
+			return
+		}
+		fmt.Fprint(w, stored)
+	}))
+	defer ts.Close()
+	d := &LocalDeduper{DB: newTestDatabase(ts), Id: "dedupe", Keep: 2}
+	if seen, err := d.Seen("x", "1-x"); err != nil || !seen {
+		t.Fatalf("seen: expected x from the stored document, got %v, %v", seen, err)
+	}
+	d.Record("y", "1-y")
+	d.Record("z", "1-z")
+	if stored != `{"_rev":"0-2","processed":[["y","1-y"],["z","1-z"]]}` {
+		t.Fatalf("stored: got %s", stored)
+	}
+}
+
+func TestConsumerDeduper(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests++; requests > 2 {
+			cancel()
+		}
+		// the same changes every time, as after a reconnect
+		fmt.Fprint(w, `{"results":[{"seq":"2-b","id":"x","changes":[{"rev":"1-x"}]},{"seq":"3-c","id":"y","changes":[{"rev":"1-y"}]}],"last_seq":"1-a"}`)
+	}))
+	defer ts.Close()
+	d := &MemoryDeduper{}
+	d.Record("x", "1-x")
+	c := newTestDatabase(ts).NewConsumer(ConsumerOptions{Deduper: d})
+	handled := []string{}
+	err := c.Run(ctx, func(ch Change) error {
+		handled = append(handled, ch.Id)
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("run: expected to be canceled, got %v", err)
+	}
+	if fmt.Sprint(handled) != "[y]" {
+		t.Fatalf("handled: got %v", handled)
+	}
+	if s := c.Stats(); s.Processed != 1 || s.Skipped < 3 {
+		t.Fatalf("stats: got %+v", s)
+	}
+}
@@ -0,0 +1,332 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DesignDoc is a CouchDB design document.
+// Id must carry the "_design/" prefix.
+type DesignDoc struct {
+	Id                string          `json:"_id"`
+	Rev               string          `json:"_rev,omitempty"`
+	Language          string          `json:"language,omitempty"`
+	Views             map[string]View `json:"views,omitempty"`
+	ValidateDocUpdate string          `json:"validate_doc_update,omitempty"`
+	Rewrites          *Rewrites       `json:"rewrites,omitempty"`
+
+	// Version numbers the releases of a design document, by convention;
+	// SyncDesignDoc won't replace a design document with a higher one.
+	Version int `json:"version,omitempty"`
+
+	// Other holds any fields not modelled above (shows, lists, filters...),
+	// so they survive a Retrieve/Put round trip.
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// designDoc has DesignDoc's fields, but not its JSON methods.
+type designDoc DesignDoc
+
+var designDocFields = jsonFieldNames(reflect.TypeOf(designDoc{}))
+
+func (dd *DesignDoc) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, (*designDoc)(dd)); err != nil {
+		return err
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for _, name := range designDocFields {
+		delete(m, name)
+	}
+	dd.Other = nil
+	if len(m) > 0 {
+		dd.Other = m
+	}
+	return nil
+}
+
+func (dd DesignDoc) MarshalJSON() ([]byte, error) {
+	b, err := json.Marshal(designDoc(dd))
+	if err != nil || len(dd.Other) == 0 {
+		return b, err
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range dd.Other {
+		if _, ok := m[k]; !ok {
+			m[k] = v
+		}
+	}
+	return json.Marshal(m)
+}
+
+// jsonFieldNames returns the JSON names of the exported fields of struct t.
+func jsonFieldNames(t reflect.Type) []string {
+	names := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = f.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// View is a single map/reduce view within a design document.
+// In "javascript" and "erlang" design documents Map holds the source of
+// the map function; in "query" (Mango index) design documents the map is
+// an index definition, held in Index instead.
+type View struct {
+	Map     string
+	Reduce  string
+	Index   *IndexMap
+	Options json.RawMessage // only used by "query" design documents
+}
+
+type viewJSON struct {
+	Map     json.RawMessage `json:"map"`
+	Reduce  string          `json:"reduce,omitempty"`
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+func (v View) MarshalJSON() ([]byte, error) {
+	var m interface{} = v.Map
+	if v.Index != nil {
+		if v.Map != "" {
+			return nil, fmt.Errorf("view has both a map function and an index")
+		}
+		m = v.Index
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(viewJSON{b, v.Reduce, v.Options})
+}
+
+func (v *View) UnmarshalJSON(b []byte) error {
+	raw := viewJSON{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*v = View{Reduce: raw.Reduce, Options: raw.Options}
+	if len(raw.Map) > 0 && raw.Map[0] == '{' {
+		v.Index = &IndexMap{}
+		return json.Unmarshal(raw.Map, v.Index)
+	}
+	if len(raw.Map) == 0 {
+		return nil
+	}
+	return json.Unmarshal(raw.Map, &v.Map)
+}
+
+// Rewrites are the URL rewriting rules of a design document, served under
+// its _rewrite path. CouchDB accepts either a list of rules, or (since 2.0)
+// a JavaScript function as a string; exactly one of Rules and Function
+// should be set.
+type Rewrites struct {
+	Rules    []Rewrite
+	Function string
+}
+
+// Rewrite is a single declarative rewrite rule. From and To may contain
+// :variables and a trailing *, as described in the CouchDB documentation.
+type Rewrite struct {
+	From   string                 `json:"from"`
+	To     string                 `json:"to"`
+	Method string                 `json:"method,omitempty"`
+	Query  map[string]interface{} `json:"query,omitempty"`
+}
+
+func (r Rewrites) MarshalJSON() ([]byte, error) {
+	if r.Function != "" {
+		if len(r.Rules) > 0 {
+			return nil, fmt.Errorf("rewrites: both rules and function set")
+		}
+		return json.Marshal(r.Function)
+	}
+	if r.Rules == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(r.Rules)
+}
+
+func (r *Rewrites) UnmarshalJSON(b []byte) error {
+	*r = Rewrites{}
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &r.Function)
+	}
+	return json.Unmarshal(b, &r.Rules)
+}
+
+// RewritePath returns the path of the _rewrite handler of the given design
+// document, relative to the server root; it's the usual target of a vhost.
+// Being internal to CouchDB, it doesn't include the BasePath.
+func (p Database) RewritePath(ddocId string) string {
+	return fmt.Sprintf("/%s/%s/_rewrite", url.PathEscape(p.Name), ddocId)
+}
+
+// DesignPlan describes what PutDesignDoc would change.
+// View names are sorted.
+type DesignPlan struct {
+	Id           string
+	Create       bool     // the design document doesn't exist yet
+	Added        []string // views only in the new design document
+	Removed      []string // views only in the existing design document
+	Changed      []string // views whose map or reduce function differs
+	OtherChanged bool     // anything besides the views differs
+	Rev          string   // current revision, if the document exists
+}
+
+// Unchanged reports whether deploying the design document would be a no-op.
+func (pl DesignPlan) Unchanged() bool {
+	return !pl.Create && !pl.OtherChanged &&
+		len(pl.Added) == 0 && len(pl.Removed) == 0 && len(pl.Changed) == 0
+}
+
+func (pl DesignPlan) String() string {
+	switch {
+	case pl.Create:
+		return fmt.Sprintf("%s: create", pl.Id)
+	case pl.Unchanged():
+		return fmt.Sprintf("%s: unchanged", pl.Id)
+	}
+	parts := []string{}
+	if len(pl.Added) > 0 {
+		parts = append(parts, "add "+strings.Join(pl.Added, ","))
+	}
+	if len(pl.Removed) > 0 {
+		parts = append(parts, "remove "+strings.Join(pl.Removed, ","))
+	}
+	if len(pl.Changed) > 0 {
+		parts = append(parts, "change "+strings.Join(pl.Changed, ","))
+	}
+	if pl.OtherChanged {
+		parts = append(parts, "update other fields")
+	}
+	return fmt.Sprintf("%s: %s", pl.Id, strings.Join(parts, "; "))
+}
+
+// RetrieveDesignDoc fetches the design document with the given id.
+func (p Database) RetrieveDesignDoc(id string) (DesignDoc, error) {
+	dd := DesignDoc{}
+	if !strings.HasPrefix(id, "_design/") {
+		return dd, fmt.Errorf("design document id must start with _design/")
+	}
+	if err := p.unmarshalURL(fmt.Sprintf("%s/%s", p.DBURL(), id), &dd); err != nil {
+		return DesignDoc{}, err
+	}
+	return dd, nil
+}
+
+// Plan compares dd against the design document currently stored under
+// dd.Id, and reports what PutDesignDoc would change. View functions are
+// compared byte-for-byte.
+func (p Database) Plan(dd DesignDoc) (DesignPlan, error) {
+	if !strings.HasPrefix(dd.Id, "_design/") {
+		return DesignPlan{}, fmt.Errorf("design document id must start with _design/")
+	}
+	if !validLanguage(dd.Language) {
+		return DesignPlan{}, fmt.Errorf("unknown design document language %q", dd.Language)
+	}
+	existing, err := p.RetrieveDesignDoc(dd.Id)
+	if isNotFound(err) {
+		return DesignPlan{Id: dd.Id, Create: true}, nil
+	} else if err != nil {
+		return DesignPlan{}, err
+	}
+	return planDesign(existing, dd)
+}
+
+// PutDesignDoc deploys dd, replacing any existing design document with the
+// same id. If the existing views and other fields are identical, no write
+// is made, so view indexes are not needlessly invalidated.
+// PutDesignDoc returns the (possibly unchanged) revision of the design doc.
+func (p Database) PutDesignDoc(dd DesignDoc) (string, error) {
+	plan, err := p.Plan(dd)
+	if err != nil {
+		return "", err
+	}
+	if plan.Unchanged() {
+		return plan.Rev, nil
+	}
+	dd.Rev = plan.Rev
+	if plan.Create {
+		_, rev, err := p.Insert(dd)
+		return rev, err
+	}
+	return p.Edit(dd)
+}
+
+// planDesign diffs two design documents.
+func planDesign(existing, dd DesignDoc) (DesignPlan, error) {
+	plan := DesignPlan{Id: dd.Id, Rev: existing.Rev}
+	for name, v := range dd.Views {
+		old, ok := existing.Views[name]
+		if !ok {
+			plan.Added = append(plan.Added, name)
+		} else if changed, err := viewsDiffer(old, v); err != nil {
+			return DesignPlan{}, err
+		} else if changed {
+			plan.Changed = append(plan.Changed, name)
+		}
+	}
+	for name := range existing.Views {
+		if _, ok := dd.Views[name]; !ok {
+			plan.Removed = append(plan.Removed, name)
+		}
+	}
+	sort.Strings(plan.Added)
+	sort.Strings(plan.Removed)
+	sort.Strings(plan.Changed)
+	a, err := designOther(existing)
+	if err != nil {
+		return DesignPlan{}, err
+	}
+	b, err := designOther(dd)
+	if err != nil {
+		return DesignPlan{}, err
+	}
+	plan.OtherChanged = !bytes.Equal(a, b)
+	return plan, nil
+}
+
+// viewsDiffer compares the encoded forms of two views.
+func viewsDiffer(a, b View) (bool, error) {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false, err
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(ab, bb), nil
+}
+
+// designOther encodes everything in dd except the id, rev and views.
+func designOther(dd DesignDoc) ([]byte, error) {
+	dd.Id, dd.Rev, dd.Views = "", "", nil
+	if dd.Language == LanguageJavaScript {
+		dd.Language = ""
+	}
+	return json.Marshal(dd)
+}
@@ -0,0 +1,135 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPlanDesign(t *testing.T) {
+	existing := DesignDoc{
+		Id:  "_design/plan",
+		Rev: "1-abc",
+		Views: map[string]View{
+			"same":    View{Map: "function(doc) { emit(doc._id, null); }"},
+			"changed": View{Map: "function(doc) { emit(doc.a, null); }"},
+			"removed": View{Map: "function(doc) { emit(null, null); }"},
+		},
+	}
+	dd := DesignDoc{
+		Id:       "_design/plan",
+		Language: "javascript",
+		Views: map[string]View{
+			"same":    View{Map: "function(doc) { emit(doc._id, null); }"},
+			"changed": View{Map: "function(doc) { emit(doc.b, null); }"},
+			"added":   View{Map: "function(doc) { emit(1, 1); }", Reduce: "_sum"},
+		},
+	}
+	plan, err := planDesign(existing, dd)
+	if err != nil {
+		t.Fatalf("failed to plan: %s", err)
+	}
+	if plan.Unchanged() {
+		t.Fatalf("plan: expected changes, got none")
+	}
+	if plan.Rev != "1-abc" {
+		t.Fatalf("rev: expected %s, got %s", "1-abc", plan.Rev)
+	}
+	if !reflect.DeepEqual(plan.Added, []string{"added"}) {
+		t.Fatalf("added: expected [added], got %v", plan.Added)
+	}
+	if !reflect.DeepEqual(plan.Removed, []string{"removed"}) {
+		t.Fatalf("removed: expected [removed], got %v", plan.Removed)
+	}
+	if !reflect.DeepEqual(plan.Changed, []string{"changed"}) {
+		t.Fatalf("changed: expected [changed], got %v", plan.Changed)
+	}
+	if plan.OtherChanged {
+		t.Fatalf("explicit javascript language should match the default")
+	}
+
+	plan, err = planDesign(existing, existing)
+	if err != nil {
+		t.Fatalf("failed to plan: %s", err)
+	}
+	if !plan.Unchanged() {
+		t.Fatalf("plan: expected no changes, got %s", plan)
+	}
+}
+
+func TestPutDesignDocUnchanged(t *testing.T) {
+	db, err := NewDatabase(TEST_HOST, TEST_PORT, TEST_NAME)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	dd := DesignDoc{
+		Id:    "_design/deploy",
+		Views: map[string]View{"v": View{Map: "function(doc) { emit(null, null); }"}},
+	}
+	rev, err := db.PutDesignDoc(dd)
+	if err != nil {
+		t.Fatalf("failed to deploy design doc: %s", err)
+	}
+	rev2, err := db.PutDesignDoc(dd)
+	if err != nil {
+		t.Fatalf("failed to redeploy design doc: %s", err)
+	}
+	if rev2 != rev {
+		t.Fatalf("redeploy: expected unchanged rev %s, got %s", rev, rev2)
+	}
+	dd.Views["w"] = View{Map: "function(doc) { emit(1, null); }"}
+	rev3, err := db.PutDesignDoc(dd)
+	if err != nil {
+		t.Fatalf("failed to update design doc: %s", err)
+	}
+	if rev3 == rev {
+		t.Fatalf("update: expected new rev, got %s", rev3)
+	}
+	if err := db.Delete(dd.Id, rev3); err != nil {
+		t.Fatalf("failed to delete design doc: %s", err)
+	}
+}
+
+func TestDesignDocOtherFields(t *testing.T) {
+	in := []byte(`{"_id":"_design/x","views":{"v":{"map":"m"}},"filters":{"f":"g"}}`)
+	dd := DesignDoc{}
+	if err := json.Unmarshal(in, &dd); err != nil {
+		t.Fatalf("failed to unmarshal design doc: %s", err)
+	}
+	if string(dd.Other["filters"]) != `{"f":"g"}` {
+		t.Fatalf("filters: expected preserved, got %v", dd.Other)
+	}
+	if _, ok := dd.Other["views"]; ok {
+		t.Fatalf("views should not be duplicated in Other")
+	}
+	out, err := json.Marshal(dd)
+	if err != nil {
+		t.Fatalf("failed to marshal design doc: %s", err)
+	}
+	if string(out) != `{"_id":"_design/x","filters":{"f":"g"},"views":{"v":{"map":"m"}}}` {
+		t.Fatalf("round trip: got %s", out)
+	}
+}
+
+func TestRewritesJSON(t *testing.T) {
+	for _, in := range []string{
+		`{"_id":"_design/r","rewrites":[{"from":"/a/*","to":"_show/a/*","method":"GET"}]}`,
+		`{"_id":"_design/r","rewrites":"function(req) { return {path: \"_all_docs\"}; }"}`,
+	} {
+		dd := DesignDoc{}
+		if err := json.Unmarshal([]byte(in), &dd); err != nil {
+			t.Fatalf("failed to unmarshal %s: %s", in, err)
+		}
+		if dd.Rewrites == nil {
+			t.Fatalf("rewrites: expected something, got nil")
+		}
+		out, err := json.Marshal(dd)
+		if err != nil {
+			t.Fatalf("failed to marshal design doc: %s", err)
+		}
+		if string(out) != in {
+			t.Fatalf("round trip: expected %s, got %s", in, out)
+		}
+	}
+}
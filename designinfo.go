@@ -0,0 +1,141 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DesignInfo describes the view index of a design document, from its
+// _info endpoint.
+type DesignInfo struct {
+	Name      string        `json:"name"`
+	ViewIndex ViewIndexInfo `json:"view_index"`
+}
+
+// ViewIndexInfo is the state of a design document's view index. The
+// Signature changes whenever the views' definitions do, and design
+// documents with the same Signature share an index.
+type ViewIndexInfo struct {
+	Signature      string `json:"signature"`
+	Language       string `json:"language"`
+	UpdaterRunning bool   `json:"updater_running"`
+	CompactRunning bool   `json:"compact_running"`
+	WaitingClients int    `json:"waiting_clients"`
+	UpdateSeq      Seq    `json:"update_seq"`
+	PurgeSeq       Seq    `json:"purge_seq"`
+	Sizes          struct {
+		Active   int64 `json:"active"`
+		External int64 `json:"external"`
+		File     int64 `json:"file"`
+	} `json:"sizes"`
+}
+
+// DesignInfo returns the view index information of the design document
+// with the given id.
+func (p Database) DesignInfo(id string) (DesignInfo, error) {
+	return p.DesignInfoContext(context.Background(), id)
+}
+
+// DesignInfoContext is DesignInfo, bounded by ctx.
+func (p Database) DesignInfoContext(ctx context.Context, id string) (DesignInfo, error) {
+	info := DesignInfo{}
+	if !strings.HasPrefix(id, "_design/") {
+		return info, fmt.Errorf("design document id must start with _design/")
+	}
+	err := p.client().unmarshalURLContext(ctx, fmt.Sprintf("%s/%s/_info", p.DBURL(), id), &info)
+	return info, err
+}
+
+// viewSignatureTTL is how long a Client trusts a view index signature it
+// has learned, before checking it again.
+const viewSignatureTTL = time.Minute
+
+// viewSignatures remembers the view index signatures of design documents,
+// so that cached view responses can be keyed by them: when a design
+// document's views change, so does its signature, and responses cached
+// under the old one are no longer served, even if a stale ETag would
+// still match. Signatures are learned from _info, and forgotten when the
+// design document is written through the Client, or after the TTL, which
+// bounds how long a deploy by another process can go unnoticed.
+type viewSignatures struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu   sync.Mutex
+	sigs map[string]viewSignature // by design document URL, without credentials
+}
+
+type viewSignature struct {
+	sig string
+	at  time.Time
+}
+
+func newViewSignatures() *viewSignatures {
+	return &viewSignatures{ttl: viewSignatureTTL, now: time.Now, sigs: map[string]viewSignature{}}
+}
+
+// designURL returns the URL of the design document of a view query or
+// design document request at u, and whether u is one.
+func designURL(u *url.URL) (*url.URL, bool) {
+	segments := strings.Split(u.Path, "/")
+	for i, seg := range segments {
+		if seg == "_design" && i > 0 && i+1 < len(segments) {
+			d := *u
+			d.Path, d.RawPath, d.RawQuery, d.Fragment = strings.Join(segments[:i+2], "/"), "", "", ""
+			return &d, true
+		}
+	}
+	return nil, false
+}
+
+// designKey identifies a design document across users.
+func designKey(d *url.URL) string {
+	return d.Scheme + "://" + d.Host + d.Path
+}
+
+// viewCacheKey returns the cache key of a GET of u: its URL, with the
+// view index signature for view queries. If the signature can't be
+// learned, the URL alone is used.
+func (c *Client) viewCacheKey(ctx context.Context, u *url.URL) string {
+	key := u.Redacted()
+	if !strings.Contains(u.Path, "/_view/") {
+		return key
+	}
+	d, ok := designURL(u)
+	if !ok {
+		return key
+	}
+	s := c.viewSigs
+	s.mu.Lock()
+	sig, ok := s.sigs[designKey(d)]
+	s.mu.Unlock()
+	if !ok || s.now().Sub(sig.at) >= s.ttl {
+		info := DesignInfo{}
+		if err := c.unmarshalURLContext(ctx, d.String()+"/_info", &info); err != nil || info.ViewIndex.Signature == "" {
+			return key
+		}
+		sig = viewSignature{info.ViewIndex.Signature, s.now()}
+		s.mu.Lock()
+		s.sigs[designKey(d)] = sig
+		s.mu.Unlock()
+	}
+	return key + "#sig=" + sig.sig
+}
+
+// forget drops the signature of the design document a write to u
+// changes, if any.
+func (s *viewSignatures) forget(u *url.URL) {
+	if strings.Contains(u.Path, "/_view/") {
+		return
+	}
+	if d, ok := designURL(u); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.sigs, designKey(d))
+	}
+}
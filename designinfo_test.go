@@ -0,0 +1,88 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDesignInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_design/app/_info" {
+			t.Errorf("path: got %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"name":"app","view_index":{"signature":"a1","language":"javascript","updater_running":true,"update_seq":12,"sizes":{"active":100,"external":50,"file":200}}}`)
+	}))
+	defer ts.Close()
+	info, err := newTestDatabase(ts).DesignInfo("_design/app")
+	if err != nil {
+		t.Fatalf("failed to get info: %s", err)
+	}
+	vi := info.ViewIndex
+	if info.Name != "app" || vi.Signature != "a1" || !vi.UpdaterRunning || vi.UpdateSeq != "12" || vi.Sizes.File != 200 {
+		t.Fatalf("info: got %+v", info)
+	}
+	if _, err := newTestDatabase(ts).DesignInfo("app"); err == nil {
+		t.Fatalf("expected error for an id without _design/")
+	}
+}
+
+func TestViewCacheBusting(t *testing.T) {
+	sig, rows, infos := "a1", `{"rows":[{"key":"old"}]}`, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/db/_design/app/_info":
+			infos++
+			fmt.Fprintf(w, `{"name":"app","view_index":{"signature":%q}}`, sig)
+		case r.URL.Path == "/db/_design/app/_view/by_key":
+			// an ETag which doesn't change with the view functions
+			w.Header().Set("ETag", `"same"`)
+			if r.Header.Get("If-None-Match") == `"same"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			fmt.Fprint(w, rows)
+		case r.URL.Path == "/db/_design/app" && r.Method == "PUT":
+			sig, rows = "b2", `{"rows":[{"key":"new"}]}`
+			fmt.Fprint(w, `{"ok":true,"id":"_design/app","rev":"2-b"}`)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithETagStore(NewMemoryETagStore(10)))
+	get := func() string {
+		r := struct{ Rows []struct{ Key string } }{}
+		if err := db.client().unmarshalURL(db.DBURL()+"/_design/app/_view/by_key", &r); err != nil {
+			t.Fatalf("query: %s", err)
+		}
+		return r.Rows[0].Key
+	}
+	if key := get(); key != "old" {
+		t.Fatalf("first query: expected old, got %s", key)
+	}
+	if key := get(); key != "old" || infos != 1 {
+		t.Fatalf("cached query: expected old after 1 _info, got %s after %d", key, infos)
+	}
+
+	// a deploy through the Client is noticed at once
+	out := map[string]interface{}{}
+	if _, err := db.interact("PUT", db.DBURL()+"/_design/app", defaultHeaders, []byte(`{"_rev":"1-a"}`), &out); err != nil {
+		t.Fatalf("deploy: %s", err)
+	}
+	if key := get(); key != "new" || infos != 2 {
+		t.Fatalf("after deploy: expected new after 2 _infos, got %s after %d", key, infos)
+	}
+
+	// one by another process, once the signature is rechecked
+	sig, rows = "c3", `{"rows":[{"key":"newer"}]}`
+	if key := get(); key != "new" {
+		t.Fatalf("before recheck: expected new, got %s", key)
+	}
+	db.Client.viewSigs.now = func() time.Time { return time.Now().Add(viewSignatureTTL) }
+	if key := get(); key != "newer" || infos != 3 {
+		t.Fatalf("after recheck: expected newer after 3 _infos, got %s after %d", key, infos)
+	}
+}
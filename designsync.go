@@ -0,0 +1,125 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNewerDesignDoc is returned by SyncDesignDoc when the deployed design
+// document has a higher Version than the one being deployed.
+var ErrNewerDesignDoc = errors.New("a newer version of the design document is deployed")
+
+// DesignDeploy records one deployment made by SyncDesignDoc.
+type DesignDeploy struct {
+	Id          string    `json:"id"`
+	Version     int       `json:"version"`
+	FromVersion int       `json:"from_version"`
+	Rev         string    `json:"rev"`
+	Deployer    string    `json:"deployer,omitempty"`
+	At          time.Time `json:"at"`
+}
+
+type designHistoryDoc struct {
+	Rev     string         `json:"_rev,omitempty"`
+	Deploys []DesignDeploy `json:"deploys"`
+}
+
+const designHistoryDocURL = "_local/design_history"
+
+// designHistoryKeep is how many deployments the history keeps.
+const designHistoryKeep = 100
+
+// SyncDesignDoc deploys dd as PutDesignDoc does, but refuses, with
+// ErrNewerDesignDoc, to replace a design document with a higher Version,
+// so that an old deployer can't undo a newer one's work. The write is
+// made against the revision the version was checked at, so if another
+// deployer gets in between, it fails with a conflict rather than
+// clobbering that deployment. deployer, eg. a hostname or release, is
+// recorded with the deployment in the _local/design_history document; see
+// DesignHistory. Nothing is written or recorded if dd is unchanged.
+func (p Database) SyncDesignDoc(dd DesignDoc, deployer string) (string, error) {
+	if !strings.HasPrefix(dd.Id, "_design/") {
+		return "", fmt.Errorf("design document id must start with _design/")
+	}
+	if !validLanguage(dd.Language) {
+		return "", fmt.Errorf("unknown design document language %q", dd.Language)
+	}
+	existing, err := p.RetrieveDesignDoc(dd.Id)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	plan := DesignPlan{Id: dd.Id, Create: true}
+	if err == nil {
+		if existing.Version > dd.Version {
+			return "", fmt.Errorf("%s: version %d is deployed, not replacing it with version %d: %w",
+				dd.Id, existing.Version, dd.Version, ErrNewerDesignDoc)
+		}
+		if plan, err = planDesign(existing, dd); err != nil {
+			return "", err
+		}
+		if plan.Unchanged() {
+			return plan.Rev, nil
+		}
+	}
+	dd.Rev = plan.Rev
+	var rev string
+	if plan.Create {
+		_, rev, err = p.Insert(dd)
+	} else {
+		rev, err = p.Edit(dd)
+	}
+	if err != nil {
+		return "", err
+	}
+	deploy := DesignDeploy{dd.Id, dd.Version, existing.Version, rev, deployer, time.Now().UTC()}
+	if err := p.recordDesignDeploy(deploy); err != nil {
+		return rev, fmt.Errorf("%s deployed, but not recorded: %w", dd.Id, err)
+	}
+	return rev, nil
+}
+
+// DesignHistory lists the deployments SyncDesignDoc has made, oldest
+// first. Only the last 100 are kept; being in a _local document, the
+// history isn't replicated.
+func (p Database) DesignHistory() ([]DesignDeploy, error) {
+	doc, err := p.loadDesignHistory()
+	return doc.Deploys, err
+}
+
+func (p Database) loadDesignHistory() (designHistoryDoc, error) {
+	doc := designHistoryDoc{}
+	err := p.unmarshalURL(fmt.Sprintf("%s/%s", p.DBURL(), designHistoryDocURL), &doc)
+	if err != nil && !isNotFound(err) {
+		return designHistoryDoc{}, err
+	}
+	return doc, nil
+}
+
+// recordDesignDeploy appends d to the history, retrying if another
+// deployer recorded theirs meanwhile.
+func (p Database) recordDesignDeploy(d DesignDeploy) error {
+	for attempt := 0; ; attempt++ {
+		doc, err := p.loadDesignHistory()
+		if err != nil {
+			return err
+		}
+		doc.Deploys = append(doc.Deploys, d)
+		if n := len(doc.Deploys); n > designHistoryKeep {
+			doc.Deploys = doc.Deploys[n-designHistoryKeep:]
+		}
+		in, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		r := WriteResult{}
+		u := fmt.Sprintf("%s/%s", p.DBURL(), designHistoryDocURL)
+		_, err = p.interact("PUT", u, map[string][]string{}, in, &r)
+		if statusCode(err) != 409 || attempt == 2 {
+			return err
+		}
+	}
+}
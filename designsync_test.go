@@ -0,0 +1,86 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSyncDesignDoc(t *testing.T) {
+	stored := `{"_id":"_design/app","_rev":"1-a","version":2,"views":{"by_name":{"map":"function(doc){}"}}}`
+	history, historyConflicts := "", 1
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/db/_design/app" && r.Method == "GET":
+			fmt.Fprint(w, stored)
+		case r.URL.Path == "/db/_design/app" && r.Method == "PUT":
+			dd := DesignDoc{}
+			json.NewDecoder(r.Body).Decode(&dd)
+			if dd.Rev != "1-a" {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error":"conflict","reason":"Document update conflict."}`)
+				return
+			}
+			fmt.Fprint(w, `{"ok":true,"id":"_design/app","rev":"2-b"}`)
+		case r.URL.Path == "/db/_local/design_history" && r.Method == "GET":
+			if history == "" {
+				w.WriteHeader(http.StatusNotFound)
+				fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+				return
+			}
+			fmt.Fprint(w, history)
+		case r.URL.Path == "/db/_local/design_history" && r.Method == "PUT":
+			if historyConflicts > 0 {
+				historyConflicts--
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error":"conflict","reason":"Document update conflict."}`)
+				return
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			history = string(b)
+			fmt.Fprint(w, `{"ok":true,"id":"_local/design_history","rev":"0-1"}`)
+		default:
+			t.Errorf("request: got %s %s", r.Method, r.URL)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	views := map[string]View{"by_name": {Map: "function(doc){ emit(doc.name) }"}}
+
+	_, err := db.SyncDesignDoc(DesignDoc{Id: "_design/app", Version: 1, Views: views}, "old")
+	if !errors.Is(err, ErrNewerDesignDoc) {
+		t.Fatalf("older version: expected ErrNewerDesignDoc, got %v", err)
+	}
+	rev, err := db.SyncDesignDoc(DesignDoc{Id: "_design/app", Version: 3, Views: views}, "web-1")
+	if err != nil {
+		t.Fatalf("failed to sync: %s", err)
+	}
+	if rev != "2-b" {
+		t.Fatalf("rev: expected 2-b, got %s", rev)
+	}
+	deploys, err := db.DesignHistory()
+	if err != nil {
+		t.Fatalf("failed to get history: %s", err)
+	}
+	if len(deploys) != 1 {
+		t.Fatalf("history: expected 1 deploy, got %s", history)
+	}
+	d := deploys[0]
+	if d.Id != "_design/app" || d.Version != 3 || d.FromVersion != 2 || d.Rev != "2-b" || d.Deployer != "web-1" || d.At.IsZero() {
+		t.Fatalf("deploy: got %+v", d)
+	}
+
+	// the same design document is left alone
+	stored = `{"_id":"_design/app","_rev":"2-b","version":3,"views":{"by_name":{"map":"function(doc){ emit(doc.name) }"}}}`
+	if rev, err := db.SyncDesignDoc(DesignDoc{Id: "_design/app", Version: 3, Views: views}, "web-2"); err != nil || rev != "2-b" {
+		t.Fatalf("unchanged: got %s, %v", rev, err)
+	}
+	if deploys, _ := db.DesignHistory(); len(deploys) != 1 {
+		t.Fatalf("unchanged: expected no new deploy, got %+v", deploys)
+	}
+}
@@ -0,0 +1,184 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of FieldChange.
+const (
+	Added   = "added"
+	Removed = "removed"
+	Updated = "changed"
+)
+
+// FieldChange is a single difference found by Diff. Path is a JSON Pointer
+// to the field; Old and New hold its JSON values (Old is empty for added
+// fields, New for removed ones).
+type FieldChange struct {
+	Path string          `json:"path"`
+	Kind string          `json:"kind"`
+	Old  json.RawMessage `json:"old,omitempty"`
+	New  json.RawMessage `json:"new,omitempty"`
+}
+
+// Changes is the result of Diff, ordered by path.
+type Changes []FieldChange
+
+// Paths returns the path of every change.
+func (c Changes) Paths() []string {
+	paths := make([]string, len(c))
+	for i, fc := range c {
+		paths[i] = fc.Path
+	}
+	return paths
+}
+
+// Without returns the changes, except those at or below any of paths.
+func (c Changes) Without(paths ...string) Changes {
+	out := Changes{}
+	for _, fc := range c {
+		keep := true
+		for _, p := range paths {
+			if fc.Path == p || strings.HasPrefix(fc.Path, p+"/") {
+				keep = false
+			}
+		}
+		if keep {
+			out = append(out, fc)
+		}
+	}
+	return out
+}
+
+func (c Changes) String() string {
+	lines := make([]string, len(c))
+	for i, fc := range c {
+		switch fc.Kind {
+		case Added:
+			lines[i] = fmt.Sprintf("+ %s: %s", fc.Path, fc.New)
+		case Removed:
+			lines[i] = fmt.Sprintf("- %s: %s", fc.Path, fc.Old)
+		default:
+			lines[i] = fmt.Sprintf("~ %s: %s -> %s", fc.Path, fc.Old, fc.New)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Diff compares two JSON documents field by field, descending into objects
+// and arrays; array elements are compared by position. An empty a or b is
+// treated as an empty object, so Diff(nil, doc) lists every field as added.
+func Diff(a, b json.RawMessage) (Changes, error) {
+	var av, bv interface{} = map[string]interface{}{}, map[string]interface{}{}
+	if len(a) > 0 {
+		if err := decodeNumbers(a, &av); err != nil {
+			return nil, err
+		}
+	}
+	if len(b) > 0 {
+		if err := decodeNumbers(b, &bv); err != nil {
+			return nil, err
+		}
+	}
+	c := Changes{}
+	diffValues("", av, bv, &c)
+	sort.SliceStable(c, func(i, j int) bool { return c[i].Path < c[j].Path })
+	return c, nil
+}
+
+func diffValues(path string, a, b interface{}, c *Changes) {
+	switch at := a.(type) {
+	case map[string]interface{}:
+		if bt, ok := b.(map[string]interface{}); ok {
+			for k, v := range at {
+				p := path + "/" + escapePointer(k)
+				if w, ok := bt[k]; ok {
+					diffValues(p, v, w, c)
+				} else {
+					*c = append(*c, FieldChange{Path: p, Kind: Removed, Old: mustJSON(v)})
+				}
+			}
+			for k, w := range bt {
+				if _, ok := at[k]; !ok {
+					p := path + "/" + escapePointer(k)
+					*c = append(*c, FieldChange{Path: p, Kind: Added, New: mustJSON(w)})
+				}
+			}
+			return
+		}
+	case []interface{}:
+		if bt, ok := b.([]interface{}); ok {
+			for i := 0; i < len(at) || i < len(bt); i++ {
+				p := path + "/" + strconv.Itoa(i)
+				switch {
+				case i >= len(bt):
+					*c = append(*c, FieldChange{Path: p, Kind: Removed, Old: mustJSON(at[i])})
+				case i >= len(at):
+					*c = append(*c, FieldChange{Path: p, Kind: Added, New: mustJSON(bt[i])})
+				default:
+					diffValues(p, at[i], bt[i], c)
+				}
+			}
+			return
+		}
+	}
+	if !jsonEqual(a, b) {
+		*c = append(*c, FieldChange{Path: path, Kind: Updated, Old: mustJSON(a), New: mustJSON(b)})
+	}
+}
+
+// jsonEqual compares decoded JSON values, treating numbers as equal if
+// they have the same value, however they're written, at any depth.
+func jsonEqual(a, b interface{}) bool {
+	switch at := a.(type) {
+	case json.Number:
+		bt, ok := b.(json.Number)
+		if !ok || at == bt {
+			return ok
+		}
+		ar, aok := new(big.Rat).SetString(string(at))
+		br, bok := new(big.Rat).SetString(string(bt))
+		return aok && bok && ar.Cmp(br) == 0
+	case map[string]interface{}:
+		bt, ok := b.(map[string]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for k, v := range at {
+			if w, ok := bt[k]; !ok || !jsonEqual(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bt, ok := b.([]interface{})
+		if !ok || len(at) != len(bt) {
+			return false
+		}
+		for i := range at {
+			if !jsonEqual(at[i], bt[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// escapePointer escapes a member name for use in a JSON Pointer.
+func escapePointer(s string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(s)
+}
+
+// mustJSON encodes a value decoded from JSON, which can't fail.
+func mustJSON(v interface{}) json.RawMessage {
+	b, _ := json.Marshal(v)
+	return b
+}
@@ -0,0 +1,43 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a := json.RawMessage(`{"_rev":"1-a","name":"x","tags":["a","b"],"address":{"city":"Oslo","zip":"0150"},"a/b":1}`)
+	b := json.RawMessage(`{"_rev":"2-b","name":"x","tags":["a","c","d"],"address":{"city":"Bergen"},"a/b":1.0,"new":true,"c/d":2}`)
+	c, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("failed to diff: %s", err)
+	}
+	expected := Changes{
+		{Path: "/_rev", Kind: Updated, Old: json.RawMessage(`"1-a"`), New: json.RawMessage(`"2-b"`)},
+		{Path: "/address/city", Kind: Updated, Old: json.RawMessage(`"Oslo"`), New: json.RawMessage(`"Bergen"`)},
+		{Path: "/address/zip", Kind: Removed, Old: json.RawMessage(`"0150"`)},
+		{Path: "/c~1d", Kind: Added, New: json.RawMessage(`2`)},
+		{Path: "/new", Kind: Added, New: json.RawMessage(`true`)},
+		{Path: "/tags/1", Kind: Updated, Old: json.RawMessage(`"b"`), New: json.RawMessage(`"c"`)},
+		{Path: "/tags/2", Kind: Added, New: json.RawMessage(`"d"`)},
+	}
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("diff:\nexpected\n%s\ngot\n%s", expected, c)
+	}
+	if paths := c.Without("/_rev", "/address").Paths(); len(paths) != 4 {
+		t.Fatalf("without: expected 4 paths, got %v", paths)
+	}
+}
+
+func TestDiffIdentical(t *testing.T) {
+	doc := json.RawMessage(`{"a":[1,{"b":null}]}`)
+	c, err := Diff(doc, doc)
+	if err != nil {
+		t.Fatalf("failed to diff: %s", err)
+	}
+	if len(c) != 0 {
+		t.Fatalf("expected no changes, got\n%s", c)
+	}
+}
@@ -0,0 +1,82 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// lookupSRV is net.LookupSRV, replaceable in tests.
+var lookupSRV = net.LookupSRV
+
+// DiscoverSRV returns the nodes advertised by the DNS SRV records for
+// service on name, eg. DiscoverSRV("couchdb", "example.com") looks up
+// _couchdb._tcp.example.com. Nodes are ordered by priority and weight,
+// as returned by net.LookupSRV. scheme is "http" or "https". The nodes
+// aren't checked with Running; callers wanting failover can try them in
+// order.
+func DiscoverSRV(scheme, service, name string) ([]Server, error) {
+	return DefaultClient.DiscoverSRV(scheme, service, name)
+}
+
+// DiscoverSeed returns the cluster nodes listed by the /_membership of
+// the server at seedurl. See Server.Nodes.
+func DiscoverSeed(seedurl string) ([]Server, error) {
+	return DefaultClient.DiscoverSeed(seedurl)
+}
+
+// DiscoverSRV is the package-level DiscoverSRV, using this Client.
+func (c *Client) DiscoverSRV(scheme, service, name string) ([]Server, error) {
+	if scheme != "http" && scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme %q", scheme)
+	}
+	_, addrs, err := lookupSRV(service, "tcp", name)
+	if err != nil {
+		return nil, err
+	}
+	servers := []Server{}
+	for _, addr := range addrs {
+		s := Server{Host: strings.TrimSuffix(addr.Target, "."), Port: strconv.Itoa(int(addr.Port)), Client: c, BasePath: c.basePath}
+		if scheme == "https" {
+			s.Scheme = scheme
+		}
+		servers = append(servers, s)
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no SRV records for %s", name)
+	}
+	return servers, nil
+}
+
+// DiscoverSeed is the package-level DiscoverSeed, using this Client.
+func (c *Client) DiscoverSeed(seedurl string) ([]Server, error) {
+	s, segments, err := c.parseURL(seedurl)
+	if err != nil {
+		return nil, err
+	}
+	s.BasePath = c.joinPath(segments)
+	return s.Nodes()
+}
+
+// Nodes returns a Server for each member of the cluster s belongs to,
+// from /_membership. Node names like "couchdb@10.0.0.2" give the host;
+// scheme, port, credentials and base path are taken from s, as nodes
+// of a cluster are normally configured alike.
+func (s Server) Nodes() ([]Server, error) {
+	m, err := s.Membership()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []Server{}
+	for _, name := range m.ClusterNodes {
+		node := s
+		node.Host = name[strings.LastIndex(name, "@")+1:]
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 0 {
+		return nil, fmt.Errorf("no cluster nodes at %s", RedactURL(s.BaseURL()))
+	}
+	return nodes, nil
+}
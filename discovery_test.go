@@ -0,0 +1,61 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiscoverSRV(t *testing.T) {
+	defer func(f func(string, string, string) (string, []*net.SRV, error)) { lookupSRV = f }(lookupSRV)
+	lookupSRV = func(service, proto, name string) (string, []*net.SRV, error) {
+		if service != "couchdb" || proto != "tcp" || name != "example.com" {
+			t.Fatalf("lookup: got %s %s %s", service, proto, name)
+		}
+		return "_couchdb._tcp.example.com.", []*net.SRV{
+			{Target: "a.example.com.", Port: 6984, Priority: 10},
+			{Target: "b.example.com.", Port: 6985, Priority: 20},
+		}, nil
+	}
+	servers, err := DiscoverSRV("https", "couchdb", "example.com")
+	if err != nil {
+		t.Fatalf("failed to discover: %s", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("servers: expected 2, got %d", len(servers))
+	}
+	if servers[0].BaseURL() != "https://a.example.com:6984" || servers[1].BaseURL() != "https://b.example.com:6985" {
+		t.Fatalf("servers: got %s, %s", servers[0].BaseURL(), servers[1].BaseURL())
+	}
+	if _, err := DiscoverSRV("ftp", "couchdb", "example.com"); err == nil {
+		t.Fatalf("expected error for unsupported scheme")
+	}
+}
+
+func TestDiscoverSeed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/couchdb/_all_dbs":
+			fmt.Fprint(w, `[]`)
+		case "/couchdb/_membership":
+			fmt.Fprint(w, `{"all_nodes":["couchdb@127.0.0.1"],"cluster_nodes":["couchdb@127.0.0.1","couchdb@10.0.0.2"]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	nodes, err := DiscoverSeed(ts.URL + "/couchdb")
+	if err != nil {
+		t.Fatalf("failed to discover: %s", err)
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("nodes: expected 2, got %d", len(nodes))
+	}
+	_, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	if expected := fmt.Sprintf("http://10.0.0.2:%s/couchdb", port); nodes[1].BaseURL() != expected {
+		t.Fatalf("node: expected %s, got %s", expected, nodes[1].BaseURL())
+	}
+}
@@ -0,0 +1,118 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// maxDumpLine is the longest document Verify accepts, which is more than
+// CouchDB's default max_document_size of 8 MiB, allowing for inline
+// attachments.
+const maxDumpLine = 64 << 20
+
+// Dump writes every document in the database to w, attachments included,
+// as one JSON object per line, and returns how many it wrote. Design
+// documents are included; _local documents aren't. Documents written
+// during the dump may or may not be in it.
+func (p Database) Dump(w io.Writer) (int, error) {
+	return p.DumpContext(context.Background(), w)
+}
+
+// DumpContext is Dump, bounded by ctx.
+func (p Database) DumpContext(ctx context.Context, w io.Writer) (int, error) {
+	n := 0
+	line := &bytes.Buffer{}
+	err := p.streamField(ctx, "_all_docs", "include_docs=true&attachments=true", "rows", func(raw json.RawMessage) error {
+		row := struct {
+			Doc json.RawMessage `json:"doc"`
+		}{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return err
+		}
+		if len(row.Doc) == 0 || string(row.Doc) == "null" {
+			return nil // deleted since it was listed
+		}
+		if err := writeDumpLine(w, line, row.Doc); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// dumpPageSize is how many changes DumpIncremental asks for at a time.
+const dumpPageSize = 1000
+
+// DumpIncremental writes the documents changed since the given sequence
+// to w, in Dump's format, with deleted documents as tombstones, {"_id",
+// "_rev", "_deleted": true}. It returns how many it wrote, and the
+// sequence to save and pass as since next time, so that each backup
+// after a full one only has what changed. Replayed in order after the
+// dumps before it, it brings a restored database up to date.
+func (p Database) DumpIncremental(w io.Writer, since Seq) (int, Seq, error) {
+	return p.DumpIncrementalContext(context.Background(), w, since)
+}
+
+// DumpIncrementalContext is DumpIncremental, bounded by ctx.
+func (p Database) DumpIncrementalContext(ctx context.Context, w io.Writer, since Seq) (int, Seq, error) {
+	return p.dumpChanges(ctx, w, since, dumpPageSize)
+}
+
+// writeDumpLine writes doc to w on a line of its own, using line as a
+// buffer.
+func writeDumpLine(w io.Writer, line *bytes.Buffer, doc json.RawMessage) error {
+	line.Reset()
+	if err := json.Compact(line, doc); err != nil {
+		return err
+	}
+	line.WriteByte('\n')
+	_, err := w.Write(line.Bytes())
+	return err
+}
+
+// Verify reads a dump written by Dump, gzipped or not, checking that
+// every line is a document with an _id, and returns how many there are.
+func Verify(r io.Reader) (int, error) {
+	scanner, err := dumpScanner(r)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for scanner.Scan() {
+		doc := struct {
+			Id *string `json:"_id"`
+		}{}
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			return n, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		if doc.Id == nil || *doc.Id == "" {
+			return n, fmt.Errorf("line %d: document without an _id", n+1)
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// dumpScanner returns a scanner of the lines of a dump, gunzipping it if
+// need be.
+func dumpScanner(r io.Reader) (*bufio.Scanner, error) {
+	br := bufio.NewReader(r)
+	r = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		r = zr
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxDumpLine)
+	return scanner, nil
+}
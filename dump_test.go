@@ -0,0 +1,80 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_all_docs" || r.URL.Query().Get("attachments") != "true" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"total_rows":3,"rows":[
+			{"id":"a","doc":{"_id":"a", "_rev":"1-a",
+				"n":1}},
+			{"id":"b","doc":null},
+			{"id":"_design/c","doc":{"_id":"_design/c","_rev":"1-c"}}]}`)
+	}))
+	defer ts.Close()
+	buf := &bytes.Buffer{}
+	n, err := newTestDatabase(ts).Dump(buf)
+	if err != nil {
+		t.Fatalf("dump: %s", err)
+	}
+	want := "{\"_id\":\"a\",\"_rev\":\"1-a\",\"n\":1}\n{\"_id\":\"_design/c\",\"_rev\":\"1-c\"}\n"
+	if n != 2 || buf.String() != want {
+		t.Fatalf("dump: expected 2 documents %q, got %d %q", want, n, buf)
+	}
+
+	if n, err := Verify(bytes.NewReader(buf.Bytes())); n != 2 || err != nil {
+		t.Fatalf("verify: expected 2 documents, got %d, %v", n, err)
+	}
+	zipped := &bytes.Buffer{}
+	zw := gzip.NewWriter(zipped)
+	zw.Write(buf.Bytes())
+	zw.Close()
+	if n, err := Verify(zipped); n != 2 || err != nil {
+		t.Fatalf("verify gzipped: expected 2 documents, got %d, %v", n, err)
+	}
+}
+
+func TestVerifyBroken(t *testing.T) {
+	for name, dump := range map[string]string{
+		"truncated": "{\"_id\":\"a\"}\n{\"_id\":\"b\",\"n\":",
+		"no id":     "{\"_id\":\"a\"}\n{\"n\":1}\n",
+		"not json":  "<html>\n",
+	} {
+		if _, err := Verify(strings.NewReader(dump)); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDumpIncremental(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("since") != "5-x" || q.Get("include_docs") != "true" || q.Get("attachments") != "true" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"results":[
+			{"seq":"6-x","id":"a","changes":[{"rev":"2-a"}],"doc":{"_id":"a","_rev":"2-a"}},
+			{"seq":"7-x","id":"b","changes":[{"rev":"3-b"}],"deleted":true,"doc":{"_id":"b","_rev":"3-b","_deleted":true}}],"last_seq":"7-x"}`)
+	}))
+	defer ts.Close()
+	buf := &bytes.Buffer{}
+	n, seq, err := newTestDatabase(ts).DumpIncremental(buf, "5-x")
+	if err != nil {
+		t.Fatalf("dump: %s", err)
+	}
+	want := "{\"_id\":\"a\",\"_rev\":\"2-a\"}\n{\"_id\":\"b\",\"_rev\":\"3-b\",\"_deleted\":true}\n"
+	if n != 2 || seq != "7-x" || buf.String() != want {
+		t.Fatalf("dump: expected 2 documents %q up to 7-x, got %d %q up to %s", want, n, buf, seq)
+	}
+}
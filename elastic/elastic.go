@@ -0,0 +1,100 @@
+// -*- tab-width: 4 -*-
+
+// Package elastic is a couch.Sink indexing documents into Elasticsearch,
+// giving full-text search to CouchDB deployments without their own:
+//
+//	sink := &elastic.Sink{URL: "http://localhost:9200", Index: "orders"}
+//	err := db.NewConsumer(couch.ConsumerOptions{
+//		ChangesOptions: couch.ChangesOptions{IncludeDocs: true},
+//	}).RunSink(ctx, sink, nil)
+package elastic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sink indexes documents into an Elasticsearch index, with the CouchDB
+// document id as the Elasticsearch id. CouchDB's _id and _rev fields
+// aren't indexed, as Elasticsearch reserves names starting with "_".
+type Sink struct {
+	URL    string       // eg. "http://localhost:9200"
+	Index  string       // the index name
+	Client *http.Client // nil means http.DefaultClient
+	Header http.Header  // added to every request, eg. for authorization
+}
+
+// Error is a failed Elasticsearch request.
+type Error struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("elasticsearch: %d: %s", e.StatusCode, e.Body)
+}
+
+func (s *Sink) docURL(id string) string {
+	return fmt.Sprintf("%s/%s/_doc/%s", strings.TrimSuffix(s.URL, "/"), url.PathEscape(s.Index), url.PathEscape(id))
+}
+
+func (s *Sink) do(ctx context.Context, method, u string, body io.Reader) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c := s.Client
+	if c == nil {
+		c = http.DefaultClient
+	}
+	r, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Body.Close()
+	b, _ := ioutil.ReadAll(r.Body)
+	if r.StatusCode >= 300 {
+		return r.StatusCode, &Error{r.StatusCode, string(b)}
+	}
+	return r.StatusCode, nil
+}
+
+// Upsert indexes doc under id, replacing any document already there.
+func (s *Sink) Upsert(ctx context.Context, id string, doc interface{}) error {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	m := map[string]json.RawMessage{}
+	if json.Unmarshal(b, &m) == nil {
+		delete(m, "_id")
+		delete(m, "_rev")
+		if b, err = json.Marshal(m); err != nil {
+			return err
+		}
+	}
+	_, err = s.do(ctx, "PUT", s.docURL(id), bytes.NewReader(b))
+	return err
+}
+
+// Delete removes the document id from the index, if it's there.
+func (s *Sink) Delete(ctx context.Context, id string) error {
+	status, err := s.do(ctx, "DELETE", s.docURL(id), nil)
+	if status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
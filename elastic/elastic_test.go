@@ -0,0 +1,46 @@
+// -*- tab-width: 4 -*-
+package elastic
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestSink(t *testing.T) {
+	requests := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.EscapedPath()+" "+string(b)+" "+r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/orders/_doc/gone":
+			w.WriteHeader(http.StatusNotFound)
+		case "/orders/_doc/bad":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"mapper_parsing_exception"}`))
+		}
+	}))
+	defer ts.Close()
+	s := &Sink{URL: ts.URL + "/", Index: "orders", Header: http.Header{"Authorization": {"ApiKey k"}}}
+	ctx := context.Background()
+	if err := s.Upsert(ctx, "a/1", map[string]interface{}{"_id": "a/1", "_rev": "1-a", "total": 5}); err != nil {
+		t.Fatalf("failed to upsert: %s", err)
+	}
+	if err := s.Delete(ctx, "gone"); err != nil {
+		t.Fatalf("delete of a missing document: expected no error, got %s", err)
+	}
+	if err := s.Upsert(ctx, "bad", map[string]int{}); err == nil || err.(*Error).StatusCode != 400 {
+		t.Fatalf("expected a 400, got %v", err)
+	}
+	expected := []string{
+		`PUT /orders/_doc/a%2F1 {"total":5} ApiKey k`,
+		`DELETE /orders/_doc/gone  ApiKey k`,
+		`PUT /orders/_doc/bad {} ApiKey k`,
+	}
+	if !reflect.DeepEqual(requests, expected) {
+		t.Fatalf("requests: expected %q, got %q", expected, requests)
+	}
+}
@@ -0,0 +1,147 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Error is returned when CouchDB answers a request with an unexpected
+// status. Name and Reason are taken from CouchDB's JSON error body, if
+// there was one. URL never contains a password.
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Name       string
+	Reason     string
+
+	// RetryAfter is how long the server asked the client to wait before
+	// retrying, from the Retry-After header; 0 if it didn't say.
+	RetryAfter time.Duration
+	// Quota is the rate limit reported by Cloudant, if any.
+	Quota *Quota
+}
+
+// Quota describes the rate limit a request counted against, as reported
+// by Cloudant's X-RateLimit-* and X-Cloudant-Request-Class headers.
+type Quota struct {
+	Class     string // "lookup", "write", "query" and so on
+	Limit     int    // requests allowed per second; 0 if not reported
+	Remaining int
+}
+
+// ErrRevUnknown is returned by writes which the server accepted without
+// reporting the new revision, eg. with batch=ok. The write will probably
+// succeed, but the document must be read back to learn its revision.
+var ErrRevUnknown = errors.New("document written, but its revision is unknown")
+
+// newError builds an Error from a failed response.
+// It consumes, but does not close, the response body.
+func newError(r *http.Response) *Error {
+	e := &Error{StatusCode: r.StatusCode, Status: r.Status}
+	e.RetryAfter = parseRetryAfter(r.Header.Get("Retry-After"), time.Now())
+	e.Quota = parseQuota(r.Header)
+	if r.Request != nil {
+		e.Method = r.Request.Method
+		if r.Request.URL != nil {
+			e.URL = r.Request.URL.Redacted()
+		}
+	}
+	cr := WriteResult{}
+	if err := json.NewDecoder(r.Body).Decode(&cr); err == nil {
+		e.Name, e.Reason = cr.Error, cr.Reason
+	}
+	return e
+}
+
+// parseRetryAfter parses a Retry-After header, in seconds or as a date.
+func parseRetryAfter(h string, now time.Time) time.Duration {
+	if h == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(h); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// parseQuota reads the rate limit headers, returning nil if there are
+// none.
+func parseQuota(h http.Header) *Quota {
+	q := Quota{Class: h.Get("X-Cloudant-Request-Class")}
+	q.Limit, _ = strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	q.Remaining, _ = strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if q == (Quota{}) {
+		return nil
+	}
+	return &q
+}
+
+// retryAfter returns the wait the server asked for with err, if any.
+func retryAfter(err error) time.Duration {
+	e := &Error{}
+	if errors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+func (e *Error) Error() string {
+	msg := e.Status
+	if e.Reason != "" {
+		msg = fmt.Sprintf("%s: %s", e.Status, e.Reason)
+	}
+	if e.URL == "" {
+		return msg
+	}
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, msg)
+}
+
+// isNotFound reports whether err is a 404 from CouchDB.
+func isNotFound(err error) bool {
+	return statusCode(err) == http.StatusNotFound
+}
+
+// statusCode returns the HTTP status carried by err, or 0 if there's none.
+func statusCode(err error) int {
+	e := &Error{}
+	if errors.As(err, &e) {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// userinfoPattern matches the userinfo part of anything that looks like
+// a URL, for strings which can't be parsed as one.
+var userinfoPattern = regexp.MustCompile(`(//[^/@\s]*?:)[^/@\s]*@`)
+
+// RedactURL returns u with any password replaced by "xxxxx", suitable for
+// error messages and logs. Strings which don't parse as URLs are redacted
+// on a best-effort basis.
+func RedactURL(u string) string {
+	if parsed, err := url.Parse(u); err == nil {
+		return parsed.Redacted()
+	}
+	return userinfoPattern.ReplaceAllString(u, "${1}xxxxx@")
+}
+
+// redactError strips passwords from errors that embed request URLs,
+// such as those returned by url.Parse and http.Client.
+func redactError(err error) error {
+	ue := &url.Error{}
+	if errors.As(err, &ue) {
+		return &url.Error{Op: ue.Op, URL: RedactURL(ue.URL), Err: ue.Err}
+	}
+	return err
+}
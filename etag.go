@@ -0,0 +1,117 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+)
+
+// ETagStore holds response bodies and their ETags, so that repeated GETs
+// can be made conditional with If-None-Match: CouchDB then answers 304 Not
+// Modified without resending the body. Implementations backed by Redis or
+// disk let several processes share validators; they must be safe for
+// concurrent use.
+type ETagStore interface {
+	// Get returns the ETag and body stored under key, if any.
+	Get(key string) (etag string, body []byte, ok bool)
+	// Put stores an ETag and body under key.
+	Put(key, etag string, body []byte)
+}
+
+// WithETagStore makes the Client cache GET responses in s, revalidating
+// them with If-None-Match on every request. Responses are keyed by URL,
+// including the user name, so users never see each other's entries. View
+// responses are also keyed by the view index signature (see DesignInfo),
+// so that deploying new view functions busts them; the signature is
+// checked at most once a minute, and at once after a design document is
+// written through the Client.
+func WithETagStore(s ETagStore) Option {
+	return func(c *Client) {
+		c.etags = s
+		c.viewSigs = newViewSignatures()
+	}
+}
+
+// getCached makes the GET request conditional on any stored ETag, and
+// serves the stored body if the server says it's still current.
+func (c *Client) getCached(req *http.Request) (io.ReadCloser, error) {
+	key := c.viewCacheKey(req.Context(), req.URL)
+	etag, body, ok := c.etags.Get(key)
+	if ok {
+		req.Header.Set("If-None-Match", etag)
+	}
+	r, err := c.do(req)
+	if ok && statusCode(err) == http.StatusNotModified {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	etag = r.Header.Get("ETag")
+	if etag == "" {
+		return r.Body, nil
+	}
+	defer r.Body.Close()
+	body, err = ioutil.ReadAll(c.limitBody(r.Body))
+	if err != nil {
+		return nil, err
+	}
+	c.etags.Put(key, etag, body)
+	return ioutil.NopCloser(bytes.NewReader(body)), nil
+}
+
+// MemoryETagStore is an in-process ETagStore which keeps the most
+// recently used entries, up to a fixed number.
+type MemoryETagStore struct {
+	mu      sync.Mutex
+	max     int
+	order   *list.List // of *etagEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type etagEntry struct {
+	key  string
+	etag string
+	body []byte
+}
+
+// NewMemoryETagStore returns a MemoryETagStore holding at most max entries.
+func NewMemoryETagStore(max int) *MemoryETagStore {
+	return &MemoryETagStore{
+		max:     max,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (s *MemoryETagStore) Get(key string) (string, []byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	s.order.MoveToFront(e)
+	entry := e.Value.(*etagEntry)
+	return entry.etag, entry.body, true
+}
+
+func (s *MemoryETagStore) Put(key, etag string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		e.Value = &etagEntry{key, etag, body}
+		s.order.MoveToFront(e)
+		return
+	}
+	s.entries[key] = s.order.PushFront(&etagEntry{key, etag, body})
+	for s.max > 0 && s.order.Len() > s.max {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*etagEntry).key)
+	}
+}
@@ -0,0 +1,53 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestETagStore(t *testing.T) {
+	sent, notModified := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"1-abc"` {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		sent++
+		w.Header().Set("ETag", `"1-abc"`)
+		fmt.Fprint(w, `{"_id":"doc","_rev":"1-abc","Foo":7}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithETagStore(NewMemoryETagStore(10)))
+	for i := 0; i < 3; i++ {
+		r := DBRecord{}
+		rev, err := db.Retrieve("doc", &r)
+		if err != nil {
+			t.Fatalf("failed to retrieve: %s", err)
+		}
+		if rev != "1-abc" || r.Foo != 7 {
+			t.Fatalf("retrieve %d: got rev %s, Foo %d", i, rev, r.Foo)
+		}
+	}
+	if sent != 1 || notModified != 2 {
+		t.Fatalf("expected 1 full and 2 conditional responses, got %d and %d", sent, notModified)
+	}
+}
+
+func TestMemoryETagStoreEviction(t *testing.T) {
+	s := NewMemoryETagStore(2)
+	s.Put("a", "1", nil)
+	s.Put("b", "2", nil)
+	s.Get("a")
+	s.Put("c", "3", nil)
+	if _, _, ok := s.Get("b"); ok {
+		t.Fatalf("expected least recently used entry to be evicted")
+	}
+	if _, _, ok := s.Get("a"); !ok {
+		t.Fatalf("expected recently used entry to be kept")
+	}
+}
@@ -0,0 +1,125 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strconv"
+)
+
+// ExportOptions configure Export.
+type ExportOptions struct {
+	PageSize int // documents per request; 0 means 1000
+}
+
+// ExportResult is the outcome of Export.
+type ExportResult struct {
+	Docs int // lines written, including tombstones
+	Seq  Seq // the last_seq of the final batch of changes
+}
+
+// Export writes the database to w in Dump's format, as a snapshot
+// consistent as of a single update sequence, rather than the fuzzy crawl
+// of Dump. It records the database's update_seq, pages through
+// _all_docs, and then appends the changes made since the recorded seq,
+// until it runs out. Documents changed during the export so appear more
+// than once, each time superseding the last, and those deleted appear as
+// tombstones, {"_id", "_rev", "_deleted": true}: a dump must be replayed
+// in order. The result's Seq isn't the recorded update_seq but the
+// last_seq of the final batch of changes, which can be passed to
+// DumpIncremental to carry on from where the export ended.
+func (p Database) Export(w io.Writer, opts ExportOptions) (ExportResult, error) {
+	return p.ExportContext(context.Background(), w, opts)
+}
+
+// ExportContext is Export, bounded by ctx.
+func (p Database) ExportContext(ctx context.Context, w io.Writer, opts ExportOptions) (ExportResult, error) {
+	if opts.PageSize <= 0 {
+		opts.PageSize = 1000
+	}
+	info, err := p.InfoContext(ctx)
+	if err != nil {
+		return ExportResult{}, err
+	}
+	line := &bytes.Buffer{}
+	result := ExportResult{}
+	last := ""
+	for page := 0; ; page++ {
+		q := url.Values{
+			"include_docs": {"true"},
+			"attachments":  {"true"},
+			"limit":        {strconv.Itoa(opts.PageSize)},
+		}
+		if page > 0 {
+			q.Set("startkey", string(mustJSON(last)))
+			q.Set("skip", "1")
+		}
+		rows := 0
+		err := p.streamField(ctx, "_all_docs", q.Encode(), "rows", func(raw json.RawMessage) error {
+			row := struct {
+				Id  string          `json:"id"`
+				Doc json.RawMessage `json:"doc"`
+			}{}
+			if err := json.Unmarshal(raw, &row); err != nil {
+				return err
+			}
+			rows++
+			last = row.Id
+			if len(row.Doc) == 0 || string(row.Doc) == "null" {
+				return nil // deleted since the fence; the changes will say
+			}
+			if err := writeDumpLine(w, line, row.Doc); err != nil {
+				return err
+			}
+			result.Docs++
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+		if rows < opts.PageSize {
+			break
+		}
+	}
+	n, seq, err := p.dumpChanges(ctx, w, info.UpdateSeq, opts.PageSize)
+	result.Docs += n
+	result.Seq = seq
+	return result, err
+}
+
+// dumpChanges writes the documents changed since the given sequence to w,
+// in batches of up to limit, until a batch comes back short, returning
+// how many lines it wrote and the sequence it got to.
+func (p Database) dumpChanges(ctx context.Context, w io.Writer, since Seq, limit int) (int, Seq, error) {
+	line := &bytes.Buffer{}
+	n := 0
+	for {
+		r := ChangesResponse{}
+		opts := ChangesOptions{Since: since, Limit: limit, IncludeDocs: true}
+		if err := p.changes(ctx, opts, url.Values{"attachments": {"true"}}, &r); err != nil {
+			return n, since, err
+		}
+		for _, c := range r.Results {
+			doc := c.Doc
+			if c.Deleted && (len(doc) == 0 || string(doc) == "null") {
+				doc = mustJSON(map[string]interface{}{"_id": c.Id, "_rev": c.Rev(), "_deleted": true})
+			}
+			if len(doc) == 0 || string(doc) == "null" {
+				continue
+			}
+			if err := writeDumpLine(w, line, doc); err != nil {
+				return n, since, err
+			}
+			n++
+		}
+		if r.LastSeq != "" {
+			since = r.LastSeq
+		}
+		if len(r.Results) < limit {
+			return n, since, nil
+		}
+	}
+}
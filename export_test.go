@@ -0,0 +1,61 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExport(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch r.URL.Path {
+		case "/db":
+			fmt.Fprint(w, `{"db_name":"db","update_seq":"10-x"}`)
+		case "/db/_all_docs":
+			switch q.Get("startkey") {
+			case "":
+				fmt.Fprint(w, `{"rows":[{"id":"a","doc":{"_id":"a","_rev":"1-a"}},{"id":"b","doc":{"_id":"b","_rev":"1-b"}}]}`)
+			case `"b"`:
+				if q.Get("skip") != "1" {
+					t.Errorf("second page: expected skip=1, got %s", r.URL.RawQuery)
+				}
+				// c was deleted after the fence
+				fmt.Fprint(w, `{"rows":[{"id":"c","doc":null}]}`)
+			default:
+				t.Errorf("unexpected page %s", r.URL.RawQuery)
+			}
+		case "/db/_changes":
+			switch q.Get("since") {
+			case "10-x":
+				fmt.Fprint(w, `{"results":[
+					{"seq":"11-x","id":"a","changes":[{"rev":"2-a"}],"doc":{"_id":"a","_rev":"2-a","n":2}},
+					{"seq":"12-x","id":"c","changes":[{"rev":"2-c"}],"deleted":true}],"last_seq":"12-x"}`)
+			case "12-x":
+				fmt.Fprint(w, `{"results":[],"last_seq":"12-x"}`)
+			default:
+				t.Errorf("unexpected changes since %s", q.Get("since"))
+			}
+		}
+	}))
+	defer ts.Close()
+	buf := &bytes.Buffer{}
+	result, err := newTestDatabase(ts).Export(buf, ExportOptions{PageSize: 2})
+	if err != nil {
+		t.Fatalf("export: %s", err)
+	}
+	want := `{"_id":"a","_rev":"1-a"}
+{"_id":"b","_rev":"1-b"}
+{"_id":"a","_rev":"2-a","n":2}
+{"_deleted":true,"_id":"c","_rev":"2-c"}
+`
+	if buf.String() != want {
+		t.Fatalf("export: expected %q, got %q", want, buf)
+	}
+	if result != (ExportResult{Docs: 4, Seq: "12-x"}) {
+		t.Fatalf("result: expected 4 lines as of 12-x, got %+v", result)
+	}
+}
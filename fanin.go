@@ -0,0 +1,259 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AggregatorOptions configure an Aggregator.
+type AggregatorOptions struct {
+	// Match picks the databases to follow by name; nil means every
+	// database but the system ones, whose names start with "_".
+	Match func(name string) bool
+
+	// Consumer configures the Consumer of each database. Its
+	// Checkpointer is ignored in favour of Checkpointer below.
+	Consumer ConsumerOptions
+
+	// Checkpointer returns the Checkpointer of a database's Consumer, eg.
+	// a LocalCheckpointer in the database itself; nil means each is a
+	// MemoryCheckpointer.
+	Checkpointer func(db Database) Checkpointer
+}
+
+// DBChange is a change from one of the databases an Aggregator follows.
+type DBChange struct {
+	DB string
+	Change
+}
+
+// Aggregator merges the changes feeds of many databases on a server, eg.
+// one per tenant, into a single stream, as for a global index. Databases
+// are discovered from _all_dbs and then _db_updates, so those created
+// later are followed too, and those deleted are dropped. Each database
+// has its own Consumer, so its own checkpoint; changes from different
+// databases are interleaved as they arrive, but those of each database
+// stay in order.
+type Aggregator struct {
+	s    Server
+	opts AggregatorOptions
+
+	mu        sync.Mutex
+	consumers map[string]*aggregated
+}
+
+type aggregated struct {
+	consumer *Consumer
+	cancel   context.CancelFunc
+}
+
+// aggregatedChange is a change waiting to be handled, with where to send
+// the result.
+type aggregatedChange struct {
+	DBChange
+	done chan error
+}
+
+// NewAggregator returns an Aggregator of the server's databases.
+func (s Server) NewAggregator(opts AggregatorOptions) *Aggregator {
+	if opts.Match == nil {
+		opts.Match = func(name string) bool { return !strings.HasPrefix(name, "_") }
+	}
+	if opts.Checkpointer == nil {
+		opts.Checkpointer = func(Database) Checkpointer { return &MemoryCheckpointer{} }
+	}
+	return &Aggregator{s: s, opts: opts, consumers: map[string]*aggregated{}}
+}
+
+// Databases returns the names of the databases being followed, sorted.
+func (a *Aggregator) Databases() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	names := []string{}
+	for name := range a.consumers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stats returns the stats of the Consumer of each database followed.
+func (a *Aggregator) Stats() map[string]ConsumerStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := map[string]ConsumerStats{}
+	for name, c := range a.consumers {
+		stats[name] = c.consumer.Stats()
+	}
+	return stats
+}
+
+// Run follows the databases until ctx is done or fn returns an error,
+// which Run returns. fn is called for one change at a time, and a
+// database's checkpoint only moves on once fn has handled its changes.
+func (a *Aggregator) Run(ctx context.Context, fn func(DBChange) error) error {
+	ctx, done, err := a.s.client().background(ctx)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return closedErr(ctx, a.run(ctx, fn))
+}
+
+func (a *Aggregator) run(ctx context.Context, fn func(DBChange) error) error {
+	wg := sync.WaitGroup{}
+	defer wg.Wait() // after cancel, below
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := make(chan aggregatedChange)
+	errs := make(chan error, 1)
+	start := func(name string) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if _, ok := a.consumers[name]; ok || !a.opts.Match(name) {
+			return
+		}
+		db := a.s.database(name)
+		opts := a.opts.Consumer
+		opts.Checkpointer = a.opts.Checkpointer(db)
+		c := &aggregated{consumer: db.NewConsumer(opts)}
+		var cctx context.Context
+		cctx, c.cancel = context.WithCancel(ctx)
+		a.consumers[name] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := c.consumer.Run(cctx, func(ch Change) error {
+				done := make(chan error, 1)
+				select {
+				case changes <- aggregatedChange{DBChange{name, ch}, done}:
+				case <-cctx.Done():
+					return cctx.Err()
+				}
+				return <-done
+			})
+			if err != nil && cctx.Err() == nil {
+				select {
+				case errs <- fmt.Errorf("%s: %w", name, err):
+				default:
+				}
+			}
+		}()
+	}
+	stop := func(name string) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if c, ok := a.consumers[name]; ok {
+			c.cancel()
+			delete(a.consumers, name)
+		}
+	}
+	defer func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		for name, c := range a.consumers {
+			c.cancel()
+			delete(a.consumers, name)
+		}
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := a.discover(ctx, start, stop); err != nil && ctx.Err() == nil {
+			select {
+			case errs <- err:
+			default:
+			}
+		}
+	}()
+	for {
+		select {
+		case ch := <-changes:
+			err := fn(ch.DBChange)
+			ch.done <- err
+			if err != nil {
+				return err
+			}
+		case err := <-errs:
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// dbUpdate is an event of the _db_updates feed.
+type dbUpdate struct {
+	Name string `json:"db_name"`
+	Type string `json:"type"` // "created", "updated" or "deleted"
+}
+
+// discover starts a consumer for every database there is, and then for
+// each one created, stopping those of databases deleted, until ctx is
+// done.
+func (a *Aggregator) discover(ctx context.Context, start, stop func(string)) error {
+	base := a.s.BaseURL()
+	c := a.s.client()
+	// note where the feed is before listing, so no database is missed
+	r := struct {
+		Results []dbUpdate `json:"results"`
+		LastSeq Seq        `json:"last_seq"`
+	}{}
+	if err := c.unmarshalURLContext(ctx, base+"/_db_updates?since=now", &r); err != nil {
+		return err
+	}
+	names := []string{}
+	if err := c.unmarshalURLContext(ctx, base+"/_all_dbs", &names); err != nil {
+		return err
+	}
+	for _, name := range names {
+		start(name)
+	}
+	timeout := a.opts.Consumer.PollTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	retry := a.opts.Consumer.RetryDelay
+	if retry <= 0 {
+		retry = time.Second
+	}
+	since := r.LastSeq
+	for {
+		v := url.Values{
+			"feed":    {"longpoll"},
+			"since":   {string(since)},
+			"timeout": {strconv.FormatInt(int64(timeout/time.Millisecond), 10)},
+		}
+		r.Results, r.LastSeq = nil, ""
+		if err := c.unmarshalURLContext(ctx, base+"/_db_updates?"+v.Encode(), &r); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			select {
+			case <-time.After(retry):
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		for _, u := range r.Results {
+			switch u.Type {
+			case "created", "updated":
+				start(u.Name)
+			case "deleted":
+				stop(u.Name)
+			}
+		}
+		if r.LastSeq != "" {
+			since = r.LastSeq
+		}
+	}
+}
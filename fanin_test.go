@@ -0,0 +1,89 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAggregator(t *testing.T) {
+	mu := sync.Mutex{}
+	served := map[string]bool{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case r.URL.Path == "/_db_updates" && q.Get("since") == "now":
+			fmt.Fprint(w, `{"results":[],"last_seq":"1-a"}`)
+			return
+		case r.URL.Path == "/_db_updates" && q.Get("since") == "1-a":
+			fmt.Fprint(w, `{"results":[{"db_name":"tenant-c","type":"created","seq":"2-b"},{"db_name":"tenant-a","type":"updated","seq":"3-c"}],"last_seq":"3-c"}`)
+			return
+		case r.URL.Path == "/_all_dbs":
+			fmt.Fprint(w, `["_users","tenant-a","tenant-b"]`)
+			return
+		case strings.HasSuffix(r.URL.Path, "/_changes"):
+			db := strings.Split(r.URL.Path, "/")[1]
+			mu.Lock()
+			first := !served[db]
+			served[db] = true
+			mu.Unlock()
+			if first {
+				fmt.Fprintf(w, `{"results":[{"seq":"1-x","id":"%s-doc","changes":[{"rev":"1-x"}]}],"last_seq":"1-x"}`, db)
+				return
+			}
+		}
+		// long polls with nothing new
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+		fmt.Fprint(w, `{"results":[],"last_seq":"1-x"}`)
+	}))
+	defer ts.Close()
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	cps := map[string]*MemoryCheckpointer{}
+	a := Server{Host: host, Port: port}.NewAggregator(AggregatorOptions{
+		Consumer: ConsumerOptions{PollTimeout: time.Second, RetryDelay: time.Millisecond},
+		Checkpointer: func(db Database) Checkpointer {
+			mu.Lock()
+			defer mu.Unlock()
+			cps[db.Name] = &MemoryCheckpointer{}
+			return cps[db.Name]
+		},
+	})
+	got := []string{}
+	stop := errors.New("stop")
+	err := a.Run(context.Background(), func(ch DBChange) error {
+		got = append(got, ch.DB+" "+ch.Id)
+		if len(got) == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+	sort.Strings(got)
+	expected := []string{"tenant-a tenant-a-doc", "tenant-b tenant-b-doc", "tenant-c tenant-c-doc"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("changes: expected %v, got %v", expected, got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(cps) != 3 || cps["_users"] != nil {
+		t.Fatalf("checkpointers: got %v", cps)
+	}
+	if len(a.Databases()) != 0 {
+		t.Fatalf("databases: expected none after Run, got %v", a.Databases())
+	}
+}
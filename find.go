@@ -0,0 +1,268 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// FindOptions are the parameters of a Mango query, besides its selector.
+// Zero values leave the server defaults in place.
+type FindOptions struct {
+	Fields    []string      // fields of each document to return; nil means all
+	Sort      []interface{} // eg. []interface{}{"name", map[string]string{"age": "desc"}}
+	Limit     int           // 0 means the server default, 25
+	Skip      int
+	UseIndex  interface{} // a design document name, or []string{ddoc, index}
+	Bookmark  string      // continue from a previous response's Bookmark
+	Conflicts bool        // include _conflicts in each document
+	Update    *bool       // nil means update the index before answering
+	Stable    bool        // answer from the same shard replicas every time
+
+	// ExecutionStats asks for the response's ExecutionStats.
+	ExecutionStats bool
+}
+
+// body builds the request body of a query for selector.
+func (o FindOptions) body(selector interface{}) ([]byte, error) {
+	if selector == nil {
+		return nil, fmt.Errorf("no selector specified")
+	}
+	m := map[string]interface{}{"selector": selector}
+	if o.Fields != nil {
+		m["fields"] = o.Fields
+	}
+	if o.Sort != nil {
+		m["sort"] = o.Sort
+	}
+	if o.Limit > 0 {
+		m["limit"] = o.Limit
+	}
+	if o.Skip > 0 {
+		m["skip"] = o.Skip
+	}
+	if o.UseIndex != nil {
+		m["use_index"] = o.UseIndex
+	}
+	if o.Bookmark != "" {
+		m["bookmark"] = o.Bookmark
+	}
+	if o.Conflicts {
+		m["conflicts"] = true
+	}
+	if o.Update != nil {
+		m["update"] = *o.Update
+	}
+	if o.Stable {
+		m["stable"] = true
+	}
+	if o.ExecutionStats {
+		m["execution_stats"] = true
+	}
+	return json.Marshal(m)
+}
+
+// FindResponse is the response to a Mango query. Bookmark continues the
+// query with FindOptions.Bookmark; Warning is set when CouchDB had to
+// scan, eg. because no index matched the selector. ExecutionStats is set
+// if FindOptions.ExecutionStats asked for it.
+type FindResponse struct {
+	Docs           []json.RawMessage `json:"docs"`
+	Bookmark       string            `json:"bookmark,omitempty"`
+	Warning        string            `json:"warning,omitempty"`
+	ExecutionStats *ExecutionStats   `json:"execution_stats,omitempty"`
+}
+
+// ExecutionStats describe the work CouchDB did to answer a Mango query.
+// Many more keys or documents examined than results returned suggest the
+// query needs a better index.
+type ExecutionStats struct {
+	KeysExamined       int64   `json:"total_keys_examined"`
+	DocsExamined       int64   `json:"total_docs_examined"`
+	QuorumDocsExamined int64   `json:"total_quorum_docs_examined"`
+	ResultsReturned    int64   `json:"results_returned"`
+	ExecutionTimeMs    float64 `json:"execution_time_ms"`
+}
+
+// ExecutionTime returns ExecutionTimeMs as a Duration.
+func (s ExecutionStats) ExecutionTime() time.Duration {
+	return time.Duration(s.ExecutionTimeMs * float64(time.Millisecond))
+}
+
+// Find runs a Mango query via _find, eg.
+//
+//	r, err := db.Find(map[string]interface{}{"type": "user"}, couch.FindOptions{Limit: 10})
+func (p Database) Find(selector interface{}, opts FindOptions) (FindResponse, error) {
+	return p.FindContext(context.Background(), selector, opts)
+}
+
+// FindContext is Find, but gives up when ctx is done.
+func (p Database) FindContext(ctx context.Context, selector interface{}, opts FindOptions) (FindResponse, error) {
+	in, err := opts.body(selector)
+	if err != nil {
+		return FindResponse{}, err
+	}
+	sampled := p.noteFind(selector, opts)
+	r := FindResponse{}
+	u := fmt.Sprintf("%s/_find", p.DBURL())
+	if _, err := p.client().interactContext(ctx, "POST", u, map[string][]string{}, in, &r); err != nil {
+		return FindResponse{}, err
+	}
+	if !sampled {
+		p.noteFindWarning(r.Warning)
+	}
+	return r, nil
+}
+
+// FindStream runs a Mango query like Find, but returns a DocReader which
+// decodes the matching documents one at a time as they arrive, so large
+// result sets are never held in memory. The caller must Close it.
+func (p Database) FindStream(selector interface{}, opts FindOptions) (*DocReader, error) {
+	return p.FindStreamContext(context.Background(), selector, opts)
+}
+
+// FindStreamContext is FindStream, bounded by ctx.
+func (p Database) FindStreamContext(ctx context.Context, selector interface{}, opts FindOptions) (*DocReader, error) {
+	in, err := opts.body(selector)
+	if err != nil {
+		return nil, err
+	}
+	p.noteFind(selector, opts)
+	u := fmt.Sprintf("%s/_find", p.DBURL())
+	r, err := p.client().request(ctx, "POST", u, map[string][]string{}, in)
+	if err != nil {
+		return nil, err
+	}
+	dr, err := newDocReader(r.Body, "docs")
+	if err != nil {
+		r.Body.Close()
+		return nil, err
+	}
+	dr.warn = func(w string) { p.client().logWarning(u, w) }
+	return dr, nil
+}
+
+// DocReader reads documents one at a time from a response, like
+// bufio.Scanner:
+//
+//	for dr.Next() {
+//		if err := dr.Decode(&doc); err != nil { ... }
+//	}
+//	if err := dr.Err(); err != nil { ... }
+//
+// Once Next returns false, Bookmark, Warning and ExecutionStats hold
+// those members of the response.
+type DocReader struct {
+	Bookmark       string
+	Warning        string
+	ExecutionStats *ExecutionStats
+
+	body  io.ReadCloser
+	dec   *json.Decoder
+	field string
+	warn  func(string) // logs Warning, if set
+	doc   json.RawMessage
+	done  bool
+	err   error
+}
+
+// newDocReader reads body up to the start of its array member field.
+func newDocReader(body io.ReadCloser, field string) (*DocReader, error) {
+	dr := &DocReader{body: body, dec: json.NewDecoder(body), field: field}
+	if err := expectDelim(dr.dec, '{'); err != nil {
+		return nil, err
+	}
+	for {
+		if !dr.dec.More() {
+			return nil, fmt.Errorf("malformed response: no %q member", field)
+		}
+		found, err := dr.member()
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			return dr, expectDelim(dr.dec, '[')
+		}
+	}
+}
+
+// member reads the next member of the response object, up to the value
+// if it's the array being read, and otherwise keeping what's wanted.
+func (dr *DocReader) member() (bool, error) {
+	t, err := dr.dec.Token()
+	if err != nil {
+		return false, err
+	}
+	var dest interface{} = &json.RawMessage{}
+	switch t {
+	case dr.field:
+		return true, nil
+	case "bookmark":
+		dest = &dr.Bookmark
+	case "warning":
+		dest = &dr.Warning
+	case "execution_stats":
+		dest = &dr.ExecutionStats
+	}
+	return false, dr.dec.Decode(dest)
+}
+
+// Next advances to the next document, returning false when there are no
+// more or on error.
+func (dr *DocReader) Next() bool {
+	if dr.done {
+		return false
+	}
+	if dr.dec.More() {
+		dr.doc = nil
+		if dr.err = dr.dec.Decode(&dr.doc); dr.err == nil {
+			return true
+		}
+	} else {
+		dr.err = dr.finish()
+	}
+	dr.doc, dr.done = nil, true
+	return false
+}
+
+// finish reads the rest of the response after the array.
+func (dr *DocReader) finish() error {
+	if err := expectDelim(dr.dec, ']'); err != nil {
+		return err
+	}
+	for dr.dec.More() {
+		if _, err := dr.member(); err != nil {
+			return err
+		}
+	}
+	if dr.warn != nil {
+		dr.warn(dr.Warning)
+	}
+	return expectDelim(dr.dec, '}')
+}
+
+// Raw returns the current document as JSON.
+func (dr *DocReader) Raw() json.RawMessage {
+	return dr.doc
+}
+
+// Decode decodes the current document into v, as Retrieve would.
+func (dr *DocReader) Decode(v interface{}) error {
+	if dr.doc == nil {
+		return fmt.Errorf("no current document")
+	}
+	return unmarshalDoc(dr.doc, v)
+}
+
+// Err returns the error which stopped Next, if any.
+func (dr *DocReader) Err() error {
+	return dr.err
+}
+
+// Close releases the response.
+func (dr *DocReader) Close() error {
+	return dr.body.Close()
+}
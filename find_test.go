@@ -0,0 +1,148 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFindOptionsBody(t *testing.T) {
+	update := false
+	b, err := FindOptions{
+		Fields:   []string{"_id", "name"},
+		Sort:     []interface{}{map[string]string{"name": "desc"}},
+		Limit:    10,
+		UseIndex: []string{"_design/idx", "by_name"},
+		Update:   &update,
+	}.body(map[string]interface{}{"type": "user"})
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	expected := `{"fields":["_id","name"],"limit":10,"selector":{"type":"user"},"sort":[{"name":"desc"}],"update":false,"use_index":["_design/idx","by_name"]}`
+	if string(b) != expected {
+		t.Fatalf("body: expected %s, got %s", expected, b)
+	}
+	if _, err := (FindOptions{}).body(nil); err == nil {
+		t.Fatalf("expected error for nil selector")
+	}
+}
+
+const findResponse = `{"docs":[{"_id":"a","_rev":"1-a","name":"Ann"},{"_id":"b","_rev":"1-b","name":"Bo"}],"bookmark":"g1AAAA","warning":"No matching index found"}`
+
+func TestFind(t *testing.T) {
+	body := map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/db/_find" {
+			t.Errorf("request: got %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, findResponse)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	r, err := db.Find(map[string]interface{}{"type": "user"}, FindOptions{Bookmark: "g0"})
+	if err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	if body["bookmark"] != "g0" {
+		t.Fatalf("bookmark: expected g0 to be sent, got %v", body["bookmark"])
+	}
+	if len(r.Docs) != 2 || r.Bookmark != "g1AAAA" || r.Warning == "" {
+		t.Fatalf("response: got %+v", r)
+	}
+}
+
+func TestFindStream(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, findResponse)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	dr, err := db.FindStream(map[string]interface{}{"type": "user"}, FindOptions{})
+	if err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	defer dr.Close()
+	type user struct {
+		ID   string `json:"-" couch:"id"`
+		Name string `json:"name"`
+	}
+	users := []user{}
+	for dr.Next() {
+		u := user{}
+		if err := dr.Decode(&u); err != nil {
+			t.Fatalf("failed to decode: %s", err)
+		}
+		users = append(users, u)
+	}
+	if err := dr.Err(); err != nil {
+		t.Fatalf("failed to read: %s", err)
+	}
+	if !reflect.DeepEqual(users, []user{{"a", "Ann"}, {"b", "Bo"}}) {
+		t.Fatalf("docs: got %+v", users)
+	}
+	if dr.Bookmark != "g1AAAA" || dr.Warning != "No matching index found" {
+		t.Fatalf("trailer: got %q %q", dr.Bookmark, dr.Warning)
+	}
+}
+
+func TestFindExecutionStats(t *testing.T) {
+	body := map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"docs":[{"_id":"a"}],"bookmark":"g1","execution_stats":{"total_keys_examined":0,"total_docs_examined":200,"total_quorum_docs_examined":0,"results_returned":1,"execution_time_ms":12.5}}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	selector := map[string]interface{}{"type": "user"}
+	r, err := db.Find(selector, FindOptions{ExecutionStats: true})
+	if err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	if body["execution_stats"] != true {
+		t.Fatalf("execution_stats: expected true to be sent, got %v", body["execution_stats"])
+	}
+	expected := ExecutionStats{DocsExamined: 200, ResultsReturned: 1, ExecutionTimeMs: 12.5}
+	if r.ExecutionStats == nil || *r.ExecutionStats != expected {
+		t.Fatalf("stats: expected %+v, got %+v", expected, r.ExecutionStats)
+	}
+	if d := r.ExecutionStats.ExecutionTime(); d != 12500*time.Microsecond {
+		t.Fatalf("execution time: expected 12.5ms, got %s", d)
+	}
+
+	dr, err := db.FindStream(selector, FindOptions{ExecutionStats: true})
+	if err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	defer dr.Close()
+	for dr.Next() {
+	}
+	if dr.Err() != nil || dr.ExecutionStats == nil || *dr.ExecutionStats != expected {
+		t.Fatalf("stream stats: got %+v, %v", dr.ExecutionStats, dr.Err())
+	}
+}
+
+func TestDocReaderMalformed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"warning":"w","docs":[{"_id":"a"},`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	dr, err := db.FindStream(map[string]interface{}{}, FindOptions{})
+	if err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	defer dr.Close()
+	n := 0
+	for dr.Next() {
+		n++
+	}
+	if n != 1 || dr.Err() == nil || dr.Warning != "w" {
+		t.Fatalf("expected 1 doc then an error, got %d docs, %v", n, dr.Err())
+	}
+}
@@ -0,0 +1,131 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// HotDocsOptions configure the access counting enabled by WithHotDocs.
+type HotDocsOptions struct {
+	Window time.Duration    // how long accesses are counted for; 0 means a minute
+	Clock  func() time.Time // defaults to time.Now
+}
+
+// WithHotDocs makes the Client count reads and writes of each document,
+// for HotDocs. Documents which top the list are contended (if written) or
+// good candidates for caching (if read).
+func WithHotDocs(opts HotDocsOptions) Option {
+	return func(c *Client) {
+		if opts.Window <= 0 {
+			opts.Window = time.Minute
+		}
+		if opts.Clock == nil {
+			opts.Clock = time.Now
+		}
+		c.hotDocs = &hotDocs{opts: opts, current: map[[2]string]*DocHeat{}}
+	}
+}
+
+// DocHeat counts the accesses to one document.
+type DocHeat struct {
+	DB     string
+	ID     string
+	Reads  int
+	Writes int
+}
+
+// Total is the number of reads and writes.
+func (h DocHeat) Total() int {
+	return h.Reads + h.Writes
+}
+
+// hotDocs counts accesses in the current window, keeping the counts of
+// the previous one, so there's always at least a window's worth.
+type hotDocs struct {
+	opts HotDocsOptions
+
+	mu       sync.Mutex
+	start    time.Time
+	current  map[[2]string]*DocHeat // {db, id}
+	previous map[[2]string]*DocHeat
+}
+
+// rotate starts a new window if the current one is over.
+func (h *hotDocs) rotate(now time.Time) {
+	if h.start.IsZero() {
+		h.start = now
+	}
+	if elapsed := now.Sub(h.start); elapsed >= h.opts.Window {
+		h.previous = h.current
+		if elapsed >= 2*h.opts.Window {
+			h.previous = nil
+		}
+		h.current = map[[2]string]*DocHeat{}
+		h.start = now
+	}
+}
+
+func (h *hotDocs) record(db, id string, write bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rotate(h.opts.Clock())
+	d, ok := h.current[[2]string{db, id}]
+	if !ok {
+		d = &DocHeat{DB: db, ID: id}
+		h.current[[2]string{db, id}] = d
+	}
+	if write {
+		d.Writes++
+	} else {
+		d.Reads++
+	}
+}
+
+// HotDocs returns the n most accessed documents (all of them if n is
+// negative), busiest first, counting accesses over the last one to two
+// windows, or nil without WithHotDocs.
+func (c *Client) HotDocs(n int) []DocHeat {
+	h := c.hotDocs
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	h.rotate(h.opts.Clock())
+	sums := map[[2]string]DocHeat{}
+	for _, counts := range []map[[2]string]*DocHeat{h.previous, h.current} {
+		for k, d := range counts {
+			sum := sums[k]
+			sum.DB, sum.ID = d.DB, d.ID
+			sum.Reads += d.Reads
+			sum.Writes += d.Writes
+			sums[k] = sum
+		}
+	}
+	h.mu.Unlock()
+	hot := []DocHeat{}
+	for _, d := range sums {
+		hot = append(hot, d)
+	}
+	sort.Slice(hot, func(i, j int) bool {
+		if hot[i].Total() != hot[j].Total() {
+			return hot[i].Total() > hot[j].Total()
+		}
+		if hot[i].DB != hot[j].DB {
+			return hot[i].DB < hot[j].DB
+		}
+		return hot[i].ID < hot[j].ID
+	})
+	if n >= 0 && len(hot) > n {
+		hot = hot[:n]
+	}
+	return hot
+}
+
+// noteAccess counts a read or write of document id, if enabled.
+func (p Database) noteAccess(id string, write bool) {
+	if h := p.client().hotDocs; h != nil && id != "" {
+		h.record(p.Name, id, write)
+	}
+}
@@ -0,0 +1,54 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHotDocs(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprintf(w, `{"_id":"%s","_rev":"1-x"}`, r.URL.Path[len("/db/"):])
+		default:
+			fmt.Fprintf(w, `{"ok":true,"id":"%s","rev":"2-x"}`, r.URL.Path[len("/db/"):])
+		}
+	}))
+	defer ts.Close()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClient(WithHotDocs(HotDocsOptions{Window: time.Minute, Clock: func() time.Time { return now }}))
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	db := Database{Host: host, Port: port, Name: "db", Client: c}
+
+	doc := map[string]interface{}{}
+	for _, id := range []string{"a", "b", "a", "c", "a"} {
+		if _, err := db.Retrieve(id, &doc); err != nil {
+			t.Fatalf("failed to retrieve %s: %s", id, err)
+		}
+	}
+	if _, err := db.EditWith(map[string]interface{}{}, "b", "1-x"); err != nil {
+		t.Fatalf("failed to edit: %s", err)
+	}
+	expected := []DocHeat{{"db", "a", 3, 0}, {"db", "b", 1, 1}}
+	if got := c.HotDocs(2); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("hot docs: expected %v, got %v", expected, got)
+	}
+
+	// the previous window still counts...
+	now = now.Add(time.Minute)
+	db.Retrieve("c", &doc)
+	if got := c.HotDocs(1); !reflect.DeepEqual(got, []DocHeat{{"db", "a", 3, 0}}) {
+		t.Fatalf("next window: got %v", got)
+	}
+	// ...but not the one before
+	now = now.Add(time.Minute)
+	if got := c.HotDocs(-1); !reflect.DeepEqual(got, []DocHeat{{"db", "c", 1, 0}}) {
+		t.Fatalf("after two windows: got %v", got)
+	}
+}
@@ -0,0 +1,111 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// IDSeparator separates the segments of ids built by JoinID.
+const IDSeparator = ":"
+
+// JoinID builds a structured document id, such as "user:123:order:456",
+// from its segments, so that ids sharing leading segments can be listed
+// with AllDocsByPrefix. Segments may not be empty or contain IDSeparator,
+// as the id couldn't then be split back apart.
+func JoinID(segments ...string) (string, error) {
+	if len(segments) == 0 {
+		return "", fmt.Errorf("no id segments")
+	}
+	for _, s := range segments {
+		if s == "" || strings.Contains(s, IDSeparator) {
+			return "", fmt.Errorf("invalid id segment %q", s)
+		}
+	}
+	return strings.Join(segments, IDSeparator), nil
+}
+
+// SplitID splits an id built by JoinID back into its segments.
+func SplitID(id string) []string {
+	return strings.Split(id, IDSeparator)
+}
+
+// sortableTimeDigits is wide enough for any millisecond Unix time up to
+// the year 33658.
+const sortableTimeDigits = 15
+
+// SortableTime formats t as its Unix time in milliseconds, zero-padded
+// to a fixed width, so ids embedding it sort chronologically. Times
+// before 1970 aren't supported.
+func SortableTime(t time.Time) string {
+	return fmt.Sprintf("%0*d", sortableTimeDigits, t.UnixMilli())
+}
+
+// ParseSortableTime parses a segment formatted by SortableTime.
+func ParseSortableTime(s string) (time.Time, error) {
+	if len(s) != sortableTimeDigits {
+		return time.Time{}, fmt.Errorf("invalid sortable time %q", s)
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ms < 0 {
+		return time.Time{}, fmt.Errorf("invalid sortable time %q", s)
+	}
+	return time.UnixMilli(ms).UTC(), nil
+}
+
+// crockford is the ULID alphabet.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a new ULID (https://github.com/ulid/spec): 26
+// characters encoding the current time in milliseconds, then 80 random
+// bits. ULIDs sort by creation time (to the millisecond), which makes
+// them good ids, or id segments, for documents listed in time order.
+func NewULID() string {
+	return newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic(fmt.Sprintf("couch: reading random bytes: %s", err))
+	}
+	// 128 bits as 26 base 32 digits, the first holding just 3 bits
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[b[15]&31]
+		shiftRight5(&b)
+	}
+	return string(out)
+}
+
+// shiftRight5 shifts the 128-bit big-endian number b right by 5 bits.
+func shiftRight5(b *[16]byte) {
+	for i := 15; i > 0; i-- {
+		b[i] = b[i]>>5 | b[i-1]<<3
+	}
+	b[0] >>= 5
+}
+
+// ULIDTime returns the creation time encoded in a ULID.
+func ULIDTime(id string) (time.Time, error) {
+	if len(id) != 26 {
+		return time.Time{}, fmt.Errorf("invalid ULID %q", id)
+	}
+	var ms uint64
+	for _, c := range strings.ToUpper(id[:10]) {
+		d := strings.IndexRune(crockford, c)
+		if d < 0 {
+			return time.Time{}, fmt.Errorf("invalid ULID %q", id)
+		}
+		ms = ms<<5 | uint64(d)
+	}
+	// the first 10 digits hold 50 bits: 2 bits of padding, then the time
+	return time.UnixMilli(int64(ms)).UTC(), nil
+}
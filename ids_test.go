@@ -0,0 +1,61 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestJoinID(t *testing.T) {
+	id, err := JoinID("user", "123", "order", "456")
+	if err != nil {
+		t.Fatalf("failed to join: %s", err)
+	}
+	if id != "user:123:order:456" {
+		t.Fatalf("join: got %s", id)
+	}
+	if segs := SplitID(id); !reflect.DeepEqual(segs, []string{"user", "123", "order", "456"}) {
+		t.Fatalf("split: got %v", segs)
+	}
+	for _, bad := range [][]string{{}, {"a", ""}, {"a:b"}} {
+		if _, err := JoinID(bad...); err == nil {
+			t.Fatalf("join %q: expected error", bad)
+		}
+	}
+}
+
+func TestSortableTime(t *testing.T) {
+	when := time.Date(2012, 6, 1, 12, 30, 0, 5e6, time.UTC)
+	s := SortableTime(when)
+	if s != "001338553800005" {
+		t.Fatalf("sortable time: got %s", s)
+	}
+	back, err := ParseSortableTime(s)
+	if err != nil || !back.Equal(when) {
+		t.Fatalf("parse: expected %s, got %s (%v)", when, back, err)
+	}
+	if SortableTime(time.Unix(9, 0)) > s {
+		t.Fatalf("sortable times don't sort")
+	}
+}
+
+func TestULID(t *testing.T) {
+	when := time.Date(2016, 7, 30, 23, 54, 10, 259e6, time.UTC)
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		ids = append(ids, newULID(when.Add(time.Duration(i)*time.Millisecond)))
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Fatalf("ULIDs don't sort: %v", ids)
+	}
+	// the spec's example timestamp 1469922850259 encodes as 01ARZ3NDEK
+	if ids[0][:10] != "01ARZ3NDEK" {
+		t.Fatalf("time prefix: got %s", ids[0][:10])
+	}
+	back, err := ULIDTime(ids[0])
+	if err != nil || !back.Equal(when) {
+		t.Fatalf("ULIDTime: expected %s, got %s (%v)", when, back, err)
+	}
+}
@@ -0,0 +1,157 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexStatsOptions configure the index usage statistics enabled by
+// WithIndexStats.
+type IndexStatsOptions struct {
+	// ExplainEvery is how often Mango queries are explained to learn
+	// their index: 1 explains every Find, 10 every tenth; 0 never does,
+	// so only queries CouchDB warns have no index are counted.
+	ExplainEvery int
+	Clock        func() time.Time // defaults to time.Now
+}
+
+// WithIndexStats makes the Client count which views and Mango indexes
+// its queries use, for IndexStats. View queries are counted from their
+// URLs; Mango queries are sampled with _explain, which costs an extra
+// request each, and counted from CouchDB's "no matching index" warnings.
+func WithIndexStats(opts IndexStatsOptions) Option {
+	return func(c *Client) {
+		if opts.Clock == nil {
+			opts.Clock = time.Now
+		}
+		c.indexStats = &indexStats{opts: opts, usage: map[[2]string]*IndexUsage{}}
+	}
+}
+
+// IndexUsage counts the queries answered by one index. Index is a view
+// path like "_design/app/_view/by_name", a Mango index like
+// "_design/idx/by_type", or "_all_docs" for full scans; Type is "view",
+// or the Mango index type ("json", "text" or "special").
+type IndexUsage struct {
+	DB       string
+	Index    string
+	Type     string
+	Count    int
+	LastUsed time.Time
+}
+
+// FullScan reports whether the queries scanned the whole database.
+func (u IndexUsage) FullScan() bool {
+	return u.Type == "special" && u.Index == "_all_docs"
+}
+
+type indexStats struct {
+	opts IndexStatsOptions
+
+	mu    sync.Mutex
+	finds int
+	usage map[[2]string]*IndexUsage // {db, index}
+}
+
+// IndexStats returns the usage of every index queried through the Client
+// so far, by database and index, or nil without WithIndexStats. Indexes
+// which never appear are candidates for removal; full scans point at
+// missing ones.
+func (c *Client) IndexStats() []IndexUsage {
+	if c.indexStats == nil {
+		return nil
+	}
+	s := c.indexStats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	usage := []IndexUsage{}
+	for _, u := range s.usage {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].DB != usage[j].DB {
+			return usage[i].DB < usage[j].DB
+		}
+		return usage[i].Index < usage[j].Index
+	})
+	return usage
+}
+
+func (s *indexStats) record(db, index, typ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.usage[[2]string{db, index}]
+	if !ok {
+		u = &IndexUsage{DB: db, Index: index, Type: typ}
+		s.usage[[2]string{db, index}] = u
+	}
+	u.Count++
+	u.LastUsed = s.opts.Clock()
+}
+
+// sample reports whether this Mango query should be explained.
+func (s *indexStats) sample() bool {
+	if s.opts.ExplainEvery <= 0 {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.finds++
+	return s.finds%s.opts.ExplainEvery == 0
+}
+
+// recordView counts req if it's a view or _all_docs query, taking the
+// database name from the path segment before the index.
+func (s *indexStats) recordView(req *http.Request) {
+	segments := strings.Split(strings.Trim(req.URL.EscapedPath(), "/"), "/")
+	for i, seg := range segments {
+		switch {
+		case seg == "_all_docs" && i == len(segments)-1 && i > 0:
+			s.record(unescapeSegment(segments[i-1]), "_all_docs", "special")
+			return
+		case seg == "_design" && i > 0 && i+3 < len(segments) && segments[i+2] == "_view":
+			index := strings.Join([]string{"_design", unescapeSegment(segments[i+1]), "_view", unescapeSegment(segments[i+3])}, "/")
+			s.record(unescapeSegment(segments[i-1]), index, "view")
+			return
+		}
+	}
+}
+
+func unescapeSegment(seg string) string {
+	if s, err := url.PathUnescape(seg); err == nil {
+		return s
+	}
+	return seg
+}
+
+// noteFind counts a Mango query on p, explaining it if it's sampled.
+// It returns whether it did, so that warnings aren't counted twice.
+func (p Database) noteFind(selector interface{}, opts FindOptions) bool {
+	s := p.client().indexStats
+	if s == nil || !s.sample() {
+		return false
+	}
+	e, err := p.Explain(selector, opts)
+	if err != nil {
+		return false
+	}
+	index := e.Index.Name
+	if e.Index.DDoc != nil {
+		index = *e.Index.DDoc + "/" + e.Index.Name
+	}
+	s.record(p.Name, index, e.Index.Type)
+	return true
+}
+
+// noteFindWarning counts an unsampled Mango query which CouchDB warned
+// had no index.
+func (p Database) noteFindWarning(warning string) {
+	if s := p.client().indexStats; s != nil && strings.Contains(warning, "No matching index") {
+		s.record(p.Name, "_all_docs", "special")
+	}
+}
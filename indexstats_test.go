@@ -0,0 +1,63 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIndexStats(t *testing.T) {
+	explains := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_explain":
+			explains++
+			fmt.Fprint(w, `{"dbname":"db","index":{"ddoc":"_design/idx","name":"by_type","type":"json"}}`)
+		case "/db/_find":
+			fmt.Fprint(w, `{"docs":[],"warning":"No matching index found, create an index to optimize query time."}`)
+		default:
+			fmt.Fprint(w, `{"rows":[]}`)
+		}
+	}))
+	defer ts.Close()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClient(WithIndexStats(IndexStatsOptions{ExplainEvery: 2, Clock: func() time.Time { return now }}))
+	host, port, _ := net.SplitHostPort(ts.Listener.Addr().String())
+	db := Database{Host: host, Port: port, Name: "db", Client: c}
+
+	for i := 0; i < 2; i++ {
+		if err := db.QueryView("_design/app/_view/by_name", ViewOptions{}, &ViewResponse[string, int]{}); err != nil {
+			t.Fatalf("failed to query: %s", err)
+		}
+	}
+	if err := db.Query("_all_docs", nil, &ViewResponse[string, int]{}); err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := db.Find(map[string]interface{}{"type": "user"}, FindOptions{}); err != nil {
+			t.Fatalf("failed to find: %s", err)
+		}
+	}
+	if explains != 1 {
+		t.Fatalf("explains: expected 1, got %d", explains)
+	}
+	expected := []IndexUsage{
+		{DB: "db", Index: "_all_docs", Type: "special", Count: 2, LastUsed: now},
+		{DB: "db", Index: "_design/app/_view/by_name", Type: "view", Count: 2, LastUsed: now},
+		{DB: "db", Index: "_design/idx/by_type", Type: "json", Count: 1, LastUsed: now},
+	}
+	got := c.IndexStats()
+	if fmt.Sprint(got) != fmt.Sprint(expected) {
+		t.Fatalf("stats: expected %+v, got %+v", expected, got)
+	}
+	if !got[0].FullScan() || got[1].FullScan() {
+		t.Fatalf("full scans: got %+v", got)
+	}
+	if NewClient().IndexStats() != nil {
+		t.Fatalf("expected no stats without WithIndexStats")
+	}
+}
@@ -0,0 +1,80 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"time"
+)
+
+// DatabaseInfo is the summary returned by GET /{db}.
+type DatabaseInfo struct {
+	Name           string `json:"db_name"`
+	DocCount       int64  `json:"doc_count"`
+	DocDelCount    int64  `json:"doc_del_count"`
+	UpdateSeq      Seq    `json:"update_seq"`
+	PurgeSeq       Seq    `json:"purge_seq"`
+	CompactRunning bool   `json:"compact_running"`
+	Sizes          struct {
+		Active   int64 `json:"active"`   // bytes of live data
+		External int64 `json:"external"` // bytes of uncompressed documents
+		File     int64 `json:"file"`     // bytes on disk
+	} `json:"sizes"`
+	InstanceStartTime string `json:"instance_start_time"`
+}
+
+// Info returns the database's summary.
+func (p Database) Info() (DatabaseInfo, error) {
+	return p.InfoContext(context.Background())
+}
+
+// InfoContext is Info, but gives up when ctx is done.
+func (p Database) InfoContext(ctx context.Context) (DatabaseInfo, error) {
+	di := DatabaseInfo{}
+	if err := p.client().unmarshalURLContext(ctx, p.DBURL(), &di); err != nil {
+		return DatabaseInfo{}, err
+	}
+	return di, nil
+}
+
+// WatchInfo polls the database's summary every interval, sending each
+// snapshot on the returned channel, starting with one straight away, eg.
+// to alert when doc_del_count or the file size crosses a threshold. A
+// consumer that falls behind gets the latest snapshot, not a backlog.
+// Failed polls are logged to the Client's Logger, if any, and skipped.
+// The channel is closed when ctx is done or the Client is closed. An
+// interval of 0 or less means a minute.
+func (p Database) WatchInfo(ctx context.Context, interval time.Duration) <-chan DatabaseInfo {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	infos := make(chan DatabaseInfo, 1)
+	c := p.client()
+	ctx, done, err := c.background(ctx)
+	if err != nil {
+		close(infos)
+		return infos
+	}
+	go func() {
+		defer close(infos)
+		defer done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			if di, err := p.InfoContext(ctx); err == nil {
+				select {
+				case <-infos: // stale
+				default:
+				}
+				infos <- di
+			} else if ctx.Err() == nil && c.logger != nil {
+				c.logger.Printf("couch: watching %s: %s", p.Name, err)
+			}
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return infos
+}
@@ -0,0 +1,68 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchInfo(t *testing.T) {
+	var polls int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&polls, 1)
+		if n == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, `{"db_name":"db","doc_del_count":%d}`, n)
+	}))
+	defer ts.Close()
+	logged := &strings.Builder{}
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithLogger(log.New(logged, "", 0)))
+	ctx, cancel := context.WithCancel(context.Background())
+	infos := db.WatchInfo(ctx, 10*time.Millisecond)
+
+	// the first snapshot comes straight away, and a failed poll is skipped
+	if di := <-infos; di.DocDelCount != 1 {
+		t.Fatalf("first snapshot: expected 1 deleted, got %d", di.DocDelCount)
+	}
+	if di := <-infos; di.DocDelCount != 3 {
+		t.Fatalf("second snapshot: expected 3 deleted, got %d", di.DocDelCount)
+	}
+	if !strings.Contains(logged.String(), "couch: watching db") {
+		t.Fatalf("expected the failed poll to be logged, got %q", logged)
+	}
+
+	// a slow consumer gets the latest snapshot
+	time.Sleep(50 * time.Millisecond)
+	if di := <-infos; di.DocDelCount < 6 {
+		t.Fatalf("after falling behind: expected a recent snapshot, got %d deleted", di.DocDelCount)
+	}
+
+	cancel()
+	for range infos {
+	}
+}
+
+func TestWatchInfoZeroInterval(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"db_name":"db"}`)
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	infos := newTestDatabase(ts).WatchInfo(ctx, 0)
+	if di, ok := <-infos; !ok || di.Name != "db" {
+		t.Fatalf("first snapshot: got %+v, %v", di, ok)
+	}
+	cancel()
+	for range infos {
+	}
+}
@@ -0,0 +1,107 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// KeyEncoder converts Go values to JSON view keys, for ViewOptions and
+// the key options of Query.
+type KeyEncoder interface {
+	EncodeKey(v interface{}) (json.RawMessage, error)
+}
+
+// KeyEncoderFunc adapts a function to a KeyEncoder.
+type KeyEncoderFunc func(v interface{}) (json.RawMessage, error)
+
+func (f KeyEncoderFunc) EncodeKey(v interface{}) (json.RawMessage, error) {
+	return f(v)
+}
+
+// ViewKeyer is implemented by types which know how their values appear in
+// view keys, eg. an ID type whose map functions emit it in parts. ViewKey
+// returns a value to encode in its place.
+type ViewKeyer interface {
+	ViewKey() (interface{}, error)
+}
+
+// DefaultKeyEncoder encodes keys as map functions usually emit them:
+// time.Times as by TimeKey (as JavaScript's Date.toISOString does), and
+// ViewKeyers as their ViewKey, also within arrays, slices and maps.
+// json.RawMessages are used verbatim, and anything else is encoded as
+// JSON.
+var DefaultKeyEncoder KeyEncoder = KeyEncoderFunc(encodeKey)
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+	viewKeyerType  = reflect.TypeOf((*ViewKeyer)(nil)).Elem()
+)
+
+func encodeKey(v interface{}) (json.RawMessage, error) {
+	k, err := keyValue(reflect.ValueOf(v))
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(k)
+}
+
+// keyValue rewrites the times and ViewKeyers in v, returning a value for
+// json.Marshal.
+func keyValue(v reflect.Value) (interface{}, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+	t := v.Type()
+	switch {
+	case t == rawMessageType:
+		return v.Interface(), nil
+	case t.Implements(viewKeyerType):
+		if t.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		k, err := v.Interface().(ViewKeyer).ViewKey()
+		if err != nil {
+			return nil, err
+		}
+		return keyValue(reflect.ValueOf(k))
+	case t == timeType:
+		return TimeKey(v.Interface().(time.Time)), nil
+	}
+	switch t.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil, nil
+		}
+		return keyValue(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && (v.IsNil() || t.Elem().Kind() == reflect.Uint8) {
+			return v.Interface(), nil // null, or base64 like encoding/json
+		}
+		a := make([]interface{}, v.Len())
+		for i := range a {
+			k, err := keyValue(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			a[i] = k
+		}
+		return a, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String || v.IsNil() {
+			return v.Interface(), nil
+		}
+		m := make(map[string]interface{}, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			k, err := keyValue(it.Value())
+			if err != nil {
+				return nil, err
+			}
+			m[it.Key().String()] = k
+		}
+		return m, nil
+	}
+	return v.Interface(), nil
+}
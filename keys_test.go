@@ -0,0 +1,107 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type orderId struct {
+	Region string
+	N      int
+}
+
+func (id orderId) ViewKey() (interface{}, error) {
+	if id.Region == "" {
+		return nil, fmt.Errorf("no region")
+	}
+	return []interface{}{id.Region, id.N}, nil
+}
+
+func TestDefaultKeyEncoder(t *testing.T) {
+	at := time.Date(2012, 6, 1, 10, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+	n := 7
+	for _, c := range []struct {
+		key      interface{}
+		expected string
+	}{
+		{"abc", `"abc"`},
+		{42, `42`},
+		{int64(1) << 40, `1099511627776`},
+		{2.5, `2.5`},
+		{uint8(3), `3`},
+		{true, `true`},
+		{nil, `null`},
+		{&n, `7`},
+		{json.RawMessage(`["raw",{}]`), `["raw",{}]`},
+		{at, `"2012-06-01T08:00:00.000Z"`},
+		{&at, `"2012-06-01T08:00:00.000Z"`},
+		{[]interface{}{"user", at, 1}, `["user","2012-06-01T08:00:00.000Z",1]`},
+		{[2]time.Time{at, at.Add(time.Millisecond)}, `["2012-06-01T08:00:00.000Z","2012-06-01T08:00:00.001Z"]`},
+		{map[string]interface{}{"at": at}, `{"at":"2012-06-01T08:00:00.000Z"}`},
+		{orderId{"eu", 12}, `["eu",12]`},
+		{[]orderId{{"eu", 1}, {"us", 2}}, `[["eu",1],["us",2]]`},
+		{[]interface{}{}, `[]`},
+	} {
+		b, err := DefaultKeyEncoder.EncodeKey(c.key)
+		if err != nil {
+			t.Fatalf("%#v: %s", c.key, err)
+		}
+		if string(b) != c.expected {
+			t.Fatalf("%#v: expected %s, got %s", c.key, c.expected, b)
+		}
+	}
+	if _, err := DefaultKeyEncoder.EncodeKey([]interface{}{orderId{}}); err == nil {
+		t.Fatalf("expected the ViewKey error")
+	}
+}
+
+func TestViewOptionsKeyEncoder(t *testing.T) {
+	upper := KeyEncoderFunc(func(v interface{}) (json.RawMessage, error) {
+		b, err := json.Marshal(v)
+		return json.RawMessage(strings.ToUpper(string(b))), err
+	})
+	v, err := ViewOptions{Key: "abc", KeyEncoder: upper}.Values()
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	if v.Get("key") != `"ABC"` {
+		t.Fatalf("values: got %v", v)
+	}
+	if v, _ = (ViewOptions{Keys: []interface{}{"x"}, KeyEncoder: upper}).Values(); v.Get("keys") != `["X"]` {
+		t.Fatalf("values: got %v", v)
+	}
+	if _, err := (ViewOptions{StartKey: orderId{}}).Values(); err == nil {
+		t.Fatalf("expected the ViewKey error")
+	}
+}
+
+func TestQueryKeys(t *testing.T) {
+	seen := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.URL.Query().Get("startkey") + " " + r.URL.Query().Get("endkey") + " " + r.URL.Query().Get("limit")
+		fmt.Fprint(w, `{"rows":[]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	start := time.Date(2012, 6, 1, 0, 0, 0, 0, time.UTC)
+	err := db.Query("_design/app/_view/by_date", map[string]interface{}{
+		"startkey": []interface{}{"eu", start},
+		"endkey":   orderId{"eu", 9},
+		"limit":    10,
+	}, &KeyedViewResponse{})
+	if err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if expected := `["eu","2012-06-01T00:00:00.000Z"] ["eu",9] 10`; seen != expected {
+		t.Fatalf("query: expected %s, got %s", expected, seen)
+	}
+	if err := db.Query("_design/app/_view/by_date", map[string]interface{}{"key": orderId{}}, &KeyedViewResponse{}); err == nil {
+		t.Fatalf("expected the ViewKey error")
+	}
+}
@@ -0,0 +1,151 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Design document languages understood by CouchDB.
+const (
+	LanguageJavaScript = "javascript"
+	LanguageQuery      = "query" // Mango indexes, as created by _index
+	LanguageErlang     = "erlang"
+)
+
+// IsQuery reports whether dd is a Mango ("query" language) design document.
+func (dd DesignDoc) IsQuery() bool {
+	return dd.Language == LanguageQuery
+}
+
+// IndexMap is the map of a view in a "query" design document: the fields
+// indexed, in order, and an optional partial index selector.
+type IndexMap struct {
+	Fields                []IndexField
+	PartialFilterSelector map[string]interface{}
+}
+
+// IndexField is a single indexed field and its sort order ("asc"/"desc").
+type IndexField struct {
+	Name  string
+	Order string
+}
+
+// MarshalJSON writes Fields as an object, in order, as CouchDB expects.
+func (m IndexMap) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(`{"fields":{`)
+	for i, f := range m.Fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.Name)
+		if err != nil {
+			return nil, err
+		}
+		order, err := json.Marshal(f.Order)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(order)
+	}
+	buf.WriteByte('}')
+	if m.PartialFilterSelector != nil {
+		b, err := json.Marshal(m.PartialFilterSelector)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(`,"partial_filter_selector":`)
+		buf.Write(b)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON reads Fields in document order.
+func (m *IndexMap) UnmarshalJSON(b []byte) error {
+	raw := struct {
+		Fields                json.RawMessage        `json:"fields"`
+		PartialFilterSelector map[string]interface{} `json:"partial_filter_selector"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*m = IndexMap{PartialFilterSelector: raw.PartialFilterSelector}
+	if len(raw.Fields) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw.Fields))
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		f := IndexField{}
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		f.Name, _ = t.(string)
+		if err := dec.Decode(&f.Order); err != nil {
+			return err
+		}
+		m.Fields = append(m.Fields, f)
+	}
+	return expectDelim(dec, '}')
+}
+
+// NewQueryDesignDoc returns a "query" language design document holding a
+// single JSON index named name over the given fields (all ascending),
+// equivalent to what POST /{db}/_index creates. It can be deployed with
+// PutDesignDoc.
+func NewQueryDesignDoc(ddocId, name string, fields ...string) DesignDoc {
+	if !strings.HasPrefix(ddocId, "_design/") {
+		ddocId = "_design/" + ddocId
+	}
+	m := &IndexMap{}
+	for _, f := range fields {
+		m.Fields = append(m.Fields, IndexField{f, "asc"})
+	}
+	def, _ := json.Marshal(map[string]interface{}{"def": map[string]interface{}{"fields": fields}})
+	return DesignDoc{
+		Id:       ddocId,
+		Language: LanguageQuery,
+		Views: map[string]View{
+			name: View{Index: m, Reduce: "_count", Options: def},
+		},
+	}
+}
+
+// QueryDesignDocs returns the Mango ("query" language) design documents in
+// the database, ie. the indexes created by _index.
+func (p Database) QueryDesignDocs() ([]DesignDoc, error) {
+	r, err := p.DesignDocs(map[string]interface{}{"include_docs": true})
+	if err != nil {
+		return nil, err
+	}
+	dds := []DesignDoc{}
+	for _, row := range r.Rows {
+		dd := DesignDoc{}
+		if err := json.Unmarshal(row.Doc, &dd); err != nil {
+			return nil, fmt.Errorf("couldn't decode %s: %s", row.Id, err)
+		}
+		if dd.IsQuery() {
+			dds = append(dds, dd)
+		}
+	}
+	return dds, nil
+}
+
+// validLanguage reports whether lang is a language CouchDB understands
+// (the empty string defaults to JavaScript).
+func validLanguage(lang string) bool {
+	switch lang {
+	case "", LanguageJavaScript, LanguageQuery, LanguageErlang:
+		return true
+	}
+	return false
+}
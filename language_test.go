@@ -0,0 +1,45 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const queryDesignJSON = `{"_id":"_design/idx","language":"query","views":{"by-name":{"map":{"fields":{"name":"asc","age":"desc"},"partial_filter_selector":{"type":"user"}},"reduce":"_count","options":{"def":{"fields":["name",{"age":"desc"}]}}}}}`
+
+func TestQueryDesignDocRoundTrip(t *testing.T) {
+	dd := DesignDoc{}
+	if err := json.Unmarshal([]byte(queryDesignJSON), &dd); err != nil {
+		t.Fatalf("failed to decode query design doc: %s", err)
+	}
+	if !dd.IsQuery() {
+		t.Fatalf("language: expected query, got %s", dd.Language)
+	}
+	v := dd.Views["by-name"]
+	if v.Index == nil || len(v.Index.Fields) != 2 || v.Index.Fields[1] != (IndexField{"age", "desc"}) {
+		t.Fatalf("index: got %+v", v.Index)
+	}
+	out, err := json.Marshal(dd)
+	if err != nil {
+		t.Fatalf("failed to encode query design doc: %s", err)
+	}
+	if string(out) != queryDesignJSON {
+		t.Fatalf("round trip:\nexpected %s\n     got %s", queryDesignJSON, out)
+	}
+}
+
+func TestNewQueryDesignDoc(t *testing.T) {
+	dd := NewQueryDesignDoc("idx", "by-name", "name", "age")
+	if dd.Id != "_design/idx" || !dd.IsQuery() {
+		t.Fatalf("design doc: got %s (%s)", dd.Id, dd.Language)
+	}
+	b, err := json.Marshal(dd.Views["by-name"])
+	if err != nil {
+		t.Fatalf("failed to encode view: %s", err)
+	}
+	expected := `{"map":{"fields":{"name":"asc","age":"asc"}},"reduce":"_count","options":{"def":{"fields":["name","age"]}}}`
+	if string(b) != expected {
+		t.Fatalf("view:\nexpected %s\n     got %s", expected, b)
+	}
+}
@@ -0,0 +1,124 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// purgeBatch is how many tombstones Maintain purges per request.
+const purgeBatch = 100
+
+// MaintenanceOptions configure Maintain.
+type MaintenanceOptions struct {
+	ConflictThreshold int // report documents with at least this many conflicts; 0 means 1
+	RevisionThreshold int // report documents edited at least this many times; 0 means 1000, CouchDB's default revs_limit
+
+	// PurgeTombstones purges deleted documents, keeping only the
+	// KeepTombstones most recently deleted ones. Purging is irreversible,
+	// and purged deletions no longer replicate.
+	PurgeTombstones bool
+	KeepTombstones  int
+}
+
+// MaintenanceReport is the outcome of Maintain.
+type MaintenanceReport struct {
+	Docs          int         // live documents
+	Tombstones    int         // deleted documents, before any purge
+	Purged        int         // tombstones purged
+	Conflicted    []DocHealth // documents at or over ConflictThreshold
+	DeepRevisions []DocHealth // documents at or over RevisionThreshold
+}
+
+// DocHealth describes the revision tree of a single document.
+type DocHealth struct {
+	Id         string
+	Rev        string // the winning revision
+	Generation int    // the number of the winning revision
+	Conflicts  int    // other leaf revisions, including deleted ones
+}
+
+// Maintain scans the database's revision trees, via _changes with
+// style=all_docs, and reports heavily-conflicted and deeply-revised
+// documents, so they can be resolved or rewritten. It optionally purges
+// old tombstones.
+func (p Database) Maintain(opts MaintenanceOptions) (MaintenanceReport, error) {
+	if opts.ConflictThreshold <= 0 {
+		opts.ConflictThreshold = 1
+	}
+	if opts.RevisionThreshold <= 0 {
+		opts.RevisionThreshold = 1000
+	}
+	report := MaintenanceReport{}
+	tombstones := map[string][]string{}
+	order := []string{} // tombstone ids, oldest deletion first
+	err := p.streamField(context.Background(), "_changes", "style=all_docs", "results", func(raw json.RawMessage) error {
+		c := Change{}
+		if err := json.Unmarshal(raw, &c); err != nil {
+			return err
+		}
+		if len(c.Revs) == 0 {
+			return nil
+		}
+		if c.Deleted {
+			tombstones[c.Id] = c.Revs
+			order = append(order, c.Id)
+			return nil
+		}
+		report.Docs++
+		h := DocHealth{Id: c.Id, Rev: c.Rev(), Conflicts: len(c.Revs) - 1}
+		h.Generation, _ = strconv.Atoi(strings.SplitN(h.Rev, "-", 2)[0])
+		if h.Conflicts >= opts.ConflictThreshold {
+			report.Conflicted = append(report.Conflicted, h)
+		}
+		if h.Generation >= opts.RevisionThreshold {
+			report.DeepRevisions = append(report.DeepRevisions, h)
+		}
+		return nil
+	})
+	if err != nil {
+		return MaintenanceReport{}, err
+	}
+	report.Tombstones = len(order)
+	if !opts.PurgeTombstones || len(order) <= opts.KeepTombstones {
+		return report, nil
+	}
+	order = order[:len(order)-opts.KeepTombstones]
+	for len(order) > 0 {
+		n := len(order)
+		if n > purgeBatch {
+			n = purgeBatch
+		}
+		batch := map[string][]string{}
+		for _, id := range order[:n] {
+			batch[id] = tombstones[id]
+		}
+		purged, err := p.purge(batch)
+		report.Purged += purged
+		if err != nil {
+			return report, err
+		}
+		order = order[n:]
+	}
+	return report, nil
+}
+
+// purge removes the given revisions of documents entirely, via _purge,
+// and returns how many documents were purged.
+func (p Database) purge(revs map[string][]string) (int, error) {
+	in, err := json.Marshal(revs)
+	if err != nil {
+		return 0, err
+	}
+	r := struct {
+		Purged map[string]json.RawMessage `json:"purged"`
+	}{}
+	u := fmt.Sprintf("%s/_purge", p.DBURL())
+	if _, err := p.interact("POST", u, map[string][]string{}, in, &r); err != nil {
+		return 0, err
+	}
+	return len(r.Purged), nil
+}
@@ -0,0 +1,53 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMaintain(t *testing.T) {
+	purged := map[string][]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_changes":
+			if r.URL.Query().Get("style") != "all_docs" {
+				t.Errorf("style: got %q", r.URL.Query().Get("style"))
+			}
+			fmt.Fprint(w, `{"results":[
+				{"seq":1,"id":"ok","changes":[{"rev":"3-a"}]},
+				{"seq":2,"id":"old","deleted":true,"changes":[{"rev":"2-b"}]},
+				{"seq":3,"id":"split","changes":[{"rev":"4-c"},{"rev":"4-d"},{"rev":"3-e"}]},
+				{"seq":4,"id":"new","deleted":true,"changes":[{"rev":"5-f"}]}
+			],"last_seq":4,"pending":0}`)
+		case "/db/_purge":
+			json.NewDecoder(r.Body).Decode(&purged)
+			fmt.Fprint(w, `{"purge_seq":null,"purged":{"old":["2-b"]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	report, err := db.Maintain(MaintenanceOptions{RevisionThreshold: 4, PurgeTombstones: true, KeepTombstones: 1})
+	if err != nil {
+		t.Fatalf("failed to maintain: %s", err)
+	}
+	expected := MaintenanceReport{
+		Docs:          2,
+		Tombstones:    2,
+		Purged:        1,
+		Conflicted:    []DocHealth{{"split", "4-c", 4, 2}},
+		DeepRevisions: []DocHealth{{"split", "4-c", 4, 2}},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("report:\nexpected %+v\n     got %+v", expected, report)
+	}
+	if !reflect.DeepEqual(purged, map[string][]string{"old": {"2-b"}}) {
+		t.Fatalf("purge: expected only the oldest tombstone, got %v", purged)
+	}
+}
@@ -0,0 +1,55 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrResponseTooLarge is returned when a response to be read whole is
+// larger than the Client's WithMaxResponseSize.
+var ErrResponseTooLarge = errors.New("response too large")
+
+// WithMaxResponseSize makes the Client fail with ErrResponseTooLarge,
+// rather than read on, when a response it would hold in memory grows past
+// max bytes; 0 means no limit. That protects a service from a query made
+// without a limit, which could otherwise decode hundreds of MB. Streamed
+// responses, eg. from QueryStream, FindStream and changes feeds, aren't
+// limited, so they're the way to read results too large to hold; nor are
+// attachments read with GetAttachment.
+func WithMaxResponseSize(max int64) Option {
+	return func(c *Client) {
+		c.maxResponseSize = max
+	}
+}
+
+// limitBody limits r to the Client's maximum response size, if any.
+func (c *Client) limitBody(r io.Reader) io.Reader {
+	if c.maxResponseSize <= 0 {
+		return r
+	}
+	return &limitedBody{r, c.maxResponseSize}
+}
+
+// limitedBody reads up to n bytes from r, failing with
+// ErrResponseTooLarge if there are more.
+type limitedBody struct {
+	r io.Reader
+	n int64 // bytes remaining
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	if l.n < 0 {
+		// drop the byte over the limit, which may complete a document
+		return n - 1, ErrResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,54 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxResponseSize(t *testing.T) {
+	rows := `{"total_rows":3,"offset":0,"rows":[` + strings.Repeat(`{"id":"a","key":"a","value":null},`, 2) + `{"id":"c","key":"c","value":null}]}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_design/app/_view/all":
+			fmt.Fprint(w, rows)
+		case "/db/doc":
+			fmt.Fprint(w, `{"_id":"doc","_rev":"1-a","body":"`+strings.Repeat("x", 1000)+`"}`)
+		}
+	}))
+	defer ts.Close()
+	c := NewClient(WithMaxResponseSize(int64(len(rows))))
+	db := newTestDatabase(ts)
+	db.Client = c
+
+	// a response of exactly the maximum size is read
+	out := map[string]interface{}{}
+	if err := db.QueryViewContext(context.Background(), "_design/app/_view/all", ViewOptions{}, &out); err != nil {
+		t.Fatalf("query: %s", err)
+	}
+
+	db.Client = c.With(WithMaxResponseSize(int64(len(rows) - 1)))
+	err := db.QueryViewContext(context.Background(), "_design/app/_view/all", ViewOptions{}, &out)
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("query: expected ErrResponseTooLarge, got %v", err)
+	}
+	if _, err := db.Retrieve("doc", &out); !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("retrieve: expected ErrResponseTooLarge, got %v", err)
+	}
+
+	// streams aren't limited
+	n := 0
+	err = db.streamField(context.Background(), "_design/app/_view/all", "", "rows", func(json.RawMessage) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Fatalf("stream: got %d rows, %v", n, err)
+	}
+}
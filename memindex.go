@@ -0,0 +1,108 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// MemIndex is an in-process index from keys to document ids, like
+// username to user id, kept up to date from a database's changes feed so
+// lookups don't need a request. Keys are unique: if two documents have
+// the same key, the one changed last has it.
+type MemIndex struct {
+	consumer *Consumer
+	key      func(id string, doc json.RawMessage) (string, bool)
+
+	mu    sync.RWMutex
+	ids   map[string]string // key -> id
+	keys  map[string]string // id -> key
+	ready chan struct{}
+	once  sync.Once
+}
+
+// NewMemIndex returns an index of the database's documents by key, which
+// returns a document's key, or false to leave it out. opts configure the
+// Consumer which maintains it; documents are always included. As the
+// index is only kept in memory, it always starts from the beginning of
+// the changes feed: opts' Since, Checkpointer and Deduper are ignored.
+func (p Database) NewMemIndex(key func(id string, doc json.RawMessage) (string, bool), opts ConsumerOptions) *MemIndex {
+	opts.IncludeDocs = true
+	opts.Since, opts.Checkpointer, opts.Deduper = "", &MemoryCheckpointer{}, nil
+	m := &MemIndex{
+		key:   key,
+		ids:   map[string]string{},
+		keys:  map[string]string{},
+		ready: make(chan struct{}),
+	}
+	m.consumer = p.NewConsumer(opts)
+	m.consumer.batchDone = func(s ConsumerStats, caughtUp bool) {
+		if caughtUp {
+			m.once.Do(func() { close(m.ready) })
+		}
+	}
+	return m
+}
+
+// Run builds the index and keeps it up to date until ctx is done, as
+// Consumer.Run.
+func (m *MemIndex) Run(ctx context.Context) error {
+	return m.consumer.Run(ctx, func(ch Change) error {
+		key, ok := "", false
+		if !ch.Deleted && len(ch.Doc) > 0 && string(ch.Doc) != "null" {
+			key, ok = m.key(ch.Id, ch.Doc)
+		}
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if old, had := m.keys[ch.Id]; had {
+			delete(m.keys, ch.Id)
+			if m.ids[old] == ch.Id {
+				delete(m.ids, old)
+			}
+		}
+		if ok {
+			m.ids[key], m.keys[ch.Id] = ch.Id, key
+		}
+		return nil
+	})
+}
+
+// Ready is closed once the index has caught up with the database, ie.
+// after the first batch shorter than the Consumer's Limit, or the first
+// batch if it has none.
+func (m *MemIndex) Ready() <-chan struct{} {
+	return m.ready
+}
+
+// Get returns the id of the document with key.
+func (m *MemIndex) Get(key string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	id, ok := m.ids[key]
+	return id, ok
+}
+
+// Len returns the number of keys in the index.
+func (m *MemIndex) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.ids)
+}
+
+// Snapshot returns a copy of the index, from keys to ids, which later
+// changes don't affect.
+func (m *MemIndex) Snapshot() map[string]string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snapshot := make(map[string]string, len(m.ids))
+	for k, id := range m.ids {
+		snapshot[k] = id
+	}
+	return snapshot
+}
+
+// Stats returns the stats of the index's Consumer.
+func (m *MemIndex) Stats() ConsumerStats {
+	return m.consumer.Stats()
+}
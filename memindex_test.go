@@ -0,0 +1,89 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemIndex(t *testing.T) {
+	batches := []string{
+		`{"results":[
+			{"seq":"1","id":"u1","changes":[{"rev":"1-a"}],"doc":{"_id":"u1","username":"ann"}},
+			{"seq":"2","id":"u2","changes":[{"rev":"1-b"}],"doc":{"_id":"u2","username":"bo"}},
+			{"seq":"3","id":"o1","changes":[{"rev":"1-c"}],"doc":{"_id":"o1","type":"order"}}],"last_seq":"3"}`,
+		`{"results":[
+			{"seq":"4","id":"u1","changes":[{"rev":"2-a"}],"doc":{"_id":"u1","username":"annie"}},
+			{"seq":"5","id":"u2","deleted":true,"changes":[{"rev":"2-b"}],"doc":{"_id":"u2","_deleted":true}}],"last_seq":"5"}`,
+	}
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("include_docs") != "true" {
+			t.Errorf("query: got %s", r.URL.RawQuery)
+		}
+		if requests++; requests <= len(batches) {
+			fmt.Fprint(w, batches[requests-1])
+			return
+		}
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+	idx := newTestDatabase(ts).NewMemIndex(func(id string, doc json.RawMessage) (string, bool) {
+		d := struct {
+			Username string `json:"username"`
+		}{}
+		json.Unmarshal(doc, &d)
+		return d.Username, d.Username != ""
+	}, ConsumerOptions{ChangesOptions: ChangesOptions{Limit: 3}})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- idx.Run(ctx) }()
+	select {
+	case <-idx.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("index never caught up")
+	}
+	if id, ok := idx.Get("annie"); !ok || id != "u1" {
+		t.Fatalf("annie: got %q, %v", id, ok)
+	}
+	if _, ok := idx.Get("ann"); ok {
+		t.Fatalf("ann: expected the old key to be gone")
+	}
+	if !reflect.DeepEqual(idx.Snapshot(), map[string]string{"annie": "u1"}) || idx.Len() != 1 {
+		t.Fatalf("snapshot: got %v", idx.Snapshot())
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("run: got %v", err)
+	}
+}
+
+func TestMemIndexStartsAfresh(t *testing.T) {
+	since := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case since <- r.URL.Query().Get("since"):
+			fmt.Fprint(w, `{"results":[],"last_seq":"0"}`)
+		default:
+			<-r.Context().Done()
+		}
+	}))
+	defer ts.Close()
+	cp := &MemoryCheckpointer{}
+	cp.Save("5")
+	idx := newTestDatabase(ts).NewMemIndex(func(id string, doc json.RawMessage) (string, bool) {
+		return id, true
+	}, ConsumerOptions{ChangesOptions: ChangesOptions{Since: "3"}, Checkpointer: cp})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go idx.Run(ctx)
+	if s := <-since; s != "" {
+		t.Fatalf("since: expected the beginning, got %q", s)
+	}
+}
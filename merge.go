@@ -0,0 +1,126 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Conflict is a field changed differently on both sides of a Merge3.
+// Values are empty where the field was absent (or removed).
+type Conflict struct {
+	Path   string          `json:"path"`
+	Base   json.RawMessage `json:"base,omitempty"`
+	Mine   json.RawMessage `json:"mine,omitempty"`
+	Theirs json.RawMessage `json:"theirs,omitempty"`
+}
+
+// Merge3 merges two JSON documents derived from a common ancestor, base:
+// typically the winning and a conflicting revision of a document, and the
+// revision they diverged from. Changes made on only one side are kept;
+// objects changed on both sides are merged field by field. Any other field
+// changed differently on both sides is reported as a Conflict, and takes
+// mine's value in the result. Arrays are merged as whole values.
+// Document metadata, eg. _id and _rev, isn't merged: the result carries
+// theirs', so that it can be written over their revision.
+func Merge3(base, mine, theirs json.RawMessage) (json.RawMessage, []Conflict, error) {
+	var b, m, t interface{}
+	for _, d := range []struct {
+		raw json.RawMessage
+		v   *interface{}
+	}{{base, &b}, {mine, &m}, {theirs, &t}} {
+		*d.v = map[string]interface{}{}
+		if len(d.raw) > 0 {
+			if err := decodeNumbers(d.raw, d.v); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	id, rev := stripMeta(m)
+	if tid, trev := stripMeta(t); tid != nil || trev != nil {
+		id, rev = tid, trev
+	}
+	stripMeta(b)
+	conflicts := []Conflict{}
+	merged, _ := merge3("", b, m, t, true, true, true, &conflicts)
+	if o, ok := merged.(map[string]interface{}); ok {
+		if id != nil {
+			o["_id"] = id
+		}
+		if rev != nil {
+			o["_rev"] = rev
+		}
+	}
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	out, err := json.Marshal(merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, conflicts, nil
+}
+
+// stripMeta removes the metadata fields from doc, if it's an object,
+// returning its _id and _rev.
+func stripMeta(doc interface{}) (id, rev interface{}) {
+	o, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	id, rev = o["_id"], o["_rev"]
+	for _, k := range []string{"_id", "_rev", "_conflicts", "_deleted_conflicts", "_revisions", "_revs_info"} {
+		delete(o, k)
+	}
+	return id, rev
+}
+
+// merge3 merges one value; the has* flags say whether it's present on
+// each side. It returns the merged value and whether it's present.
+func merge3(path string, b, m, t interface{}, hasB, hasM, hasT bool, conflicts *[]Conflict) (interface{}, bool) {
+	same := func(x, y interface{}, hasX, hasY bool) bool {
+		return hasX == hasY && (!hasX || jsonEqual(x, y))
+	}
+	switch {
+	case same(m, t, hasM, hasT):
+		return m, hasM
+	case same(m, b, hasM, hasB):
+		return t, hasT
+	case same(t, b, hasT, hasB):
+		return m, hasM
+	}
+	mo, mok := m.(map[string]interface{})
+	to, tok := t.(map[string]interface{})
+	bo, bok := b.(map[string]interface{})
+	if mok && tok && (bok || !hasB) {
+		if bo == nil {
+			bo = map[string]interface{}{}
+		}
+		keys := map[string]bool{}
+		for _, o := range []map[string]interface{}{bo, mo, to} {
+			for k := range o {
+				keys[k] = true
+			}
+		}
+		out := map[string]interface{}{}
+		for k := range keys {
+			bv, hb := bo[k]
+			mv, hm := mo[k]
+			tv, ht := to[k]
+			if v, ok := merge3(path+"/"+escapePointer(k), bv, mv, tv, hb, hm, ht, conflicts); ok {
+				out[k] = v
+			}
+		}
+		return out, true
+	}
+	c := Conflict{Path: path}
+	if hasB {
+		c.Base = mustJSON(b)
+	}
+	if hasM {
+		c.Mine = mustJSON(m)
+	}
+	if hasT {
+		c.Theirs = mustJSON(t)
+	}
+	*conflicts = append(*conflicts, c)
+	return m, hasM
+}
@@ -0,0 +1,60 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMerge3(t *testing.T) {
+	base := json.RawMessage(`{"name":"x","count":1,"tags":["a"],"address":{"city":"Oslo","zip":"0150"},"gone":true}`)
+	mine := json.RawMessage(`{"name":"y","count":2,"tags":["a"],"address":{"city":"Oslo","zip":"0151"},"gone":true}`)
+	theirs := json.RawMessage(`{"name":"x","count":3,"tags":["a","b"],"address":{"city":"Bergen","zip":"0150"},"new":1}`)
+	merged, conflicts, err := Merge3(base, mine, theirs)
+	if err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	expected := `{"address":{"city":"Bergen","zip":"0151"},"count":2,"name":"y","new":1,"tags":["a","b"]}`
+	if string(merged) != expected {
+		t.Fatalf("merge:\nexpected %s\n     got %s", expected, merged)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "/count" {
+		t.Fatalf("conflicts: expected /count only, got %+v", conflicts)
+	}
+	if string(conflicts[0].Mine) != "2" || string(conflicts[0].Theirs) != "3" || string(conflicts[0].Base) != "1" {
+		t.Fatalf("conflict values: got %+v", conflicts[0])
+	}
+}
+
+func TestMerge3DeleteVsEdit(t *testing.T) {
+	base := json.RawMessage(`{"a":1}`)
+	mine := json.RawMessage(`{}`)
+	theirs := json.RawMessage(`{"a":2}`)
+	merged, conflicts, err := Merge3(base, mine, theirs)
+	if err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	if string(merged) != `{}` {
+		t.Fatalf("merge: expected mine to win, got %s", merged)
+	}
+	if len(conflicts) != 1 || conflicts[0].Mine != nil {
+		t.Fatalf("conflicts: got %+v", conflicts)
+	}
+}
+
+func TestMerge3Revisions(t *testing.T) {
+	base := json.RawMessage(`{"_id":"d","_rev":"1-a","n":1,"s":"x"}`)
+	mine := json.RawMessage(`{"_id":"d","_rev":"2-b","n":2,"s":"x"}`)
+	theirs := json.RawMessage(`{"_id":"d","_rev":"2-c","_conflicts":["2-b"],"n":1,"s":"y"}`)
+	merged, conflicts, err := Merge3(base, mine, theirs)
+	if err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	expected := `{"_id":"d","_rev":"2-c","n":2,"s":"y"}`
+	if string(merged) != expected {
+		t.Fatalf("merge:\nexpected %s\n     got %s", expected, merged)
+	}
+	if len(conflicts) != 0 {
+		t.Fatalf("conflicts: expected none, got %+v", conflicts)
+	}
+}
@@ -0,0 +1,63 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// ApplyMergePatch applies an RFC 7386 JSON Merge Patch to the JSON object
+// doc: members of patch replace those of doc, recursively for objects,
+// and null members remove them.
+func ApplyMergePatch(doc, patch []byte) ([]byte, error) {
+	var target, p interface{}
+	if err := decodeNumbers(doc, &target); err != nil {
+		return nil, err
+	}
+	if err := decodeNumbers(patch, &p); err != nil {
+		return nil, err
+	}
+	if _, ok := p.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("merge patch must be a JSON object")
+	}
+	return json.Marshal(mergePatch(target, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// decodeNumbers unmarshals JSON, keeping numbers as json.Number so they
+// survive a round trip unchanged.
+func decodeNumbers(b []byte, v interface{}) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	return d.Decode(v)
+}
+
+// MergePatch fetches document id, applies the JSON Merge Patch to it, and
+// saves the result, returning the new revision; eg. `{"status":"done"}`
+// sets a single field. If another writer updates the document in the
+// meantime, MergePatch starts again from the new revision.
+// The patch may not change _id or _rev.
+func (p Database) MergePatch(id string, patch json.RawMessage) (string, error) {
+	return p.update(id, func(doc []byte) ([]byte, error) {
+		return ApplyMergePatch(doc, patch)
+	})
+}
@@ -0,0 +1,22 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"testing"
+)
+
+func TestApplyMergePatch(t *testing.T) {
+	doc := []byte(`{"_id":"x","_rev":"1-a","title":"Goodbye!","author":{"givenName":"John","familyName":"Doe"},"tags":["example","sample"],"content":"This will be unchanged","n":12345678901234567890}`)
+	patch := []byte(`{"title":"Hello!","phoneNumber":"+01-123-456-7890","author":{"familyName":null},"tags":["example"]}`)
+	out, err := ApplyMergePatch(doc, patch)
+	if err != nil {
+		t.Fatalf("failed to merge: %s", err)
+	}
+	expected := `{"_id":"x","_rev":"1-a","author":{"givenName":"John"},"content":"This will be unchanged","n":12345678901234567890,"phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`
+	if string(out) != expected {
+		t.Fatalf("merge:\nexpected %s\n     got %s", expected, out)
+	}
+	if _, err := ApplyMergePatch(doc, []byte(`["not","an","object"]`)); err == nil {
+		t.Fatalf("expected an error for a non-object patch")
+	}
+}
@@ -0,0 +1,161 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Migration is one step in the evolution of a database, like creating an
+// index or reshaping documents. ID identifies the step once it's applied,
+// so it must never change. Up may be run again if the process dies before
+// the step is recorded, so it should be idempotent; the helpers below are.
+type Migration struct {
+	ID          string
+	Description string
+	Up          func(db Database) error
+}
+
+// DesignDocMigration deploys dd with PutDesignDoc.
+func DesignDocMigration(id string, dd DesignDoc) Migration {
+	return Migration{
+		ID:          id,
+		Description: "deploy " + dd.Id,
+		Up: func(db Database) error {
+			_, err := db.PutDesignDoc(dd)
+			return err
+		},
+	}
+}
+
+// IndexMigration creates a Mango index named name over fields, in the
+// design document ddocId, as by NewQueryDesignDoc.
+func IndexMigration(id, ddocId, name string, fields ...string) Migration {
+	m := DesignDocMigration(id, NewQueryDesignDoc(ddocId, name, fields...))
+	m.Description = fmt.Sprintf("index %s on %s", name, strings.Join(fields, ", "))
+	return m
+}
+
+// DocsMigration rewrites every document but design documents with fn,
+// which returns the new document, or nil to leave it alone. Documents are
+// read from _all_docs and written back by Transform; any which fail to
+// write fail the step.
+func DocsMigration(id string, fn func(doc json.RawMessage) (json.RawMessage, error)) Migration {
+	return Migration{
+		ID:          id,
+		Description: "rewrite documents",
+		Up: func(db Database) error {
+			progress, err := db.Transform(context.Background(), "_all_docs", func(doc json.RawMessage) (interface{}, bool, error) {
+				after, err := fn(doc)
+				return after, after != nil && !bytes.Equal(after, doc), err
+			}, TransformOptions{})
+			if err == nil && progress.Failed > 0 {
+				err = fmt.Errorf("%d documents failed to write", progress.Failed)
+			}
+			return err
+		},
+	}
+}
+
+// Migrator applies Migrations to DB in order, recording those applied in
+// the _local/migrations document, which doesn't replicate: each replica
+// records its own.
+type Migrator struct {
+	DB         Database
+	Migrations []Migration
+}
+
+// MigrationStatus says whether a migration has been applied, and when.
+type MigrationStatus struct {
+	ID          string
+	Description string
+	Applied     bool
+	AppliedAt   time.Time
+}
+
+type migrationRecord struct {
+	ID        string    `json:"id"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+type migrationsDoc struct {
+	Rev     string            `json:"_rev,omitempty"`
+	Applied []migrationRecord `json:"applied"`
+}
+
+const migrationsDocURL = "_local/migrations"
+
+func (m Migrator) load() (migrationsDoc, error) {
+	doc := migrationsDoc{}
+	err := m.DB.unmarshalURL(fmt.Sprintf("%s/%s", m.DB.DBURL(), migrationsDocURL), &doc)
+	if err != nil && !isNotFound(err) {
+		return migrationsDoc{}, err
+	}
+	return doc, nil
+}
+
+// Status lists the migrations in order, with whether each is applied.
+func (m Migrator) Status() ([]MigrationStatus, error) {
+	doc, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]time.Time{}
+	for _, r := range doc.Applied {
+		applied[r.ID] = r.AppliedAt
+	}
+	status := []MigrationStatus{}
+	for _, mig := range m.Migrations {
+		at, ok := applied[mig.ID]
+		status = append(status, MigrationStatus{ID: mig.ID, Description: mig.Description, Applied: ok, AppliedAt: at})
+	}
+	return status, nil
+}
+
+// Up applies the pending migrations in order, stopping at the first that
+// fails, and returns the IDs of those it applied. If another process is
+// migrating the same database at once, recording a step fails with a
+// conflict.
+func (m Migrator) Up() ([]string, error) {
+	seen := map[string]bool{}
+	for _, mig := range m.Migrations {
+		if mig.ID == "" || seen[mig.ID] {
+			return nil, fmt.Errorf("migration IDs must be unique and non-empty: %q", mig.ID)
+		}
+		seen[mig.ID] = true
+	}
+	doc, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	done := map[string]bool{}
+	for _, r := range doc.Applied {
+		done[r.ID] = true
+	}
+	applied := []string{}
+	for _, mig := range m.Migrations {
+		if done[mig.ID] {
+			continue
+		}
+		if err := mig.Up(m.DB); err != nil {
+			return applied, fmt.Errorf("migration %s: %w", mig.ID, err)
+		}
+		doc.Applied = append(doc.Applied, migrationRecord{mig.ID, time.Now().UTC()})
+		in, err := json.Marshal(doc)
+		if err != nil {
+			return applied, err
+		}
+		r := WriteResult{}
+		u := fmt.Sprintf("%s/%s", m.DB.DBURL(), migrationsDocURL)
+		if _, err := m.DB.interact("PUT", u, map[string][]string{}, in, &r); err != nil {
+			return applied, fmt.Errorf("recording migration %s: %w", mig.ID, err)
+		}
+		doc.Rev = r.Rev
+		applied = append(applied, mig.ID)
+	}
+	return applied, nil
+}
@@ -0,0 +1,84 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMigrator(t *testing.T) {
+	local := `{"_rev":"0-1","applied":[{"id":"001","applied_at":"2020-01-01T00:00:00Z"}]}`
+	bulk := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/db/_local/migrations" && r.Method == "GET":
+			fmt.Fprint(w, local)
+		case r.URL.Path == "/db/_local/migrations" && r.Method == "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			local = string(b)
+			fmt.Fprint(w, `{"ok":true,"id":"_local/migrations","rev":"0-2"}`)
+		case r.URL.Path == "/db/_all_docs":
+			fmt.Fprint(w, `{"rows":[
+				{"id":"_design/app","doc":{"_id":"_design/app","_rev":"1-d"}},
+				{"id":"a","doc":{"_id":"a","_rev":"1-a","name":"ann"}},
+				{"id":"b","doc":{"_id":"b","_rev":"1-b","name":"Bo"}}]}`)
+		case r.URL.Path == "/db/_bulk_docs":
+			b, _ := ioutil.ReadAll(r.Body)
+			bulk = string(b)
+			fmt.Fprint(w, `[{"ok":true,"id":"a","rev":"2-a"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	ran := []string{}
+	step := func(id string) Migration {
+		return Migration{ID: id, Up: func(db Database) error { ran = append(ran, id); return nil }}
+	}
+	capitalize := DocsMigration("003", func(doc json.RawMessage) (json.RawMessage, error) {
+		m := map[string]interface{}{}
+		json.Unmarshal(doc, &m)
+		name := m["name"].(string)
+		if upper := strings.ToUpper(name[:1]) + name[1:]; upper != name {
+			m["name"] = upper
+			return json.Marshal(m)
+		}
+		return nil, nil
+	})
+	m := Migrator{DB: newTestDatabase(ts), Migrations: []Migration{step("001"), step("002"), capitalize}}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatalf("failed to get status: %s", err)
+	}
+	if len(status) != 3 || !status[0].Applied || status[1].Applied || status[0].AppliedAt.Year() != 2020 {
+		t.Fatalf("status: got %+v", status)
+	}
+
+	applied, err := m.Up()
+	if err != nil {
+		t.Fatalf("failed to migrate: %s", err)
+	}
+	if !reflect.DeepEqual(applied, []string{"002", "003"}) || !reflect.DeepEqual(ran, []string{"002"}) {
+		t.Fatalf("applied %v, ran %v", applied, ran)
+	}
+	if bulk != `{"docs":[{"_id":"a","_rev":"1-a","name":"Ann"}]}` {
+		t.Fatalf("bulk: got %s", bulk)
+	}
+	doc := migrationsDoc{}
+	json.Unmarshal([]byte(local), &doc)
+	if doc.Rev != "0-2" || len(doc.Applied) != 3 || doc.Applied[2].ID != "003" {
+		t.Fatalf("record: got %s", local)
+	}
+
+	m.Migrations = append(m.Migrations, step("002"))
+	if _, err := m.Up(); err == nil {
+		t.Fatalf("expected error for duplicate IDs")
+	}
+}
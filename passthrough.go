@@ -0,0 +1,82 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// UserCredentials are an end user's own CouchDB credentials, forwarded
+// by a gateway so that CouchDB authorizes each request as that user,
+// against the database's _security object and validate_doc_update
+// functions, rather than as the gateway's own, more privileged, user.
+type UserCredentials struct {
+	// Session is the value of an AuthSession cookie from _session.
+	Session string
+	// JWT is a bearer token, for CouchDB's jwt_authentication_handler.
+	JWT string
+}
+
+// UserCredentialsFrom returns the credentials of an incoming request: its
+// AuthSession cookie, or else a bearer token in its Authorization header.
+// It returns false if r has neither.
+func UserCredentialsFrom(r *http.Request) (UserCredentials, bool) {
+	if cookie, err := r.Cookie("AuthSession"); err == nil && cookie.Value != "" {
+		return UserCredentials{Session: cookie.Value}, true
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") && token != "" {
+		return UserCredentials{JWT: token}, true
+	}
+	return UserCredentials{}, false
+}
+
+type userCredentialsKey struct{}
+
+// UserContext returns a copy of ctx in which requests are made with the
+// given user's credentials, in place of the Client's own: any basic or
+// cookie auth, and any Authorization or Cookie headers from WithHeader.
+// A 401 is returned as it is, as the user must log in again. Handlers like
+// ServeDoc use their request's context, so a gateway can wrap them in
+// middleware which calls UserCredentialsFrom and UserContext.
+func UserContext(ctx context.Context, u UserCredentials) context.Context {
+	return context.WithValue(ctx, userCredentialsKey{}, u)
+}
+
+func userCredentials(ctx context.Context) (UserCredentials, bool) {
+	u, ok := ctx.Value(userCredentialsKey{}).(UserCredentials)
+	return u, ok && (u.Session != "" || u.JWT != "")
+}
+
+// authorize replaces any credentials on req with u. The URL's userinfo
+// goes too, or the transport would still send it as basic auth.
+func (u UserCredentials) authorize(req *http.Request) {
+	if req.URL.User != nil {
+		anon := *req.URL
+		anon.User = nil
+		req.URL = &anon
+	}
+	req.Header.Del("Authorization")
+	req.Header.Del("Cookie")
+	if u.Session != "" {
+		req.AddCookie(&http.Cookie{Name: "AuthSession", Value: u.Session})
+	} else {
+		req.Header.Set("Authorization", "Bearer "+u.JWT)
+	}
+}
+
+// ErrNoUserCredentials is returned for requests without UserCredentials
+// through a Client made WithUserPassthrough.
+var ErrNoUserCredentials = errors.New("request without user credentials")
+
+// WithUserPassthrough makes the Client refuse, with ErrNoUserCredentials,
+// requests whose context doesn't carry UserCredentials, so that a gateway
+// can't fall back on its own privileges by mistake. It's useful with
+// Client.With, for the Client that serves end users' requests.
+func WithUserPassthrough() Option {
+	return func(c *Client) {
+		c.userOnly = true
+	}
+}
@@ -0,0 +1,74 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestUserPassthrough(t *testing.T) {
+	var got http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		if cookie, err := r.Cookie("AuthSession"); err == nil && cookie.Value == "expired" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"unauthorized","reason":"Session expired"}`))
+			return
+		}
+		w.Write([]byte(`{"_id":"doc","_rev":"1-a"}`))
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	db.Auth = url.UserPassword("admin", "secret")
+	db.Client = NewClient(WithHeader("Authorization", "Basic c3VwZXI6dXNlcg=="))
+
+	// an end user's cookie is passed through in place of the gateway's
+	// credentials
+	gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, ok := UserCredentialsFrom(r); ok {
+			r = r.WithContext(UserContext(r.Context(), u))
+		}
+		db.ServeDoc(w, r, "doc")
+	})
+	req := httptest.NewRequest("GET", "/doc", nil)
+	req.AddCookie(&http.Cookie{Name: "AuthSession", Value: "alice"})
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status: expected 200, got %d", w.Code)
+	}
+	if got.Get("Authorization") != "" || got.Get("Cookie") != "AuthSession=alice" {
+		t.Fatalf("expected only the user's cookie, got %v", got)
+	}
+
+	// as is a JWT
+	req = httptest.NewRequest("GET", "/doc", nil)
+	req.Header.Set("Authorization", "Bearer eyJhbGciOi")
+	gateway.ServeHTTP(httptest.NewRecorder(), req)
+	if got.Get("Authorization") != "Bearer eyJhbGciOi" {
+		t.Fatalf("expected the user's token, got %v", got)
+	}
+
+	// an expired session is the user's to renew
+	req = httptest.NewRequest("GET", "/doc", nil)
+	req.AddCookie(&http.Cookie{Name: "AuthSession", Value: "expired"})
+	w = httptest.NewRecorder()
+	gateway.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired session: expected 401, got %d", w.Code)
+	}
+
+	// requests without credentials are refused by a passthrough client
+	db.Client = db.Client.With(WithUserPassthrough())
+	if _, err := db.InfoContext(context.Background()); !errors.Is(err, ErrNoUserCredentials) {
+		t.Fatalf("without credentials: expected ErrNoUserCredentials, got %v", err)
+	}
+	ctx := UserContext(context.Background(), UserCredentials{Session: "bob"})
+	if _, err := db.InfoContext(ctx); err != nil {
+		t.Fatalf("with credentials: %s", err)
+	}
+}
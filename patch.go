@@ -0,0 +1,285 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// conflictRetries is how many times a read-modify-write helper retries
+// after losing a race to another writer.
+const conflictRetries = 5
+
+// PatchOp is a single RFC 6902 JSON Patch operation: one of "add",
+// "remove", "replace", "move", "copy" or "test". Paths are JSON Pointers
+// (RFC 6901), eg. "/tags/0" or "/tags/-" to append.
+type PatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	From  string      `json:"from,omitempty"`
+	Value interface{} `json:"value"`
+}
+
+// JSONPatch is an RFC 6902 JSON Patch: operations applied in order.
+type JSONPatch []PatchOp
+
+// Apply applies the patch to the JSON document doc, returning the patched
+// document. The patch is applied atomically: if any operation fails
+// (including a failed "test"), an error is returned instead.
+func (jp JSONPatch) Apply(doc []byte) ([]byte, error) {
+	var root interface{}
+	if err := decodeNumbers(doc, &root); err != nil {
+		return nil, err
+	}
+	for i, op := range jp {
+		var err error
+		if root, err = op.apply(root); err != nil {
+			return nil, fmt.Errorf("patch operation %d (%s %s): %s", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(root)
+}
+
+func (op PatchOp) apply(root interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add":
+		return pointerAdd(root, path, normalizeJSON(op.Value))
+	case "remove":
+		return pointerRemove(root, path)
+	case "replace":
+		if _, err := pointerGet(root, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return normalizeJSON(op.Value), nil
+		}
+		if root, err = pointerRemove(root, path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(root, path, normalizeJSON(op.Value))
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		v, err := pointerGet(root, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, fmt.Errorf("can't move a value into itself")
+			}
+			if root, err = pointerRemove(root, from); err != nil {
+				return nil, err
+			}
+		} else {
+			v = normalizeJSON(v)
+		}
+		return pointerAdd(root, path, v)
+	case "test":
+		v, err := pointerGet(root, path)
+		if err != nil {
+			return nil, err
+		}
+		if !jsonEqual(normalizeJSON(v), normalizeJSON(op.Value)) {
+			return nil, fmt.Errorf("test failed")
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("unknown operation %q", op.Op)
+}
+
+// normalizeJSON returns a deep copy of v as it would be decoded from JSON
+// with UseNumber, so values from Go and from documents compare equal.
+func normalizeJSON(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var out interface{}
+	decodeNumbers(b, &out)
+	return out
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into unescaped tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if p[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %q", p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, appendOK bool) (int, error) {
+	if token == "-" && appendOK {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	max := length - 1
+	if appendOK {
+		max = length
+	}
+	if i > max {
+		return 0, fmt.Errorf("array index %d out of range", i)
+	}
+	return i, nil
+}
+
+func pointerGet(node interface{}, path []string) (interface{}, error) {
+	for _, t := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[t]
+			if !ok {
+				return nil, fmt.Errorf("no member %q", t)
+			}
+			node = v
+		case []interface{}:
+			i, err := arrayIndex(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("can't index into %T", node)
+		}
+	}
+	return node, nil
+}
+
+// pointerMutate walks to the container holding the last token of path,
+// and replaces that container with the result of fn.
+func pointerMutate(node interface{}, path []string, fn func(parent interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("no member %q", path[0])
+		}
+		child, err := pointerMutate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = child
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		child, err := pointerMutate(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = child
+		return n, nil
+	}
+	return nil, fmt.Errorf("can't index into %T", node)
+}
+
+func pointerAdd(root interface{}, path []string, v interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	return pointerMutate(root, path, func(parent interface{}, key string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			n[key] = v
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = v
+			return n, nil
+		}
+		return nil, fmt.Errorf("can't add to %T", parent)
+	})
+}
+
+func pointerRemove(root interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("can't remove the whole document")
+	}
+	return pointerMutate(root, path, func(parent interface{}, key string) (interface{}, error) {
+		switch n := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := n[key]; !ok {
+				return nil, fmt.Errorf("no member %q", key)
+			}
+			delete(n, key)
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("can't remove from %T", parent)
+	})
+}
+
+// Patch fetches document id, applies the JSON Patch to it, and saves the
+// result, returning the new revision. If another writer updates the
+// document in the meantime, Patch starts again from the new revision.
+// The patch may not change _id or _rev.
+func (p Database) Patch(id string, patch JSONPatch) (string, error) {
+	return p.update(id, patch.Apply)
+}
+
+// update is a read-modify-write loop: it fetches document id, transforms
+// it with fn, and saves the result, retrying on conflicts.
+func (p Database) update(id string, fn func(doc []byte) ([]byte, error)) (string, error) {
+	if id == "" {
+		return "", fmt.Errorf("no id specified")
+	}
+	for attempt := 0; ; attempt++ {
+		before, err := p.currentDoc(id)
+		if err != nil {
+			return "", err
+		}
+		idRev := IdAndRev{}
+		if err := json.Unmarshal(before, &idRev); err != nil {
+			return "", err
+		}
+		after, err := fn(before)
+		if err != nil {
+			return "", err
+		}
+		check := IdAndRev{}
+		if err := json.Unmarshal(after, &check); err != nil {
+			return "", err
+		}
+		if check != idRev {
+			return "", fmt.Errorf("update may not change _id or _rev")
+		}
+		rev, err := p.Edit(json.RawMessage(after))
+		if statusCode(err) == 409 && attempt < conflictRetries {
+			continue
+		}
+		return rev, err
+	}
+}
@@ -0,0 +1,110 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestJSONPatchApply(t *testing.T) {
+	doc := []byte(`{"_id":"x","name":"a","tags":["one","two"],"nested":{"n":1}}`)
+	for _, c := range []struct {
+		patch    JSONPatch
+		expected string
+	}{
+		{JSONPatch{{Op: "add", Path: "/tags/-", Value: "three"}},
+			`{"_id":"x","name":"a","nested":{"n":1},"tags":["one","two","three"]}`},
+		{JSONPatch{{Op: "add", Path: "/tags/0", Value: "zero"}},
+			`{"_id":"x","name":"a","nested":{"n":1},"tags":["zero","one","two"]}`},
+		{JSONPatch{{Op: "remove", Path: "/tags/0"}, {Op: "replace", Path: "/name", Value: "b"}},
+			`{"_id":"x","name":"b","nested":{"n":1},"tags":["two"]}`},
+		{JSONPatch{{Op: "move", From: "/nested/n", Path: "/n"}},
+			`{"_id":"x","n":1,"name":"a","nested":{},"tags":["one","two"]}`},
+		{JSONPatch{{Op: "copy", From: "/tags", Path: "/nested/tags"}, {Op: "test", Path: "/nested/n", Value: 1}},
+			`{"_id":"x","name":"a","nested":{"n":1,"tags":["one","two"]},"tags":["one","two"]}`},
+		{JSONPatch{{Op: "add", Path: "/a~1b", Value: map[string]int{"c": 1}}},
+			`{"_id":"x","a/b":{"c":1},"name":"a","nested":{"n":1},"tags":["one","two"]}`},
+		{JSONPatch{{Op: "test", Path: "/nested", Value: map[string]interface{}{"n": json.Number("1.0")}}, {Op: "test", Path: "/nested/n", Value: json.Number("1e0")}},
+			`{"_id":"x","name":"a","nested":{"n":1},"tags":["one","two"]}`},
+	} {
+		out, err := c.patch.Apply(doc)
+		if err != nil {
+			t.Fatalf("%+v: failed to apply: %s", c.patch, err)
+		}
+		if string(out) != c.expected {
+			t.Fatalf("%+v:\nexpected %s\n     got %s", c.patch, c.expected, out)
+		}
+	}
+}
+
+func TestJSONPatchErrors(t *testing.T) {
+	doc := []byte(`{"name":"a","tags":["one"]}`)
+	for _, patch := range []JSONPatch{
+		{{Op: "remove", Path: "/missing"}},
+		{{Op: "replace", Path: "/tags/1", Value: 1}},
+		{{Op: "add", Path: "/tags/01", Value: 1}},
+		{{Op: "test", Path: "/name", Value: "b"}},
+		{{Op: "test", Path: "/tags", Value: []interface{}{"one", 1}}},
+		{{Op: "move", From: "/tags", Path: "/tags/0"}},
+		{{Op: "frobnicate", Path: "/name"}},
+	} {
+		if _, err := patch.Apply(doc); err == nil {
+			t.Errorf("%+v: expected an error", patch)
+		}
+	}
+}
+
+func TestPatchOpNullValue(t *testing.T) {
+	var patch JSONPatch
+	if err := json.Unmarshal([]byte(`[{"op":"replace","path":"/name","value":null}]`), &patch); err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	b, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	if expected := `[{"op":"replace","path":"/name","value":null}]`; string(b) != expected {
+		t.Fatalf("round trip: expected %s, got %s", expected, b)
+	}
+	out, err := patch.Apply([]byte(`{"name":"a"}`))
+	if err != nil || string(out) != `{"name":null}` {
+		t.Fatalf("apply: got %s, %v", out, err)
+	}
+}
+
+func TestPatchConflictRetry(t *testing.T) {
+	rev, puts := 1, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			fmt.Fprintf(w, `{"_id":"doc","_rev":"%d-x","count":%d}`, rev, rev)
+		case "PUT":
+			puts++
+			body, _ := ioutil.ReadAll(r.Body)
+			sent := IdAndRev{}
+			json.Unmarshal(body, &sent)
+			if puts == 1 {
+				rev++ // someone else got there first
+			}
+			if sent.Rev != fmt.Sprintf("%d-x", rev) {
+				w.WriteHeader(http.StatusConflict)
+				fmt.Fprint(w, `{"error":"conflict","reason":"Document update conflict."}`)
+				return
+			}
+			rev++
+			fmt.Fprintf(w, `{"ok":true,"id":"doc","rev":"%d-x"}`, rev)
+		}
+	}))
+	defer ts.Close()
+	newRev, err := newTestDatabase(ts).Patch("doc", JSONPatch{{Op: "replace", Path: "/count", Value: 10}})
+	if err != nil {
+		t.Fatalf("failed to patch: %s", err)
+	}
+	if puts != 2 || newRev != "3-x" {
+		t.Fatalf("expected a retry ending at 3-x, got %d puts and %s", puts, newRev)
+	}
+}
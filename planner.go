@@ -0,0 +1,97 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNoIndex is returned by Planner.Find when no index can answer a
+// query, and there's no fallback view for it either.
+var ErrNoIndex = errors.New("no index matches the selector")
+
+// Explanation is CouchDB's plan for a Mango query, from _explain.
+type Explanation struct {
+	DBName   string                 `json:"dbname"`
+	Index    ExplainIndex           `json:"index"`
+	Selector json.RawMessage        `json:"selector"`
+	Opts     map[string]interface{} `json:"opts"`
+	Limit    int                    `json:"limit"`
+	Skip     int                    `json:"skip"`
+	Fields   json.RawMessage        `json:"fields"`
+}
+
+// ExplainIndex is the index chosen for a query. DDoc is nil for the
+// special _all_docs index.
+type ExplainIndex struct {
+	DDoc *string         `json:"ddoc"`
+	Name string          `json:"name"`
+	Type string          `json:"type"` // "json", "text" or "special"
+	Def  json.RawMessage `json:"def"`
+}
+
+// FullScan reports whether the query would scan the whole database,
+// because no index matches its selector.
+func (e Explanation) FullScan() bool {
+	return e.Index.Type == "special" && e.Index.Name == "_all_docs"
+}
+
+// Explain returns the plan CouchDB would use for the Mango query.
+func (p Database) Explain(selector interface{}, opts FindOptions) (Explanation, error) {
+	in, err := opts.body(selector)
+	if err != nil {
+		return Explanation{}, err
+	}
+	e := Explanation{}
+	u := fmt.Sprintf("%s/_explain", p.DBURL())
+	if _, err := p.interact("POST", u, map[string][]string{}, in, &e); err != nil {
+		return Explanation{}, err
+	}
+	return e, nil
+}
+
+// Planner runs Mango queries only when an index can answer them, so a
+// query which would scan the whole database fails in development rather
+// than loading production. Each query is explained first: if no index
+// matches, it's handed to Fallback, which may name a view (with options)
+// to answer it instead; otherwise Find returns ErrNoIndex.
+type Planner struct {
+	DB Database
+
+	// Fallback returns the view answering queries no index can, or false.
+	// The view's rows are returned as they are, with their documents, so
+	// it must select exactly the documents the selector would; Fields,
+	// Sort and Bookmark don't apply to it.
+	Fallback func(selector interface{}, opts FindOptions) (view string, vo ViewOptions, ok bool)
+}
+
+// Find runs the query with the index CouchDB picks, or the fallback view.
+func (pl Planner) Find(selector interface{}, opts FindOptions) (FindResponse, error) {
+	e, err := pl.DB.Explain(selector, opts)
+	if err != nil {
+		return FindResponse{}, err
+	}
+	if !e.FullScan() {
+		return pl.DB.Find(selector, opts)
+	}
+	if pl.Fallback == nil {
+		return FindResponse{}, ErrNoIndex
+	}
+	view, vo, ok := pl.Fallback(selector, opts)
+	if !ok {
+		return FindResponse{}, ErrNoIndex
+	}
+	vo.IncludeDocs = true
+	if vo.Limit == 0 {
+		vo.Limit = opts.Limit
+	}
+	if vo.Skip == 0 {
+		vo.Skip = opts.Skip
+	}
+	r := FindResponse{Docs: []json.RawMessage{}}
+	if err := pl.DB.QueryScan(view, vo, &r.Docs); err != nil {
+		return FindResponse{}, err
+	}
+	return r, nil
+}
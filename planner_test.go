@@ -0,0 +1,59 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPlanner(t *testing.T) {
+	indexed := true
+	paths := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/db/_explain":
+			if indexed {
+				fmt.Fprint(w, `{"dbname":"db","index":{"ddoc":"_design/idx","name":"by_type","type":"json","def":{"fields":[{"type":"asc"}]}},"limit":25}`)
+			} else {
+				fmt.Fprint(w, `{"dbname":"db","index":{"ddoc":null,"name":"_all_docs","type":"special","def":{"fields":[{"_id":"asc"}]}},"limit":25}`)
+			}
+		case "/db/_find":
+			fmt.Fprint(w, `{"docs":[{"_id":"a"}]}`)
+		case "/db/_design/app/_view/users":
+			if r.URL.Query().Get("include_docs") != "true" || r.URL.Query().Get("limit") != "5" {
+				t.Errorf("view query: got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"rows":[{"id":"b","key":null,"value":null,"doc":{"_id":"b"}}]}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	pl := Planner{DB: newTestDatabase(ts)}
+	selector := map[string]interface{}{"type": "user"}
+
+	r, err := pl.Find(selector, FindOptions{Limit: 5})
+	if err != nil || len(r.Docs) != 1 || string(r.Docs[0]) != `{"_id":"a"}` {
+		t.Fatalf("indexed: got %+v, %v", r, err)
+	}
+
+	indexed = false
+	if _, err := pl.Find(selector, FindOptions{Limit: 5}); err != ErrNoIndex {
+		t.Fatalf("unindexed: expected ErrNoIndex, got %v", err)
+	}
+
+	pl.Fallback = func(selector interface{}, opts FindOptions) (string, ViewOptions, bool) {
+		return "_design/app/_view/users", ViewOptions{}, true
+	}
+	paths = nil
+	r, err = pl.Find(selector, FindOptions{Limit: 5})
+	if err != nil || len(r.Docs) != 1 || string(r.Docs[0]) != `{"_id":"b"}` {
+		t.Fatalf("fallback: got %+v, %v", r, err)
+	}
+	if len(paths) != 2 || paths[1] != "/db/_design/app/_view/users" {
+		t.Fatalf("fallback: expected explain then view, got %v", paths)
+	}
+}
@@ -0,0 +1,166 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrForbidden is returned for requests which a Client's Policy refuses,
+// without sending them.
+var ErrForbidden = errors.New("forbidden by policy")
+
+// Policy reports whether a session may make a request of class op on the
+// database db, or on the server itself when db is "". It's only a guide,
+// for failing fast: CouchDB still authorizes everything it's sent.
+type Policy func(s SessionInfo, db string, op OpClass) bool
+
+// RolePolicy returns a Policy which allows each class of operation, on
+// any database, to sessions with at least one of its roles. Classes not
+// in roles are allowed to everyone, and server admins may do anything.
+func RolePolicy(roles map[OpClass][]string) Policy {
+	return func(s SessionInfo, db string, op OpClass) bool {
+		allowed, ok := roles[op]
+		if !ok || s.IsAdmin() {
+			return true
+		}
+		for _, role := range allowed {
+			if s.HasRole(role) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// policySessionTTL is how long a session's roles are trusted before
+// _session is asked again.
+const policySessionTTL = 5 * time.Minute
+
+// maxPolicySessions is how many sessions are cached before expired ones
+// are cleared out.
+const maxPolicySessions = 1000
+
+// WithPolicy checks each request against p before sending it, refusing
+// those it doesn't allow with ErrForbidden. The session is that of the
+// request's credentials (see UserContext), looked up from /_session and
+// cached for a few minutes, so role changes take a while to be seen. The
+// database is the first segment of the request's path after the Client's
+// base path (see WithBasePath).
+func WithPolicy(p Policy) Option {
+	return func(c *Client) {
+		c.policy = &policy{allow: p, sessions: map[string]policySession{}, now: time.Now}
+	}
+}
+
+type policy struct {
+	allow    Policy
+	mu       sync.Mutex
+	sessions map[string]policySession
+	now      func() time.Time
+}
+
+type policySession struct {
+	info    SessionInfo
+	expires time.Time
+}
+
+// Allowed reports whether the Client's Policy allows requests of class op
+// on the database, so that a UI can hide what the user can't do. Without
+// a Policy, everything is allowed.
+func (p Database) Allowed(op OpClass) (bool, error) {
+	return p.AllowedContext(context.Background(), op)
+}
+
+// AllowedContext is Allowed, for the credentials of ctx.
+func (p Database) AllowedContext(ctx context.Context, op OpClass) (bool, error) {
+	c := p.client()
+	if c.policy == nil {
+		return true, nil
+	}
+	u, err := url.Parse(p.BaseURL())
+	if err != nil {
+		return false, err
+	}
+	s, err := c.policy.session(ctx, c, u)
+	if err != nil {
+		return false, err
+	}
+	return c.policy.allow(s, p.Name, op), nil
+}
+
+// guard returns ErrForbidden if the Policy refuses req.
+func (c *Client) guard(req *http.Request) error {
+	if c.policy == nil || strings.HasSuffix(req.URL.Path, "/_session") {
+		return nil
+	}
+	s, err := c.policy.session(req.Context(), c, req.URL)
+	if err != nil {
+		return err
+	}
+	db := policyDatabase(strings.TrimPrefix(req.URL.EscapedPath(), c.basePath))
+	op := classify(req)
+	if !c.policy.allow(s, db, op) {
+		return fmt.Errorf("%w: %s on %q for %q", ErrForbidden, op, db, s.Name)
+	}
+	return nil
+}
+
+// policyDatabase returns the database named by the first segment of
+// path, which is escaped so that a "/" in a name isn't taken for a
+// separator, or "" if it's a server endpoint.
+func policyDatabase(path string) string {
+	seg, _, _ := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if seg, err := url.PathUnescape(seg); err == nil {
+		path = seg
+	}
+	switch {
+	case path == "_users" || path == "_replicator" || path == "_global_changes":
+		return path
+	case strings.HasPrefix(path, "_"):
+		return ""
+	}
+	return path
+}
+
+// session returns the session for the credentials requests to u's server
+// are made with in ctx.
+func (p *policy) session(ctx context.Context, c *Client, u *url.URL) (SessionInfo, error) {
+	key := u.Scheme + "://" + u.Host
+	if creds, ok := userCredentials(ctx); ok {
+		key += " session=" + creds.Session + " jwt=" + creds.JWT
+	} else if u.User != nil {
+		key += " user=" + u.User.Username()
+	}
+	p.mu.Lock()
+	s, ok := p.sessions[key]
+	p.mu.Unlock()
+	if ok && p.now().Before(s.expires) {
+		return s.info, nil
+	}
+	server := *u
+	server.Path, server.RawPath, server.RawQuery = c.basePath+"/_session", "", ""
+	r := sessionResponse{}
+	if _, err := c.interactContext(ctx, "GET", server.String(), nil, nil, &r); err != nil {
+		return SessionInfo{}, err
+	}
+	info := r.info()
+	p.mu.Lock()
+	if len(p.sessions) >= maxPolicySessions {
+		// end users' sessions come and go
+		for k, s := range p.sessions {
+			if !p.now().Before(s.expires) {
+				delete(p.sessions, k)
+			}
+		}
+	}
+	p.sessions[key] = policySession{info, p.now().Add(policySessionTTL)}
+	p.mu.Unlock()
+	return info, nil
+}
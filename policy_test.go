@@ -0,0 +1,128 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy(t *testing.T) {
+	sessions, writes := 0, 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_session":
+			sessions++
+			roles := `[]`
+			if cookie, err := r.Cookie("AuthSession"); err == nil && cookie.Value == "editor" {
+				roles = `["editor"]`
+			}
+			w.Write([]byte(`{"ok":true,"userCtx":{"name":"someone","roles":` + roles + `}}`))
+		case r.Method == "PUT":
+			writes++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"doc","rev":"1-a"}`))
+		default:
+			w.Write([]byte(`{"_id":"doc","_rev":"1-a"}`))
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithPolicy(RolePolicy(map[OpClass][]string{OpWrite: {"editor"}})))
+	reader := UserContext(context.Background(), UserCredentials{Session: "reader"})
+	editor := UserContext(context.Background(), UserCredentials{Session: "editor"})
+
+	// writes are refused without being sent, reads are allowed
+	if ok, err := db.AllowedContext(reader, OpWrite); ok || err != nil {
+		t.Fatalf("reader writing: expected not allowed, got %v, %v", ok, err)
+	}
+	if ok, err := db.AllowedContext(reader, OpRead); !ok || err != nil {
+		t.Fatalf("reader reading: expected allowed, got %v, %v", ok, err)
+	}
+	if _, err := db.PutAttachmentContext(reader, "doc", "1-a", "a.txt", strings.NewReader("hi"), AttachmentOptions{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("reader writing: expected ErrForbidden, got %v", err)
+	}
+	if writes != 0 {
+		t.Fatalf("expected no writes to be sent, got %d", writes)
+	}
+	if _, err := db.PutAttachmentContext(editor, "doc", "1-a", "a.txt", strings.NewReader("hi"), AttachmentOptions{}); err != nil {
+		t.Fatalf("editor writing: %s", err)
+	}
+	if writes != 1 {
+		t.Fatalf("expected the editor's write, got %d", writes)
+	}
+
+	// sessions are looked up once per user, until they expire
+	if sessions != 2 {
+		t.Fatalf("sessions: expected 2, got %d", sessions)
+	}
+	db.client().policy.now = func() time.Time { return time.Now().Add(policySessionTTL) }
+	db.AllowedContext(reader, OpRead)
+	if sessions != 3 {
+		t.Fatalf("sessions after expiry: expected 3, got %d", sessions)
+	}
+}
+
+func TestPolicyDatabase(t *testing.T) {
+	for path, want := range map[string]string{
+		"/db/doc":           "db",
+		"/a%2Fb/_all_docs":  "a/b",
+		"/_all_dbs":         "",
+		"/_users/org.couch": "_users",
+		"/":                 "",
+	} {
+		if got := policyDatabase(path); got != want {
+			t.Fatalf("%s: expected %q, got %q", path, want, got)
+		}
+	}
+}
+
+func TestPolicyWith(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		roles := `[]`
+		if r.Header.Get("Authorization") == "Bearer editor" {
+			roles = `["editor"]`
+		}
+		w.Write([]byte(`{"ok":true,"userCtx":{"name":"someone","roles":` + roles + `}}`))
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithPolicy(RolePolicy(map[OpClass][]string{OpWrite: {"editor"}})))
+	if ok, err := db.Allowed(OpWrite); ok || err != nil {
+		t.Fatalf("anonymous writing: expected not allowed, got %v, %v", ok, err)
+	}
+
+	// the clone's credentials differ, so it mustn't reuse the parent's session
+	editor := db
+	editor.Client = db.Client.With(WithHeader("Authorization", "Bearer editor"))
+	if ok, err := editor.Allowed(OpWrite); !ok || err != nil {
+		t.Fatalf("editor writing: expected allowed, got %v, %v", ok, err)
+	}
+	if ok, err := db.Allowed(OpWrite); ok || err != nil {
+		t.Fatalf("anonymous writing after clone: expected not allowed, got %v, %v", ok, err)
+	}
+}
+
+func TestPolicyEscapedDatabase(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok":true,"userCtx":{"name":"someone","roles":[]}}`))
+	}))
+	defer ts.Close()
+	dbs := []string{}
+	db := newTestDatabase(ts)
+	db.Name = "a/b"
+	db.Client = NewClient(WithPolicy(func(s SessionInfo, db string, op OpClass) bool {
+		dbs = append(dbs, db)
+		return false
+	}))
+	if _, err := db.Retrieve("doc", &map[string]interface{}{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("retrieve: expected ErrForbidden, got %v", err)
+	}
+	if len(dbs) != 1 || dbs[0] != "a/b" {
+		t.Fatalf("database: expected a/b, got %q", dbs)
+	}
+}
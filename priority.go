@@ -0,0 +1,107 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+)
+
+// Priority classifies requests by who is waiting for them, so that
+// background work can be kept from starving user-facing requests which
+// share a Client. See WithPriorityPool.
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // a user is waiting; the default
+	PriorityBatch                       // bulk loads, backfills, reports and the like
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityInteractive:
+		return "interactive"
+	case PriorityBatch:
+		return "batch"
+	}
+	return "unknown"
+}
+
+type priorityKey struct{}
+
+// PriorityContext returns a copy of ctx under which requests are made at
+// priority p, eg. PriorityContext(ctx, PriorityBatch) for a Transform.
+func PriorityContext(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// WithDefaultPriority sets the priority of requests whose context doesn't
+// set one, including those made by methods without a context. It's
+// useful with Client.With, for a batch job's Client.
+func WithDefaultPriority(p Priority) Option {
+	return func(c *Client) {
+		c.priority = p
+	}
+}
+
+// WithPriorityPool gives requests of priority p connections of their own,
+// at most maxConns to any one host (0 means no limit), and limits them,
+// whatever their OpClass, to rate per second with bursts of up to burst
+// (a rate of 0 means no limit); any WithRateLimit limits apply as well.
+// Requests of a priority without a pool share the Client's main
+// connections, so typically only PriorityBatch is given one: however
+// busy it gets, interactive requests have the main pool to themselves.
+func WithPriorityPool(p Priority, maxConns int, rate float64, burst int) Option {
+	return func(c *Client) {
+		pools := map[Priority]*priorityPool{}
+		for k, v := range c.pools {
+			pools[k] = v
+		}
+		pool := &priorityPool{maxConns: maxConns}
+		if rate > 0 {
+			pool.limiter = newTokenBucket(rate, burst)
+		}
+		pools[p] = pool
+		c.pools = pools
+	}
+}
+
+// priorityPool is the connections and rate limit of one priority.
+type priorityPool struct {
+	maxConns int
+	limiter  *tokenBucket
+	rt       http.RoundTripper // nil until built by Client.init
+}
+
+// priorityOf returns the priority of req.
+func (c *Client) priorityOf(req *http.Request) Priority {
+	if p, ok := req.Context().Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return c.priority
+}
+
+// initPools builds the connection pool of each priority, unless it
+// already has one and rebuild is false, and the http.Client using it.
+func (c *Client) initPools(rebuild bool) {
+	c.poolClients = map[Priority]*http.Client{}
+	pools := map[Priority]*priorityPool{}
+	for p, pool := range c.pools {
+		if rebuild || pool.rt == nil {
+			t := c.transport()
+			t.MaxConnsPerHost = pool.maxConns
+			pool = &priorityPool{maxConns: pool.maxConns, limiter: pool.limiter, rt: t}
+		}
+		pools[p] = pool
+		c.poolClients[p] = &http.Client{Transport: pool.rt, Timeout: c.timeout}
+	}
+	c.pools = pools
+}
+
+// poolFor returns the http.Client and rate limit for req's priority.
+func (c *Client) poolFor(req *http.Request) (*http.Client, *tokenBucket) {
+	p := c.priorityOf(req)
+	if hc, ok := c.poolClients[p]; ok {
+		return hc, c.pools[p].limiter
+	}
+	return c.httpClient, nil
+}
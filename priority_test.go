@@ -0,0 +1,92 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPriorityPool(t *testing.T) {
+	mu := sync.Mutex{}
+	batchInFlight, maxBatchInFlight := 0, 0
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/batch" {
+			mu.Lock()
+			batchInFlight++
+			if batchInFlight > maxBatchInFlight {
+				maxBatchInFlight = batchInFlight
+			}
+			mu.Unlock()
+			<-release
+			mu.Lock()
+			batchInFlight--
+			mu.Unlock()
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	c := NewClient(WithPriorityPool(PriorityBatch, 1, 0, 0))
+	if c.poolClients[PriorityBatch].Transport == c.httpClient.Transport {
+		t.Fatalf("expected the batch pool to have its own transport")
+	}
+	if clone := c.With(WithTimeout(time.Second)); clone.poolClients[PriorityBatch].Transport != c.poolClients[PriorityBatch].Transport {
+		t.Fatalf("expected clones to share the batch pool")
+	}
+
+	batch := PriorityContext(context.Background(), PriorityBatch)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- c.unmarshalURLContext(batch, ts.URL+"/batch", &map[string]interface{}{})
+		}()
+	}
+	// batch requests fill their pool, but interactive ones aren't held up
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := c.unmarshalURLContext(ctx, ts.URL+"/interactive", &map[string]interface{}{}); err != nil {
+		t.Fatalf("interactive request: %s", err)
+	}
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("batch request: %s", err)
+		}
+	}
+	if maxBatchInFlight != 1 {
+		t.Fatalf("batch requests in flight: expected at most 1, got %d", maxBatchInFlight)
+	}
+}
+
+func TestPriorityRateLimit(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	base := NewClient(WithPriorityPool(PriorityBatch, 0, 0.01, 1))
+	batch := base.With(WithDefaultPriority(PriorityBatch))
+	get := func(c *Client, ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		return c.unmarshalURLContext(ctx, ts.URL+"/db/doc", &map[string]interface{}{})
+	}
+	if err := get(batch, context.Background()); err != nil {
+		t.Fatalf("first batch request: %s", err)
+	}
+	if err := get(batch, context.Background()); err != context.DeadlineExceeded {
+		t.Fatalf("second batch request: expected to wait for the rate limit, got %v", err)
+	}
+	if err := get(base, context.Background()); err != nil {
+		t.Fatalf("interactive request: %s", err)
+	}
+	if err := get(batch, PriorityContext(context.Background(), PriorityInteractive)); err != nil {
+		t.Fatalf("interactive request from the batch client: %s", err)
+	}
+	if err := get(base, PriorityContext(context.Background(), PriorityBatch)); err != context.DeadlineExceeded {
+		t.Fatalf("batch request from the base client: expected to wait, got %v", err)
+	}
+}
@@ -0,0 +1,44 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+)
+
+// PushDirectory uploads the files of fsys as attachments of the document
+// docID, usually a design document, couchapp-style: a file "css/site.css"
+// becomes the attachment "css/site.css", so that it's served at
+// /{db}/_design/{app}/css/site.css. The document is created if need be.
+// Files whose attachment already has the same digest aren't uploaded
+// again; attachments without a file are left alone. It returns the
+// document's final revision, eg.
+//
+//	rev, err := db.PushDirectory(os.DirFS("site"), "_design/site")
+func (p Database) PushDirectory(fsys fs.FS, docID string) (string, error) {
+	rev, stubs, err := p.attachmentStubs(docID)
+	if err != nil && !isNotFound(err) {
+		return "", err
+	}
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		sum := md5.Sum(b)
+		if stub, ok := stubs[name]; ok && stub.Digest == "md5-"+base64.StdEncoding.EncodeToString(sum[:]) {
+			return nil
+		}
+		if rev, err = p.PutAttachment(docID, rev, name, bytes.NewReader(b), AttachmentOptions{}); err != nil {
+			return fmt.Errorf("pushing %s: %w", name, err)
+		}
+		return nil
+	})
+	return rev, err
+}
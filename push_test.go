@@ -0,0 +1,51 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestPushDirectory(t *testing.T) {
+	unchanged := md5.Sum([]byte("body {}"))
+	puts := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			fmt.Fprintf(w, `{"_id":"_design/site","_rev":"1-s","_attachments":{"css/site.css":{"content_type":"text/css","digest":"md5-%s","length":7,"revpos":1,"stub":true}}}`,
+				base64.StdEncoding.EncodeToString(unchanged[:]))
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		rev := r.URL.Query().Get("rev")
+		puts = append(puts, fmt.Sprintf("%s %s %s %s", r.URL.EscapedPath(), rev, r.Header.Get("Content-Type"), b))
+		fmt.Fprintf(w, `{"ok":true,"id":"_design/site","rev":"%c-s"}`, rev[0]+1)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	fsys := fstest.MapFS{
+		"index.html":   {Data: []byte("<html></html>")},
+		"css/site.css": {Data: []byte("body {}")},
+		"js/app.js":    {Data: []byte("go()")},
+	}
+	rev, err := db.PushDirectory(fsys, "_design/site")
+	if err != nil {
+		t.Fatalf("failed to push: %s", err)
+	}
+	if rev != "3-s" {
+		t.Fatalf("rev: expected 3-s, got %s", rev)
+	}
+	expected := []string{
+		"/db/_design/site/index.html 1-s text/html; charset=utf-8 <html></html>",
+		"/db/_design/site/js%2Fapp.js 2-s text/javascript; charset=utf-8 go()",
+	}
+	if !reflect.DeepEqual(puts, expected) {
+		t.Fatalf("puts: expected %q, got %q", expected, puts)
+	}
+}
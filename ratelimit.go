@@ -0,0 +1,158 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OpClass classifies requests for rate limiting. Cloudant provisions
+// throughput separately for lookups, writes and queries, and these match
+// its classes.
+type OpClass int
+
+const (
+	OpRead  OpClass = iota // document and attachment reads, _changes, _bulk_get
+	OpWrite                // anything but GET or HEAD which isn't a query
+	OpQuery                // views, _all_docs, _find, _explain and search
+)
+
+func (o OpClass) String() string {
+	switch o {
+	case OpRead:
+		return "read"
+	case OpWrite:
+		return "write"
+	case OpQuery:
+		return "query"
+	}
+	return "unknown"
+}
+
+// WithRateLimit limits requests of the given class to rate per second,
+// allowing bursts of up to burst requests. Requests over the limit wait
+// for their turn, or until their context is done. Each class is limited
+// independently, and classes without a limit (or with a rate of 0) are
+// unrestricted.
+func WithRateLimit(class OpClass, rate float64, burst int) Option {
+	return func(c *Client) {
+		// copy the limits, which a Client shares with its clones
+		limiters := make(map[OpClass]*tokenBucket, len(c.limiters)+1)
+		for k, b := range c.limiters {
+			limiters[k] = b
+		}
+		if rate <= 0 {
+			delete(limiters, class)
+		} else {
+			limiters[class] = newTokenBucket(rate, burst)
+		}
+		c.limiters = limiters
+	}
+}
+
+// classify returns the OpClass of req.
+func classify(req *http.Request) OpClass {
+	path := req.URL.Path
+	for _, q := range []string{"/_view/", "/_all_docs", "/_find", "/_explain", "/_search/"} {
+		if strings.Contains(path, q) {
+			return OpQuery
+		}
+	}
+	if req.Method == "GET" || req.Method == "HEAD" || strings.HasSuffix(path, "/_bulk_get") || strings.HasSuffix(path, "/_changes") {
+		return OpRead
+	}
+	return OpWrite
+}
+
+// limit waits until the rate limit for req's class, if any, allows it.
+func (c *Client) limit(req *http.Request) error {
+	if b, ok := c.limiters[classify(req)]; ok {
+		return b.wait(req.Context())
+	}
+	return nil
+}
+
+// throttled slows down the rate limit for req's class, if any, after
+// the server answered it with 429 Too Many Requests, so that no request
+// of that class is sent for the wait the server asked for (or one
+// token's worth, if it didn't say).
+func (c *Client) throttled(req *http.Request, wait time.Duration) {
+	if b, ok := c.limiters[classify(req)]; ok {
+		b.pause(wait)
+	}
+}
+
+// tokenBucket holds up to burst tokens, refilled at rate per second.
+// Tokens may go negative: each caller reserves one and waits until the
+// bucket would have refilled enough to cover it.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), now: time.Now}
+}
+
+// reserve takes a token, returning how long the caller must wait for it.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// pause empties the bucket, so that the next token is available after
+// wait at the earliest.
+func (b *tokenBucket) pause(wait time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.last = b.now()
+	if owed := -wait.Seconds() * b.rate; owed < b.tokens {
+		b.tokens = owed
+	}
+}
+
+// cancel returns a reserved token that wasn't used.
+func (b *tokenBucket) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens++
+}
+
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d == 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,112 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClassify(t *testing.T) {
+	for _, test := range []struct {
+		method, path string
+		expected     OpClass
+	}{
+		{"GET", "/db/doc", OpRead},
+		{"HEAD", "/db/doc", OpRead},
+		{"GET", "/db/_changes", OpRead},
+		{"POST", "/db/_bulk_get", OpRead},
+		{"PUT", "/db/doc", OpWrite},
+		{"POST", "/db/_bulk_docs", OpWrite},
+		{"DELETE", "/db/doc", OpWrite},
+		{"GET", "/db/_design/app/_view/by_name", OpQuery},
+		{"POST", "/db/_all_docs", OpQuery},
+		{"POST", "/db/_find", OpQuery},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if got := classify(req); got != test.expected {
+			t.Fatalf("%s %s: expected %s, got %s", test.method, test.path, test.expected, got)
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(10, 2)
+	b.now = func() time.Time { return now }
+	for i, expected := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if d := b.reserve(); d != expected {
+			t.Fatalf("reservation %d: expected %s, got %s", i, expected, d)
+		}
+	}
+	// 0.5s refills 5 tokens, covering the 2 owed
+	now = now.Add(500 * time.Millisecond)
+	if d := b.reserve(); d != 0 {
+		t.Fatalf("after refill: expected no wait, got %s", d)
+	}
+	// but never more than the burst
+	now = now.Add(time.Hour)
+	b.reserve()
+	b.reserve()
+	if d := b.reserve(); d <= 0 {
+		t.Fatalf("after burst: expected a wait, got %s", d)
+	}
+}
+
+func TestRateLimitContext(t *testing.T) {
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+	c := NewClient(WithRateLimit(OpRead, 0.001, 1))
+	out := map[string]interface{}{}
+	if err := c.unmarshalURL(ts.URL+"/db/doc", &out); err != nil {
+		t.Fatalf("first read: %s", err)
+	}
+	// writes aren't limited
+	if _, err := c.interact("PUT", ts.URL+"/db/doc", defaultHeaders, []byte(`{}`), &out); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.unmarshalURLContext(ctx, ts.URL+"/db/doc", &out); err != context.DeadlineExceeded {
+		t.Fatalf("second read: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if requests != 2 {
+		t.Fatalf("requests: expected 2, got %d", requests)
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newTokenBucket(10, 5)
+	b.now = func() time.Time { return now }
+	b.pause(2 * time.Second)
+	if d := b.reserve(); d != 2100*time.Millisecond {
+		t.Fatalf("after pause: expected 2.1s, got %s", d)
+	}
+	b = newTokenBucket(10, 5)
+	b.now = func() time.Time { return now }
+	b.pause(0)
+	if d := b.reserve(); d != 100*time.Millisecond {
+		t.Fatalf("after pause without wait: expected 100ms, got %s", d)
+	}
+}
+
+func TestRateLimitWith(t *testing.T) {
+	base := NewClient(WithRateLimit(OpRead, 10, 1))
+	clone := base.With(WithRateLimit(OpWrite, 5, 1), WithRateLimit(OpRead, 0, 0))
+	if _, ok := base.limiters[OpWrite]; ok {
+		t.Fatalf("the clone's write limit leaked into its parent")
+	}
+	if _, ok := base.limiters[OpRead]; !ok {
+		t.Fatalf("the clone removed its parent's read limit")
+	}
+	if _, ok := clone.limiters[OpRead]; ok {
+		t.Fatalf("expected the clone's read limit to be removed")
+	}
+}
@@ -0,0 +1,229 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// RawDoc is a document kept as raw JSON, for services which pass
+// documents through without decoding them, like proxies. It can be used
+// wherever a document can: Insert, Edit, Retrieve, bulk writes and so on.
+// Its _id and _rev are read and written by splicing the bytes of the
+// top-level object, without decoding the rest; Retrieve, and Insert and
+// Edit through a *RawDoc, update them in place.
+type RawDoc json.RawMessage
+
+func (d RawDoc) MarshalJSON() ([]byte, error) {
+	if d == nil {
+		return []byte("null"), nil
+	}
+	return d, nil
+}
+
+func (d *RawDoc) UnmarshalJSON(b []byte) error {
+	*d = append((*d)[:0], b...)
+	return nil
+}
+
+// GetID returns the document's _id, or "" if it has none.
+func (d RawDoc) GetID() string {
+	return d.member("_id")
+}
+
+// GetRev returns the document's _rev, or "" if it has none.
+func (d RawDoc) GetRev() string {
+	return d.member("_rev")
+}
+
+// SetID sets the document's _id.
+func (d *RawDoc) SetID(id string) {
+	*d = d.with("_id", id)
+}
+
+// SetRev sets the document's _rev.
+func (d *RawDoc) SetRev(rev string) {
+	*d = d.with("_rev", rev)
+}
+
+// member returns the string member name, or "" if there's no such
+// string member.
+func (d RawDoc) member(name string) string {
+	m, ok := findMember(d, name)
+	if !ok {
+		return ""
+	}
+	s := ""
+	if json.Unmarshal(d[m.value:m.end], &s) != nil {
+		return ""
+	}
+	return s
+}
+
+// with returns d with the string member name set to s, replacing any
+// existing value, or otherwise inserted first (a _rev after any _id).
+func (d RawDoc) with(name, s string) RawDoc {
+	v := mustJSON(s)
+	if m, ok := findMember(d, name); ok {
+		return splice(d, m.value, m.end, v)
+	}
+	if name == "_rev" {
+		if id, ok := findMember(d, "_id"); ok {
+			return splice(d, id.end, id.end, append([]byte(`,"_rev":`), v...))
+		}
+	}
+	start := bytes.IndexByte(d, '{')
+	if start < 0 {
+		return d
+	}
+	member := append(append(mustJSON(name), ':'), v...)
+	if rest := bytes.TrimSpace(d[start+1:]); len(rest) > 0 && rest[0] != '}' {
+		member = append(member, ',')
+	}
+	return splice(d, start+1, start+1, member)
+}
+
+// without returns d without the member name, if it has it.
+func (d RawDoc) without(name string) RawDoc {
+	m, ok := findMember(d, name)
+	if !ok {
+		return d
+	}
+	if m.comma >= 0 {
+		if m.comma >= m.end {
+			return splice(d, m.key, m.comma+1, nil)
+		}
+		return splice(d, m.comma, m.end, nil)
+	}
+	return splice(d, m.key, m.end, nil)
+}
+
+// splice returns a copy of b with b[from:to] replaced by with.
+func splice(b []byte, from, to int, with []byte) []byte {
+	out := make([]byte, 0, len(b)-(to-from)+len(with))
+	out = append(append(append(out, b[:from]...), with...), b[to:]...)
+	return out
+}
+
+// rawMember locates a member of a JSON object: its key starts at key, its
+// value spans value to end, and comma is the offset of the comma
+// separating it from the next member, or the previous one if it's last;
+// -1 if it's the only member.
+type rawMember struct {
+	key, value, end, comma int
+}
+
+// findMember finds the member name of the top-level object b, scanning
+// only its top level.
+func findMember(b []byte, name string) (rawMember, bool) {
+	i := skipSpace(b, 0)
+	if i >= len(b) || b[i] != '{' {
+		return rawMember{}, false
+	}
+	i++
+	prevComma := -1
+	for {
+		i = skipSpace(b, i)
+		if i >= len(b) || b[i] != '"' {
+			return rawMember{}, false
+		}
+		m := rawMember{key: i, comma: prevComma}
+		keyEnd, err := skipValue(b, i)
+		if err != nil {
+			return rawMember{}, false
+		}
+		key := ""
+		if json.Unmarshal(b[i:keyEnd], &key) != nil {
+			return rawMember{}, false
+		}
+		i = skipSpace(b, keyEnd)
+		if i >= len(b) || b[i] != ':' {
+			return rawMember{}, false
+		}
+		m.value = skipSpace(b, i+1)
+		if m.end, err = skipValue(b, m.value); err != nil {
+			return rawMember{}, false
+		}
+		i = skipSpace(b, m.end)
+		if i >= len(b) {
+			return rawMember{}, false
+		}
+		if b[i] == ',' {
+			m.comma, prevComma = i, i
+		}
+		if key == name {
+			return m, true
+		}
+		if b[i] != ',' {
+			return rawMember{}, false
+		}
+		i++
+	}
+}
+
+func skipSpace(b []byte, i int) int {
+	for i < len(b) && (b[i] == ' ' || b[i] == '\t' || b[i] == '\n' || b[i] == '\r') {
+		i++
+	}
+	return i
+}
+
+// skipValue returns the offset just past the JSON value starting at i.
+func skipValue(b []byte, i int) (int, error) {
+	if i >= len(b) {
+		return 0, fmt.Errorf("unexpected end of JSON")
+	}
+	switch b[i] {
+	case '"':
+		for j := i + 1; j < len(b); j++ {
+			switch b[j] {
+			case '\\':
+				j++
+			case '"':
+				return j + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("unterminated string")
+	case '{', '[':
+		depth := 0
+		for j := i; j < len(b); j++ {
+			switch b[j] {
+			case '"':
+				end, err := skipValue(b, j)
+				if err != nil {
+					return 0, err
+				}
+				j = end - 1
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return j + 1, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("unterminated object or array")
+	}
+	j := i
+	for j < len(b) && !bytes.ContainsRune([]byte(",}] \t\n\r"), rune(b[j])) {
+		j++
+	}
+	if j == i {
+		return 0, fmt.Errorf("unexpected %q", b[i])
+	}
+	return j, nil
+}
+
+// rawDocOf returns d's JSON if it's a RawDoc or *RawDoc.
+func rawDocOf(d interface{}) (RawDoc, bool) {
+	switch r := d.(type) {
+	case RawDoc:
+		return r, true
+	case *RawDoc:
+		if r != nil {
+			return *r, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,102 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRawDocMembers(t *testing.T) {
+	d := RawDoc(`{ "name" : "x,\"_rev\":}", "nested":{"_rev":"no"}, "_rev": "1-a" ,"n":[1,{"a":2}], "_id":"doc"}`)
+	if d.GetID() != "doc" || d.GetRev() != "1-a" {
+		t.Fatalf("get: got %q, %q", d.GetID(), d.GetRev())
+	}
+	d.SetRev("2-b")
+	if expected := `{ "name" : "x,\"_rev\":}", "nested":{"_rev":"no"}, "_rev": "2-b" ,"n":[1,{"a":2}], "_id":"doc"}`; string(d) != expected {
+		t.Fatalf("set rev: got %s", d)
+	}
+	for _, c := range []struct{ in, name, expected string }{
+		{`{"_id":"a","_rev":"1-a","x":1}`, "_rev", `{"_id":"a","x":1}`},
+		{`{"_id":"a","x":1,"_rev":"1-a"}`, "_rev", `{"_id":"a","x":1}`},
+		{`{"_rev":"1-a"}`, "_rev", `{}`},
+		{`{"x":1}`, "_rev", `{"x":1}`},
+	} {
+		if got := string(RawDoc(c.in).without(c.name)); got != c.expected {
+			t.Fatalf("without %s in %s: expected %s, got %s", c.name, c.in, c.expected, got)
+		}
+	}
+	for _, c := range []struct{ in, expected string }{
+		{`{}`, `{"_id":"new"}`},
+		{` { "x":1}`, ` {"_id":"new", "x":1}`},
+	} {
+		d := RawDoc(c.in)
+		d.SetID("new")
+		if string(d) != c.expected {
+			t.Fatalf("set id in %s: expected %s, got %s", c.in, c.expected, d)
+		}
+	}
+	if RawDoc(`[1]`).GetID() != "" || RawDoc(`{"_id":`).GetID() != "" {
+		t.Fatalf("expected no id in malformed documents")
+	}
+}
+
+func TestRawDoc(t *testing.T) {
+	body := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		switch {
+		case r.Method == "GET":
+			fmt.Fprint(w, `{"_id":"doc","_rev":"1-a","big":{"deep":[1,2,3]}}`)
+		case r.Method == "POST" && r.URL.Path == "/db/_bulk_docs":
+			fmt.Fprint(w, `[{"ok":true,"id":"a","rev":"1-x"}]`)
+		case r.Method == "POST":
+			fmt.Fprint(w, `{"ok":true,"id":"new","rev":"1-n"}`)
+		case r.Method == "PUT":
+			fmt.Fprint(w, `{"ok":true,"id":"doc","rev":"2-b"}`)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+
+	d := RawDoc{}
+	rev, err := db.Retrieve("doc", &d)
+	if err != nil {
+		t.Fatalf("retrieve: %s", err)
+	}
+	if rev != "1-a" || string(d) != `{"_id":"doc","_rev":"1-a","big":{"deep":[1,2,3]}}` {
+		t.Fatalf("retrieve: got %s, %s", rev, d)
+	}
+
+	if rev, err = db.Edit(&d); err != nil || rev != "2-b" {
+		t.Fatalf("edit: got %s, %v", rev, err)
+	}
+	if body != `{"_id":"doc","_rev":"1-a","big":{"deep":[1,2,3]}}` || d.GetRev() != "2-b" {
+		t.Fatalf("edit: sent %s, then got %s", body, d)
+	}
+
+	n := RawDoc(`{"x":1}`)
+	id, rev, err := db.Insert(&n)
+	if err != nil || id != "new" || rev != "1-n" {
+		t.Fatalf("insert: got %s, %s, %v", id, rev, err)
+	}
+	if string(n) != `{"_id":"new","_rev":"1-n","x":1}` {
+		t.Fatalf("insert: got %s", n)
+	}
+
+	if _, err := db.BulkDocs([]interface{}{RawDoc(`{"_id":"a"}`)}); err != nil {
+		t.Fatalf("bulk: %s", err)
+	}
+	in := struct{ Docs []json.RawMessage }{}
+	if err := json.Unmarshal([]byte(body), &in); err != nil || len(in.Docs) != 1 || string(in.Docs[0]) != `{"_id":"a"}` {
+		t.Fatalf("bulk: sent %s", body)
+	}
+
+	if _, _, err := db.Insert(RawDoc(`[1]`)); err == nil {
+		t.Fatalf("expected error for a raw document which isn't an object")
+	}
+}
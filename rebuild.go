@@ -0,0 +1,144 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RebuildOptions control RebuildDesignDoc.
+type RebuildOptions struct {
+	// Progress, if set, is called as the rebuild moves through its
+	// stages, and every PollInterval while the index builds.
+	Progress     func(RebuildProgress)
+	PollInterval time.Duration // 0 means 2 seconds
+}
+
+// RebuildProgress reports how far a RebuildDesignDoc has got.
+type RebuildProgress struct {
+	Stage   string // "deploy", "build", "swap" or "cleanup"
+	Percent int    // how much of the index is built, in the build stage
+}
+
+// RebuildDesignDoc deploys dd without making its views unavailable while
+// their index is rebuilt, as it would be by a plain PutDesignDoc. dd is
+// first deployed under a temporary id, dd.Id + "_rebuild", and one of its
+// views queried until the index is built. As CouchDB shares an index
+// between design documents with identical views, dd is then deployed
+// under its own id and answers from the built index at once. Finally the
+// temporary design document is deleted and old indexes cleaned up. It
+// returns the new revision of dd.
+//
+// Progress percentages come from _active_tasks, which needs an admin; an
+// index whose progress can't be seen is reported at 0% until it's done.
+func (p Database) RebuildDesignDoc(ctx context.Context, dd DesignDoc, opts RebuildOptions) (string, error) {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 2 * time.Second
+	}
+	report := func(stage string, percent int) {
+		if opts.Progress != nil {
+			opts.Progress(RebuildProgress{stage, percent})
+		}
+	}
+	names := []string{}
+	for name, v := range dd.Views {
+		if v.Map != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("%s has no map views to rebuild", dd.Id)
+	}
+	sort.Strings(names)
+
+	report("deploy", 0)
+	tmp := dd
+	tmp.Id, tmp.Rev = dd.Id+"_rebuild", ""
+	tmpRev, err := p.PutDesignDoc(tmp)
+	if err != nil {
+		return "", err
+	}
+
+	// querying any view waits for the whole design document's index
+	built := make(chan error, 1)
+	go func() {
+		view := fmt.Sprintf("%s/_view/%s", tmp.Id, names[0])
+		built <- p.QueryViewContext(ctx, view, ViewOptions{Limit: 1}, &KeyedViewResponse{})
+	}()
+	report("build", 0)
+	tick := time.NewTicker(opts.PollInterval)
+	defer tick.Stop()
+wait:
+	for {
+		select {
+		case err := <-built:
+			if err != nil {
+				return "", fmt.Errorf("building %s: %w", tmp.Id, err)
+			}
+			break wait
+		case <-tick.C:
+			report("build", p.indexProgress(tmp.Id))
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	report("build", 100)
+
+	report("swap", 100)
+	rev, err := p.PutDesignDoc(dd)
+	if err != nil {
+		return "", err
+	}
+
+	report("cleanup", 100)
+	if err := p.Delete(tmp.Id, tmpRev); err != nil {
+		return rev, err
+	}
+	return rev, p.ViewCleanup()
+}
+
+// indexProgress returns the average progress of the indexer tasks
+// building ddoc in this database, or 0 if there are none to be seen.
+func (p Database) indexProgress(ddoc string) int {
+	tasks := []struct {
+		Type           string `json:"type"`
+		Database       string `json:"database"`
+		DesignDocument string `json:"design_document"`
+		Progress       int    `json:"progress"`
+	}{}
+	if err := p.unmarshalURL(p.BaseURL()+"/_active_tasks", &tasks); err != nil {
+		return 0
+	}
+	sum, n := 0, 0
+	for _, t := range tasks {
+		// in a cluster, Database is a shard, like "shards/00000000-7fffffff/db.1600000000"
+		db := strings.TrimSuffix(t.Database, ".couch")
+		if i := strings.LastIndex(db, "/"); i >= 0 {
+			db = db[i+1:]
+		}
+		if i := strings.LastIndex(db, "."); i >= 0 && strings.HasPrefix(t.Database, "shards/") {
+			db = db[:i]
+		}
+		if t.Type == "indexer" && t.DesignDocument == ddoc && db == p.Name {
+			sum += t.Progress
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / n
+}
+
+// ViewCleanup removes the index files no design document uses any more,
+// via _view_cleanup.
+func (p Database) ViewCleanup() error {
+	r := struct {
+		OK bool `json:"ok"`
+	}{}
+	_, err := p.interact("POST", p.DBURL()+"/_view_cleanup", map[string][]string{}, []byte("{}"), &r)
+	return err
+}
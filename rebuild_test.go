@@ -0,0 +1,89 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRebuildDesignDoc(t *testing.T) {
+	mu := sync.Mutex{}
+	log := []string{}
+	logf := func(format string, v ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		log = append(log, fmt.Sprintf(format, v...))
+	}
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_active_tasks":
+			fmt.Fprint(w, `[
+				{"type":"indexer","database":"shards/00000000-7fffffff/db.1600000000","design_document":"_design/app_rebuild","progress":40},
+				{"type":"indexer","database":"shards/80000000-ffffffff/db.1600000000","design_document":"_design/app_rebuild","progress":60},
+				{"type":"indexer","database":"shards/80000000-ffffffff/other.1600000000","design_document":"_design/app_rebuild","progress":0}]`)
+		case r.Method == "GET" && r.URL.Path == "/db/_design/app_rebuild/_view/by_name":
+			<-release
+			fmt.Fprint(w, `{"total_rows":0,"offset":0,"rows":[]}`)
+		case r.Method == "GET" && r.URL.Path == "/db/_design/app":
+			fmt.Fprint(w, `{"_id":"_design/app","_rev":"1-old","views":{"by_name":{"map":"function(doc){}"}}}`)
+		case r.Method == "GET":
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+		case r.Method == "PUT":
+			dd := DesignDoc{}
+			b, _ := ioutil.ReadAll(r.Body)
+			json.Unmarshal(b, &dd)
+			logf("put %s %s", r.URL.Path, dd.Rev)
+			if dd.Rev == "" {
+				fmt.Fprintf(w, `{"ok":true,"id":%q,"rev":"1-tmp"}`, dd.Id)
+				return
+			}
+			fmt.Fprintf(w, `{"ok":true,"id":%q,"rev":"2-new"}`, dd.Id)
+		case r.Method == "DELETE":
+			logf("delete %s %s", r.URL.Path, r.Header.Get("If-Match"))
+			fmt.Fprint(w, `{"ok":true,"rev":"2-tmp"}`)
+		case r.URL.Path == "/db/_view_cleanup":
+			logf("cleanup")
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprint(w, `{"ok":true}`)
+		default:
+			t.Errorf("request: got %s %s", r.Method, r.URL)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	progress := []RebuildProgress{}
+	dd := DesignDoc{Id: "_design/app", Views: map[string]View{"by_name": {Map: "function(doc){ emit(doc.name) }"}}}
+	rev, err := db.RebuildDesignDoc(context.Background(), dd, RebuildOptions{
+		PollInterval: 10 * time.Millisecond,
+		Progress: func(p RebuildProgress) {
+			progress = append(progress, p)
+			if p.Percent == 50 && len(progress) == 3 {
+				close(release)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("failed to rebuild: %s", err)
+	}
+	if rev != "2-new" {
+		t.Fatalf("rev: expected 2-new, got %s", rev)
+	}
+	expected := []string{"put /db/_design/app_rebuild ", "put /db/_design/app 1-old", "delete /db/_design/app_rebuild 1-tmp", "cleanup"}
+	if !reflect.DeepEqual(log, expected) {
+		t.Fatalf("requests: expected %q, got %q", expected, log)
+	}
+	stages := []RebuildProgress{{"deploy", 0}, {"build", 0}, {"build", 50}, {"build", 100}, {"swap", 100}, {"cleanup", 100}}
+	if !reflect.DeepEqual(progress, stages) {
+		t.Fatalf("progress: expected %v, got %v", stages, progress)
+	}
+}
@@ -0,0 +1,120 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Stats is the value produced by the builtin _stats reduce function.
+type Stats struct {
+	Sum    float64 `json:"sum"`
+	Count  uint64  `json:"count"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	Sumsqr float64 `json:"sumsqr"`
+}
+
+// Mean returns the arithmetic mean of the reduced values.
+func (s Stats) Mean() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// StdDev returns the population standard deviation of the reduced values.
+func (s Stats) StdDev() float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	mean := s.Mean()
+	return math.Sqrt(math.Max(0, s.Sumsqr/float64(s.Count)-mean*mean))
+}
+
+// Count returns the single value of a view with a _count reduce.
+// An empty view (or key range) counts as 0.
+func (p Database) Count(view string, options map[string]interface{}) (uint64, error) {
+	var n uint64
+	_, err := reduceOne(p, view, options, &n)
+	return n, err
+}
+
+// Sum returns the single value of a view with a _sum reduce.
+// An empty view (or key range) sums to 0.
+func (p Database) Sum(view string, options map[string]interface{}) (float64, error) {
+	var sum float64
+	_, err := reduceOne(p, view, options, &sum)
+	return sum, err
+}
+
+// SumStats returns the single value of a view with a _stats reduce.
+// An empty view (or key range) gives zero Stats.
+func (p Database) SumStats(view string, options map[string]interface{}) (Stats, error) {
+	s := Stats{}
+	_, err := reduceOne(p, view, options, &s)
+	return s, err
+}
+
+// reduceOne runs an ungrouped reduce query, decoding the single resulting
+// value into v. It reports whether there was a value at all.
+func reduceOne[V any](p Database, view string, options map[string]interface{}, v *V) (bool, error) {
+	rows, err := QueryTyped[interface{}, V](p, view, options)
+	if err != nil {
+		return false, err
+	}
+	switch len(rows) {
+	case 0:
+		return false, nil
+	case 1:
+		*v = rows[0].Value
+		return true, nil
+	}
+	return false, fmt.Errorf("reduce returned %d rows; use QueryTyped for grouped results", len(rows))
+}
+
+// RollupRow is a single group of a Rollup: Key holds the first elements
+// of the array keys in the group.
+type RollupRow struct {
+	Key   []json.RawMessage
+	Value json.RawMessage
+}
+
+// Decode decodes the reduced value of the group into v, eg. a *Stats
+// for a view reduced with _stats.
+func (r RollupRow) Decode(v interface{}) error {
+	return json.Unmarshal(r.Value, v)
+}
+
+// Rollup reduces an array-keyed view grouped by the first level elements
+// of its keys, eg. level 2 of a view keyed by DateKey(t, KeyDay) gives
+// one row per [year, month]. opts select the rows to reduce; their
+// GroupLevel is replaced, and Reduce may not be false.
+func (p Database) Rollup(view string, level int, opts ViewOptions) ([]RollupRow, error) {
+	if level < 1 {
+		return nil, fmt.Errorf("rollup level must be at least 1")
+	}
+	if opts.Reduce != nil && !*opts.Reduce {
+		return nil, fmt.Errorf("rollup of an unreduced view")
+	}
+	opts.Group, opts.GroupLevel = false, level
+	r := struct {
+		Rows []struct {
+			Key   json.RawMessage `json:"key"`
+			Value json.RawMessage `json:"value"`
+		} `json:"rows"`
+	}{}
+	if err := p.QueryView(view, opts, &r); err != nil {
+		return nil, err
+	}
+	rows := make([]RollupRow, len(r.Rows))
+	for i, row := range r.Rows {
+		rows[i].Value = row.Value
+		if err := json.Unmarshal(row.Key, &rows[i].Key); err != nil {
+			// not an array key; the group is the key itself
+			rows[i].Key = []json.RawMessage{row.Key}
+		}
+	}
+	return rows, nil
+}
@@ -0,0 +1,74 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSumStats(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rows":[{"key":null,"value":{"sum":6,"count":3,"min":1,"max":3,"sumsqr":14}}]}`)
+	}))
+	defer ts.Close()
+	s, err := newTestDatabase(ts).SumStats("_design/d/_view/v", nil)
+	if err != nil {
+		t.Fatalf("failed to reduce: %s", err)
+	}
+	if s.Count != 3 || s.Mean() != 2 || s.Max != 3 {
+		t.Fatalf("stats: got %+v", s)
+	}
+}
+
+func TestCountEmpty(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rows":[]}`)
+	}))
+	defer ts.Close()
+	n, err := newTestDatabase(ts).Count("_design/d/_view/v", nil)
+	if err != nil {
+		t.Fatalf("failed to count: %s", err)
+	}
+	if n != 0 {
+		t.Fatalf("count: expected 0, got %d", n)
+	}
+}
+
+func TestCountGrouped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rows":[{"key":"a","value":1},{"key":"b","value":2}]}`)
+	}))
+	defer ts.Close()
+	if _, err := newTestDatabase(ts).Count("_design/d/_view/v", map[string]interface{}{"group": true}); err == nil {
+		t.Fatalf("expected an error for grouped results")
+	}
+}
+
+func TestRollup(t *testing.T) {
+	query := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"rows":[
+			{"key":[2012,5],"value":{"sum":3,"count":2,"min":1,"max":2,"sumsqr":5}},
+			{"key":[2012,6],"value":{"sum":4,"count":1,"min":4,"max":4,"sumsqr":16}}
+		]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	rows, err := db.Rollup("_design/d/_view/by_day", 2, ViewOptions{Group: true, StartKey: []int{2012}})
+	if err != nil {
+		t.Fatalf("failed to roll up: %s", err)
+	}
+	if query != "group_level=2&startkey=%5B2012%5D" {
+		t.Fatalf("query: got %s", query)
+	}
+	if len(rows) != 2 || string(rows[1].Key[1]) != "6" {
+		t.Fatalf("rows: got %+v", rows)
+	}
+	s := Stats{}
+	if err := rows[0].Decode(&s); err != nil || s.Mean() != 1.5 {
+		t.Fatalf("stats: got %+v (%v)", s, err)
+	}
+}
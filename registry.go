@@ -0,0 +1,131 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrUnknownType is returned when decoding a document whose type field
+// has no registered Go type.
+var ErrUnknownType = errors.New("unknown document type")
+
+// Registry maps the value of a type field, present in every document of
+// a heterogeneous database, to the Go type its documents decode into.
+type Registry struct {
+	field string
+	mu    sync.RWMutex
+	types map[string]reflect.Type
+}
+
+// NewRegistry returns an empty Registry using the given type field;
+// if field is empty, it's "type".
+func NewRegistry(field string) *Registry {
+	if field == "" {
+		field = "type"
+	}
+	return &Registry{field: field, types: map[string]reflect.Type{}}
+}
+
+// Register decodes documents whose type field is typ into values of the
+// same type as prototype, eg. reg.Register("user", User{}). prototype may
+// also be a pointer, eg. (*User)(nil).
+func (r *Registry) Register(typ string, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		panic("couch: Register of nil prototype")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[typ] = t
+}
+
+// Decode decodes doc into a new value of the type registered for its type
+// field, and returns a pointer to it, eg. a *User. Metadata is set as by
+// Retrieve.
+func (r *Registry) Decode(doc json.RawMessage) (interface{}, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	typ := ""
+	if raw, ok := fields[r.field]; !ok || json.Unmarshal(raw, &typ) != nil {
+		return nil, fmt.Errorf("%w: no string %q field", ErrUnknownType, r.field)
+	}
+	r.mu.RLock()
+	t, ok := r.types[typ]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownType, typ)
+	}
+	v := reflect.New(t).Interface()
+	if err := unmarshalDoc(doc, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// WithRegistry makes the Client decode documents with r in RetrieveAny.
+func WithRegistry(r *Registry) Option {
+	return func(c *Client) {
+		c.registry = r
+	}
+}
+
+// RetrieveAny fetches the document matching id, and decodes it into the
+// Go type registered for it with WithRegistry.
+func (p Database) RetrieveAny(id string) (interface{}, error) {
+	reg := p.client().registry
+	if reg == nil {
+		return nil, fmt.Errorf("no registry configured (see WithRegistry)")
+	}
+	if id == "" {
+		return nil, fmt.Errorf("no id specified")
+	}
+	doc, err := p.currentDoc(id)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't Retrieve %s: %w", id, err)
+	}
+	return reg.Decode(doc)
+}
+
+// DecodeDocs decodes the documents of an include_docs response with reg,
+// in row order. Rows without a document (errors, deleted documents) are
+// skipped.
+func (r AllDocsResponse) DecodeDocs(reg *Registry) ([]interface{}, error) {
+	docs := make([]interface{}, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		if len(row.Doc) == 0 || string(row.Doc) == "null" {
+			continue
+		}
+		v, err := reg.Decode(row.Doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", row.Id, err)
+		}
+		docs = append(docs, v)
+	}
+	return docs, nil
+}
+
+// DecodeDocs decodes the documents of an IncludeDocs changes batch with
+// reg, in order. Deletions are skipped.
+func (r ChangesResponse) DecodeDocs(reg *Registry) ([]interface{}, error) {
+	docs := make([]interface{}, 0, len(r.Results))
+	for _, c := range r.Results {
+		if c.Deleted || len(c.Doc) == 0 {
+			continue
+		}
+		v, err := reg.Decode(c.Doc)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.Id, err)
+		}
+		docs = append(docs, v)
+	}
+	return docs, nil
+}
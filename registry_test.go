@@ -0,0 +1,67 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type regUser struct {
+	ID   string `json:"-" couch:"id"`
+	Name string `json:"name"`
+}
+
+type regOrder struct {
+	Total int `json:"total"`
+}
+
+func TestRegistryDecode(t *testing.T) {
+	reg := NewRegistry("")
+	reg.Register("user", regUser{})
+	reg.Register("order", (*regOrder)(nil))
+	r := AllDocsResponse{Rows: []AllDocsRow{
+		{Id: "u1", Doc: []byte(`{"_id":"u1","type":"user","name":"alice"}`)},
+		{Id: "gone", Error: "not_found"},
+		{Id: "o1", Doc: []byte(`{"_id":"o1","type":"order","total":3}`)},
+	}}
+	docs, err := r.DecodeDocs(reg)
+	if err != nil {
+		t.Fatalf("failed to decode: %s", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("expected 2 docs, got %d", len(docs))
+	}
+	if u, ok := docs[0].(*regUser); !ok || *u != (regUser{"u1", "alice"}) {
+		t.Fatalf("docs[0]: got %#v", docs[0])
+	}
+	if o, ok := docs[1].(*regOrder); !ok || o.Total != 3 {
+		t.Fatalf("docs[1]: got %#v", docs[1])
+	}
+	if _, err := reg.Decode([]byte(`{"type":"invoice"}`)); !errors.Is(err, ErrUnknownType) {
+		t.Fatalf("unregistered type: expected ErrUnknownType, got %v", err)
+	}
+}
+
+func TestRetrieveAny(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"_id":"o1","_rev":"1-a","type":"order","total":7}`)
+	}))
+	defer ts.Close()
+	reg := NewRegistry("")
+	reg.Register("order", regOrder{})
+	db := newTestDatabase(ts)
+	if _, err := db.RetrieveAny("o1"); err == nil {
+		t.Fatalf("expected error without a registry")
+	}
+	db.Client = NewClient(WithRegistry(reg))
+	v, err := db.RetrieveAny("o1")
+	if err != nil {
+		t.Fatalf("failed to retrieve: %s", err)
+	}
+	if o, ok := v.(*regOrder); !ok || o.Total != 7 {
+		t.Fatalf("retrieve: got %#v", v)
+	}
+}
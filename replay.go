@@ -0,0 +1,105 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// replayBatch is how many changes Replay reads and writes at once.
+const replayBatch = 500
+
+// ReplayResult counts what Replay did.
+type ReplayResult struct {
+	Changes int // changes read in the range
+	Written int // documents written to the target
+	Failed  int // documents the target refused, eg. for validation
+	LastSeq Seq // the sequence of the last change replayed
+}
+
+// Number returns the numeric part of the sequence: all of it for CouchDB
+// 1.x, and the prefix before the "-" since 2.0, which grows as the
+// database changes. It returns -1 if there is none.
+func (s Seq) Number() int64 {
+	n, err := strconv.ParseInt(strings.SplitN(string(s), "-", 2)[0], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// Replay copies the documents changed in source after fromSeq, up to and
+// including toSeq ("" means up to now), into target, as they were at the
+// end of the range; deletions are replayed too. Revisions are written
+// as they are, with new_edits=false, as replication does, so replaying
+// a range twice is harmless, but documents edited in the target since
+// become conflicted rather than overwritten.
+//
+// Sequences are compared by Number, which in a cluster only roughly
+// orders changes, so the range's ends are approximate; widen it to be
+// sure.
+func Replay(ctx context.Context, source, target Database, fromSeq, toSeq Seq) (ReplayResult, error) {
+	result := ReplayResult{LastSeq: fromSeq}
+	end := toSeq.Number()
+	if toSeq != "" && end < 0 {
+		return result, fmt.Errorf("bad sequence %q", toSeq)
+	}
+	since := fromSeq
+	for {
+		r, err := source.ChangesContext(ctx, ChangesOptions{Since: since, IncludeDocs: true, Limit: replayBatch})
+		if err != nil {
+			return result, err
+		}
+		docs := []json.RawMessage{}
+		// not Pending, which servers that don't send it leave at 0
+		done := len(r.Results) < replayBatch
+		for _, c := range r.Results {
+			if toSeq != "" && c.Seq.Number() > end {
+				done = true
+				break
+			}
+			result.Changes++
+			result.LastSeq = c.Seq
+			if len(c.Doc) > 0 && string(c.Doc) != "null" {
+				docs = append(docs, c.Doc)
+			}
+		}
+		if len(docs) > 0 {
+			written, err := target.replicate(ctx, docs)
+			result.Written += written
+			result.Failed += len(docs) - written
+			if err != nil {
+				return result, err
+			}
+		}
+		if done {
+			return result, nil
+		}
+		since = r.LastSeq
+	}
+}
+
+// replicate writes docs to the database with their revisions as they are,
+// and returns how many were written.
+func (p Database) replicate(ctx context.Context, docs []json.RawMessage) (int, error) {
+	in, err := json.Marshal(map[string]interface{}{"docs": docs, "new_edits": false})
+	if err != nil {
+		return 0, err
+	}
+	// with new_edits=false, only failures are listed
+	failures := []WriteResult{}
+	u := fmt.Sprintf("%s/_bulk_docs", p.DBURL())
+	if _, err := p.client().interactContext(ctx, "POST", u, map[string][]string{}, in, &failures); err != nil {
+		return 0, err
+	}
+	written := len(docs)
+	for _, f := range failures {
+		if f.Error != "" {
+			written--
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,82 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSeqNumber(t *testing.T) {
+	for s, expected := range map[Seq]int64{"57-g1AAAA": 57, "12": 12, "now": -1, "": -1} {
+		if n := s.Number(); n != expected {
+			t.Fatalf("%q: expected %d, got %d", s, expected, n)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	since := []string{}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = append(since, r.URL.Query().Get("since"))
+		fmt.Fprint(w, `{"results":[
+			{"seq":"3-a","id":"a","changes":[{"rev":"2-a"}],"doc":{"_id":"a","_rev":"2-a","n":1}},
+			{"seq":"4-b","id":"b","deleted":true,"changes":[{"rev":"3-b"}],"doc":{"_id":"b","_rev":"3-b","_deleted":true}},
+			{"seq":"6-c","id":"c","changes":[{"rev":"1-c"}],"doc":{"_id":"c","_rev":"1-c"}}],
+			"last_seq":"6-c","pending":4}`)
+	}))
+	defer source.Close()
+	var written map[string]interface{}
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/db/_bulk_docs" {
+			t.Errorf("path: got %s", r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&written)
+		fmt.Fprint(w, `[{"id":"b","rev":"3-b","error":"forbidden","reason":"no"}]`)
+	}))
+	defer target.Close()
+	result, err := Replay(context.Background(), newTestDatabase(source), newTestDatabase(target), "2-x", "5-y")
+	if err != nil {
+		t.Fatalf("failed to replay: %s", err)
+	}
+	if !reflect.DeepEqual(since, []string{"2-x"}) {
+		t.Fatalf("since: got %v", since)
+	}
+	expected := ReplayResult{Changes: 2, Written: 1, Failed: 1, LastSeq: "4-b"}
+	if result != expected {
+		t.Fatalf("result: expected %+v, got %+v", expected, result)
+	}
+	if written["new_edits"] != false || len(written["docs"].([]interface{})) != 2 {
+		t.Fatalf("written: got %v", written)
+	}
+}
+
+func TestReplayWithoutPending(t *testing.T) {
+	since := []string{}
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = append(since, r.URL.Query().Get("since"))
+		results := []string{}
+		if len(since) == 1 {
+			for i := 1; i <= replayBatch; i++ {
+				results = append(results, fmt.Sprintf(`{"seq":"%d-x","id":"d%d","changes":[{"rev":"1-a"}]}`, i, i))
+			}
+		}
+		fmt.Fprintf(w, `{"results":[%s],"last_seq":"%d-x"}`, strings.Join(results, ","), len(results))
+	}))
+	defer source.Close()
+	result, err := Replay(context.Background(), newTestDatabase(source), newTestDatabase(source), "", "")
+	if err != nil {
+		t.Fatalf("failed to replay: %s", err)
+	}
+	if len(since) != 2 || since[1] != fmt.Sprintf("%d-x", replayBatch) {
+		t.Fatalf("since: expected a second batch, got %v", since)
+	}
+	if result.Changes != replayBatch {
+		t.Fatalf("changes: expected %d, got %d", replayBatch, result.Changes)
+	}
+}
@@ -0,0 +1,259 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// redacted replaces credentials in replication documents read back by
+// Replication and Replications.
+const redacted = "xxxxx"
+
+// ReplicationEndpoint is the source or target of a replication. Its
+// credentials are best kept in Auth or Headers rather than in URL, so
+// they're not spread through logs and the replication scheduler's output.
+type ReplicationEndpoint struct {
+	URL     string
+	Auth    *ReplicationAuth
+	Headers map[string]string
+}
+
+// ReplicationAuth holds the credentials of a ReplicationEndpoint;
+// set one of its fields.
+type ReplicationAuth struct {
+	Basic *BasicAuth `json:"basic,omitempty"`
+	IAM   *IAMAuth   `json:"iam,omitempty"` // IBM Cloudant IAM
+}
+
+type BasicAuth struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type IAMAuth struct {
+	APIKey string `json:"api_key"`
+}
+
+type endpointJSON struct {
+	URL     string            `json:"url"`
+	Auth    *ReplicationAuth  `json:"auth,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// EndpointFor returns the endpoint of db, with its credentials (if any)
+// moved from the URL to basic auth.
+func EndpointFor(db Database) ReplicationEndpoint {
+	e := ReplicationEndpoint{}
+	if db.Auth != nil {
+		password, _ := db.Auth.Password()
+		e.Auth = &ReplicationAuth{Basic: &BasicAuth{db.Auth.Username(), password}}
+		db.Auth = nil
+	}
+	e.URL = db.DBURL()
+	return e
+}
+
+// MarshalJSON writes endpoints with neither Auth nor Headers as a plain
+// URL string, which every CouchDB version accepts.
+func (e ReplicationEndpoint) MarshalJSON() ([]byte, error) {
+	if e.Auth == nil && len(e.Headers) == 0 {
+		return json.Marshal(e.URL)
+	}
+	return json.Marshal(endpointJSON{e.URL, e.Auth, e.Headers})
+}
+
+func (e *ReplicationEndpoint) UnmarshalJSON(b []byte) error {
+	*e = ReplicationEndpoint{}
+	if len(b) > 0 && b[0] == '"' {
+		return json.Unmarshal(b, &e.URL)
+	}
+	raw := endpointJSON{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	*e = ReplicationEndpoint{raw.URL, raw.Auth, raw.Headers}
+	return nil
+}
+
+// redacted returns a copy of e with its URL password, auth secrets and
+// Authorization/Cookie header values replaced.
+func (e ReplicationEndpoint) redacted() ReplicationEndpoint {
+	out := ReplicationEndpoint{URL: RedactURL(e.URL)}
+	if e.Auth != nil {
+		out.Auth = &ReplicationAuth{}
+		if e.Auth.Basic != nil {
+			out.Auth.Basic = &BasicAuth{e.Auth.Basic.Username, redacted}
+		}
+		if e.Auth.IAM != nil {
+			out.Auth.IAM = &IAMAuth{redacted}
+		}
+	}
+	if e.Headers != nil {
+		out.Headers = map[string]string{}
+		for k, v := range e.Headers {
+			switch strings.ToLower(k) {
+			case "authorization", "cookie":
+				v = redacted
+			}
+			out.Headers[k] = v
+		}
+	}
+	return out
+}
+
+// ReplicationDoc is a document in the _replicator database, describing a
+// replication managed by the server's replication scheduler. The
+// underscored state fields are maintained by the server.
+type ReplicationDoc struct {
+	Id           string              `json:"_id,omitempty"`
+	Rev          string              `json:"_rev,omitempty"`
+	Source       ReplicationEndpoint `json:"source"`
+	Target       ReplicationEndpoint `json:"target"`
+	Continuous   bool                `json:"continuous,omitempty"`
+	CreateTarget bool                `json:"create_target,omitempty"`
+	Selector     interface{}         `json:"selector,omitempty"`
+	DocIds       []string            `json:"doc_ids,omitempty"`
+	Filter       string              `json:"filter,omitempty"`
+	QueryParams  map[string]string   `json:"query_params,omitempty"`
+
+	State       string `json:"_replication_state,omitempty"` // eg. "completed", "failed"
+	StateReason string `json:"_replication_state_reason,omitempty"`
+	StateTime   string `json:"_replication_state_time,omitempty"`
+}
+
+// Redacted returns a copy of the document with credentials replaced.
+func (d ReplicationDoc) Redacted() ReplicationDoc {
+	d.Source, d.Target = d.Source.redacted(), d.Target.redacted()
+	return d
+}
+
+// ReplicationStatus is the scheduler's view of a replication document,
+// from /_scheduler/docs.
+type ReplicationStatus struct {
+	DocId       string                 `json:"doc_id"`
+	Id          string                 `json:"id"` // the replication id, shared by identical replications
+	State       string                 `json:"state"`
+	Info        map[string]interface{} `json:"info"`
+	ErrorCount  int                    `json:"error_count"`
+	StartTime   string                 `json:"start_time"`
+	LastUpdated string                 `json:"last_updated"`
+	Source      string                 `json:"source"` // redacted by the server
+	Target      string                 `json:"target"`
+}
+
+func (s Server) replicator() Database {
+	return s.database("_replicator")
+}
+
+// CreateReplication writes a replication document to the _replicator
+// database, returning its id and revision; a doc with Id and Rev replaces
+// an existing one. The database must exist, as it
+// does on any CouchDB set up as a single node or cluster.
+func (s Server) CreateReplication(doc ReplicationDoc) (string, string, error) {
+	if doc.Source.URL == "" || doc.Target.URL == "" {
+		return "", "", fmt.Errorf("must specify both source and target")
+	}
+	doc.State, doc.StateReason, doc.StateTime = "", "", ""
+	return s.replicator().Insert(doc)
+}
+
+// Replication reads back a replication document, with credentials
+// redacted.
+func (s Server) Replication(id string) (ReplicationDoc, error) {
+	doc := ReplicationDoc{}
+	if _, err := s.replicator().Retrieve(url.PathEscape(id), &doc); err != nil {
+		return ReplicationDoc{}, err
+	}
+	return doc.Redacted(), nil
+}
+
+// Replications lists the replication documents, with credentials redacted.
+func (s Server) Replications() ([]ReplicationDoc, error) {
+	r, err := s.replicator().AllDocs(map[string]interface{}{"include_docs": true})
+	if err != nil {
+		return nil, err
+	}
+	docs := []ReplicationDoc{}
+	for _, row := range r.Rows {
+		if strings.HasPrefix(row.Id, "_design/") || len(row.Doc) == 0 {
+			continue
+		}
+		doc := ReplicationDoc{}
+		if err := json.Unmarshal(row.Doc, &doc); err != nil {
+			return nil, fmt.Errorf("%s: %w", row.Id, err)
+		}
+		docs = append(docs, doc.Redacted())
+	}
+	return docs, nil
+}
+
+// ReplicationStatus asks the scheduler (CouchDB 2.1+) for the state of
+// the replication described by the given replication document.
+func (s Server) ReplicationStatus(id string) (ReplicationStatus, error) {
+	st := ReplicationStatus{}
+	u := fmt.Sprintf("%s/_scheduler/docs/_replicator/%s", s.BaseURL(), url.PathEscape(id))
+	if err := s.unmarshalURL(u, &st); err != nil {
+		return ReplicationStatus{}, err
+	}
+	return st, nil
+}
+
+// DeleteReplication deletes a replication document, cancelling the
+// replication if it's still running.
+func (s Server) DeleteReplication(id, rev string) error {
+	return s.replicator().Delete(url.PathEscape(id), rev)
+}
+
+// ReplicationResult is the outcome of a one-shot replication.
+type ReplicationResult struct {
+	Ok        bool                 `json:"ok"`
+	NoChanges bool                 `json:"no_changes"`
+	SessionId string               `json:"session_id"`
+	History   []ReplicationHistory `json:"history"`
+}
+
+// ReplicationHistory summarizes a replication session.
+type ReplicationHistory struct {
+	DocsRead         int `json:"docs_read"`
+	DocsWritten      int `json:"docs_written"`
+	DocWriteFailures int `json:"doc_write_failures"`
+	MissingChecked   int `json:"missing_checked"`
+	MissingFound     int `json:"missing_found"`
+}
+
+// ReplicateFiltered copies the documents of source matching the Mango
+// selector into target, creating target if needed, eg. to extract one
+// tenant's documents. source and target are database names on s, or
+// URLs. It blocks until the replication completes.
+func (s Server) ReplicateFiltered(source, target string, selector interface{}) (ReplicationResult, error) {
+	if selector == nil {
+		return ReplicationResult{}, fmt.Errorf("no selector specified")
+	}
+	in, err := json.Marshal(ReplicationDoc{
+		Source:       s.endpoint(source),
+		Target:       s.endpoint(target),
+		CreateTarget: true,
+		Selector:     selector,
+	})
+	if err != nil {
+		return ReplicationResult{}, err
+	}
+	r := ReplicationResult{}
+	u := fmt.Sprintf("%s/_replicate", s.BaseURL())
+	if _, err := s.interact("POST", u, map[string][]string{}, in, &r); err != nil {
+		return ReplicationResult{}, err
+	}
+	return r, nil
+}
+
+// endpoint returns the endpoint for db, a URL or the name of a database
+// on s; CouchDB 3 no longer accepts bare names.
+func (s Server) endpoint(db string) ReplicationEndpoint {
+	if strings.Contains(db, "://") {
+		return ReplicationEndpoint{URL: db}
+	}
+	return EndpointFor(s.database(db))
+}
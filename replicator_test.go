@@ -0,0 +1,104 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestReplicationEndpointJSON(t *testing.T) {
+	db := Database{Host: "db.example", Port: "5984", Name: "src", Auth: url.UserPassword("bob", "secret")}
+	e := EndpointFor(db)
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	expected := `{"url":"http://db.example:5984/src","auth":{"basic":{"username":"bob","password":"secret"}}}`
+	if string(b) != expected {
+		t.Fatalf("endpoint:\nexpected %s\n     got %s", expected, b)
+	}
+	plain, _ := json.Marshal(ReplicationEndpoint{URL: "http://localhost:5984/dst"})
+	if string(plain) != `"http://localhost:5984/dst"` {
+		t.Fatalf("plain endpoint: got %s", plain)
+	}
+	back := ReplicationEndpoint{}
+	if err := json.Unmarshal(plain, &back); err != nil || back.URL != "http://localhost:5984/dst" {
+		t.Fatalf("plain endpoint round trip: got %+v, %v", back, err)
+	}
+}
+
+func TestReplicationRedacted(t *testing.T) {
+	var created string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT":
+			b, _ := ioutil.ReadAll(r.Body)
+			created = string(b)
+			fmt.Fprint(w, `{"ok":true,"id":"rep","rev":"1-a"}`)
+		default:
+			fmt.Fprint(w, `{"_id":"rep","_rev":"1-a",
+				"source":{"url":"http://bob:secret@a:5984/src","headers":{"Authorization":"Basic abc","X-Other":"keep"}},
+				"target":{"url":"http://b:5984/dst","auth":{"iam":{"api_key":"key"}}},
+				"_replication_state":"completed"}`)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	s := Server{Host: u.Hostname(), Port: u.Port()}
+	doc := ReplicationDoc{
+		Id:     "rep",
+		Source: ReplicationEndpoint{URL: "http://a:5984/src"},
+		Target: ReplicationEndpoint{URL: "http://b:5984/dst"},
+		State:  "ignored",
+	}
+	if _, _, err := s.CreateReplication(doc); err != nil {
+		t.Fatalf("failed to create replication: %s", err)
+	}
+	if created != `{"source":"http://a:5984/src","target":"http://b:5984/dst"}` {
+		t.Fatalf("created: got %s", created)
+	}
+	got, err := s.Replication("rep")
+	if err != nil {
+		t.Fatalf("failed to read replication: %s", err)
+	}
+	if got.Source.URL != "http://bob:xxxxx@a:5984/src" {
+		t.Fatalf("source url: got %s", got.Source.URL)
+	}
+	if got.Source.Headers["Authorization"] != "xxxxx" || got.Source.Headers["X-Other"] != "keep" {
+		t.Fatalf("source headers: got %v", got.Source.Headers)
+	}
+	if got.Target.Auth.IAM.APIKey != "xxxxx" {
+		t.Fatalf("target auth: got %+v", got.Target.Auth.IAM)
+	}
+	if got.State != "completed" {
+		t.Fatalf("state: got %s", got.State)
+	}
+}
+
+func TestReplicateFiltered(t *testing.T) {
+	body := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		fmt.Fprint(w, `{"ok":true,"session_id":"s1","history":[{"docs_read":3,"docs_written":3}]}`)
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	s := Server{Host: u.Hostname(), Port: u.Port()}
+	r, err := s.ReplicateFiltered("all", "http://other:5984/acme", map[string]string{"tenant": "acme"})
+	if err != nil {
+		t.Fatalf("failed to replicate: %s", err)
+	}
+	if !r.Ok || r.History[0].DocsWritten != 3 {
+		t.Fatalf("result: got %+v", r)
+	}
+	expected := fmt.Sprintf(`{"source":"http://%s/all","target":"http://other:5984/acme","create_target":true,"selector":{"tenant":"acme"}}`, u.Host)
+	if body != expected {
+		t.Fatalf("request:\nexpected %s\n     got %s", expected, body)
+	}
+}
@@ -0,0 +1,168 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Resharder manages shard splitting on a CouchDB 3.x cluster, via the
+// /_reshard API. Get one from Server.Reshard.
+type Resharder struct {
+	s Server
+}
+
+// Reshard returns the Resharder of the server. Servers without the
+// "reshard" feature (see Capabilities) answer its requests with errors.
+func (s Server) Reshard() Resharder {
+	return Resharder{s}
+}
+
+func (r Resharder) url(parts ...string) string {
+	u := fmt.Sprintf("%s/_reshard", r.s.BaseURL())
+	for _, p := range parts {
+		u += "/" + url.PathEscape(p)
+	}
+	return u
+}
+
+// ReshardSummary is the cluster-wide resharding state and job counts.
+type ReshardSummary struct {
+	State       string `json:"state"` // "running" or "stopped"
+	StateReason string `json:"state_reason"`
+	Completed   int    `json:"completed"`
+	Failed      int    `json:"failed"`
+	Running     int    `json:"running"`
+	Stopped     int    `json:"stopped"`
+	Total       int    `json:"total"`
+}
+
+// ReshardJob is a single shard splitting job.
+type ReshardJob struct {
+	Id         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Node       string                 `json:"node"`
+	Source     string                 `json:"source"`
+	Targets    []string               `json:"targets"`
+	JobState   string                 `json:"job_state"` // new, running, stopped, completed or failed
+	SplitState string                 `json:"split_state"`
+	StateInfo  map[string]interface{} `json:"state_info"`
+	StartTime  time.Time              `json:"start_time"`
+	UpdateTime time.Time              `json:"update_time"`
+	History    []ReshardEvent         `json:"history"`
+}
+
+// ReshardEvent is an entry in a job's history.
+type ReshardEvent struct {
+	Type      string    `json:"type"`
+	Detail    string    `json:"detail"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// SplitRequest selects the shards to split. DB is required; Range (eg.
+// "00000000-7fffffff"), Shard (a full shard name) and Node narrow it down.
+type SplitRequest struct {
+	DB    string `json:"db,omitempty"`
+	Range string `json:"range,omitempty"`
+	Shard string `json:"shard,omitempty"`
+	Node  string `json:"node,omitempty"`
+}
+
+// SplitResult is the outcome of creating the job for one shard copy.
+type SplitResult struct {
+	Ok     bool   `json:"ok"`
+	Id     string `json:"id"`
+	Node   string `json:"node"`
+	Shard  string `json:"shard"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Summary returns the resharding state of the cluster.
+func (r Resharder) Summary() (ReshardSummary, error) {
+	sum := ReshardSummary{}
+	if err := r.s.unmarshalURL(r.url(), &sum); err != nil {
+		return ReshardSummary{}, err
+	}
+	return sum, nil
+}
+
+// Stop stops resharding on the whole cluster; running jobs are paused.
+func (r Resharder) Stop(reason string) error {
+	return r.setState(r.url("state"), "stopped", reason)
+}
+
+// Resume restarts resharding after Stop.
+func (r Resharder) Resume() error {
+	return r.setState(r.url("state"), "running", "")
+}
+
+// Jobs lists all resharding jobs.
+func (r Resharder) Jobs() ([]ReshardJob, error) {
+	jobs := struct {
+		Jobs []ReshardJob `json:"jobs"`
+	}{}
+	if err := r.s.unmarshalURL(r.url("jobs"), &jobs); err != nil {
+		return nil, err
+	}
+	return jobs.Jobs, nil
+}
+
+// Job returns the resharding job with the given id.
+func (r Resharder) Job(id string) (ReshardJob, error) {
+	job := ReshardJob{}
+	if err := r.s.unmarshalURL(r.url("jobs", id), &job); err != nil {
+		return ReshardJob{}, err
+	}
+	return job, nil
+}
+
+// Split creates a job to split each shard copy matched by req in two.
+// Results for copies whose job couldn't be created have Ok false.
+func (r Resharder) Split(req SplitRequest) ([]SplitResult, error) {
+	if req.DB == "" && req.Shard == "" {
+		return nil, fmt.Errorf("must specify a database or shard")
+	}
+	in, err := json.Marshal(struct {
+		Type string `json:"type"`
+		SplitRequest
+	}{"split", req})
+	if err != nil {
+		return nil, err
+	}
+	results := []SplitResult{}
+	if _, err := r.s.interact("POST", r.url("jobs"), map[string][]string{}, in, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// StopJob stops a single job, which can be resumed with ResumeJob.
+func (r Resharder) StopJob(id, reason string) error {
+	return r.setState(r.url("jobs", id, "state"), "stopped", reason)
+}
+
+// ResumeJob resumes a job stopped with StopJob.
+func (r Resharder) ResumeJob(id string) error {
+	return r.setState(r.url("jobs", id, "state"), "running", "")
+}
+
+// DeleteJob stops and removes a job.
+func (r Resharder) DeleteJob(id string) error {
+	_, err := r.s.interact("DELETE", r.url("jobs", id), map[string][]string{}, nil, &WriteResult{})
+	return err
+}
+
+func (r Resharder) setState(u, state, reason string) error {
+	in, err := json.Marshal(struct {
+		State  string `json:"state"`
+		Reason string `json:"reason,omitempty"`
+	}{state, reason})
+	if err != nil {
+		return err
+	}
+	_, err = r.s.interact("PUT", u, map[string][]string{}, in, &WriteResult{})
+	return err
+}
@@ -0,0 +1,72 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestReshard(t *testing.T) {
+	requests := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, fmt.Sprintf("%s %s %s", r.Method, r.URL.EscapedPath(), b))
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/_reshard":
+			fmt.Fprint(w, `{"state":"running","state_reason":null,"completed":1,"failed":0,"running":1,"stopped":0,"total":2}`)
+		case r.Method == "POST" && r.URL.Path == "/_reshard/jobs":
+			fmt.Fprint(w, `[{"ok":true,"id":"001-abc","node":"node1@127.0.0.1","shard":"shards/00000000-ffffffff/db.1"}]`)
+		case r.Method == "GET" && r.URL.Path == "/_reshard/jobs":
+			fmt.Fprint(w, `{"jobs":[{"id":"001-abc","job_state":"running","split_state":"copy_local_docs","type":"split","start_time":"2019-02-01T12:00:00Z","update_time":"2019-02-01T12:00:05Z","history":[{"type":"new","detail":null,"timestamp":"2019-02-01T12:00:00Z"}]}],"offset":0,"total_rows":1}`)
+		default:
+			fmt.Fprint(w, `{"ok":true}`)
+		}
+	}))
+	defer ts.Close()
+	u, _ := url.Parse(ts.URL)
+	s := Server{Host: u.Hostname(), Port: u.Port()}
+	rs := s.Reshard()
+	sum, err := rs.Summary()
+	if err != nil {
+		t.Fatalf("failed to get summary: %s", err)
+	}
+	if sum.State != "running" || sum.Total != 2 {
+		t.Fatalf("summary: got %+v", sum)
+	}
+	results, err := rs.Split(SplitRequest{DB: "db", Range: "00000000-ffffffff"})
+	if err != nil {
+		t.Fatalf("failed to split: %s", err)
+	}
+	if len(results) != 1 || results[0].Id != "001-abc" {
+		t.Fatalf("split: got %+v", results)
+	}
+	jobs, err := rs.Jobs()
+	if err != nil {
+		t.Fatalf("failed to list jobs: %s", err)
+	}
+	if len(jobs) != 1 || jobs[0].JobState != "running" || len(jobs[0].History) != 1 {
+		t.Fatalf("jobs: got %+v", jobs)
+	}
+	if err := rs.StopJob("001-abc", "maintenance"); err != nil {
+		t.Fatalf("failed to stop job: %s", err)
+	}
+	if err := rs.Resume(); err != nil {
+		t.Fatalf("failed to resume: %s", err)
+	}
+	expected := []string{
+		`GET /_reshard `,
+		`POST /_reshard/jobs {"type":"split","db":"db","range":"00000000-ffffffff"}`,
+		`GET /_reshard/jobs `,
+		`PUT /_reshard/jobs/001-abc/state {"state":"stopped","reason":"maintenance"}`,
+		`PUT /_reshard/state {"state":"running"}`,
+	}
+	for i, e := range expected {
+		if requests[i] != e {
+			t.Fatalf("request %d:\nexpected %s\n     got %s", i, e, requests[i])
+		}
+	}
+}
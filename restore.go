@@ -0,0 +1,176 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RestoreOptions configure Restore. The hooks are applied in order: MapID,
+// Strip, then Transform, so that eg. a production dump can be loaded into
+// staging anonymized.
+type RestoreOptions struct {
+	BatchSize int // documents written at once; 0 means 500
+
+	// MapID, if set, gives the id to restore each document under, eg.
+	// with a prefix. Tombstones are mapped too, so they delete the
+	// documents they should.
+	MapID func(id string) string
+	// Strip lists top-level fields removed from every document; _id and
+	// _deleted can't be.
+	Strip []string
+	// Transform, if set, is given each document, but not tombstones, to
+	// change in place, eg. to mask personal data; numbers in it are
+	// json.Numbers, so they're restored exactly. Returning false skips
+	// the document. The document may be given another _id, but not lose
+	// it.
+	Transform func(doc map[string]interface{}) (bool, error)
+}
+
+// RestoreResult counts the documents a Restore has handled.
+type RestoreResult struct {
+	Read    int // lines read
+	Written int // documents written
+	Deleted int // documents deleted by tombstones
+	Skipped int // documents skipped by Transform, and tombstones of documents which don't exist
+	Failed  int // documents which failed to write, eg. refused by validate_doc_update
+}
+
+// Restore loads a dump, written by Dump, Export or DumpIncremental, into
+// the database, overwriting the documents it has in common with it, and
+// replaying tombstones as deletions. Documents get new revisions, as
+// their contents may be changed by the hooks. Lines are written in
+// order, in batches of BatchSize, so a later line for a document wins.
+// Documents which fail to write are counted in Failed; Restore only
+// fails if the dump can't be read, a hook fails or a request fails.
+func (p Database) Restore(ctx context.Context, r io.Reader, opts RestoreOptions) (RestoreResult, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+	result := RestoreResult{}
+	for _, field := range opts.Strip {
+		if field == "_id" || field == "_deleted" {
+			return result, fmt.Errorf("can't strip %s", field)
+		}
+	}
+	scanner, err := dumpScanner(r)
+	if err != nil {
+		return result, err
+	}
+	batch := []map[string]interface{}{}
+	index := map[string]int{} // id -> position in batch
+	for scanner.Scan() {
+		result.Read++
+		dec := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		dec.UseNumber()
+		doc := map[string]interface{}{}
+		if err := dec.Decode(&doc); err != nil {
+			return result, fmt.Errorf("line %d: %w", result.Read, err)
+		}
+		id, _ := doc["_id"].(string)
+		if id == "" {
+			return result, fmt.Errorf("line %d: document without an _id", result.Read)
+		}
+		if opts.MapID != nil {
+			id = opts.MapID(id)
+			doc["_id"] = id
+		}
+		delete(doc, "_rev")
+		for _, field := range opts.Strip {
+			delete(doc, field)
+		}
+		if opts.Transform != nil && doc["_deleted"] != true {
+			keep, err := opts.Transform(doc)
+			if err != nil {
+				return result, fmt.Errorf("%s: %w", id, err)
+			}
+			if !keep {
+				result.Skipped++
+				continue
+			}
+			if id, _ = doc["_id"].(string); id == "" {
+				return result, fmt.Errorf("line %d: transformed document without an _id", result.Read)
+			}
+		}
+		if i, ok := index[id]; ok {
+			batch[i] = doc // superseded
+			continue
+		}
+		index[id] = len(batch)
+		batch = append(batch, doc)
+		if len(batch) < opts.BatchSize {
+			continue
+		}
+		if err := p.restoreBatch(ctx, batch, &result); err != nil {
+			return result, err
+		}
+		batch, index = batch[:0], map[string]int{}
+	}
+	if err := scanner.Err(); err != nil {
+		return result, err
+	}
+	if len(batch) > 0 {
+		return result, p.restoreBatch(ctx, batch, &result)
+	}
+	return result, nil
+}
+
+// restoreBatch writes docs over the database's current revisions.
+func (p Database) restoreBatch(ctx context.Context, docs []map[string]interface{}, result *RestoreResult) error {
+	ids := make([]string, len(docs))
+	for i, doc := range docs {
+		ids[i], _ = doc["_id"].(string) // checked by Restore
+	}
+	current := AllDocsResponse{}
+	in, err := json.Marshal(map[string]interface{}{"keys": ids})
+	if err != nil {
+		return err
+	}
+	if _, err := p.client().interactContext(ctx, "POST", p.DBURL()+"/_all_docs", map[string][]string{}, in, &current); err != nil {
+		return err
+	}
+	revs := map[string]string{}
+	for _, row := range current.Rows {
+		if row.Error == "" && !row.Value.Deleted {
+			revs[row.Id] = row.Value.Rev
+		}
+	}
+	writes := []interface{}{}
+	deletes := map[string]bool{}
+	for i, doc := range docs {
+		id := ids[i]
+		rev, exists := revs[id]
+		if doc["_deleted"] == true {
+			if !exists {
+				result.Skipped++
+				continue
+			}
+			deletes[id] = true
+		}
+		if exists {
+			doc["_rev"] = rev
+		}
+		writes = append(writes, doc)
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	written, err := p.BulkDocs(writes)
+	if err != nil {
+		return err
+	}
+	for _, r := range written {
+		switch {
+		case r.Error != "":
+			result.Failed++
+		case deletes[r.ID]:
+			result.Deleted++
+		default:
+			result.Written++
+		}
+	}
+	return nil
+}
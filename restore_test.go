@@ -0,0 +1,143 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRestore(t *testing.T) {
+	written := []map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_all_docs":
+			// staging already has user:b, and had user:d
+			fmt.Fprint(w, `{"rows":[
+				{"key":"user:a","error":"not_found"},
+				{"id":"user:b","key":"user:b","value":{"rev":"4-b"}},
+				{"key":"user:c","error":"not_found"},
+				{"id":"user:d","key":"user:d","value":{"rev":"2-d","deleted":true}}]}`)
+		case "/db/_bulk_docs":
+			b, _ := ioutil.ReadAll(r.Body)
+			in := struct{ Docs []map[string]interface{} }{}
+			json.Unmarshal(b, &in)
+			results := []string{}
+			for _, doc := range in.Docs {
+				written = append(written, doc)
+				results = append(results, fmt.Sprintf(`{"ok":true,"id":%q,"rev":"1-x"}`, doc["_id"]))
+			}
+			fmt.Fprintf(w, "[%s]", strings.Join(results, ","))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer ts.Close()
+	dump := `{"_id":"a","_rev":"1-a","email":"a@example.com","name":"Ann","n":12345678901234567}
+{"_id":"b","_rev":"2-b","email":"b@example.com","name":"Bob"}
+{"_id":"secret","_rev":"1-s","secret":true}
+{"_id":"a","_rev":"2-a","email":"a@example.com","name":"Ann Other","n":1}
+{"_id":"c","_rev":"3-c","_deleted":true}
+{"_id":"d","_rev":"1-d","name":"Dee"}
+`
+	result, err := newTestDatabase(ts).Restore(context.Background(), strings.NewReader(dump), RestoreOptions{
+		MapID: func(id string) string { return "user:" + id },
+		Strip: []string{"email"},
+		Transform: func(doc map[string]interface{}) (bool, error) {
+			if doc["secret"] == true {
+				return false, nil
+			}
+			doc["name"] = "anonymous"
+			return true, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+	want := []map[string]interface{}{
+		{"_id": "user:a", "name": "anonymous", "n": 1.0},
+		{"_id": "user:b", "_rev": "4-b", "name": "anonymous"},
+		{"_id": "user:d", "name": "anonymous"},
+	}
+	if !reflect.DeepEqual(written, want) {
+		t.Fatalf("written: expected %v, got %v", want, written)
+	}
+	if want := (RestoreResult{Read: 6, Written: 3, Skipped: 2}); result != want {
+		t.Fatalf("result: expected %+v, got %+v", want, result)
+	}
+}
+
+func TestRestoreDeletes(t *testing.T) {
+	written := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/_all_docs" {
+			fmt.Fprint(w, `{"rows":[{"id":"a","key":"a","value":{"rev":"5-a"}}]}`)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		written = string(b)
+		fmt.Fprint(w, `[{"ok":true,"id":"a","rev":"6-a"}]`)
+	}))
+	defer ts.Close()
+	dump := "{\"_id\":\"a\",\"_rev\":\"1-a\"}\n{\"_id\":\"a\",\"_rev\":\"2-a\",\"_deleted\":true}\n"
+	result, err := newTestDatabase(ts).Restore(context.Background(), strings.NewReader(dump), RestoreOptions{})
+	if err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+	if written != `{"docs":[{"_deleted":true,"_id":"a","_rev":"5-a"}]}` {
+		t.Fatalf("expected the document deleted at its current revision, got %s", written)
+	}
+	if want := (RestoreResult{Read: 2, Deleted: 1}); result != want {
+		t.Fatalf("result: expected %+v, got %+v", want, result)
+	}
+}
+
+func TestRestoreHookIds(t *testing.T) {
+	written := []map[string]interface{}{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/db/_all_docs" {
+			fmt.Fprint(w, `{"rows":[]}`)
+			return
+		}
+		in := struct{ Docs []map[string]interface{} }{}
+		json.NewDecoder(r.Body).Decode(&in)
+		written = append(written, in.Docs...)
+		fmt.Fprint(w, `[{"ok":true,"id":"merged","rev":"1-x"}]`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	dump := `{"_id":"a","n":1}
+{"_id":"b","n":2}
+`
+	if _, err := db.Restore(context.Background(), strings.NewReader(dump), RestoreOptions{Strip: []string{"_id"}}); err == nil {
+		t.Fatalf("stripping _id: expected an error")
+	}
+	if _, err := db.Restore(context.Background(), strings.NewReader(dump), RestoreOptions{
+		Transform: func(doc map[string]interface{}) (bool, error) {
+			doc["_id"] = 1
+			return true, nil
+		},
+	}); err == nil {
+		t.Fatalf("retyping _id: expected an error")
+	}
+
+	// documents are batched by the id Transform gives them
+	_, err := db.Restore(context.Background(), strings.NewReader(dump), RestoreOptions{
+		Transform: func(doc map[string]interface{}) (bool, error) {
+			doc["_id"] = "merged"
+			return true, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("restore: %s", err)
+	}
+	if len(written) != 1 || written[0]["n"] != 2.0 {
+		t.Fatalf("written: expected the later document only, got %v", written)
+	}
+}
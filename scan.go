@@ -0,0 +1,58 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// QueryScan runs the view query and appends each row's value to dest,
+// which must be a pointer to a slice, eg.
+//
+//	users := []User{}
+//	err := db.QueryScan("_design/app/_view/by_name", couch.ViewOptions{IncludeDocs: true}, &users)
+//
+// With IncludeDocs, rows' documents are decoded instead of their values,
+// as by Retrieve, and rows without a document (eg. deleted ones) are
+// skipped. Rows are decoded as they're read, without buffering the whole
+// response.
+func (p Database) QueryScan(view string, opts ViewOptions, dest interface{}) error {
+	return p.QueryScanContext(context.Background(), view, opts, dest)
+}
+
+// QueryScanContext is QueryScan, but gives up when ctx is done.
+func (p Database) QueryScanContext(ctx context.Context, view string, opts ViewOptions, dest interface{}) error {
+	if view == "" {
+		return fmt.Errorf("empty view")
+	}
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("QueryScan: dest must be a pointer to a slice, not %T", dest)
+	}
+	slice = slice.Elem()
+	v, err := opts.Values()
+	if err != nil {
+		return err
+	}
+	return p.streamField(ctx, view, v.Encode(), "rows", func(raw json.RawMessage) error {
+		row := Row{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return err
+		}
+		elem := reflect.New(slice.Type().Elem())
+		if opts.IncludeDocs {
+			if len(row.Doc) == 0 || string(row.Doc) == "null" {
+				return nil
+			}
+			if err := unmarshalDoc(row.Doc, elem.Interface()); err != nil {
+				return err
+			}
+		} else if err := json.Unmarshal(row.Value, elem.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestQueryScan(t *testing.T) {
+	query := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		if r.URL.Query().Get("include_docs") == "true" {
+			fmt.Fprint(w, `{"total_rows":3,"offset":0,"rows":[
+				{"id":"a","key":"x","value":null,"doc":{"_id":"a","_rev":"1-a","name":"Ann"}},
+				{"id":"b","key":"y","value":null,"doc":null},
+				{"id":"c","key":"z","value":null,"doc":{"_id":"c","_rev":"2-c","name":"Cy"}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"total_rows":2,"offset":0,"rows":[{"id":"a","key":"x","value":1},{"id":"c","key":"z","value":2}]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+
+	counts := []int{}
+	if err := db.QueryScan("_design/app/_view/v", ViewOptions{Limit: 2}, &counts); err != nil {
+		t.Fatalf("failed to scan values: %s", err)
+	}
+	if query != "limit=2" || !reflect.DeepEqual(counts, []int{1, 2}) {
+		t.Fatalf("values: got %v for %s", counts, query)
+	}
+
+	type user struct {
+		ID   string `json:"-" couch:"id"`
+		Name string `json:"name"`
+	}
+	users := []user{}
+	if err := db.QueryScan("_design/app/_view/v", ViewOptions{IncludeDocs: true}, &users); err != nil {
+		t.Fatalf("failed to scan docs: %s", err)
+	}
+	if !reflect.DeepEqual(users, []user{{"a", "Ann"}, {"c", "Cy"}}) {
+		t.Fatalf("docs: got %+v", users)
+	}
+
+	if err := db.QueryScan("_design/app/_view/v", ViewOptions{}, counts); err == nil {
+		t.Fatalf("expected error for non-pointer dest")
+	}
+}
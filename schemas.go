@@ -0,0 +1,449 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrSchemaViolation is returned for writes of documents which don't
+// match their schema, without sending them.
+var ErrSchemaViolation = errors.New("document doesn't match its schema")
+
+// schemasDesignDoc is where Schemas are stored: in a design document, so
+// that they replicate with the data they describe, and only admins can
+// change them.
+const schemasDesignDoc = "_design/schemas"
+
+// Schemas holds JSON Schemas for the documents of a database, stored in
+// the database itself, under its _design/schemas design document. Like a
+// Registry, it picks the schema of a document by the value of its type
+// field. WithSchemas checks documents against their schema before
+// they're written.
+//
+// The common subset of JSON Schema is supported: type, enum, const,
+// properties, required, additionalProperties (as a boolean), items,
+// minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength,
+// maxLength, pattern, minItems and maxItems. Other keywords are ignored.
+// Fields starting with an underscore, CouchDB's metadata, are exempt
+// from a document's additionalProperties.
+type Schemas struct {
+	db    Database
+	field string
+
+	mu      sync.RWMutex
+	raw     map[string]json.RawMessage
+	schemas map[string]*jsonSchema
+}
+
+// LoadSchemas reads the schemas stored in the database, for documents
+// with the given type field; if field is empty, it's "type". A database
+// without schemas gives an empty Schemas.
+func (p Database) LoadSchemas(field string) (*Schemas, error) {
+	if field == "" {
+		field = "type"
+	}
+	s := &Schemas{db: p, field: field}
+	return s, s.Reload()
+}
+
+// Reload reads the schemas again, eg. after another process changed them.
+func (s *Schemas) Reload() error {
+	raw, err := s.stored()
+	if err != nil {
+		return err
+	}
+	schemas, err := compileSchemas(raw)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.raw, s.schemas = raw, schemas
+	return nil
+}
+
+// compileSchemas compiles each of the stored schemas in raw.
+func compileSchemas(raw map[string]json.RawMessage) (map[string]*jsonSchema, error) {
+	schemas := map[string]*jsonSchema{}
+	for typ, b := range raw {
+		compiled, err := compileSchema(b)
+		if err != nil {
+			return nil, fmt.Errorf("schema %q: %w", typ, err)
+		}
+		schemas[typ] = compiled
+	}
+	return schemas, nil
+}
+
+// stored returns the schemas in the database's design document.
+func (s *Schemas) stored() (map[string]json.RawMessage, error) {
+	raw := map[string]json.RawMessage{}
+	dd, err := s.db.RetrieveDesignDoc(schemasDesignDoc)
+	if isNotFound(err) {
+		return raw, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if b, ok := dd.Other["schemas"]; ok {
+		if err := json.Unmarshal(b, &raw); err != nil {
+			return nil, err
+		}
+	}
+	return raw, nil
+}
+
+// Put stores schema as the schema of documents whose type field is typ,
+// replacing any it had.
+func (s *Schemas) Put(typ string, schema json.RawMessage) error {
+	if _, err := compileSchema(schema); err != nil {
+		return fmt.Errorf("schema %q: %w", typ, err)
+	}
+	return s.update(func(raw map[string]json.RawMessage) { raw[typ] = schema })
+}
+
+// Delete removes the schema of documents whose type field is typ.
+func (s *Schemas) Delete(typ string) error {
+	return s.update(func(raw map[string]json.RawMessage) { delete(raw, typ) })
+}
+
+// update applies fn to the stored schemas and writes them back, trying
+// again once if the design document changed meanwhile. As others may
+// have changed them too, all of them are then compiled afresh.
+func (s *Schemas) update(fn func(map[string]json.RawMessage)) error {
+	for attempt := 0; ; attempt++ {
+		dd, err := s.db.RetrieveDesignDoc(schemasDesignDoc)
+		if isNotFound(err) {
+			dd = DesignDoc{Id: schemasDesignDoc}
+		} else if err != nil {
+			return err
+		}
+		raw := map[string]json.RawMessage{}
+		if b, ok := dd.Other["schemas"]; ok {
+			if err := json.Unmarshal(b, &raw); err != nil {
+				return err
+			}
+		}
+		fn(raw)
+		schemas, err := compileSchemas(raw)
+		if err != nil {
+			return err
+		}
+		if dd.Other == nil {
+			dd.Other = map[string]json.RawMessage{}
+		}
+		dd.Other["schemas"] = mustJSON(raw)
+		_, err = s.db.PutDesignDoc(dd)
+		if statusCode(err) == http.StatusConflict && attempt == 0 {
+			continue
+		}
+		if err == nil {
+			s.mu.Lock()
+			s.raw, s.schemas = raw, schemas
+			s.mu.Unlock()
+		}
+		return err
+	}
+}
+
+// Types returns the types with a schema, sorted.
+func (s *Schemas) Types() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	types := make([]string, 0, len(s.schemas))
+	for typ := range s.schemas {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Schema returns the schema of documents whose type field is typ, as
+// stored, and whether there is one.
+func (s *Schemas) Schema(typ string) (json.RawMessage, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	b, ok := s.raw[typ]
+	return b, ok
+}
+
+// Validate checks doc against the schema of its type, returning an error
+// wrapping ErrSchemaViolation if it doesn't match. Documents without a
+// type field, or of a type without a schema, design documents and
+// deletions are valid.
+func (s *Schemas) Validate(doc json.RawMessage) error {
+	return s.validate(doc, "")
+}
+
+// validate is Validate, for a document written under id if it has no _id
+// of its own.
+func (s *Schemas) validate(doc json.RawMessage, id string) error {
+	var v interface{}
+	if err := decodeNumbers(doc, &v); err != nil {
+		return err
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%w: not an object", ErrSchemaViolation)
+	}
+	if docID, _ := m["_id"].(string); docID != "" {
+		id = docID
+	}
+	if strings.HasPrefix(id, "_design/") || m["_deleted"] == true {
+		return nil
+	}
+	typ, _ := m[s.field].(string)
+	s.mu.RLock()
+	schema, ok := s.schemas[typ]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	if err := schema.validate(v, "", true); err != nil {
+		if id != "" {
+			return fmt.Errorf("%w: %s: %s", ErrSchemaViolation, id, err)
+		}
+		return fmt.Errorf("%w: %s", ErrSchemaViolation, err)
+	}
+	return nil
+}
+
+// WithSchemas makes the Client check documents against s before writing
+// them, via Insert, InsertWith, Edit, EditWith and BulkDocs, refusing
+// those which don't match with ErrSchemaViolation. Any timestamps are
+// added first, so schemas may require them.
+func WithSchemas(s *Schemas) Option {
+	return func(c *Client) {
+		c.schemas = s
+	}
+}
+
+// checkSchema validates the JSON document doc, to be written under id,
+// if the Client has Schemas.
+func (p Database) checkSchema(doc []byte, id string) error {
+	if s := p.client().schemas; s != nil {
+		return s.validate(doc, id)
+	}
+	return nil
+}
+
+// jsonSchema is a compiled JSON Schema.
+type jsonSchema struct {
+	Types                []string
+	Enum                 []interface{}
+	Const                *interface{}
+	Properties           map[string]*jsonSchema
+	Required             []string
+	AdditionalProperties *bool
+	Items                *jsonSchema
+	Minimum, Maximum     *float64
+	ExclusiveMinimum     *float64
+	ExclusiveMaximum     *float64
+	MinLength, MaxLength *int
+	Pattern              *regexp.Regexp
+	MinItems, MaxItems   *int
+}
+
+func compileSchema(b json.RawMessage) (*jsonSchema, error) {
+	raw := struct {
+		Type                 json.RawMessage            `json:"type"`
+		Enum                 []interface{}              `json:"enum"`
+		Const                *json.RawMessage           `json:"const"`
+		Properties           map[string]json.RawMessage `json:"properties"`
+		Required             []string                   `json:"required"`
+		AdditionalProperties *bool                      `json:"additionalProperties"`
+		Items                json.RawMessage            `json:"items"`
+		Minimum              *float64                   `json:"minimum"`
+		Maximum              *float64                   `json:"maximum"`
+		ExclusiveMinimum     *float64                   `json:"exclusiveMinimum"`
+		ExclusiveMaximum     *float64                   `json:"exclusiveMaximum"`
+		MinLength            *int                       `json:"minLength"`
+		MaxLength            *int                       `json:"maxLength"`
+		Pattern              string                     `json:"pattern"`
+		MinItems             *int                       `json:"minItems"`
+		MaxItems             *int                       `json:"maxItems"`
+	}{}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, err
+	}
+	s := &jsonSchema{
+		Required:             raw.Required,
+		AdditionalProperties: raw.AdditionalProperties,
+		Minimum:              raw.Minimum,
+		Maximum:              raw.Maximum,
+		ExclusiveMinimum:     raw.ExclusiveMinimum,
+		ExclusiveMaximum:     raw.ExclusiveMaximum,
+		MinLength:            raw.MinLength,
+		MaxLength:            raw.MaxLength,
+		MinItems:             raw.MinItems,
+		MaxItems:             raw.MaxItems,
+	}
+	for _, e := range raw.Enum {
+		s.Enum = append(s.Enum, normalizeJSON(e))
+	}
+	if len(raw.Type) > 0 {
+		if err := json.Unmarshal(raw.Type, &s.Types); err != nil {
+			typ := ""
+			if err := json.Unmarshal(raw.Type, &typ); err != nil {
+				return nil, fmt.Errorf("type must be a string or an array of strings")
+			}
+			s.Types = []string{typ}
+		}
+	}
+	if raw.Const != nil {
+		var v interface{}
+		if err := decodeNumbers(*raw.Const, &v); err != nil {
+			return nil, err
+		}
+		s.Const = &v
+	}
+	if raw.Pattern != "" {
+		re, err := regexp.Compile(raw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("pattern: %w", err)
+		}
+		s.Pattern = re
+	}
+	if len(raw.Items) > 0 {
+		items, err := compileSchema(raw.Items)
+		if err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+		s.Items = items
+	}
+	if len(raw.Properties) > 0 {
+		s.Properties = map[string]*jsonSchema{}
+		for name, b := range raw.Properties {
+			prop, err := compileSchema(b)
+			if err != nil {
+				return nil, fmt.Errorf("properties/%s: %w", name, err)
+			}
+			s.Properties[name] = prop
+		}
+	}
+	return s, nil
+}
+
+// jsonType returns the JSON Schema type of v, decoded with UseNumber.
+func jsonType(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case json.Number:
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	}
+	return "object"
+}
+
+// validate checks v, found at path, against s. Top-level metadata fields
+// are exempt from additionalProperties.
+func (s *jsonSchema) validate(v interface{}, path string, top bool) error {
+	where := path
+	if where == "" {
+		where = "/"
+	}
+	typ := jsonType(v)
+	if len(s.Types) > 0 {
+		ok := false
+		for _, t := range s.Types {
+			ok = ok || t == typ || (t == "number" && typ == "integer")
+		}
+		if !ok {
+			return fmt.Errorf("%s: expected %s, got %s", where, strings.Join(s.Types, " or "), typ)
+		}
+	}
+	if s.Enum != nil || s.Const != nil {
+		if s.Const != nil && !reflect.DeepEqual(v, *s.Const) {
+			return fmt.Errorf("%s: expected %s", where, mustJSON(*s.Const))
+		}
+		if s.Enum != nil {
+			ok := false
+			for _, e := range s.Enum {
+				ok = ok || reflect.DeepEqual(v, e)
+			}
+			if !ok {
+				return fmt.Errorf("%s: expected one of %s", where, mustJSON(s.Enum))
+			}
+		}
+	}
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		switch {
+		case s.Minimum != nil && f < *s.Minimum:
+			return fmt.Errorf("%s: %s is less than %v", where, v, *s.Minimum)
+		case s.Maximum != nil && f > *s.Maximum:
+			return fmt.Errorf("%s: %s is more than %v", where, v, *s.Maximum)
+		case s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum:
+			return fmt.Errorf("%s: %s is not more than %v", where, v, *s.ExclusiveMinimum)
+		case s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum:
+			return fmt.Errorf("%s: %s is not less than %v", where, v, *s.ExclusiveMaximum)
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		switch {
+		case s.MinLength != nil && n < *s.MinLength:
+			return fmt.Errorf("%s: shorter than %d characters", where, *s.MinLength)
+		case s.MaxLength != nil && n > *s.MaxLength:
+			return fmt.Errorf("%s: longer than %d characters", where, *s.MaxLength)
+		case s.Pattern != nil && !s.Pattern.MatchString(v):
+			return fmt.Errorf("%s: doesn't match %s", where, s.Pattern)
+		}
+	case []interface{}:
+		switch {
+		case s.MinItems != nil && len(v) < *s.MinItems:
+			return fmt.Errorf("%s: fewer than %d items", where, *s.MinItems)
+		case s.MaxItems != nil && len(v) > *s.MaxItems:
+			return fmt.Errorf("%s: more than %d items", where, *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, e := range v {
+				if err := s.Items.validate(e, fmt.Sprintf("%s/%d", path, i), false); err != nil {
+					return err
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				return fmt.Errorf("%s: missing %q", where, name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties && !(top && strings.HasPrefix(name, "_")) {
+					return fmt.Errorf("%s: unexpected %q", where, name)
+				}
+				continue
+			}
+			if err := prop.validate(v[name], path+"/"+name, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
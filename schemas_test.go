@@ -0,0 +1,139 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["name", "email"],
+	"additionalProperties": false,
+	"properties": {
+		"type": {"const": "user"},
+		"name": {"type": "string", "minLength": 1},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"age": {"type": "integer", "minimum": 0},
+		"role": {"enum": ["admin", "member"]},
+		"tags": {"type": "array", "items": {"type": "string"}, "maxItems": 2}
+	}
+}`
+
+func TestSchemas(t *testing.T) {
+	var stored []byte
+	writes := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/db/_design/schemas" && r.Method == "GET":
+			if stored == nil {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+				return
+			}
+			w.Write(stored)
+		case r.URL.Path == "/db/_design/schemas":
+			// stored as CouchDB would, with its id and rev
+			doc := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&doc)
+			doc["_id"], doc["_rev"] = "_design/schemas", "1-a"
+			stored, _ = json.Marshal(doc)
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"_design/schemas","rev":"1-a"}`))
+		default:
+			writes++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"ok":true,"id":"u","rev":"1-a"}`))
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+
+	schemas, err := db.LoadSchemas("")
+	if err != nil {
+		t.Fatalf("load without schemas: %s", err)
+	}
+	if err := schemas.Put("user", json.RawMessage(userSchema)); err != nil {
+		t.Fatalf("put: %s", err)
+	}
+	if err := schemas.Put("broken", json.RawMessage(`{"pattern": "("}`)); err == nil {
+		t.Fatalf("expected a broken schema to be refused")
+	}
+
+	// another process loads them at startup
+	loaded, err := db.LoadSchemas("")
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if types := loaded.Types(); !reflect.DeepEqual(types, []string{"user"}) {
+		t.Fatalf("types: expected [user], got %v", types)
+	}
+
+	// and writes are checked against them
+	db.Client = NewClient(WithSchemas(loaded))
+	if _, _, err := db.InsertWith(map[string]interface{}{"type": "user", "name": "Ann", "email": "ann@example.com", "age": 30}, "u"); err != nil {
+		t.Fatalf("valid user: %s", err)
+	}
+	if _, _, err := db.InsertWith(map[string]interface{}{"type": "user", "name": "Bob"}, "bob"); !errors.Is(err, ErrSchemaViolation) || !strings.Contains(err.Error(), "bob") {
+		t.Fatalf("user without an email: expected ErrSchemaViolation for bob, got %v", err)
+	}
+	if _, err := db.BulkDocs([]interface{}{map[string]interface{}{"_id": "u", "type": "user", "name": "Cy", "email": "cy"}}); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("bulk write of a bad email: expected ErrSchemaViolation, got %v", err)
+	}
+	if _, _, err := db.InsertWith(map[string]interface{}{"type": "note", "anything": true}, "n"); err != nil {
+		t.Fatalf("document without a schema: %s", err)
+	}
+	if _, _, err := db.InsertWith(map[string]interface{}{"type": "user"}, "_design/user"); err != nil {
+		t.Fatalf("design document: %s", err)
+	}
+	if writes != 3 {
+		t.Fatalf("expected only the valid documents to be written, got %d writes", writes)
+	}
+
+	// a Put picks up the schemas others have stored meanwhile
+	if err := loaded.Put("note", json.RawMessage(`{"required": ["text"]}`)); err != nil {
+		t.Fatalf("put note: %s", err)
+	}
+	if err := schemas.Put("order", json.RawMessage(`{"required": ["total"]}`)); err != nil {
+		t.Fatalf("put order: %s", err)
+	}
+	if types := schemas.Types(); !reflect.DeepEqual(types, []string{"note", "order", "user"}) {
+		t.Fatalf("types after put: expected [note order user], got %v", types)
+	}
+	if err := schemas.Validate(json.RawMessage(`{"type": "note"}`)); !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("note without text: expected ErrSchemaViolation, got %v", err)
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := compileSchema(json.RawMessage(userSchema))
+	if err != nil {
+		t.Fatalf("compile: %s", err)
+	}
+	s := &Schemas{field: "type", schemas: map[string]*jsonSchema{"user": schema}}
+	for doc, want := range map[string]string{
+		`{"_id":"u","_rev":"1-a","type":"user","name":"Ann","email":"a@b","age":3,"role":"admin","tags":["x"]}`: "",
+		`{"_id":"u","_deleted":true,"type":"user"}`:                                                             "",
+		`{"type":"user","name":"","email":"a@b"}`:                                                               "/name: shorter than 1 characters",
+		`{"type":"user","name":"Ann","email":"a@b","age":1.5}`:                                                  "/age: expected integer, got number",
+		`{"type":"user","name":"Ann","email":"a@b","age":-1}`:                                                   "/age: -1 is less than 0",
+		`{"type":"user","name":"Ann","email":"a@b","role":"root"}`:                                              `/role: expected one of ["admin","member"]`,
+		`{"type":"user","name":"Ann","email":"a@b","tags":["x",1]}`:                                             "/tags/1: expected string, got integer",
+		`{"type":"user","name":"Ann","email":"a@b","tags":["x","y","z"]}`:                                       "/tags: more than 2 items",
+		`{"type":"user","name":"Ann","email":"a@b","admin":true}`:                                               `/: unexpected "admin"`,
+		`{"_id":"u","type":"user","name":"Ann"}`:                                                                `u: /: missing "email"`,
+	} {
+		err := s.Validate(json.RawMessage(doc))
+		switch {
+		case want == "" && err != nil:
+			t.Fatalf("%s: expected it to be valid, got %s", doc, err)
+		case want != "" && (!errors.Is(err, ErrSchemaViolation) || !strings.HasSuffix(err.Error(), want)):
+			t.Fatalf("%s: expected %q, got %v", doc, want, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// serveRequestHeaders are passed on from the client to CouchDB, making
+// ServeDoc's requests conditional or partial.
+var serveRequestHeaders = []string{"If-None-Match", "If-Modified-Since", "If-Range", "Range"}
+
+// serveResponseHeaders are passed back from CouchDB to the client.
+var serveResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"ETag", "Last-Modified", "Content-MD5", "Cache-Control",
+}
+
+// ServeDoc answers r with the document id, streamed from CouchDB as it's
+// read, for building thin API gateways. Conditional requests are passed
+// on, so a client's If-None-Match gets a 304 when its copy is current.
+// CouchDB's errors are answered with the same status and JSON body, and
+// failures to reach it with 502 Bad Gateway. Only GET and HEAD are
+// allowed. As responses are streamed, WithMaxResponseSize doesn't limit
+// them. id is taken as is, eg. from the gateway's decoded request path,
+// and escaped, so it can't reach another document or database.
+func (p Database) ServeDoc(w http.ResponseWriter, r *http.Request, id string) {
+	path, ok := serveDocPath(id)
+	if !ok {
+		serveError(w, &Error{StatusCode: http.StatusNotFound, Name: "not_found", Reason: "missing"})
+		return
+	}
+	p.noteAccess(id, false)
+	p.serve(w, r, fmt.Sprintf("%s/%s", p.DBURL(), path))
+}
+
+// ServeAttachment answers r with the document's attachment name, as
+// ServeDoc does. Range requests are passed on too, so clients can resume
+// downloads and seek in media.
+func (p Database) ServeAttachment(w http.ResponseWriter, r *http.Request, id, name string) {
+	path, ok := serveDocPath(id)
+	if !ok || name == "" {
+		serveError(w, &Error{StatusCode: http.StatusNotFound, Name: "not_found", Reason: "missing"})
+		return
+	}
+	p.noteAccess(id, false)
+	p.serve(w, r, fmt.Sprintf("%s/%s/%s", p.DBURL(), path, serveSegment(name)))
+}
+
+// serveDocPath escapes id for a document's URL, keeping the "/" of a
+// design or local document's prefix, as CouchDB expects. It's false for
+// ids no document can have, like "" or "_all_docs", which would name an
+// endpoint of the database rather than a document.
+func serveDocPath(id string) (string, bool) {
+	for _, prefix := range []string{"_design/", "_local/"} {
+		if rest := strings.TrimPrefix(id, prefix); rest != id {
+			return prefix + serveSegment(rest), rest != ""
+		}
+	}
+	return serveSegment(id), id != "" && !strings.HasPrefix(id, "_")
+}
+
+// serveSegment escapes s as a single path segment; unlike
+// url.PathEscape, it escapes the dots of "." and "..", so they aren't
+// taken as relative paths.
+func serveSegment(s string) string {
+	if s == "." || s == ".." {
+		return strings.Repeat("%2E", len(s))
+	}
+	return url.PathEscape(s)
+}
+
+func (p Database) serve(w http.ResponseWriter, r *http.Request, u string) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		serveError(w, &Error{StatusCode: http.StatusMethodNotAllowed, Name: "method_not_allowed", Reason: "Only GET, HEAD allowed"})
+		return
+	}
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, u, nil)
+	if err != nil {
+		serveError(w, &Error{StatusCode: http.StatusBadGateway, Name: "bad_gateway", Reason: redactError(err).Error()})
+		return
+	}
+	for _, h := range serveRequestHeaders {
+		for _, v := range r.Header.Values(h) {
+			req.Header.Add(h, v)
+		}
+	}
+	resp, err := p.client().do(req)
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			e = &Error{StatusCode: http.StatusBadGateway, Name: "bad_gateway", Reason: err.Error()}
+		}
+		if e.StatusCode == http.StatusNotModified {
+			// the client's ETag is current
+			if etag := r.Header.Get("If-None-Match"); etag != "" {
+				w.Header().Set("ETag", etag)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		serveError(w, e)
+		return
+	}
+	defer resp.Body.Close()
+	for _, h := range serveResponseHeaders {
+		for _, v := range resp.Header.Values(h) {
+			w.Header().Add(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if r.Method != "HEAD" {
+		io.Copy(w, resp.Body)
+	}
+}
+
+// serveError answers with e's status and a CouchDB-style JSON error.
+func serveError(w http.ResponseWriter, e *Error) {
+	name, reason := e.Name, e.Reason
+	if name == "" {
+		name = http.StatusText(e.StatusCode)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.StatusCode)
+	json.NewEncoder(w).Encode(map[string]string{"error": name, "reason": reason})
+}
@@ -0,0 +1,107 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeDoc(t *testing.T) {
+	lastURL := ""
+	couch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lastURL = r.URL.RequestURI()
+		switch r.URL.EscapedPath() {
+		case "/db/doc":
+			if r.Header.Get("If-None-Match") == `"1-a"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("ETag", `"1-a"`)
+			w.Write([]byte(`{"_id":"doc","_rev":"1-a"}`))
+		case "/db/_design/app":
+			w.Write([]byte(`{"_id":"_design/app"}`))
+		case "/db/doc/clip%20one.mp4":
+			if r.Header.Get("Range") != "bytes=2-4" {
+				t.Errorf("range: got %q", r.Header.Get("Range"))
+			}
+			w.Header().Set("Content-Type", "video/mp4")
+			w.Header().Set("Content-Range", "bytes 2-4/10")
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write([]byte("234"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"not_found","reason":"missing"}`))
+		}
+	}))
+	defer couch.Close()
+	db := newTestDatabase(couch)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/docs/")
+		if name := r.URL.Query().Get("attachment"); name != "" {
+			db.ServeAttachment(w, r, id, name)
+			return
+		}
+		db.ServeDoc(w, r, id)
+	}))
+	defer gateway.Close()
+	get := func(method, path string, header map[string]string) (*http.Response, string) {
+		req, _ := http.NewRequest(method, gateway.URL+path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %s", method, path, err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(b)
+	}
+
+	resp, body := get("GET", "/docs/doc", nil)
+	if resp.StatusCode != 200 || body != `{"_id":"doc","_rev":"1-a"}` || resp.Header.Get("ETag") != `"1-a"` || resp.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("doc: got %d %v %s", resp.StatusCode, resp.Header, body)
+	}
+	if resp, body = get("GET", "/docs/doc", map[string]string{"If-None-Match": `"1-a"`}); resp.StatusCode != 304 || body != "" || resp.Header.Get("ETag") != `"1-a"` {
+		t.Fatalf("conditional: got %d %v %s", resp.StatusCode, resp.Header, body)
+	}
+	if resp, body = get("HEAD", "/docs/doc", nil); resp.StatusCode != 200 || body != "" {
+		t.Fatalf("head: got %d %s", resp.StatusCode, body)
+	}
+	if resp, body = get("GET", "/docs/_design/app", nil); resp.StatusCode != 200 {
+		t.Fatalf("design doc: got %d %s", resp.StatusCode, body)
+	}
+	if resp, body = get("GET", "/docs/missing", nil); resp.StatusCode != 404 || body != "{\"error\":\"not_found\",\"reason\":\"missing\"}\n" {
+		t.Fatalf("missing: got %d %s", resp.StatusCode, body)
+	}
+	if resp, _ = get("DELETE", "/docs/doc", nil); resp.StatusCode != 405 || resp.Header.Get("Allow") != "GET, HEAD" {
+		t.Fatalf("delete: got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	resp, body = get("GET", "/docs/doc?attachment=clip+one.mp4", map[string]string{"Range": "bytes=2-4"})
+	if resp.StatusCode != 206 || body != "234" || resp.Header.Get("Content-Range") != "bytes 2-4/10" || resp.Header.Get("Content-Type") != "video/mp4" {
+		t.Fatalf("attachment: got %d %v %s", resp.StatusCode, resp.Header, body)
+	}
+
+	// ids from the request can't reach other endpoints or databases
+	for path, want := range map[string]string{
+		"/docs/x%3Finclude_docs=true": "/db/x%3Finclude_docs=true",
+		"/docs/a%2Fb":                 "/db/a%2Fb",
+		"/docs/_all_docs":             "", // not asked for
+		"/docs/_design/":              "",
+		"/docs/%2E%2E":                "/db/%2E%2E",
+		"/docs/_design/%2E%2E":        "/db/_design/%2E%2E",
+		"/docs/_local/a%2F..%2Fb":     "/db/_local/a%2F..%2Fb",
+		"/docs/doc?attachment=..":     "/db/doc/%2E%2E",
+	} {
+		lastURL = ""
+		if resp, _ = get("GET", path, nil); resp.StatusCode != 404 || lastURL != want {
+			t.Fatalf("%s: expected a 404 for %s, got %d for %s", path, want, resp.StatusCode, lastURL)
+		}
+	}
+}
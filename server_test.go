@@ -0,0 +1,244 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestVhosts(t *testing.T) {
+	s, err := NewServer(TEST_HOST, TEST_PORT)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	db, err := s.Database(TEST_NAME)
+	if err != nil {
+		t.Fatalf("error opening database: %s", err)
+	}
+	path := db.RewritePath("_design/app")
+	if err := s.SetVhost("couch-go.test", path); err != nil {
+		t.Fatalf("failed to set vhost: %s", err)
+	}
+	vhosts, err := s.Vhosts()
+	if err != nil {
+		t.Fatalf("failed to list vhosts: %s", err)
+	}
+	if vhosts["couch-go.test"] != path {
+		t.Fatalf("vhost: expected %s, got %s", path, vhosts["couch-go.test"])
+	}
+	if err := s.DeleteVhost("couch-go.test"); err != nil {
+		t.Fatalf("failed to delete vhost: %s", err)
+	}
+}
+
+func TestEnableCORS(t *testing.T) {
+	s, err := NewServer(TEST_HOST, TEST_PORT)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	opts := CORSOptions{Credentials: true, Methods: []string{"GET", "PUT"}}
+	if err := s.EnableCORS([]string{"http://localhost:8080"}, opts); err != nil {
+		t.Fatalf("failed to enable CORS: %s", err)
+	}
+	origins, err := s.Config("cors", "origins")
+	if err != nil {
+		t.Fatalf("failed to read CORS origins: %s", err)
+	}
+	if origins != "http://localhost:8080" {
+		t.Fatalf("origins: expected %s, got %s", "http://localhost:8080", origins)
+	}
+	if err := s.DisableCORS(); err != nil {
+		t.Fatalf("failed to disable CORS: %s", err)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	s, err := NewServer(TEST_HOST, TEST_PORT)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	m, err := s.Membership()
+	if err != nil {
+		t.Fatalf("failed to get membership: %s", err)
+	}
+	if len(m.ClusterNodes) == 0 {
+		t.Fatalf("cluster nodes: expected at least one, got none")
+	}
+}
+
+func TestCreateDBOptions(t *testing.T) {
+	query := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	if _, err := db.Server().CreateDB("sharded", CreateDBOptions{Q: 8, N: 3, Partitioned: true}); err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	if query != "n=3&partitioned=true&q=8" {
+		t.Fatalf("query: expected n=3&partitioned=true&q=8, got %s", query)
+	}
+	if _, err := db.Server().CreateDB("plain", CreateDBOptions{}); err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+	if query != "" {
+		t.Fatalf("query: expected none, got %s", query)
+	}
+}
+
+func TestDeleteDatabaseGuard(t *testing.T) {
+	deleted := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deleted++
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer ts.Close()
+	s := newTestDatabase(ts).Server()
+	for _, opts := range []DeleteDBOptions{{}, {Confirm: "other"}} {
+		if err := s.DeleteDatabase("victim", opts); err != ErrDeleteNotConfirmed {
+			t.Fatalf("%+v: expected ErrDeleteNotConfirmed, got %v", opts, err)
+		}
+	}
+	if err := s.DeleteDatabase("_users", DeleteDBOptions{Confirm: "_users"}); err != ErrDeleteNotConfirmed {
+		t.Fatalf("system database: expected ErrDeleteNotConfirmed, got %v", err)
+	}
+	if deleted != 0 {
+		t.Fatalf("expected no DELETE requests, got %d", deleted)
+	}
+	if err := s.DeleteDatabase("victim", DeleteDBOptions{Confirm: "victim"}); err != nil {
+		t.Fatalf("failed to delete confirmed database: %s", err)
+	}
+	if deleted != 1 {
+		t.Fatalf("expected 1 DELETE request, got %d", deleted)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	for in, expected := range map[string]struct {
+		host, port, scheme string
+		segments           []string
+	}{
+		"http://localhost:5984/db":          {"localhost", "5984", "", []string{"db"}},
+		"http://localhost/db/":              {"localhost", "5984", "", []string{"db"}},
+		"https://example.com/couchdb/db":    {"example.com", "443", "https", []string{"couchdb", "db"}},
+		"http://[::1]:6984/":                {"::1", "6984", "", []string{}},
+		"http://u:p@10.0.0.1:5984//a%2Fb//": {"10.0.0.1", "5984", "", []string{"a/b"}},
+	} {
+		s, segments, err := DefaultClient.parseURL(in)
+		if err != nil {
+			t.Fatalf("%s: failed to parse: %s", in, err)
+		}
+		if s.Host != expected.host || s.Port != expected.port || s.Scheme != expected.scheme {
+			t.Fatalf("%s: expected %+v, got %+v", in, expected, s)
+		}
+		if !reflect.DeepEqual(segments, expected.segments) {
+			t.Fatalf("%s: segments: expected %q, got %q", in, expected.segments, segments)
+		}
+	}
+	for _, in := range []string{"localhost:5984/db", "ftp://localhost/db", "http:///db"} {
+		if _, _, err := DefaultClient.parseURL(in); err == nil {
+			t.Fatalf("%s: expected error", in)
+		}
+	}
+}
+
+func TestBasePathURLs(t *testing.T) {
+	s := Server{Host: "example.com", Port: "443", Scheme: "https", BasePath: "couchdb/"}
+	db := s.database("a/b")
+	if db.DBURL() != "https://example.com:443/couchdb/a%2Fb" {
+		t.Fatalf("db url: got %s", db.DBURL())
+	}
+	if db.Server().BaseURL() != s.BaseURL() {
+		t.Fatalf("server: expected %s, got %s", s.BaseURL(), db.Server().BaseURL())
+	}
+}
+
+func TestWithBasePath(t *testing.T) {
+	paths := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		fmt.Fprint(w, `["_users"]`)
+	}))
+	defer ts.Close()
+	c := NewClient(WithBasePath("couchdb/"))
+	s, err := c.NewServerByURL(ts.URL)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if s.BasePath != "/couchdb" {
+		t.Fatalf("base path: expected /couchdb, got %q", s.BasePath)
+	}
+	if _, err := c.NewServerByURL(ts.URL + "/other/"); err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/couchdb/_all_dbs", "/other/_all_dbs"}) {
+		t.Fatalf("paths: got %v", paths)
+	}
+}
+
+func TestIPv6(t *testing.T) {
+	l, err := net.Listen("tcp", "[::1]:0")
+	if err != nil {
+		t.Skipf("no IPv6 loopback: %s", err)
+	}
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_all_dbs":
+			fmt.Fprint(w, `["db"]`)
+		case "/db":
+			fmt.Fprint(w, `{"db_name":"db"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	db, err := NewDatabaseByURL(fmt.Sprintf("http://[::1]:%s/db", port))
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if db.Host != "::1" || db.Port != port {
+		t.Fatalf("host: expected ::1 %s, got %s %s", port, db.Host, db.Port)
+	}
+	if expected := fmt.Sprintf("http://[::1]:%s/db", port); db.DBURL() != expected {
+		t.Fatalf("db url: expected %s, got %s", expected, db.DBURL())
+	}
+	for _, host := range []string{"::1", "[::1]"} {
+		s, err := NewServer(host, port)
+		if err != nil {
+			t.Fatalf("%s: failed to connect: %s", host, err)
+		}
+		if s.BaseURL() != fmt.Sprintf("http://[::1]:%s", port) {
+			t.Fatalf("%s: base url: got %s", host, s.BaseURL())
+		}
+	}
+}
+
+func TestCreateAdminError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_membership" {
+			fmt.Fprint(w, `{"all_nodes":["couchdb@a"],"cluster_nodes":["couchdb@a"]}`)
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error":"unauthorized","reason":"You are not a server admin."}`)
+	}))
+	defer ts.Close()
+	err := newTestDatabase(ts).Server().CreateAdmin("admin", "secret")
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected a 401 *Error, got %v", err)
+	}
+}
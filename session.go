@@ -0,0 +1,64 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+)
+
+// SessionInfo is the user context CouchDB associates with a request's
+// credentials. Name is empty for anonymous requests.
+type SessionInfo struct {
+	Name                   string
+	Roles                  []string
+	AuthenticationDB       string
+	AuthenticationHandlers []string
+	Authenticated          string // the handler that authenticated the request
+}
+
+// HasRole reports whether the session has the given role.
+func (si SessionInfo) HasRole(role string) bool {
+	for _, r := range si.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the session is a server admin.
+func (si SessionInfo) IsAdmin() bool {
+	return si.HasRole("_admin")
+}
+
+type sessionResponse struct {
+	Ok      bool `json:"ok"`
+	UserCtx struct {
+		Name  string   `json:"name"`
+		Roles []string `json:"roles"`
+	} `json:"userCtx"`
+	Info struct {
+		AuthenticationDB       string   `json:"authentication_db"`
+		AuthenticationHandlers []string `json:"authentication_handlers"`
+		Authenticated          string   `json:"authenticated"`
+	} `json:"info"`
+}
+
+// Session returns the identity and roles the server's credentials map to,
+// from GET /_session.
+func (s Server) Session() (SessionInfo, error) {
+	r := sessionResponse{}
+	if err := s.unmarshalURL(fmt.Sprintf("%s/_session", s.BaseURL()), &r); err != nil {
+		return SessionInfo{}, err
+	}
+	return r.info(), nil
+}
+
+func (r sessionResponse) info() SessionInfo {
+	return SessionInfo{
+		Name:                   r.UserCtx.Name,
+		Roles:                  r.UserCtx.Roles,
+		AuthenticationDB:       r.Info.AuthenticationDB,
+		AuthenticationHandlers: r.Info.AuthenticationHandlers,
+		Authenticated:          r.Info.Authenticated,
+	}
+}
@@ -0,0 +1,20 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"testing"
+)
+
+func TestSession(t *testing.T) {
+	s, err := NewServer(TEST_HOST, TEST_PORT)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	si, err := s.Session()
+	if err != nil {
+		t.Fatalf("failed to get session: %s", err)
+	}
+	if si.Name == "" && si.IsAdmin() {
+		t.Logf("anonymous admin: server is in admin party mode")
+	}
+}
@@ -0,0 +1,141 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClientClosed is returned for requests made through a Client after
+// Close, and by the consumers Close stops.
+var ErrClientClosed = errors.New("client closed")
+
+// Close shuts the Client down: new requests fail with ErrClientClosed,
+// and the long-running work using it, like Consumer, Aggregator and
+// MemIndex runs and BulkInsertWithRetry backoffs, is stopped, returning
+// ErrClientClosed. Close then waits, until ctx is done, for that work and
+// for requests in flight to finish, and closes idle connections. It
+// returns ctx's error if it gave up waiting.
+//
+// Clients made with With share their original's lifetime, so closing
+// either closes both. Close may be called more than once.
+func (c *Client) Close(ctx context.Context) error {
+	if c.life == nil {
+		return nil
+	}
+	select {
+	case <-c.life.close():
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.httpClient.CloseIdleConnections()
+	for _, hc := range c.poolClients {
+		hc.CloseIdleConnections()
+	}
+	return nil
+}
+
+// lifecycle tracks the requests and background work of a Client and its
+// clones, so that Close can stop them and wait for them.
+type lifecycle struct {
+	ctx    context.Context // cancelled by close
+	cancel context.CancelCauseFunc
+
+	mu     sync.Mutex
+	closed bool
+	active int
+	idle   chan struct{} // closed once closed and nothing is active
+}
+
+func newLifecycle() *lifecycle {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	return &lifecycle{ctx: ctx, cancel: cancel, idle: make(chan struct{})}
+}
+
+// enter registers some work, returning the function to call when it's
+// done, or ErrClientClosed after close. It's a no-op on a nil lifecycle,
+// as a Client not made by NewClient has.
+func (l *lifecycle) enter() (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrClientClosed
+	}
+	l.active++
+	once := sync.Once{}
+	return func() { once.Do(l.leave) }, nil
+}
+
+func (l *lifecycle) leave() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active--; l.closed && l.active == 0 {
+		close(l.idle)
+	}
+}
+
+// close stops new work and cancels background work, returning a channel
+// closed once nothing is active.
+func (l *lifecycle) close() <-chan struct{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.closed {
+		l.closed = true
+		l.cancel(ErrClientClosed)
+		if l.active == 0 {
+			close(l.idle)
+		}
+	}
+	return l.idle
+}
+
+// background registers long-running work bounded by ctx, returning a
+// context which is also cancelled by Close, and the function to call
+// when the work is done.
+func (c *Client) background(ctx context.Context) (context.Context, func(), error) {
+	leave, err := c.life.enter()
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.life == nil {
+		return ctx, leave, nil
+	}
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(c.life.ctx, func() { cancel(ErrClientClosed) })
+	return ctx, func() {
+		stop()
+		cancel(nil)
+		leave()
+	}, nil
+}
+
+// closedErr returns ErrClientClosed in place of err if ctx, from
+// background, was cancelled by Close.
+func closedErr(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil && context.Cause(ctx) == ErrClientClosed {
+		return ErrClientClosed
+	}
+	return err
+}
+
+// pause waits for d, or returns ErrClientClosed if the Client is closed
+// meanwhile.
+func (c *Client) pause(d time.Duration) error {
+	if c.life == nil {
+		time.Sleep(d)
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-c.life.ctx.Done():
+		return ErrClientClosed
+	}
+}
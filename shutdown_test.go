@@ -0,0 +1,107 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientClose(t *testing.T) {
+	polling := make(chan struct{}, 1)
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_changes":
+			select {
+			case polling <- struct{}{}:
+			default:
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			fmt.Fprint(w, `{"results":[],"last_seq":"1"}`)
+		case "/db/slow":
+			<-release
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer ts.Close()
+	c := NewClient()
+	db := newTestDatabase(ts)
+	db.Client = c.With(WithTimeout(5 * time.Second))
+
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- db.NewConsumer(ConsumerOptions{}).Run(context.Background(), func(Change) error { return nil })
+	}()
+	<-polling
+	slowErr := make(chan error, 1)
+	go func() {
+		slowErr <- db.unmarshalURL(db.DBURL()+"/slow", &map[string]interface{}{})
+	}()
+	for {
+		c.life.mu.Lock()
+		active := c.life.active
+		c.life.mu.Unlock()
+		if active == 3 { // the consumer, its poll and the slow request
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// the consumer stops, but the request in flight is waited for
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := c.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("close: expected to time out waiting, got %v", err)
+	}
+	if err := <-runErr; err != ErrClientClosed {
+		t.Fatalf("run: expected ErrClientClosed, got %v", err)
+	}
+	close(release)
+	if err := <-slowErr; err != nil {
+		t.Fatalf("request in flight: %s", err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	if err := db.unmarshalURL(db.DBURL()+"/slow", &map[string]interface{}{}); err != ErrClientClosed {
+		t.Fatalf("request after close: expected ErrClientClosed, got %v", err)
+	}
+	if err := db.NewConsumer(ConsumerOptions{}).Run(context.Background(), func(Change) error { return nil }); err != ErrClientClosed {
+		t.Fatalf("run after close: expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClientCloseBulkRetry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(w, `{"error":"unavailable","reason":"try later"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	db.Client = NewClient()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := db.BulkInsertWithRetry([]interface{}{map[string]string{"_id": "a"}}, RetryPolicy{MaxAttempts: 5, Backoff: time.Hour})
+		errc <- err
+	}()
+	if err := db.Client.Close(context.Background()); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	select {
+	case err := <-errc:
+		if !errors.Is(err, ErrClientClosed) {
+			t.Fatalf("retry: expected ErrClientClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("retry: still backing off after close")
+	}
+}
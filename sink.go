@@ -0,0 +1,53 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Sink is an external index kept up to date from a changes feed, like a
+// search engine; see the elastic package for one. Upsert adds or replaces
+// a document, and Delete removes one, succeeding if it isn't there.
+type Sink interface {
+	Upsert(ctx context.Context, id string, doc interface{}) error
+	Delete(ctx context.Context, id string) error
+}
+
+// SinkMapper turns a document into what's indexed for it, or returns
+// false to keep it out of the index (removing it, if it was indexed).
+type SinkMapper func(id string, doc json.RawMessage) (interface{}, bool, error)
+
+// RunSink runs the consumer, indexing the changed documents into sink,
+// mapped by mapper (nil means as they are); deleted documents are
+// deleted from it. Design documents are skipped. The consumer must be
+// made with IncludeDocs. As delivery is at least once, the same document
+// may be indexed again.
+func (c *Consumer) RunSink(ctx context.Context, sink Sink, mapper SinkMapper) error {
+	if !c.opts.IncludeDocs {
+		return fmt.Errorf("sink: consumer must include docs")
+	}
+	if mapper == nil {
+		mapper = func(id string, doc json.RawMessage) (interface{}, bool, error) {
+			return doc, true, nil
+		}
+	}
+	return c.Run(ctx, func(ch Change) error {
+		if strings.HasPrefix(ch.Id, "_design/") {
+			return nil
+		}
+		if ch.Deleted || len(ch.Doc) == 0 || string(ch.Doc) == "null" {
+			return sink.Delete(ctx, ch.Id)
+		}
+		doc, ok, err := mapper(ch.Id, ch.Doc)
+		if err != nil {
+			return fmt.Errorf("mapping %s: %w", ch.Id, err)
+		}
+		if !ok {
+			return sink.Delete(ctx, ch.Id)
+		}
+		return sink.Upsert(ctx, ch.Id, doc)
+	})
+}
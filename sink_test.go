@@ -0,0 +1,67 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type testSink []string
+
+func (s *testSink) Upsert(ctx context.Context, id string, doc interface{}) error {
+	b, _ := json.Marshal(doc)
+	*s = append(*s, fmt.Sprintf("upsert %s %s", id, b))
+	return nil
+}
+
+func (s *testSink) Delete(ctx context.Context, id string) error {
+	*s = append(*s, "delete "+id)
+	return nil
+}
+
+func TestRunSink(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("include_docs") != "true" {
+			t.Errorf("query: got %s", r.URL.RawQuery)
+		}
+		if requests++; requests > 1 {
+			cancel()
+			return
+		}
+		fmt.Fprint(w, `{"results":[
+			{"seq":"1","id":"a","changes":[{"rev":"1-a"}],"doc":{"_id":"a","_rev":"1-a","title":"Hello","secret":"x"}},
+			{"seq":"2","id":"_design/app","changes":[{"rev":"1-d"}],"doc":{"_id":"_design/app","_rev":"1-d"}},
+			{"seq":"3","id":"b","deleted":true,"changes":[{"rev":"2-b"}],"doc":{"_id":"b","_rev":"2-b","_deleted":true}},
+			{"seq":"4","id":"c","changes":[{"rev":"1-c"}],"doc":{"_id":"c","_rev":"1-c","draft":true}}],"last_seq":"4"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	sink := &testSink{}
+	mapper := func(id string, doc json.RawMessage) (interface{}, bool, error) {
+		d := struct {
+			Title string `json:"title"`
+			Draft bool   `json:"draft"`
+		}{}
+		err := json.Unmarshal(doc, &d)
+		return map[string]string{"title": d.Title}, !d.Draft, err
+	}
+	if err := db.NewConsumer(ConsumerOptions{}).RunSink(ctx, sink, mapper); err == nil {
+		t.Fatalf("expected error without IncludeDocs")
+	}
+	c := db.NewConsumer(ConsumerOptions{ChangesOptions: ChangesOptions{IncludeDocs: true}})
+	if err := c.RunSink(ctx, sink, mapper); err != context.Canceled {
+		t.Fatalf("run: got %v", err)
+	}
+	expected := []string{`upsert a {"title":"Hello"}`, "delete b", "delete c"}
+	if !reflect.DeepEqual([]string(*sink), expected) {
+		t.Fatalf("sink: expected %q, got %q", expected, *sink)
+	}
+}
@@ -0,0 +1,201 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SlowOp describes a request which took at least the WithSlowLog
+// threshold.
+type SlowOp struct {
+	Op       OpClass
+	Method   string
+	URL      string        // including the query string, but never a password
+	Body     string        // the request body of a query, eg. a Mango selector, up to 1KB
+	Duration time.Duration // from sending the request to reading or closing its response
+	Status   int           // 0 if there was no response
+	Size     int64         // response bytes read
+	Rows     int           // rows or docs read, for view and Mango queries
+	Err      error
+}
+
+func (o SlowOp) String() string {
+	s := fmt.Sprintf("couch: slow %s: %s %s took %s, %d bytes", o.Op, o.Method, o.URL, o.Duration, o.Size)
+	if o.Op == OpQuery {
+		s += fmt.Sprintf(", %d rows", o.Rows)
+	}
+	if o.Body != "" {
+		s += ": " + o.Body
+	}
+	if o.Err != nil {
+		s += fmt.Sprintf(" (%s)", o.Err)
+	}
+	return s
+}
+
+// slowLogBody is how much of a query's request body a SlowOp keeps.
+const slowLogBody = 1024
+
+// WithSlowLog calls fn with every request which takes threshold or
+// longer, to find the expensive views and selectors; 0 reports every
+// request. A request takes until its response is read to the end or
+// closed, so for streamed responses that includes the time spent on each
+// row. If fn is nil, slow requests are logged with the Client's Logger
+// (see WithLogger), if any.
+func WithSlowLog(threshold time.Duration, fn func(SlowOp)) Option {
+	return func(c *Client) {
+		c.slowLog = &slowLog{threshold, fn}
+	}
+}
+
+type slowLog struct {
+	threshold time.Duration
+	fn        func(SlowOp)
+}
+
+// reportSlow passes op on, if it was slow.
+func (c *Client) reportSlow(op SlowOp) {
+	if op.Duration < c.slowLog.threshold {
+		return
+	}
+	if c.slowLog.fn != nil {
+		c.slowLog.fn(op)
+	} else if c.logger != nil {
+		c.logger.Printf("%s", op)
+	}
+}
+
+// failedSlow reports a request which failed after start, if it was slow.
+func (c *Client) failedSlow(req *http.Request, start time.Time, status int, err error) {
+	if c.slowLog == nil {
+		return
+	}
+	op := slowOp(req)
+	op.Duration, op.Status, op.Err = time.Since(start), status, err
+	c.reportSlow(op)
+}
+
+// slowOp starts describing req for the slow log.
+func slowOp(req *http.Request) SlowOp {
+	op := SlowOp{Op: classify(req), Method: req.Method, URL: req.URL.Redacted()}
+	if op.Op == OpQuery && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			b, _ := ioutil.ReadAll(io.LimitReader(body, slowLogBody))
+			op.Body = string(b)
+			body.Close()
+		}
+	}
+	return op
+}
+
+// slowBody times and measures a response body, reporting it to the slow
+// log once it's read to the end or closed.
+type slowBody struct {
+	io.ReadCloser
+	c     *Client
+	op    SlowOp
+	start time.Time
+	rows  rowCounter
+	once  sync.Once
+}
+
+func (b *slowBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.op.Size += int64(n)
+	if b.op.Op == OpQuery {
+		b.rows.count(p[:n])
+	}
+	if err != nil {
+		b.finish(err)
+	}
+	return n, err
+}
+
+func (b *slowBody) Close() error {
+	b.finish(nil)
+	return b.ReadCloser.Close()
+}
+
+func (b *slowBody) finish(err error) {
+	b.once.Do(func() {
+		if err != io.EOF {
+			b.op.Err = err
+		}
+		b.op.Duration = time.Since(b.start)
+		b.op.Rows = b.rows.rows
+		b.c.reportSlow(b.op)
+	})
+}
+
+// rowCounter counts the elements of the "rows", "docs" or "results"
+// array of a JSON object as it's read, without decoding it.
+type rowCounter struct {
+	depth    int
+	inString bool
+	escaped  bool
+	key      []byte // the string being read at depth 1
+	lastKey  string // the last member name at depth 1
+	counting bool   // in an array of rows, at depth 2
+	pending  bool   // expecting another row
+	rows     int
+}
+
+func (rc *rowCounter) count(p []byte) {
+	for _, ch := range p {
+		if rc.inString {
+			switch {
+			case rc.escaped:
+				rc.escaped = false
+			case ch == '\\':
+				rc.escaped = true
+			case ch == '"':
+				rc.inString = false
+				continue
+			}
+			if rc.depth == 1 {
+				rc.key = append(rc.key, ch)
+			}
+			continue
+		}
+		if ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' {
+			continue
+		}
+		if rc.counting && rc.depth == 2 && rc.pending && ch != ']' {
+			rc.rows++
+			rc.pending = false
+		}
+		switch ch {
+		case '"':
+			rc.inString = true
+			if rc.depth == 1 {
+				rc.key = rc.key[:0]
+			}
+		case ':':
+			if rc.depth == 1 {
+				rc.lastKey = string(rc.key)
+			}
+		case ',':
+			if rc.counting && rc.depth == 2 {
+				rc.pending = true
+			}
+		case '{', '[':
+			rc.depth++
+			if ch == '[' && rc.depth == 2 {
+				switch rc.lastKey {
+				case "rows", "docs", "results":
+					rc.counting, rc.pending = true, true
+				}
+			}
+		case '}', ']':
+			rc.depth--
+			if rc.depth == 1 {
+				rc.counting = false
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlowLog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_design/app/_view/by_name":
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprint(w, `{"total_rows":3,"offset":0,"rows":[
+				{"id":"a","key":["a,]"],"value":{"n":[1,2]}},
+				{"id":"b","key":"b\"]","value":null},
+				{"id":"c","key":"c","value":null}]}`)
+		case "/db/_find":
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprint(w, `{"docs":[{"_id":"a"},{"_id":"b"}],"bookmark":"g1"}`)
+		case "/db/missing":
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error":"not_found","reason":"missing"}`)
+		default:
+			fmt.Fprint(w, `{"_id":"fast","_rev":"1-a"}`)
+		}
+	}))
+	defer ts.Close()
+	mu := sync.Mutex{}
+	ops := []SlowOp{}
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithSlowLog(10*time.Millisecond, func(op SlowOp) {
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, op)
+	}))
+
+	out := map[string]interface{}{}
+	if err := db.QueryViewContext(context.Background(), "_design/app/_view/by_name", ViewOptions{Limit: 3}, &out); err != nil {
+		t.Fatalf("query: %s", err)
+	}
+	if _, err := db.Find(map[string]string{"type": "user"}, FindOptions{}); err != nil {
+		t.Fatalf("find: %s", err)
+	}
+	if _, err := db.Retrieve("fast", &out); err != nil {
+		t.Fatalf("retrieve: %s", err)
+	}
+	db.Retrieve("missing", &out)
+
+	if len(ops) != 3 {
+		t.Fatalf("slow ops: expected 3, got %+v", ops)
+	}
+	view := ops[0]
+	if view.Op != OpQuery || view.Method != "GET" || !strings.HasSuffix(view.URL, "/db/_design/app/_view/by_name?limit=3") {
+		t.Fatalf("view: got %+v", view)
+	}
+	if view.Rows != 3 || view.Status != 200 || view.Size == 0 || view.Duration < 10*time.Millisecond || view.Err != nil {
+		t.Fatalf("view: got %+v", view)
+	}
+	find := ops[1]
+	body := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(find.Body), &body); err != nil || find.Rows != 2 {
+		t.Fatalf("find: got %+v", find)
+	}
+	if missing := ops[2]; missing.Op != OpRead || missing.Status != 404 || statusCode(missing.Err) != 404 {
+		t.Fatalf("missing: got %+v", missing)
+	}
+	if s := find.String(); !strings.Contains(s, "slow query: POST") || !strings.Contains(s, "2 rows") {
+		t.Fatalf("string: got %s", s)
+	}
+}
@@ -0,0 +1,223 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ChangesHandlerOptions configure a ChangesHandler.
+type ChangesHandlerOptions struct {
+	// ChangesOptions select the changes of the shared feed. Since is
+	// ignored: the feed starts from now.
+	ChangesOptions
+
+	// Filter, if set, is called with each browser's request, and returns
+	// the function selecting the changes that connection is sent, eg.
+	// the documents of the user the request is authenticated as. An error
+	// refuses the connection with 403 Forbidden.
+	Filter func(r *http.Request) (func(Change) bool, error)
+
+	Buffer    int           // changes queued for each connection; 0 means 100
+	Heartbeat time.Duration // how often idle connections are pinged; 0 means 30 seconds
+}
+
+// sseCatchUpLimit is the most changes a reconnecting browser is caught up
+// on; further behind, it's sent a reset event instead.
+const sseCatchUpLimit = 1000
+
+// ChangesHandler is an http.Handler which relays a database's changes
+// feed to browsers as Server-Sent Events, so web apps can get live
+// updates without access to CouchDB. All connections share one feed,
+// which Run follows.
+//
+// Each change is sent as a message event with the change's seq as its
+// id, and data like a _changes result: {"seq", "id", "changes",
+// "deleted", and "doc" with IncludeDocs}. A connection which falls more
+// than Buffer changes behind is closed rather than slow the others down;
+// browsers reconnect by themselves, with the id of the last event they
+// saw as Last-Event-ID, and are caught up on the changes they missed. If
+// they're too far behind for that, they're sent a "reset" event, and
+// should reload whatever they display.
+type ChangesHandler struct {
+	db       Database
+	opts     ChangesHandlerOptions
+	consumer *Consumer
+
+	mu   sync.Mutex
+	subs map[*sseSub]bool
+}
+
+// sseSub is a connected browser.
+type sseSub struct {
+	changes chan Change
+	filter  func(Change) bool
+	dropped chan struct{} // closed if the connection falls behind
+}
+
+// NewChangesHandler returns a ChangesHandler for the database's changes.
+func (p Database) NewChangesHandler(opts ChangesHandlerOptions) *ChangesHandler {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+	if opts.Heartbeat <= 0 {
+		opts.Heartbeat = 30 * time.Second
+	}
+	co := ConsumerOptions{ChangesOptions: opts.ChangesOptions}
+	co.Since = "now"
+	return &ChangesHandler{db: p, opts: opts, consumer: p.NewConsumer(co), subs: map[*sseSub]bool{}}
+}
+
+// Run follows the changes feed, relaying changes to the connected
+// browsers, until ctx is done. Without it running, connections only get
+// heartbeats.
+func (h *ChangesHandler) Run(ctx context.Context) error {
+	return h.consumer.Run(ctx, func(ch Change) error {
+		h.broadcast(ch)
+		return nil
+	})
+}
+
+func (h *ChangesHandler) broadcast(ch Change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.filter != nil && !sub.filter(ch) {
+			continue
+		}
+		select {
+		case sub.changes <- ch:
+		default:
+			close(sub.dropped)
+			delete(h.subs, sub)
+		}
+	}
+}
+
+// Connections returns the number of browsers connected.
+func (h *ChangesHandler) Connections() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+func (h *ChangesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		serveError(w, &Error{StatusCode: http.StatusMethodNotAllowed, Name: "method_not_allowed", Reason: "Only GET allowed"})
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		serveError(w, &Error{StatusCode: http.StatusInternalServerError, Name: "internal_error", Reason: "streaming unsupported"})
+		return
+	}
+	sub := &sseSub{changes: make(chan Change, h.opts.Buffer), dropped: make(chan struct{})}
+	if h.opts.Filter != nil {
+		filter, err := h.opts.Filter(r)
+		if err != nil {
+			serveError(w, &Error{StatusCode: http.StatusForbidden, Name: "forbidden", Reason: err.Error()})
+			return
+		}
+		sub.filter = filter
+	}
+	// subscribe before catching up, so no change falls in between
+	h.mu.Lock()
+	h.subs[sub] = true
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs, sub)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nor buffer in nginx
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	caughtUp := int64(-1)
+	if last := r.Header.Get("Last-Event-ID"); last != "" {
+		var err error
+		if caughtUp, err = h.catchUp(w, r, sub, Seq(last)); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+	heartbeat := time.NewTicker(h.opts.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case ch := <-sub.changes:
+			if n := ch.Seq.Number(); n >= 0 && n <= caughtUp {
+				continue // sent while catching up
+			}
+			if err := writeChangeEvent(w, ch); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-sub.dropped:
+			return
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// catchUp sends the changes since last, returning the number of the last
+// seq sent, or of last if it sends a reset event instead.
+func (h *ChangesHandler) catchUp(w http.ResponseWriter, r *http.Request, sub *sseSub, last Seq) (int64, error) {
+	opts := h.opts.ChangesOptions
+	opts.Since, opts.Limit = last, sseCatchUpLimit+1
+	resp := ChangesResponse{}
+	if err := h.db.changes(r.Context(), opts, nil, &resp); err != nil {
+		return -1, err
+	}
+	if len(resp.Results) > sseCatchUpLimit {
+		_, err := fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		return last.Number(), err
+	}
+	sent := last.Number()
+	for _, ch := range resp.Results {
+		if sub.filter != nil && !sub.filter(ch) {
+			continue
+		}
+		if err := writeChangeEvent(w, ch); err != nil {
+			return -1, err
+		}
+		sent = ch.Seq.Number()
+	}
+	if n := resp.LastSeq.Number(); n > sent {
+		sent = n
+	}
+	return sent, nil
+}
+
+// writeChangeEvent writes ch as an SSE message event.
+func writeChangeEvent(w http.ResponseWriter, ch Change) error {
+	revs := []map[string]string{}
+	for _, rev := range ch.Revs {
+		revs = append(revs, map[string]string{"rev": rev})
+	}
+	data, err := json.Marshal(struct {
+		Seq     Seq                 `json:"seq"`
+		Id      string              `json:"id"`
+		Changes []map[string]string `json:"changes"`
+		Deleted bool                `json:"deleted,omitempty"`
+		Doc     json.RawMessage     `json:"doc,omitempty"`
+	}{ch.Seq, ch.Id, revs, ch.Deleted, ch.Doc})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\ndata: %s\n\n", ch.Seq, data)
+	return err
+}
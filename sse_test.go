@@ -0,0 +1,131 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangesHandler(t *testing.T) {
+	live := make(chan string)
+	couch := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("feed") != "longpoll" {
+			// a browser catching up
+			if q.Get("since") != "1-x" {
+				t.Errorf("catch up since: got %s", q.Get("since"))
+			}
+			fmt.Fprint(w, `{"results":[
+				{"seq":"2-x","id":"b1","changes":[{"rev":"1-b"}]},
+				{"seq":"3-x","id":"a2","changes":[{"rev":"1-a"}]}],"last_seq":"3-x"}`)
+			return
+		}
+		select {
+		case results := <-live:
+			fmt.Fprintf(w, `{"results":[%s],"last_seq":"9-x"}`, results)
+		case <-r.Context().Done():
+		}
+	}))
+	defer couch.Close()
+	db := newTestDatabase(couch)
+	h := db.NewChangesHandler(ChangesHandlerOptions{
+		Filter: func(r *http.Request) (func(Change) bool, error) {
+			user := r.URL.Query().Get("user")
+			if user == "" {
+				return nil, fmt.Errorf("who are you?")
+			}
+			return func(ch Change) bool { return strings.HasPrefix(ch.Id, user) }, nil
+		},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Run(ctx)
+	browsers := httptest.NewServer(h)
+	defer browsers.Close()
+
+	connect := func(query, lastEventID string) (*http.Response, *bufio.Reader) {
+		req, _ := http.NewRequest("GET", browsers.URL+query, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("connect: %s", err)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+	event := func(r *bufio.Reader) string {
+		lines := []string{}
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				t.Fatalf("read event: %s", err)
+			}
+			if line == "\n" {
+				return strings.Join(lines, "|")
+			}
+			lines = append(lines, strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	if resp, _ := connect("", ""); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("without a user: expected 403, got %d", resp.StatusCode)
+	}
+
+	resp, a := connect("?user=a", "")
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("content type: got %s", resp.Header.Get("Content-Type"))
+	}
+	for h.Connections() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	live <- `{"seq":"1-x","id":"a1","changes":[{"rev":"1-a"}]},
+		{"seq":"2-x","id":"b1","changes":[{"rev":"1-b"}]},
+		{"seq":"3-x","id":"a2","changes":[{"rev":"1-a"}],"deleted":true}`
+	if e := event(a); e != `id: 1-x|data: {"seq":"1-x","id":"a1","changes":[{"rev":"1-a"}]}` {
+		t.Fatalf("first event: got %s", e)
+	}
+	if e := event(a); e != `id: 3-x|data: {"seq":"3-x","id":"a2","changes":[{"rev":"1-a"}],"deleted":true}` {
+		t.Fatalf("second event: got %s", e)
+	}
+
+	// a reconnecting browser is caught up, and not sent those changes twice
+	resp2, b := connect("?user=a", "1-x")
+	defer resp2.Body.Close()
+	if e := event(b); e != `id: 3-x|data: {"seq":"3-x","id":"a2","changes":[{"rev":"1-a"}]}` {
+		t.Fatalf("catch up event: got %s", e)
+	}
+	for h.Connections() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	live <- `{"seq":"3-x","id":"a2","changes":[{"rev":"1-a"}]},{"seq":"4-x","id":"a3","changes":[{"rev":"1-a"}]}`
+	if e := event(b); !strings.HasPrefix(e, "id: 4-x|") {
+		t.Fatalf("live event after catching up: got %s", e)
+	}
+}
+
+func TestChangesHandlerBackpressure(t *testing.T) {
+	h := Database{}.NewChangesHandler(ChangesHandlerOptions{Buffer: 1})
+	slow := &sseSub{changes: make(chan Change, 1), dropped: make(chan struct{})}
+	h.subs[slow] = true
+	h.broadcast(Change{Id: "a"})
+	if h.Connections() != 1 {
+		t.Fatalf("expected the connection to keep up")
+	}
+	h.broadcast(Change{Id: "b"})
+	select {
+	case <-slow.dropped:
+	default:
+		t.Fatalf("expected the connection to be dropped")
+	}
+	if h.Connections() != 0 {
+		t.Fatalf("expected no connections, got %d", h.Connections())
+	}
+}
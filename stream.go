@@ -0,0 +1,113 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// rowChanBuffer is how many rows QueryChan reads ahead of its consumer.
+const rowChanBuffer = 64
+
+// streamArray decodes the JSON object read from r one element at a time
+// from its array member named field, calling fn for each element. Other
+// members are skipped. It stops at the first error from fn.
+func streamArray(r io.Reader, field string, fn func(json.RawMessage) error) error {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if t != field {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return err
+		}
+		for dec.More() {
+			var elem json.RawMessage
+			if err := dec.Decode(&elem); err != nil {
+				return err
+			}
+			if err := fn(elem); err != nil {
+				return err
+			}
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != d {
+		return fmt.Errorf("malformed response: expected %s, got %v", d, t)
+	}
+	return nil
+}
+
+// QueryChan runs the view query like Query, but streams the resulting rows
+// over the returned channel as they're decoded, reading at most a small
+// buffer ahead of the consumer. The row channel is closed when the rows
+// are exhausted, the query fails, or ctx is cancelled; afterwards the error
+// channel yields the error, if any, and is closed.
+func (p Database) QueryChan(ctx context.Context, view string, options map[string]interface{}) (<-chan Row, <-chan error) {
+	rows := make(chan Row, rowChanBuffer)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(rows)
+		errc <- p.queryStream(ctx, view, options, func(raw json.RawMessage) error {
+			row := Row{}
+			if err := json.Unmarshal(raw, &row); err != nil {
+				return err
+			}
+			select {
+			case rows <- row:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return rows, errc
+}
+
+// queryStream makes a view query, calling fn with each row as it's read.
+func (p Database) queryStream(ctx context.Context, view string, options map[string]interface{}, fn func(json.RawMessage) error) error {
+	if view == "" {
+		return fmt.Errorf("empty view")
+	}
+	query, err := encodeOptions(options)
+	if err != nil {
+		return err
+	}
+	return p.streamField(ctx, view, query, "rows", fn)
+}
+
+// streamField makes a GET of path?query, relative to the database, calling
+// fn with each element of the response's array member field.
+func (p Database) streamField(ctx context.Context, path, query, field string, fn func(json.RawMessage) error) error {
+	fullUrl := fmt.Sprintf("%s/%s?%s", p.DBURL(), path, query)
+	body, err := p.client().getURLContext(ctx, fullUrl)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return streamArray(body, field, fn)
+}
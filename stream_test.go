@@ -0,0 +1,75 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStreamArray(t *testing.T) {
+	in := `{"total_rows":3,"offset":0,"rows":[{"id":"a","key":"a"},{"id":"b","key":[1,2]},{"id":"c","key":3}],"update_seq":5}`
+	ids := []string{}
+	err := streamArray(strings.NewReader(in), "rows", func(raw json.RawMessage) error {
+		row := Row{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return err
+		}
+		ids = append(ids, *row.Id)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to stream rows: %s", err)
+	}
+	if strings.Join(ids, ",") != "a,b,c" {
+		t.Fatalf("ids: expected a,b,c, got %v", ids)
+	}
+}
+
+func TestRowNonStringKey(t *testing.T) {
+	row := Row{}
+	if err := json.Unmarshal([]byte(`{"id":"x","key":[2012,1],"value":3}`), &row); err != nil {
+		t.Fatalf("failed to decode row: %s", err)
+	}
+	if row.Key != nil {
+		t.Fatalf("key: expected nil for array key, got %s", *row.Key)
+	}
+	if string(row.RawKey) != "[2012,1]" || string(row.Value) != "3" {
+		t.Fatalf("raw key/value: got %s, %s", row.RawKey, row.Value)
+	}
+}
+
+func TestQueryChanCancel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rows":[`)
+		for i := 0; i < 10000; i++ {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `{"id":"%d","key":%d,"value":null}`, i, i)
+		}
+		fmt.Fprint(w, `]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rows, errc := db.QueryChan(ctx, "_all_docs", nil)
+	n := 0
+	for range rows {
+		if n++; n == 10 {
+			cancel()
+			break
+		}
+	}
+	for range rows {
+	}
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Struct fields tagged `couch:"id"` or `couch:"rev"` hold a document's
+// _id and _rev without carrying those names in the struct's own JSON:
+//
+//	type User struct {
+//		Name  string `json:"name"`
+//		ID    string `json:"-" couch:"id"`
+//		Rev   string `json:"-" couch:"rev"`
+//	}
+//
+// When such a struct is written, the tagged fields are stored as _id and
+// _rev (replacing the fields' own JSON keys, if any, and omitted if
+// empty); when it's read, they're set from _id and _rev, as they are
+// when a pointer to it is passed to Insert or Edit. Tagged fields must
+// be strings.
+
+// docMeta locates the couch-tagged fields of a struct type.
+type docMeta struct {
+	id, rev *metaField
+}
+
+type metaField struct {
+	index []int
+	name  string // JSON key of the field itself, or "" if it isn't encoded
+}
+
+var docMetaCache sync.Map // reflect.Type -> *docMeta
+
+// metaFor returns the couch-tagged fields of t, or nil if it has none.
+func metaFor(t reflect.Type) (*docMeta, error) {
+	if m, ok := docMetaCache.Load(t); ok {
+		return m.(*docMeta), nil
+	}
+	meta := &docMeta{}
+	for _, f := range reflect.VisibleFields(t) {
+		tag := f.Tag.Get("couch")
+		if tag == "" || !f.IsExported() {
+			continue
+		}
+		if f.Type.Kind() != reflect.String {
+			return nil, fmt.Errorf("%s.%s: couch:%q field must be a string", t, f.Name, tag)
+		}
+		mf := &metaField{index: f.Index, name: strings.Split(f.Tag.Get("json"), ",")[0]}
+		switch mf.name {
+		case "-":
+			mf.name = ""
+		case "":
+			mf.name = f.Name
+		}
+		switch tag {
+		case "id":
+			meta.id = mf
+		case "rev":
+			meta.rev = mf
+		default:
+			return nil, fmt.Errorf("%s.%s: unknown tag couch:%q", t, f.Name, tag)
+		}
+	}
+	if meta.id == nil && meta.rev == nil {
+		meta = nil
+	}
+	docMetaCache.Store(t, meta)
+	return meta, nil
+}
+
+// structOf dereferences d down to a struct value, if it is one.
+func structOf(d interface{}) (reflect.Value, bool) {
+	v := reflect.ValueOf(d)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.Kind() == reflect.Struct
+}
+
+// hasDocMeta reports whether d carries metadata outside its JSON: either
+// it implements one of the metadata interfaces, or it's a struct with
+// couch-tagged fields.
+func hasDocMeta(d interface{}) bool {
+	switch d.(type) {
+	case IDGetter, RevGetter, IDSetter, RevSetter:
+		return true
+	}
+	v, ok := structOf(d)
+	if !ok {
+		return false
+	}
+	meta, err := metaFor(v.Type())
+	return meta != nil || err != nil
+}
+
+// IDGetter, RevGetter, IDSetter and RevSetter let a document type carry
+// its _id and _rev however it likes. Documents implementing them are
+// stored with GetID and GetRev as _id and _rev (if non-empty), and have
+// SetID and SetRev called by Retrieve, and by Insert and Edit once the
+// write succeeds. They take precedence over couch-tagged fields.
+type IDGetter interface {
+	GetID() string
+}
+
+type RevGetter interface {
+	GetRev() string
+}
+
+type IDSetter interface {
+	SetID(string)
+}
+
+type RevSetter interface {
+	SetRev(string)
+}
+
+// marshalDoc encodes d as JSON, moving its metadata (from the interfaces
+// above, or couch-tagged fields) to _id and _rev.
+func marshalDoc(d interface{}) ([]byte, error) {
+	if r, ok := rawDocOf(d); ok {
+		if i := skipSpace(r, 0); i >= len(r) || r[i] != '{' {
+			return nil, fmt.Errorf("raw document is not a JSON object")
+		}
+		return r, nil
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	v, meta, err := metaOf(d)
+	if err != nil {
+		return nil, err
+	}
+	getID, getRev := meta.id.getter(v), meta.rev.getter(v)
+	if g, ok := d.(IDGetter); ok {
+		getID = g.GetID
+	}
+	if g, ok := d.(RevGetter); ok {
+		getRev = g.GetRev
+	}
+	if getID == nil && getRev == nil {
+		return b, nil
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	for _, mf := range []*metaField{meta.id, meta.rev} {
+		if mf != nil && mf.name != "" {
+			delete(m, mf.name)
+		}
+	}
+	for key, get := range map[string]func() string{"_id": getID, "_rev": getRev} {
+		if get == nil {
+			continue
+		}
+		if s := get(); s != "" {
+			m[key] = mustJSON(s)
+		}
+	}
+	return json.Marshal(m)
+}
+
+// metaOf returns the struct value of d and its couch-tagged fields;
+// meta is empty, not nil, if d isn't a struct or has no tagged fields.
+func metaOf(d interface{}) (reflect.Value, *docMeta, error) {
+	v, ok := structOf(d)
+	if !ok {
+		return v, &docMeta{}, nil
+	}
+	meta, err := metaFor(v.Type())
+	if meta == nil {
+		meta = &docMeta{}
+	}
+	return v, meta, err
+}
+
+// getter returns a function reading the field from struct v, or nil if
+// there's no such field.
+func (mf *metaField) getter(v reflect.Value) func() string {
+	if mf == nil {
+		return nil
+	}
+	return func() string {
+		if f, err := v.FieldByIndexErr(mf.index); err == nil {
+			return f.String()
+		}
+		return ""
+	}
+}
+
+// unmarshalDoc decodes the document b into d, and sets its metadata
+// from _id and _rev.
+func unmarshalDoc(b []byte, d interface{}) error {
+	if r, ok := d.(*RawDoc); ok {
+		*r = append((*r)[:0], b...)
+		return nil
+	}
+	if err := json.Unmarshal(b, d); err != nil {
+		return err
+	}
+	if !hasDocMeta(d) {
+		return nil
+	}
+	idRev := IdAndRev{}
+	if err := json.Unmarshal(b, &idRev); err != nil {
+		return err
+	}
+	return setDocMeta(d, idRev.Id, idRev.Rev)
+}
+
+// setDocMeta writes id and rev back to d, through the setter interfaces
+// or its couch-tagged fields. Documents without either are left alone.
+func setDocMeta(d interface{}, id, rev string) error {
+	v, meta, err := metaOf(d)
+	if err != nil {
+		return err
+	}
+	set := func(mf *metaField, s string) {
+		if mf == nil || !v.CanSet() {
+			return
+		}
+		// a nil embedded pointer means the field wasn't decoded at all
+		if f, err := v.FieldByIndexErr(mf.index); err == nil {
+			f.SetString(s)
+		}
+	}
+	if setter, ok := d.(IDSetter); ok {
+		setter.SetID(id)
+	} else {
+		set(meta.id, id)
+	}
+	if setter, ok := d.(RevSetter); ok {
+		setter.SetRev(rev)
+	} else {
+		set(meta.rev, rev)
+	}
+	return nil
+}
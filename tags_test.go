@@ -0,0 +1,119 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type taggedUser struct {
+	Name string `json:"name"`
+	ID   string `json:"id,omitempty" couch:"id"`
+	Rev  string `json:"-" couch:"rev"`
+}
+
+func TestMarshalDocTags(t *testing.T) {
+	b, err := marshalDoc(taggedUser{Name: "alice", ID: "u1", Rev: "1-a"})
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(b) != `{"_id":"u1","_rev":"1-a","name":"alice"}` {
+		t.Fatalf("marshal: got %s", b)
+	}
+	b, err = marshalDoc(&taggedUser{Name: "bob"})
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+	if string(b) != `{"name":"bob"}` {
+		t.Fatalf("marshal without metadata: got %s", b)
+	}
+
+	u := taggedUser{}
+	if err := unmarshalDoc([]byte(`{"_id":"u1","_rev":"2-b","name":"alice"}`), &u); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	}
+	if u != (taggedUser{Name: "alice", ID: "u1", Rev: "2-b"}) {
+		t.Fatalf("unmarshal: got %+v", u)
+	}
+}
+
+func TestMarshalDocBadTag(t *testing.T) {
+	type bad struct {
+		Rev int `couch:"rev"`
+	}
+	if _, err := marshalDoc(bad{}); err == nil {
+		t.Fatalf("expected error for non-string rev field")
+	}
+}
+
+func TestRetrieveTagged(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"_id":"u1","_rev":"3-c","name":"alice"}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	u := taggedUser{}
+	if err := db.RetrieveFast("u1", &u); err != nil {
+		t.Fatalf("failed to retrieve: %s", err)
+	}
+	if u.ID != "u1" || u.Rev != "3-c" {
+		t.Fatalf("metadata: got %+v", u)
+	}
+}
+
+type metaUser struct {
+	Name string `json:"name"`
+	id   string
+	rev  string
+}
+
+func (u metaUser) GetID() string      { return u.id }
+func (u metaUser) GetRev() string     { return u.rev }
+func (u *metaUser) SetID(id string)   { u.id = id }
+func (u *metaUser) SetRev(rev string) { u.rev = rev }
+
+func TestMetaInterfaces(t *testing.T) {
+	body := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+		switch r.Method {
+		case "PUT":
+			fmt.Fprint(w, `{"ok":true,"id":"u1","rev":"2-b"}`)
+		case "POST":
+			fmt.Fprint(w, `{"ok":true,"id":"u2","rev":"1-a"}`)
+		default:
+			fmt.Fprint(w, `{"_id":"u1","_rev":"1-a","name":"alice"}`)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+
+	u := &metaUser{}
+	if _, err := db.Retrieve("u1", u); err != nil {
+		t.Fatalf("failed to retrieve: %s", err)
+	}
+	if u.id != "u1" || u.rev != "1-a" {
+		t.Fatalf("retrieve: got %+v", u)
+	}
+	if _, err := db.Edit(u); err != nil {
+		t.Fatalf("failed to edit: %s", err)
+	}
+	if body != `{"_id":"u1","_rev":"1-a","name":"alice"}` {
+		t.Fatalf("edit body: got %s", body)
+	}
+	if u.rev != "2-b" {
+		t.Fatalf("edit: expected rev written back, got %+v", u)
+	}
+
+	v := &metaUser{Name: "bob"}
+	if _, _, err := db.Insert(v); err != nil {
+		t.Fatalf("failed to insert: %s", err)
+	}
+	if v.id != "u2" || v.rev != "1-a" {
+		t.Fatalf("insert: expected metadata written back, got %+v", v)
+	}
+}
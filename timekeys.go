@@ -0,0 +1,80 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"time"
+)
+
+// timeKeyLayout is RFC 3339 with a fixed number of fractional digits
+// and always in UTC, so that keys sort chronologically as strings.
+// (time.RFC3339Nano drops trailing zeros, which breaks that.)
+const timeKeyLayout = "2006-01-02T15:04:05.000Z"
+
+// TimeKey encodes t as a view key string that sorts chronologically,
+// eg. "2012-06-01T10:00:00.000Z", to the millisecond. Map functions
+// should emit the same format, which JavaScript's Date.toISOString does.
+func TimeKey(t time.Time) string {
+	return t.UTC().Format(timeKeyLayout)
+}
+
+// ParseTimeKey decodes a key encoded by TimeKey.
+func ParseTimeKey(s string) (time.Time, error) {
+	return time.Parse(timeKeyLayout, s)
+}
+
+// TimeRange returns view options selecting the string time keys in
+// [start, end), eg. to merge into the options of Query.
+func TimeRange(start, end time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"startkey":      TimeKey(start),
+		"endkey":        TimeKey(end),
+		"inclusive_end": false,
+	}
+}
+
+// Date key array levels, for DateKey.
+const (
+	KeyYear = iota + 1
+	KeyMonth
+	KeyDay
+	KeyHour
+	KeyMinute
+	KeySecond
+	KeyMillisecond
+)
+
+// DateKey encodes t, in UTC, as an array key of its date parts down to
+// the given level, eg. DateKey(t, KeyDay) is [2012, 6, 1]. Array keys allow
+// rolling up a reduce by group_level (see Rollup).
+func DateKey(t time.Time, level int) []int {
+	t = t.UTC()
+	parts := []int{t.Year(), int(t.Month()), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond() / 1e6}
+	if level < KeyYear || level > KeyMillisecond {
+		level = KeyMillisecond
+	}
+	return parts[:level]
+}
+
+// ParseDateKey decodes an array key encoded by DateKey, at any level;
+// missing parts are taken as the start of the period.
+func ParseDateKey(key []int) (time.Time, error) {
+	if len(key) < KeyYear || len(key) > KeyMillisecond {
+		return time.Time{}, fmt.Errorf("invalid date key %v", key)
+	}
+	parts := []int{0, 1, 1, 0, 0, 0, 0}
+	copy(parts, key)
+	return time.Date(parts[0], time.Month(parts[1]), parts[2], parts[3], parts[4], parts[5], parts[6]*1e6, time.UTC), nil
+}
+
+// DateRange returns view options selecting the array date keys of the
+// given level in [start, end), eg. DateRange(start, end, KeyDay) for keys
+// emitted as DateKey(t, KeyDay). The bounds must have the same level as
+// the keys, as shorter arrays collate first.
+func DateRange(start, end time.Time, level int) map[string]interface{} {
+	return map[string]interface{}{
+		"startkey":      DateKey(start, level),
+		"endkey":        DateKey(end, level),
+		"inclusive_end": false,
+	}
+}
@@ -0,0 +1,76 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeKey(t *testing.T) {
+	a := time.Date(2012, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	b := a.Add(500 * time.Millisecond)
+	if TimeKey(a) != "2012-06-01T10:00:00.000Z" {
+		t.Fatalf("time key: got %s", TimeKey(a))
+	}
+	if TimeKey(b) <= TimeKey(a) {
+		t.Fatalf("time keys don't sort: %s, %s", TimeKey(a), TimeKey(b))
+	}
+	back, err := ParseTimeKey(TimeKey(b))
+	if err != nil || !back.Equal(b) {
+		t.Fatalf("parse: expected %s, got %s (%v)", b, back, err)
+	}
+}
+
+func TestDateKey(t *testing.T) {
+	when := time.Date(2012, 6, 1, 10, 30, 15, 250e6, time.UTC)
+	if k := DateKey(when, KeyDay); !reflect.DeepEqual(k, []int{2012, 6, 1}) {
+		t.Fatalf("day key: got %v", k)
+	}
+	back, err := ParseDateKey(DateKey(when, KeyMillisecond))
+	if err != nil || !back.Equal(when) {
+		t.Fatalf("parse: expected %s, got %s (%v)", when, back, err)
+	}
+	month, err := ParseDateKey([]int{2012, 6})
+	if err != nil || !month.Equal(time.Date(2012, 6, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("parse month: got %s (%v)", month, err)
+	}
+	if _, err := ParseDateKey(nil); err == nil {
+		t.Fatalf("expected error for empty key")
+	}
+}
+
+func TestDateRange(t *testing.T) {
+	start := time.Date(2012, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2012, 6, 3, 0, 0, 0, 0, time.UTC)
+	opts := DateRange(start, end, KeyDay)
+	from, to := opts["startkey"].([]int), opts["endkey"].([]int)
+	if !reflect.DeepEqual(from, []int{2012, 6, 1}) || !reflect.DeepEqual(to, []int{2012, 6, 3}) || opts["inclusive_end"] != false {
+		t.Fatalf("options: got %v", opts)
+	}
+	// collated as CouchDB does arrays, the range has the first two days
+	selected := []int{}
+	for day := 1; day <= 3; day++ {
+		key := []int{2012, 6, day}
+		if collateInts(key, from) >= 0 && collateInts(key, to) < 0 {
+			selected = append(selected, day)
+		}
+	}
+	if !reflect.DeepEqual(selected, []int{1, 2}) {
+		t.Fatalf("selected days: expected [1 2], got %v", selected)
+	}
+}
+
+// collateInts compares array keys of numbers as CouchDB does: element by
+// element, with a shorter array first when one is a prefix of the other.
+func collateInts(a, b []int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(a) - len(b)
+}
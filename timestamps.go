@@ -0,0 +1,56 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// TimestampOptions configure the automatic timestamps enabled by
+// WithTimestamps. Either field name may be empty to disable it.
+type TimestampOptions struct {
+	Created string           // set when a document is first written
+	Updated string           // set on every write
+	Clock   func() time.Time // defaults to time.Now
+}
+
+// WithTimestamps makes the Client stamp the current time on documents it
+// writes, via Insert, InsertWith, Edit, EditWith and BulkDocs. New
+// documents (those without a _rev) get both fields, edits only Updated;
+// deletions aren't stamped. Field names default to "created_at" and
+// "updated_at" if both are empty. Times are UTC, in RFC 3339 format.
+func WithTimestamps(opts TimestampOptions) Option {
+	return func(c *Client) {
+		if opts.Created == "" && opts.Updated == "" {
+			opts.Created, opts.Updated = "created_at", "updated_at"
+		}
+		if opts.Clock == nil {
+			opts.Clock = time.Now
+		}
+		c.timestamps = &opts
+	}
+}
+
+// stamp adds timestamps, if enabled, to the JSON document doc. A document
+// is new if it has no _rev; deleted documents are returned unchanged.
+func (p Database) stamp(doc []byte) ([]byte, error) {
+	ts := p.client().timestamps
+	if ts == nil {
+		return doc, nil
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &m); err != nil {
+		return nil, err
+	}
+	if deleted := false; json.Unmarshal(m["_deleted"], &deleted) == nil && deleted {
+		return doc, nil
+	}
+	now := mustJSON(ts.Clock().UTC())
+	if _, ok := m["_rev"]; !ok && ts.Created != "" {
+		m[ts.Created] = now
+	}
+	if ts.Updated != "" {
+		m[ts.Updated] = now
+	}
+	return json.Marshal(m)
+}
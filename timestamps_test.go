@@ -0,0 +1,68 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimestamps(t *testing.T) {
+	bodies := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		switch r.URL.Path {
+		case "/db/_bulk_docs":
+			fmt.Fprint(w, `[{"id":"a","rev":"1-a"},{"id":"b","rev":"2-b"},{"id":"c","rev":"3-c"}]`)
+		default:
+			fmt.Fprint(w, `{"ok":true,"id":"doc","rev":"1-a"}`)
+		}
+	}))
+	defer ts.Close()
+	when := time.Date(2012, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	db := newTestDatabase(ts)
+	db.Client = NewClient(WithTimestamps(TimestampOptions{Clock: func() time.Time { return when }}))
+
+	if _, _, err := db.InsertWith(map[string]int{"n": 1}, "doc"); err != nil {
+		t.Fatalf("failed to insert: %s", err)
+	}
+	if _, err := db.EditWith(map[string]int{"n": 2}, "doc", "1-a"); err != nil {
+		t.Fatalf("failed to edit: %s", err)
+	}
+	docs := []interface{}{
+		map[string]string{"_id": "a"},
+		map[string]string{"_id": "b", "_rev": "1-b"},
+		map[string]interface{}{"_id": "c", "_rev": "2-c", "_deleted": true},
+	}
+	if _, err := db.BulkDocs(docs); err != nil {
+		t.Fatalf("failed to write bulk docs: %s", err)
+	}
+	stamp := `"2012-06-01T10:00:00Z"`
+	expected := []string{
+		`{"created_at":` + stamp + `,"n":1,"updated_at":` + stamp + `}`,
+		`{"_id":"doc","_rev":"1-a","n":2,"updated_at":` + stamp + `}`,
+	}
+	for i, e := range expected {
+		if bodies[i] != e {
+			t.Fatalf("body %d:\nexpected %s\n     got %s", i, e, bodies[i])
+		}
+	}
+	bulk := struct{ Docs []map[string]interface{} }{}
+	if err := json.Unmarshal([]byte(bodies[2]), &bulk); err != nil {
+		t.Fatalf("failed to decode bulk body: %s", err)
+	}
+	if _, ok := bulk.Docs[0]["created_at"]; !ok {
+		t.Fatalf("new bulk doc: expected created_at, got %v", bulk.Docs[0])
+	}
+	if _, ok := bulk.Docs[1]["created_at"]; ok {
+		t.Fatalf("edited bulk doc: unexpected created_at in %v", bulk.Docs[1])
+	}
+	if _, ok := bulk.Docs[2]["updated_at"]; ok {
+		t.Fatalf("deleted bulk doc: unexpected updated_at in %v", bulk.Docs[2])
+	}
+}
@@ -0,0 +1,201 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// TransformOptions control Transform.
+type TransformOptions struct {
+	BatchSize int // documents read and written at once; 0 means 200
+
+	// Checkpointer, if set, records how far the job has got after every
+	// batch, so that a job which is stopped resumes where it left off.
+	// The Seq it's given is an opaque cursor, not an update sequence.
+	Checkpointer Checkpointer
+
+	// Progress, if set, is called after every batch.
+	Progress func(TransformProgress)
+}
+
+// TransformProgress counts the documents a Transform has handled.
+type TransformProgress struct {
+	Read    int    // documents read
+	Changed int    // documents fn changed
+	Written int    // changed documents written
+	Failed  int    // changed documents which failed to write, eg. with a conflict
+	Cursor  string // where the next batch starts
+}
+
+// Transform runs a backfill: it reads the documents selected by source, a
+// view path like "_design/app/_view/by_type" (or "_all_docs"), or else a
+// Mango selector, and passes each to fn. When fn reports a change, the
+// returned document is written back, in batches with _bulk_docs; it keeps
+// the _id and _rev of the original if it has none of its own. Design
+// documents are skipped.
+//
+// Documents which fail to write, eg. because they changed meanwhile, are
+// counted in Failed and otherwise ignored, so a job can simply be run
+// again. Changing the keys of the view being read may make the job skip
+// or revisit documents; read from another view, or with a selector.
+func (p Database) Transform(ctx context.Context, source interface{}, fn func(doc json.RawMessage) (interface{}, bool, error), opts TransformOptions) (TransformProgress, error) {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 200
+	}
+	progress := TransformProgress{}
+	if opts.Checkpointer != nil {
+		cursor, err := opts.Checkpointer.Load()
+		if err != nil {
+			return progress, err
+		}
+		progress.Cursor = string(cursor)
+	}
+	next := p.viewBatches
+	if _, ok := source.(string); !ok {
+		next = p.findBatches
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		docs, cursor, more, err := next(ctx, source, progress.Cursor, opts.BatchSize)
+		if err != nil {
+			return progress, err
+		}
+		writes := []interface{}{}
+		for _, doc := range docs {
+			idRev := IdAndRev{}
+			if err := json.Unmarshal(doc, &idRev); err != nil {
+				return progress, err
+			}
+			if strings.HasPrefix(idRev.Id, "_design/") {
+				continue
+			}
+			progress.Read++
+			after, changed, err := fn(doc)
+			if err != nil {
+				return progress, fmt.Errorf("%s: %w", idRev.Id, err)
+			}
+			if !changed {
+				continue
+			}
+			progress.Changed++
+			b, err := withIdRev(after, idRev)
+			if err != nil {
+				return progress, fmt.Errorf("%s: %w", idRev.Id, err)
+			}
+			writes = append(writes, b)
+		}
+		if len(writes) > 0 {
+			results, err := p.BulkDocs(writes)
+			if err != nil {
+				return progress, err
+			}
+			for _, r := range results {
+				if r.Error != "" {
+					progress.Failed++
+				} else {
+					progress.Written++
+				}
+			}
+		}
+		progress.Cursor = cursor
+		if opts.Checkpointer != nil {
+			if err := opts.Checkpointer.Save(Seq(cursor)); err != nil {
+				return progress, err
+			}
+		}
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+		if !more {
+			return progress, nil
+		}
+	}
+}
+
+// withIdRev encodes doc, giving it the _id and _rev of idRev unless it
+// has its own.
+func withIdRev(doc interface{}, idRev IdAndRev) (json.RawMessage, error) {
+	b, err := marshalDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if _, ok := m["_id"]; !ok {
+		m["_id"] = mustJSON(idRev.Id)
+	}
+	if _, ok := m["_rev"]; !ok {
+		m["_rev"] = mustJSON(idRev.Rev)
+	}
+	return json.Marshal(m)
+}
+
+// viewCursor is where a view scan continues: after the given row.
+type viewCursor struct {
+	Key json.RawMessage `json:"key"`
+	Id  string          `json:"id"`
+}
+
+// viewBatches reads the next batch of documents from a view, after the
+// row named by cursor.
+func (p Database) viewBatches(ctx context.Context, source interface{}, cursor string, size int) ([]json.RawMessage, string, bool, error) {
+	view := source.(string)
+	opts := ViewOptions{IncludeDocs: true, Limit: size}
+	if view != "_all_docs" {
+		reduce := false
+		opts.Reduce = &reduce
+	}
+	if cursor != "" {
+		c := viewCursor{}
+		if err := json.Unmarshal([]byte(cursor), &c); err != nil {
+			return nil, "", false, fmt.Errorf("bad cursor: %s", err)
+		}
+		id := c.Id
+		opts = opts.After(Row{Id: &id, RawKey: c.Key})
+	}
+	r := struct {
+		Rows []Row `json:"rows"`
+	}{}
+	if err := p.QueryViewContext(ctx, view, opts, &r); err != nil {
+		return nil, "", false, err
+	}
+	docs := []json.RawMessage{}
+	for _, row := range r.Rows {
+		if len(row.Doc) > 0 && string(row.Doc) != "null" {
+			docs = append(docs, row.Doc)
+		}
+	}
+	if len(r.Rows) == 0 {
+		return docs, cursor, false, nil
+	}
+	last := r.Rows[len(r.Rows)-1]
+	c := viewCursor{Key: last.RawKey}
+	if last.Id != nil {
+		c.Id = *last.Id
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, "", false, err
+	}
+	return docs, string(b), len(r.Rows) == size, nil
+}
+
+// findBatches reads the next batch of documents matching a selector,
+// from the bookmark cursor.
+func (p Database) findBatches(ctx context.Context, selector interface{}, cursor string, size int) ([]json.RawMessage, string, bool, error) {
+	r, err := p.FindContext(ctx, selector, FindOptions{Limit: size, Bookmark: cursor})
+	if err != nil {
+		return nil, "", false, err
+	}
+	if len(r.Docs) == 0 {
+		return r.Docs, cursor, false, nil
+	}
+	return r.Docs, r.Bookmark, len(r.Docs) == size, nil
+}
@@ -0,0 +1,122 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestTransformView(t *testing.T) {
+	queries, written := []string{}, []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_design/app/_view/by_type":
+			queries = append(queries, r.URL.Query().Get("startkey_docid"))
+			if r.URL.Query().Get("startkey_docid") == "" {
+				fmt.Fprint(w, `{"rows":[
+					{"id":"a","key":"user","value":null,"doc":{"_id":"a","_rev":"1-a","type":"user"}},
+					{"id":"b","key":"user","value":null,"doc":{"_id":"b","_rev":"1-b","type":"user","active":true}}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"rows":[{"id":"c","key":"user","value":null,"doc":{"_id":"c","_rev":"1-c","type":"user"}}]}`)
+		case "/db/_bulk_docs":
+			in := struct{ Docs []map[string]interface{} }{}
+			json.NewDecoder(r.Body).Decode(&in)
+			results := []WriteResult{}
+			for _, d := range in.Docs {
+				written = append(written, fmt.Sprintf("%s %s %v", d["_id"], d["_rev"], d["active"]))
+				results = append(results, WriteResult{OK: true, ID: d["_id"].(string), Rev: "2-x"})
+			}
+			json.NewEncoder(w).Encode(results)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	type user struct {
+		Type   string `json:"type"`
+		Active bool   `json:"active"`
+	}
+	backfill := func(doc json.RawMessage) (interface{}, bool, error) {
+		u := user{}
+		if err := json.Unmarshal(doc, &u); err != nil {
+			return nil, false, err
+		}
+		if u.Active {
+			return nil, false, nil
+		}
+		u.Active = true
+		return u, true, nil
+	}
+	cp := &MemoryCheckpointer{}
+	batches := 0
+	progress, err := db.Transform(context.Background(), "_design/app/_view/by_type", backfill, TransformOptions{
+		BatchSize:    2,
+		Checkpointer: cp,
+		Progress:     func(TransformProgress) { batches++ },
+	})
+	if err != nil {
+		t.Fatalf("failed to transform: %s", err)
+	}
+	if progress.Read != 3 || progress.Changed != 2 || progress.Written != 2 || batches != 2 {
+		t.Fatalf("progress: got %+v after %d batches", progress, batches)
+	}
+	if !reflect.DeepEqual(written, []string{"a 1-a true", "c 1-c true"}) {
+		t.Fatalf("written: got %v", written)
+	}
+	if !reflect.DeepEqual(queries, []string{"", "b"}) {
+		t.Fatalf("queries: got %v", queries)
+	}
+
+	// a finished job resumes after its last row
+	queries = nil
+	if seq, _ := cp.Load(); seq == "" {
+		t.Fatalf("expected a checkpoint")
+	}
+	if _, err := db.Transform(context.Background(), "_design/app/_view/by_type", backfill, TransformOptions{BatchSize: 2, Checkpointer: cp}); err != nil {
+		t.Fatalf("failed to resume: %s", err)
+	}
+	if !reflect.DeepEqual(queries, []string{"c"}) {
+		t.Fatalf("resumed queries: got %v", queries)
+	}
+}
+
+func TestTransformSelector(t *testing.T) {
+	bookmarks := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_find":
+			body := map[string]interface{}{}
+			json.NewDecoder(r.Body).Decode(&body)
+			bookmark, _ := body["bookmark"].(string)
+			bookmarks = append(bookmarks, bookmark)
+			if bookmark == "" {
+				fmt.Fprint(w, `{"docs":[{"_id":"a","_rev":"1-a"}],"bookmark":"g1"}`)
+				return
+			}
+			fmt.Fprint(w, `{"docs":[],"bookmark":"g2"}`)
+		case "/db/_bulk_docs":
+			fmt.Fprint(w, `[{"id":"a","error":"conflict","reason":"Document update conflict."}]`)
+		}
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	progress, err := db.Transform(context.Background(), map[string]interface{}{"type": "user"}, func(doc json.RawMessage) (interface{}, bool, error) {
+		return map[string]bool{"active": true}, true, nil
+	}, TransformOptions{BatchSize: 1})
+	if err != nil {
+		t.Fatalf("failed to transform: %s", err)
+	}
+	if progress.Read != 1 || progress.Failed != 1 || progress.Cursor != "g1" {
+		t.Fatalf("progress: got %+v", progress)
+	}
+	if !reflect.DeepEqual(bookmarks, []string{"", "g1"}) {
+		t.Fatalf("bookmarks: got %v", bookmarks)
+	}
+}
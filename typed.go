@@ -0,0 +1,35 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+)
+
+// ViewRow is a view row with its key and value decoded into the types K
+// and V. Doc is only populated when the query was made with include_docs.
+type ViewRow[K, V any] struct {
+	Id    string          `json:"id"`
+	Key   K               `json:"key"`
+	Value V               `json:"value"`
+	Doc   json.RawMessage `json:"doc,omitempty"`
+}
+
+// ViewResponse is a view response whose rows are typed as ViewRow[K, V].
+type ViewResponse[K, V any] struct {
+	TotalRows uint64          `json:"total_rows"`
+	Offset    uint64          `json:"offset"`
+	Rows      []ViewRow[K, V] `json:"rows"`
+	Warning   string          `json:"warning,omitempty"`
+}
+
+// QueryTyped runs the view query like Query, decoding each row's key into
+// K and value into V, eg.
+//
+//	rows, err := couch.QueryTyped[[]int, float64](db, "_design/stats/_view/by_date", opts)
+func QueryTyped[K, V any](db Database, view string, options map[string]interface{}) ([]ViewRow[K, V], error) {
+	r := ViewResponse[K, V]{}
+	if err := db.Query(view, options, &r); err != nil {
+		return nil, err
+	}
+	return r.Rows, nil
+}
@@ -0,0 +1,35 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type statsValue struct {
+	Sum   float64 `json:"sum"`
+	Count int     `json:"count"`
+}
+
+func TestQueryTyped(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"rows":[{"key":[2012,1],"value":{"sum":3.5,"count":2}},{"key":[2012,2],"value":{"sum":1,"count":1}}]}`)
+	}))
+	defer ts.Close()
+	rows, err := QueryTyped[[]int, statsValue](newTestDatabase(ts), "_design/d/_view/v", nil)
+	if err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(rows))
+	}
+	if !reflect.DeepEqual(rows[1].Key, []int{2012, 2}) {
+		t.Fatalf("key: expected [2012 2], got %v", rows[1].Key)
+	}
+	if rows[0].Value.Sum != 3.5 || rows[0].Value.Count != 2 {
+		t.Fatalf("value: got %+v", rows[0].Value)
+	}
+}
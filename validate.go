@@ -0,0 +1,67 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SetValidateDocUpdate installs fn as the validate_doc_update function of
+// the design document ddocId, creating the design document if necessary.
+// Other contents of the design document are preserved.
+// It returns the new revision of the design document.
+func (p Database) SetValidateDocUpdate(ddocId, fn string) (string, error) {
+	if fn == "" {
+		return "", fmt.Errorf("empty validate_doc_update function")
+	}
+	dd, err := p.RetrieveDesignDoc(ddocId)
+	if isNotFound(err) {
+		dd = DesignDoc{Id: ddocId}
+	} else if err != nil {
+		return "", err
+	}
+	dd.ValidateDocUpdate = fn
+	return p.PutDesignDoc(dd)
+}
+
+// RemoveValidateDocUpdate removes the validate_doc_update function from
+// the design document ddocId, leaving the rest of it in place.
+// It returns the new revision of the design document.
+func (p Database) RemoveValidateDocUpdate(ddocId string) (string, error) {
+	dd, err := p.RetrieveDesignDoc(ddocId)
+	if err != nil {
+		return "", err
+	}
+	dd.ValidateDocUpdate = ""
+	return p.PutDesignDoc(dd)
+}
+
+// ProbeValidateDocUpdate checks a validate_doc_update function by deploying
+// it to a scratch database next to p, and attempting to write doc there.
+// It reports whether the write was rejected, and with what reason.
+// The scratch database is deleted afterwards.
+func (p Database) ProbeValidateDocUpdate(fn string, doc interface{}) (bool, string, error) {
+	scratch := p
+	scratch.Name = fmt.Sprintf("%s-vdu-scratch-%d", p.Name, time.Now().UnixNano())
+	if err := scratch.ensureDatabase(); err != nil {
+		return false, "", err
+	}
+	defer scratch.Server().DeleteDatabase(scratch.Name, DeleteDBOptions{Confirm: scratch.Name})
+	if _, err := scratch.SetValidateDocUpdate("_design/validate", fn); err != nil {
+		return false, "", err
+	}
+	_, _, err := scratch.Insert(doc)
+	var e *Error
+	if errors.As(err, &e) {
+		switch e.StatusCode {
+		case http.StatusForbidden, http.StatusUnauthorized:
+			return true, e.Reason, nil
+		}
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return false, "", nil
+}
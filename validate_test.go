@@ -0,0 +1,52 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"testing"
+)
+
+const rejectAll = `function(newDoc, oldDoc, userCtx) { throw({forbidden: "no writes"}); }`
+
+func TestProbeValidateDocUpdate(t *testing.T) {
+	db, err := NewDatabase(TEST_HOST, TEST_PORT, TEST_NAME)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	rejected, reason, err := db.ProbeValidateDocUpdate(rejectAll, Record{1, nil})
+	if err != nil {
+		t.Fatalf("failed to probe validate_doc_update: %s", err)
+	}
+	if !rejected {
+		t.Fatalf("expected write to be rejected")
+	}
+	if reason != "no writes" {
+		t.Fatalf("reason: expected %s, got %s", "no writes", reason)
+	}
+}
+
+func TestSetValidateDocUpdate(t *testing.T) {
+	db, err := NewDatabase(TEST_HOST, TEST_PORT, TEST_NAME)
+	if err != nil {
+		t.Fatalf("error connecting to CouchDB: %s", err)
+	}
+	if _, err := db.SetValidateDocUpdate("_design/validate", rejectAll); err != nil {
+		t.Fatalf("failed to set validate_doc_update: %s", err)
+	}
+	if _, _, err := db.Insert(Record{1, nil}); err == nil {
+		t.Fatalf("expected insert to be rejected")
+	}
+	rev, err := db.RemoveValidateDocUpdate("_design/validate")
+	if err != nil {
+		t.Fatalf("failed to remove validate_doc_update: %s", err)
+	}
+	id, docRev, err := db.Insert(Record{1, nil})
+	if err != nil {
+		t.Fatalf("failed to insert record after removal: %s", err)
+	}
+	if err := db.Delete(id, docRev); err != nil {
+		t.Fatalf("failed to delete record: %s", err)
+	}
+	if err := db.Delete("_design/validate", rev); err != nil {
+		t.Fatalf("failed to delete design doc: %s", err)
+	}
+}
@@ -0,0 +1,85 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidOptions is wrapped by the errors for view options which
+// can't be combined, returned before a query is sent.
+var ErrInvalidOptions = errors.New("invalid view options")
+
+// Validate checks the options for combinations CouchDB rejects, or which
+// it would silently ignore, returning a descriptive error wrapping
+// ErrInvalidOptions. Values, and so QueryView, validate the options
+// first.
+func (o ViewOptions) Validate() error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidOptions, fmt.Sprintf(format, args...))
+	}
+	reduce, noReduce := o.Reduce != nil && *o.Reduce, o.Reduce != nil && !*o.Reduce
+	switch {
+	case o.Keys != nil && (o.Key != nil || o.StartKey != nil || o.EndKey != nil):
+		return invalid("keys can't be combined with key, startkey or endkey")
+	case o.Key != nil && (o.StartKey != nil || o.EndKey != nil):
+		return invalid("key can't be combined with startkey or endkey")
+	case (o.Group || o.GroupLevel > 0) && noReduce:
+		return invalid("group and group_level need reduce")
+	case o.IncludeDocs && reduce:
+		return invalid("include_docs can't be used with reduce; set Reduce to false")
+	case o.Conflicts && !o.IncludeDocs:
+		return invalid("conflicts needs include_docs")
+	case o.StartKeyDocID != "" && o.StartKey == nil:
+		return invalid("startkey_docid needs startkey")
+	case o.EndKeyDocID != "" && o.EndKey == nil:
+		return invalid("endkey_docid needs endkey")
+	case o.Limit < 0 || o.Skip < 0 || o.GroupLevel < 0:
+		return invalid("limit, skip and group_level can't be negative")
+	}
+	switch o.Update {
+	case "", "true", "false", "lazy":
+	default:
+		return invalid("update must be true, false or lazy, not %q", o.Update)
+	}
+	return nil
+}
+
+// validateQueryOptions validates the options map of Query, as far as it
+// has the options Validate checks.
+func validateQueryOptions(options map[string]interface{}) error {
+	o := ViewOptions{}
+	for name, v := range options {
+		switch name {
+		case "key":
+			o.Key = v
+		case "keys":
+			o.Keys = []interface{}{v}
+		case "startkey", "start_key":
+			o.StartKey = v
+		case "endkey", "end_key":
+			o.EndKey = v
+		case "startkey_docid", "start_key_doc_id":
+			o.StartKeyDocID, _ = v.(string)
+		case "endkey_docid", "end_key_doc_id":
+			o.EndKeyDocID, _ = v.(string)
+		case "group":
+			o.Group, _ = v.(bool)
+		case "group_level":
+			o.GroupLevel, _ = v.(int)
+		case "include_docs":
+			o.IncludeDocs, _ = v.(bool)
+		case "conflicts":
+			o.Conflicts, _ = v.(bool)
+		case "reduce":
+			if b, ok := v.(bool); ok {
+				o.Reduce = &b
+			}
+		case "limit":
+			o.Limit, _ = v.(int)
+		case "skip":
+			o.Skip, _ = v.(int)
+		}
+	}
+	return o.Validate()
+}
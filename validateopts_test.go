@@ -0,0 +1,60 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViewOptionsValidate(t *testing.T) {
+	yes, no := true, false
+	for _, o := range []ViewOptions{
+		{Key: "a", Keys: []interface{}{"b"}},
+		{StartKey: "a", Keys: []interface{}{"b"}},
+		{Key: "a", EndKey: "b"},
+		{Group: true, Reduce: &no},
+		{GroupLevel: 2, Reduce: &no},
+		{IncludeDocs: true, Reduce: &yes},
+		{Conflicts: true},
+		{StartKeyDocID: "a"},
+		{EndKeyDocID: "a"},
+		{Limit: -1},
+		{Update: "always"},
+	} {
+		if err := o.Validate(); !errors.Is(err, ErrInvalidOptions) {
+			t.Fatalf("%+v: expected ErrInvalidOptions, got %v", o, err)
+		}
+		if _, err := o.Values(); !errors.Is(err, ErrInvalidOptions) {
+			t.Fatalf("%+v: expected Values to validate, got %v", o, err)
+		}
+	}
+	for _, o := range []ViewOptions{
+		{},
+		{Keys: []interface{}{"a"}, IncludeDocs: true, Conflicts: true},
+		{StartKey: "a", EndKey: "b", StartKeyDocID: "x", Limit: 10, Skip: 1},
+		{Group: true, GroupLevel: 1, Reduce: &yes},
+		{IncludeDocs: true, Reduce: &no, Update: "lazy"},
+	} {
+		if err := o.Validate(); err != nil {
+			t.Fatalf("%+v: %s", o, err)
+		}
+	}
+}
+
+func TestQueryValidates(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request: got %s, expected none", r.URL)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	err := db.Query("_design/app/_view/v", map[string]interface{}{"include_docs": true, "reduce": true}, &KeyedViewResponse{})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("query: expected ErrInvalidOptions, got %v", err)
+	}
+	err = db.QueryView("_design/app/_view/v", ViewOptions{Key: "a", Keys: []interface{}{"b"}}, &KeyedViewResponse{})
+	if !errors.Is(err, ErrInvalidOptions) {
+		t.Fatalf("query view: expected ErrInvalidOptions, got %v", err)
+	}
+}
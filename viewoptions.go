@@ -0,0 +1,138 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ViewOptions are the query parameters of a view, as a typed alternative
+// to the options map of Query. Keys (Key, Keys, StartKey, EndKey) are
+// encoded by the KeyEncoder, and nil means unset; for a null key use
+// json.RawMessage("null"). Document ids are passed verbatim.
+type ViewOptions struct {
+	Key        interface{}
+	Keys       []interface{}
+	StartKey   interface{}
+	EndKey     interface{}
+	KeyEncoder KeyEncoder // nil means DefaultKeyEncoder
+
+	// StartKeyDocID and EndKeyDocID narrow StartKey and EndKey down to a
+	// document id, among rows with the same key. Together with Skip they
+	// make paging through rows with duplicate keys reliable; see After.
+	StartKeyDocID string
+	EndKeyDocID   string
+
+	Limit        int // 0 means no limit
+	Skip         int
+	Descending   bool
+	IncludeDocs  bool
+	Conflicts    bool  // with IncludeDocs, include each document's _conflicts
+	InclusiveEnd *bool // nil means the server default, true
+	Reduce       *bool // nil means reduce, if the view has a reduce function
+	Group        bool
+	GroupLevel   int    // group by the first GroupLevel elements of array keys; see Rollup
+	Update       string // "true", "false" or "lazy"; empty means the server default
+}
+
+// Values validates the options, and encodes them as URL query parameters.
+func (o ViewOptions) Values() (url.Values, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	v := url.Values{}
+	enc := o.KeyEncoder
+	if enc == nil {
+		enc = DefaultKeyEncoder
+	}
+	for name, key := range map[string]interface{}{
+		"key":      o.Key,
+		"startkey": o.StartKey,
+		"endkey":   o.EndKey,
+	} {
+		if key == nil {
+			continue
+		}
+		b, err := enc.EncodeKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		v.Set(name, string(b))
+	}
+	if o.Keys != nil {
+		b, err := enc.EncodeKey(o.Keys)
+		if err != nil {
+			return nil, fmt.Errorf("keys: %w", err)
+		}
+		v.Set("keys", string(b))
+	}
+	if o.StartKeyDocID != "" {
+		v.Set("startkey_docid", o.StartKeyDocID)
+	}
+	if o.EndKeyDocID != "" {
+		v.Set("endkey_docid", o.EndKeyDocID)
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Skip > 0 {
+		v.Set("skip", strconv.Itoa(o.Skip))
+	}
+	for name, b := range map[string]bool{
+		"descending":   o.Descending,
+		"include_docs": o.IncludeDocs,
+		"conflicts":    o.Conflicts,
+		"group":        o.Group,
+	} {
+		if b {
+			v.Set(name, "true")
+		}
+	}
+	if o.GroupLevel > 0 {
+		v.Set("group_level", strconv.Itoa(o.GroupLevel))
+	}
+	if o.InclusiveEnd != nil {
+		v.Set("inclusive_end", strconv.FormatBool(*o.InclusiveEnd))
+	}
+	if o.Reduce != nil {
+		v.Set("reduce", strconv.FormatBool(*o.Reduce))
+	}
+	if o.Update != "" {
+		v.Set("update", o.Update)
+	}
+	return v, nil
+}
+
+// After returns the options for the page of rows following row, the
+// last row of the current page: it starts at row's key and document id,
+// skipping row itself.
+func (o ViewOptions) After(row Row) ViewOptions {
+	o.Key, o.Keys = nil, nil
+	o.StartKey = row.RawKey
+	o.StartKeyDocID = ""
+	if row.Id != nil {
+		o.StartKeyDocID = *row.Id
+	}
+	o.Skip = 1
+	return o
+}
+
+// QueryView is Query, taking typed options.
+func (p Database) QueryView(view string, opts ViewOptions, results interface{}) error {
+	return p.QueryViewContext(context.Background(), view, opts, results)
+}
+
+// QueryViewContext is QueryView, but gives up when ctx is done.
+func (p Database) QueryViewContext(ctx context.Context, view string, opts ViewOptions, results interface{}) error {
+	if view == "" {
+		return fmt.Errorf("empty view")
+	}
+	v, err := opts.Values()
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/%s?%s", p.DBURL(), view, v.Encode())
+	return p.client().unmarshalURLContext(ctx, u, results)
+}
@@ -0,0 +1,51 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestViewOptionsValues(t *testing.T) {
+	no := false
+	o := ViewOptions{
+		StartKey:      []interface{}{"a", 1},
+		EndKey:        json.RawMessage("null"),
+		StartKeyDocID: `doc "1"`,
+		Limit:         10,
+		InclusiveEnd:  &no,
+	}
+	v, err := o.Values()
+	if err != nil {
+		t.Fatalf("failed to encode: %s", err)
+	}
+	expected := `endkey=null&inclusive_end=false&limit=10&startkey=%5B%22a%22%2C1%5D&startkey_docid=doc+%221%22`
+	if v.Encode() != expected {
+		t.Fatalf("encode:\nexpected %s\n     got %s", expected, v.Encode())
+	}
+}
+
+func TestQueryViewPaging(t *testing.T) {
+	query := ""
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{"total_rows":3,"offset":0,"rows":[{"id":"a","key":"dup","value":1},{"id":"b","key":"dup","value":1}]}`)
+	}))
+	defer ts.Close()
+	db := newTestDatabase(ts)
+	o := ViewOptions{Limit: 2}
+	r := KeyedViewResponse{}
+	if err := db.QueryView("_design/d/_view/v", o, &r); err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	next := o.After(r.Rows[len(r.Rows)-1])
+	if err := db.QueryView("_design/d/_view/v", next, &r); err != nil {
+		t.Fatalf("failed to query next page: %s", err)
+	}
+	if query != "limit=2&skip=1&startkey=%22dup%22&startkey_docid=b" {
+		t.Fatalf("next page query: got %s", query)
+	}
+}
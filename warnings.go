@@ -0,0 +1,61 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+)
+
+// Logger receives the warnings CouchDB attaches to query responses, like
+// "No matching index found, create an index to optimize query time." A
+// *log.Logger will do.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// WithLogger makes the Client log every warning in a response with l, so
+// that queries which silently scan the whole database get noticed. The
+// warnings are returned in the response types either way.
+func WithLogger(l Logger) Option {
+	return func(c *Client) {
+		c.logger = l
+	}
+}
+
+// decodeLogged decodes the JSON response to a request of u into out like
+// decodeJSON, within any maximum response size, logging its warning
+// member, if any, when there's a Logger.
+func (c *Client) decodeLogged(u string, r io.Reader, out interface{}) error {
+	r = c.limitBody(r)
+	if c.logger == nil {
+		return decodeJSON(r, out)
+	}
+	raw := json.RawMessage{}
+	if err := decodeJSON(r, &raw); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, out); err != nil {
+		return err
+	}
+	w := struct {
+		Warning string `json:"warning"`
+	}{}
+	if json.Unmarshal(raw, &w) == nil {
+		c.logWarning(u, w.Warning)
+	}
+	return nil
+}
+
+// logWarning logs warning, if there is one, against the path of u; the
+// rest of u may hold credentials.
+func (c *Client) logWarning(u, warning string) {
+	if c.logger == nil || warning == "" {
+		return
+	}
+	path := u
+	if parsed, err := url.Parse(u); err == nil {
+		path = parsed.Path
+	}
+	c.logger.Printf("couch: %s: %s", path, warning)
+}
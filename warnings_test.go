@@ -0,0 +1,66 @@
+// -*- tab-width: 4 -*-
+package couch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+type testLogger []string
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	*l = append(*l, fmt.Sprintf(format, v...))
+}
+
+func TestWarnings(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/db/_design/app/_view/by_type":
+			fmt.Fprint(w, `{"total_rows":0,"offset":0,"rows":[],"warning":"view is stale"}`)
+		case "/db/_find":
+			fmt.Fprint(w, findResponse)
+		default:
+			fmt.Fprint(w, `{"total_rows":0,"offset":0,"rows":[]}`)
+		}
+	}))
+	defer ts.Close()
+	logged := &testLogger{}
+	c := NewClient(WithLogger(logged))
+	db, err := c.databaseByURL("http://user:" + TEST_PASSWORD + "@" + ts.Listener.Addr().String() + "/db")
+	if err != nil {
+		t.Fatalf("failed to create database: %s", err)
+	}
+
+	r := KeyedViewResponse{}
+	if err := db.QueryView("_design/app/_view/by_type", ViewOptions{}, &r); err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if r.Warning != "view is stale" {
+		t.Fatalf("view warning: got %q", r.Warning)
+	}
+	if err := db.QueryView("_all_docs", ViewOptions{}, &AllDocsResponse{}); err != nil {
+		t.Fatalf("failed to query: %s", err)
+	}
+	if _, err := db.Find(map[string]interface{}{"type": "user"}, FindOptions{}); err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	dr, err := db.FindStream(map[string]interface{}{"type": "user"}, FindOptions{})
+	if err != nil {
+		t.Fatalf("failed to find: %s", err)
+	}
+	for dr.Next() {
+	}
+	dr.Close()
+
+	expected := []string{
+		"couch: /db/_design/app/_view/by_type: view is stale",
+		"couch: /db/_find: No matching index found",
+		"couch: /db/_find: No matching index found",
+	}
+	if !reflect.DeepEqual([]string(*logged), expected) {
+		t.Fatalf("logged: expected %q, got %q", expected, *logged)
+	}
+}